@@ -18,14 +18,17 @@ import (
 	errorspkg "github.com/pkg/errors"
 )
 
-const BaseImageReferenceFormat = "baseimage:%s"
+const BaseImageReferenceFormat = groot.BaseImageReferenceFormat
 const MetricsUnpackTimeName = "UnpackTime"
 const MetricsDownloadTimeName = "DownloadTime"
+const MetricsSanitizedFilesName = "SanitizedFiles"
 
 //go:generate counterfeiter . Fetcher
 //go:generate counterfeiter . Unpacker
 //go:generate counterfeiter . DependencyRegisterer
 //go:generate counterfeiter . VolumeDriver
+//go:generate counterfeiter . SignatureVerifier
+//go:generate counterfeiter . ManifestResolver
 
 type UnpackSpec struct {
 	Stream        io.ReadCloser `json:"-"`
@@ -33,6 +36,8 @@ type UnpackSpec struct {
 	UIDMappings   []groot.IDMappingSpec
 	GIDMappings   []groot.IDMappingSpec
 	BaseDirectory string
+	// ParentPaths are the volume paths of the parent layers, closest first
+	ParentPaths []string
 }
 
 type LayerInfo struct {
@@ -43,11 +48,21 @@ type LayerInfo struct {
 	BaseDirectory string
 	URLs          []string
 	MediaType     string
+	// DownloadProgress is optional. Fetchers that download the layer call it
+	// with the number of bytes downloaded so far.
+	DownloadProgress func(bytesDownloaded int64) `json:"-"`
+	// VerifyProgress is optional. Fetchers that verify the layer before
+	// returning its stream call it when they start.
+	VerifyProgress func() `json:"-"`
 }
 
 type BaseImageInfo struct {
-	LayerInfos []LayerInfo
-	Config     specsv1.Image
+	LayerInfos     []LayerInfo
+	Config         specsv1.Image
+	ManifestDigest string
+	// Cached is set when the info was not fetched from the source, in which
+	// case none of the layers can be downloaded.
+	Cached bool
 }
 
 type VolumeMeta struct {
@@ -59,19 +74,69 @@ type Fetcher interface {
 	StreamBlob(logger lager.Logger, baseImageURL *url.URL, layerInfo LayerInfo) (io.ReadCloser, int64, error)
 }
 
+// ManifestInfo is what is known about an image from its manifest alone,
+// before any of its blobs is downloaded.
+type ManifestInfo struct {
+	ManifestDigest string
+	LayerCount     int
+	// CompressedSize only counts the layers whose size is in the manifest,
+	// which schema 1 manifests don't have.
+	CompressedSize int64
+}
+
+// ManifestResolver is implemented by fetchers whose BaseImageInfo may download
+// layers, e.g. to convert schema 1 manifests, so that the image can be checked
+// before any of them is.
+type ManifestResolver interface {
+	ManifestInfo(logger lager.Logger, baseImageURL *url.URL) (ManifestInfo, error)
+}
+
+// VerifiableStream is a layer stream whose digest can only be checked once it
+// has been read to the end.
+type VerifiableStream interface {
+	io.ReadCloser
+	Verify() error
+}
+
+// BlobMismatchError is returned by Verify when the stream did not match its
+// digest. When HasFallback is set, asking for the blob again streams it from
+// the next endpoint.
+type BlobMismatchError struct {
+	Digest      string
+	ServedFrom  string
+	HasFallback bool
+}
+
+func (e *BlobMismatchError) Error() string {
+	return fmt.Sprintf("invalid checksum: layer is corrupted `%s`", e.Digest)
+}
+
 type DependencyRegisterer interface {
-	Register(id string, chainIDs []string) error
+	Register(id string, chainIDs []string, manifestDigest string) error
 }
 
 type UnpackOutput struct {
 	BytesWritten    int64
 	OpaqueWhiteouts []string
+	// ModeChanges lists the files whose mode was changed by the file mode
+	// policy of the unpacker
+	ModeChanges []ModeChange
+}
+
+type ModeChange struct {
+	Path    string
+	OldMode os.FileMode
+	NewMode os.FileMode
 }
 
 type Unpacker interface {
 	Unpack(logger lager.Logger, spec UnpackSpec) (UnpackOutput, error)
 }
 
+type SignatureVerifier interface {
+	Verify(logger lager.Logger, baseImageURL *url.URL, manifestDigest string) error
+}
+
 type VolumeDriver interface {
 	VolumePath(logger lager.Logger, id string) (string, error)
 	CreateVolume(logger lager.Logger, parentID, id string) (string, error)
@@ -89,9 +154,14 @@ type BaseImagePuller struct {
 	dependencyRegisterer DependencyRegisterer
 	metricsEmitter       groot.MetricsEmitter
 	locksmith            groot.Locksmith
+	signatureVerifier    SignatureVerifier
+	progressReporter     groot.ProgressReporter
 }
 
-func NewBaseImagePuller(fetcher Fetcher, unpacker Unpacker, volumeDriver VolumeDriver, dependencyRegisterer DependencyRegisterer, metricsEmitter groot.MetricsEmitter, locksmith groot.Locksmith) *BaseImagePuller {
+// NewBaseImagePuller creates a puller. The signatureVerifier is optional:
+// when it is nil, images are pulled without checking their signatures. So is
+// the progressReporter: when it is nil, no progress is reported.
+func NewBaseImagePuller(fetcher Fetcher, unpacker Unpacker, volumeDriver VolumeDriver, dependencyRegisterer DependencyRegisterer, metricsEmitter groot.MetricsEmitter, locksmith groot.Locksmith, signatureVerifier SignatureVerifier, progressReporter groot.ProgressReporter) *BaseImagePuller {
 	return &BaseImagePuller{
 		fetcher:              fetcher,
 		unpacker:             unpacker,
@@ -99,6 +169,8 @@ func NewBaseImagePuller(fetcher Fetcher, unpacker Unpacker, volumeDriver VolumeD
 		dependencyRegisterer: dependencyRegisterer,
 		metricsEmitter:       metricsEmitter,
 		locksmith:            locksmith,
+		signatureVerifier:    signatureVerifier,
+		progressReporter:     progressReporter,
 	}
 }
 
@@ -107,16 +179,47 @@ func (p *BaseImagePuller) Pull(logger lager.Logger, spec groot.BaseImageSpec) (g
 	logger.Info("starting")
 	defer logger.Info("ending")
 
+	manifestInfo, resolved, err := p.checkManifest(logger, spec)
+	if err != nil {
+		return groot.BaseImage{}, err
+	}
+
 	baseImageInfo, err := p.fetcher.BaseImageInfo(logger, spec.BaseImageSrc)
 	if err != nil {
 		return groot.BaseImage{}, errorspkg.Wrap(err, "fetching list of layer infos")
 	}
+	if resolved && baseImageInfo.ManifestDigest != manifestInfo.ManifestDigest {
+		return groot.BaseImage{}, errorspkg.Errorf("manifest of the image changed from `%s` to `%s` while pulling it", manifestInfo.ManifestDigest, baseImageInfo.ManifestDigest)
+	}
 	logger.Debug("fetched-layer-infos", lager.Data{"infos": baseImageInfo.LayerInfos})
+	p.reportProgress(logger, groot.ProgressEvent{
+		Event:          groot.ProgressManifestResolved,
+		ManifestDigest: baseImageInfo.ManifestDigest,
+		Layers:         len(baseImageInfo.LayerInfos),
+		Total:          p.layersSize(baseImageInfo.LayerInfos),
+	})
+
+	if p.signatureVerifier != nil && !resolved {
+		if err = p.signatureVerifier.Verify(logger, spec.BaseImageSrc, baseImageInfo.ManifestDigest); err != nil {
+			return groot.BaseImage{}, errorspkg.Wrap(err, "verifying image signature")
+		}
+	}
+
+	if err = spec.AdmissionPolicy.AdmitLayers(len(baseImageInfo.LayerInfos), p.layersSize(baseImageInfo.LayerInfos)); err != nil {
+		logger.Error("admitting-layers-failed", err)
+		return groot.BaseImage{}, err
+	}
 
 	if err = p.quotaExceeded(logger, baseImageInfo.LayerInfos, spec); err != nil {
 		return groot.BaseImage{}, err
 	}
 
+	if baseImageInfo.Cached {
+		if err = p.checkVolumesExist(logger, baseImageInfo.LayerInfos); err != nil {
+			return groot.BaseImage{}, err
+		}
+	}
+
 	err = p.buildLayer(logger, len(baseImageInfo.LayerInfos)-1, baseImageInfo.LayerInfos, spec)
 	if err != nil {
 		return groot.BaseImage{}, err
@@ -124,13 +227,14 @@ func (p *BaseImagePuller) Pull(logger lager.Logger, spec groot.BaseImageSpec) (g
 	chainIDs := p.chainIDs(baseImageInfo.LayerInfos)
 
 	baseImageRefName := fmt.Sprintf(BaseImageReferenceFormat, spec.BaseImageSrc.String())
-	if err := p.dependencyRegisterer.Register(baseImageRefName, chainIDs); err != nil {
+	if err := p.dependencyRegisterer.Register(baseImageRefName, chainIDs, baseImageInfo.ManifestDigest); err != nil {
 		return groot.BaseImage{}, err
 	}
 
 	baseImage := groot.BaseImage{
-		BaseImage: baseImageInfo.Config,
-		ChainIDs:  chainIDs,
+		BaseImage:      baseImageInfo.Config,
+		ChainIDs:       chainIDs,
+		ManifestDigest: baseImageInfo.ManifestDigest,
 	}
 	return baseImage, nil
 }
@@ -154,6 +258,18 @@ func (p *BaseImagePuller) quotaExceeded(logger lager.Logger, layerInfos []LayerI
 	return nil
 }
 
+func (p *BaseImagePuller) checkVolumesExist(logger lager.Logger, layerInfos []LayerInfo) error {
+	for _, layerInfo := range layerInfos {
+		if !p.volumeExists(logger, layerInfo.ChainID) {
+			err := errorspkg.Errorf("image is not available offline: layer `%s` has not been pulled", layerInfo.BlobID)
+			logger.Error("checking-cached-volumes-failed", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *BaseImagePuller) chainIDs(layerInfos []LayerInfo) []string {
 	chainIDs := []string{}
 	for _, layerInfo := range layerInfos {
@@ -187,6 +303,7 @@ func (p *BaseImagePuller) buildLayer(logger lager.Logger, index int, layerInfos
 		"parentChainID": layerInfo.ParentChainID,
 	})
 	if p.volumeExists(logger, layerInfo.ChainID) {
+		p.reportLayerProgress(logger, groot.ProgressLayerCached, layerInfo)
 		return nil
 	}
 
@@ -197,9 +314,11 @@ func (p *BaseImagePuller) buildLayer(logger lager.Logger, index int, layerInfos
 	defer p.locksmith.Unlock(lockFile)
 
 	if p.volumeExists(logger, layerInfo.ChainID) {
+		p.reportLayerProgress(logger, groot.ProgressLayerCached, layerInfo)
 		return nil
 	}
 
+	p.reportLayerProgress(logger, groot.ProgressLayerQueued, layerInfo)
 	downloadChan := make(chan downloadReturn, 1)
 	go p.downloadLayer(logger, spec, layerInfo, downloadChan)
 
@@ -207,18 +326,54 @@ func (p *BaseImagePuller) buildLayer(logger lager.Logger, index int, layerInfos
 		return err
 	}
 
-	downloadResult := <-downloadChan
-	if downloadResult.Err != nil {
-		return downloadResult.Err
-	}
-
-	defer downloadResult.Stream.Close()
-
 	var parentLayerInfo LayerInfo
 	if index > 0 {
 		parentLayerInfo = layerInfos[index-1]
 	}
-	return p.unpackLayer(logger, layerInfo, parentLayerInfo, spec, downloadResult.Stream)
+
+	for {
+		downloadResult := <-downloadChan
+		if downloadResult.Err != nil {
+			return downloadResult.Err
+		}
+
+		err := p.unpackDownloadedLayer(logger, layerInfo, parentLayerInfo, layerInfos[:index], spec, downloadResult.Stream)
+		mismatchErr, ok := errorspkg.Cause(err).(*BlobMismatchError)
+		if !ok || !mismatchErr.HasFallback {
+			return err
+		}
+
+		// the unpacked volume was discarded, so the layer is streamed again
+		// from the next endpoint
+		logger.Info("streaming-layer-from-next-endpoint", lager.Data{"mismatchedEndpoint": mismatchErr.ServedFrom})
+		p.downloadLayer(logger, spec, layerInfo, downloadChan)
+	}
+}
+
+func (p *BaseImagePuller) unpackDownloadedLayer(logger lager.Logger, layerInfo, parentLayerInfo LayerInfo, parentLayerInfos []LayerInfo, spec groot.BaseImageSpec, stream io.ReadCloser) error {
+	defer stream.Close()
+
+	parentPaths, err := p.parentVolumePaths(logger, parentLayerInfos)
+	if err != nil {
+		return err
+	}
+
+	return p.unpackLayer(logger, layerInfo, parentLayerInfo, parentPaths, spec, stream)
+}
+
+// parentVolumePaths returns the volume paths of the parent layers, closest
+// first. The unpacker looks for the targets of hardlinks in them.
+func (p *BaseImagePuller) parentVolumePaths(logger lager.Logger, parentLayerInfos []LayerInfo) ([]string, error) {
+	parentPaths := []string{}
+	for i := len(parentLayerInfos) - 1; i >= 0; i-- {
+		parentPath, err := p.volumeDriver.VolumePath(logger, parentLayerInfos[i].ChainID)
+		if err != nil {
+			return nil, err
+		}
+		parentPaths = append(parentPaths, parentPath)
+	}
+
+	return parentPaths, nil
 }
 
 type downloadReturn struct {
@@ -232,6 +387,22 @@ func (p *BaseImagePuller) downloadLayer(logger lager.Logger, spec groot.BaseImag
 	defer logger.Debug("ending")
 	defer p.metricsEmitter.TryEmitDurationFrom(logger, MetricsDownloadTimeName, time.Now())
 
+	if p.progressReporter != nil {
+		p.reportLayerProgress(logger, groot.ProgressLayerDownloading, layerInfo)
+		layerInfo.DownloadProgress = func(bytesDownloaded int64) {
+			p.reportProgress(logger, groot.ProgressEvent{
+				Event:   groot.ProgressLayerDownloading,
+				BlobID:  layerInfo.BlobID,
+				ChainID: layerInfo.ChainID,
+				Bytes:   bytesDownloaded,
+				Total:   layerInfo.Size,
+			})
+		}
+		layerInfo.VerifyProgress = func() {
+			p.reportLayerProgress(logger, groot.ProgressLayerVerifying, layerInfo)
+		}
+	}
+
 	stream, size, err := p.fetcher.StreamBlob(logger, spec.BaseImageSrc, layerInfo)
 	if err != nil {
 		err = errorspkg.Wrapf(err, "streaming blob `%s`", layerInfo.BlobID)
@@ -246,11 +417,12 @@ func (p *BaseImagePuller) downloadLayer(logger lager.Logger, spec groot.BaseImag
 	downloadChan <- downloadReturn{Stream: stream, Err: err}
 }
 
-func (p *BaseImagePuller) unpackLayer(logger lager.Logger, layerInfo, parentLayerInfo LayerInfo, spec groot.BaseImageSpec, stream io.ReadCloser) error {
+func (p *BaseImagePuller) unpackLayer(logger lager.Logger, layerInfo, parentLayerInfo LayerInfo, parentPaths []string, spec groot.BaseImageSpec, stream io.ReadCloser) error {
 	logger = logger.Session("unpacking-layer", lager.Data{"LayerInfo": layerInfo})
 	logger.Debug("starting")
 	defer logger.Debug("ending")
 
+	p.reportLayerProgress(logger, groot.ProgressLayerUnpacking, layerInfo)
 	tempVolumeName, volumePath, err := p.createTemporaryVolumeDirectory(logger, layerInfo, spec)
 	if err != nil {
 		return err
@@ -262,6 +434,7 @@ func (p *BaseImagePuller) unpackLayer(logger lager.Logger, layerInfo, parentLaye
 		UIDMappings:   spec.UIDMappings,
 		GIDMappings:   spec.GIDMappings,
 		BaseDirectory: layerInfo.BaseDirectory,
+		ParentPaths:   parentPaths,
 	}
 
 	volSize, err := p.unpackLayerToTemporaryDirectory(logger, unpackSpec, layerInfo, parentLayerInfo)
@@ -269,7 +442,16 @@ func (p *BaseImagePuller) unpackLayer(logger lager.Logger, layerInfo, parentLaye
 		return err
 	}
 
-	return p.finalizeVolume(logger, tempVolumeName, volumePath, layerInfo.ChainID, volSize)
+	if err := p.verifyStream(logger, stream, tempVolumeName, layerInfo); err != nil {
+		return err
+	}
+
+	if err := p.finalizeVolume(logger, tempVolumeName, volumePath, layerInfo.ChainID, volSize); err != nil {
+		return err
+	}
+
+	p.reportLayerProgress(logger, groot.ProgressLayerDone, layerInfo)
+	return nil
 }
 
 func (p *BaseImagePuller) createTemporaryVolumeDirectory(logger lager.Logger, layerInfo LayerInfo, spec groot.BaseImageSpec) (string, string, error) {
@@ -320,10 +502,33 @@ func (p *BaseImagePuller) unpackLayerToTemporaryDirectory(logger lager.Logger, u
 		return 0, errorspkg.Wrap(err, "handling opaque whiteouts")
 	}
 
+	if len(unpackOutput.ModeChanges) > 0 {
+		logger.Info("file-modes-sanitized", lager.Data{"changes": unpackOutput.ModeChanges})
+		p.metricsEmitter.TryEmitUsage(logger, MetricsSanitizedFilesName, int64(len(unpackOutput.ModeChanges)), "files")
+	}
+
 	logger.Debug("layer-unpacked")
 	return unpackOutput.BytesWritten, nil
 }
 
+func (p *BaseImagePuller) verifyStream(logger lager.Logger, stream io.ReadCloser, tempVolumeName string, layerInfo LayerInfo) error {
+	verifiableStream, ok := stream.(VerifiableStream)
+	if !ok {
+		return nil
+	}
+
+	p.reportLayerProgress(logger, groot.ProgressLayerVerifying, layerInfo)
+	if err := verifiableStream.Verify(); err != nil {
+		logger.Error("verifying-layer-failed", err)
+		if errD := p.volumeDriver.DestroyVolume(logger, tempVolumeName); errD != nil {
+			logger.Error("volume-cleanup-failed", errD)
+		}
+		return errorspkg.Wrapf(err, "verifying layer `%s`", layerInfo.BlobID)
+	}
+
+	return nil
+}
+
 func (p *BaseImagePuller) finalizeVolume(logger lager.Logger, tempVolumeName, volumePath, chainID string, volSize int64) error {
 	if err := p.volumeDriver.WriteVolumeMeta(logger, chainID, VolumeMeta{Size: volSize}); err != nil {
 		return errorspkg.Wrapf(err, "writing volume `%s` metadata", chainID)
@@ -337,6 +542,49 @@ func (p *BaseImagePuller) finalizeVolume(logger lager.Logger, tempVolumeName, vo
 	return nil
 }
 
+// checkManifest admits and verifies the image from its manifest alone, when
+// the fetcher can resolve it, so that no layer is downloaded for an image that
+// is rejected. It reports whether it did.
+func (p *BaseImagePuller) checkManifest(logger lager.Logger, spec groot.BaseImageSpec) (ManifestInfo, bool, error) {
+	resolver, ok := p.fetcher.(ManifestResolver)
+	if !ok || (p.signatureVerifier == nil && !spec.AdmissionPolicy.LimitsLayers()) {
+		return ManifestInfo{}, false, nil
+	}
+
+	manifestInfo, err := resolver.ManifestInfo(logger, spec.BaseImageSrc)
+	if err != nil {
+		return ManifestInfo{}, false, errorspkg.Wrap(err, "resolving image manifest")
+	}
+
+	if err := spec.AdmissionPolicy.AdmitLayers(manifestInfo.LayerCount, manifestInfo.CompressedSize); err != nil {
+		logger.Error("admitting-layers-failed", err)
+		return ManifestInfo{}, false, err
+	}
+
+	if p.signatureVerifier != nil {
+		if err := p.signatureVerifier.Verify(logger, spec.BaseImageSrc, manifestInfo.ManifestDigest); err != nil {
+			return ManifestInfo{}, false, errorspkg.Wrap(err, "verifying image signature")
+		}
+	}
+
+	return manifestInfo, true, nil
+}
+
+func (p *BaseImagePuller) reportProgress(logger lager.Logger, event groot.ProgressEvent) {
+	if p.progressReporter != nil {
+		p.progressReporter.Report(logger, event)
+	}
+}
+
+func (p *BaseImagePuller) reportLayerProgress(logger lager.Logger, event string, layerInfo LayerInfo) {
+	p.reportProgress(logger, groot.ProgressEvent{
+		Event:   event,
+		BlobID:  layerInfo.BlobID,
+		ChainID: layerInfo.ChainID,
+		Total:   layerInfo.Size,
+	})
+}
+
 func (p *BaseImagePuller) layersSize(layerInfos []LayerInfo) int64 {
 	var totalSize int64
 	for _, layerInfo := range layerInfos {
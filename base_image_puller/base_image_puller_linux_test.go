@@ -35,6 +35,8 @@ var _ = Describe("Base Image Puller", func() {
 		fakeLocksmith            *grootfakes.FakeLocksmith
 		fakeMetricsEmitter       *grootfakes.FakeMetricsEmitter
 		fakeDependencyRegisterer *base_image_pullerfakes.FakeDependencyRegisterer
+		fakeSignatureVerifier    *base_image_pullerfakes.FakeSignatureVerifier
+		fakeProgressReporter     *grootfakes.FakeProgressReporter
 		expectedImgDesc          specsv1.Image
 
 		baseImagePuller *base_image_puller.BaseImagePuller
@@ -58,8 +60,9 @@ var _ = Describe("Base Image Puller", func() {
 		}
 		fakeFetcher.BaseImageInfoReturns(
 			base_image_puller.BaseImageInfo{
-				LayerInfos: layerInfos,
-				Config:     expectedImgDesc,
+				LayerInfos:     layerInfos,
+				Config:         expectedImgDesc,
+				ManifestDigest: "sha256:manifest-digest",
 			}, nil)
 
 		fakeFetcher.StreamBlobStub = func(_ lager.Logger, baseImageURL *url.URL, layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
@@ -89,8 +92,10 @@ var _ = Describe("Base Image Puller", func() {
 		}
 
 		fakeDependencyRegisterer = new(base_image_pullerfakes.FakeDependencyRegisterer)
+		fakeSignatureVerifier = new(base_image_pullerfakes.FakeSignatureVerifier)
+		fakeProgressReporter = new(grootfakes.FakeProgressReporter)
 
-		baseImagePuller = base_image_puller.NewBaseImagePuller(fakeFetcher, fakeUnpacker, fakeVolumeDriver, fakeDependencyRegisterer, fakeMetricsEmitter, fakeLocksmith)
+		baseImagePuller = base_image_puller.NewBaseImagePuller(fakeFetcher, fakeUnpacker, fakeVolumeDriver, fakeDependencyRegisterer, fakeMetricsEmitter, fakeLocksmith, fakeSignatureVerifier, fakeProgressReporter)
 		logger = lagertest.NewTestLogger("image-puller")
 
 		baseImageSrcURL, err = url.Parse("docker:///an/image")
@@ -114,6 +119,14 @@ var _ = Describe("Base Image Puller", func() {
 		Expect(baseImage.ChainIDs).To(ConsistOf("layer-111", "chain-222", "chain-333"))
 	})
 
+	It("returns the manifest digest", func() {
+		baseImage, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+			BaseImageSrc: baseImageSrcURL,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(baseImage.ManifestDigest).To(Equal("sha256:manifest-digest"))
+	})
+
 	It("creates volumes for all the layers", func() {
 		_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
 			BaseImageSrc: baseImageSrcURL,
@@ -149,6 +162,22 @@ var _ = Describe("Base Image Puller", func() {
 		Expect(unpackSpec.TargetPath).To(MatchRegexp(filepath.Join(tmpVolumesDir, "chain-333-incomplete-\\d*-\\d*")))
 	})
 
+	It("passes the volume paths of the parent layers to the unpacker, closest first", func() {
+		_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+			BaseImageSrc: baseImageSrcURL,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeUnpacker.UnpackCallCount()).To(Equal(3))
+		_, unpackSpec := fakeUnpacker.UnpackArgsForCall(0)
+		Expect(unpackSpec.ParentPaths).To(BeEmpty())
+		_, unpackSpec = fakeUnpacker.UnpackArgsForCall(2)
+		Expect(unpackSpec.ParentPaths).To(Equal([]string{
+			filepath.Join(tmpVolumesDir, "chain-222"),
+			filepath.Join(tmpVolumesDir, "layer-111"),
+		}))
+	})
+
 	Context("when there is a base directory provided on a layer", func() {
 		BeforeEach(func() {
 			layerInfos[1].BaseDirectory = "/home/base_directory"
@@ -360,9 +389,10 @@ var _ = Describe("Base Image Puller", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		Expect(fakeDependencyRegisterer.RegisterCallCount()).To(Equal(1))
-		imageID, chainIDs := fakeDependencyRegisterer.RegisterArgsForCall(0)
+		imageID, chainIDs, manifestDigest := fakeDependencyRegisterer.RegisterArgsForCall(0)
 		Expect(imageID).To(Equal("baseimage:docker:///an/image"))
 		Expect(chainIDs).To(ConsistOf("layer-111", "chain-222", "chain-333"))
+		Expect(manifestDigest).To(Equal("sha256:manifest-digest"))
 	})
 
 	It("writes the metadata for each volume", func() {
@@ -400,6 +430,48 @@ var _ = Describe("Base Image Puller", func() {
 		Eventually(fakeMetricsEmitter.TryEmitDurationFromCallCount).Should(Equal(2 * len(layerInfos)))
 	})
 
+	It("does not emit a sanitized files metric when no file modes were changed", func() {
+		_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+			BaseImageSrc: baseImageSrcURL,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeMetricsEmitter.TryEmitUsageCallCount()).To(Equal(0))
+	})
+
+	Context("when the unpacker changes file modes", func() {
+		BeforeEach(func() {
+			fakeUnpacker.UnpackReturns(base_image_puller.UnpackOutput{
+				ModeChanges: []base_image_puller.ModeChange{
+					{Path: "usr/bin/su", OldMode: 0755 | os.ModeSetuid, NewMode: 0755},
+					{Path: "var/shared", OldMode: os.ModeDir | 0777, NewMode: os.ModeDir | 0775},
+				},
+			}, nil)
+		})
+
+		It("emits a metric with the number of sanitized files for each layer", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeMetricsEmitter.TryEmitUsageCallCount()).To(Equal(len(layerInfos)))
+			_, name, usage, units := fakeMetricsEmitter.TryEmitUsageArgsForCall(0)
+			Expect(name).To(Equal(base_image_puller.MetricsSanitizedFilesName))
+			Expect(usage).To(Equal(int64(2)))
+			Expect(units).To(Equal("files"))
+		})
+
+		It("logs the changes", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logger.(*lagertest.TestLogger).LogMessages()).To(ContainElement(HaveSuffix("file-modes-sanitized")))
+		})
+	})
+
 	It("uses the locksmith for each layer", func() {
 		_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
 			BaseImageSrc: baseImageSrcURL,
@@ -515,6 +587,285 @@ var _ = Describe("Base Image Puller", func() {
 		})
 	})
 
+	It("verifies the image signature with the manifest digest", func() {
+		_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+			BaseImageSrc: baseImageSrcURL,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeSignatureVerifier.VerifyCallCount()).To(Equal(1))
+		_, imageURL, manifestDigest := fakeSignatureVerifier.VerifyArgsForCall(0)
+		Expect(imageURL).To(Equal(baseImageSrcURL))
+		Expect(manifestDigest).To(Equal("sha256:manifest-digest"))
+	})
+
+	Context("when the signature verification fails", func() {
+		BeforeEach(func() {
+			fakeSignatureVerifier.VerifyReturns(errors.New("image `docker.io/an/image:latest` is not signed"))
+		})
+
+		It("returns an error", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).To(MatchError(ContainSubstring("verifying image signature: image `docker.io/an/image:latest` is not signed")))
+		})
+
+		It("does not download any layer", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).To(HaveOccurred())
+
+			Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(0))
+			Expect(fakeVolumeDriver.CreateVolumeCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the fetcher can resolve the manifest before fetching the image info", func() {
+		var fakeManifestResolver *base_image_pullerfakes.FakeManifestResolver
+
+		BeforeEach(func() {
+			fakeManifestResolver = new(base_image_pullerfakes.FakeManifestResolver)
+			fakeManifestResolver.ManifestInfoReturns(base_image_puller.ManifestInfo{
+				ManifestDigest: "sha256:manifest-digest",
+			}, nil)
+
+			resolvingFetcher := struct {
+				*base_image_pullerfakes.FakeFetcher
+				*base_image_pullerfakes.FakeManifestResolver
+			}{fakeFetcher, fakeManifestResolver}
+			baseImagePuller = base_image_puller.NewBaseImagePuller(resolvingFetcher, fakeUnpacker, fakeVolumeDriver, fakeDependencyRegisterer, fakeMetricsEmitter, fakeLocksmith, fakeSignatureVerifier, fakeProgressReporter)
+		})
+
+		It("verifies the image signature once, with the resolved manifest digest", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeManifestResolver.ManifestInfoCallCount()).To(Equal(1))
+			_, imageURL := fakeManifestResolver.ManifestInfoArgsForCall(0)
+			Expect(imageURL).To(Equal(baseImageSrcURL))
+
+			Expect(fakeSignatureVerifier.VerifyCallCount()).To(Equal(1))
+			_, _, manifestDigest := fakeSignatureVerifier.VerifyArgsForCall(0)
+			Expect(manifestDigest).To(Equal("sha256:manifest-digest"))
+		})
+
+		Context("when the signature verification fails", func() {
+			BeforeEach(func() {
+				fakeSignatureVerifier.VerifyReturns(errors.New("image `docker.io/an/image:latest` is not signed"))
+			})
+
+			It("fails before fetching the image info", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+					BaseImageSrc: baseImageSrcURL,
+				})
+				Expect(err).To(MatchError(ContainSubstring("verifying image signature: image `docker.io/an/image:latest` is not signed")))
+
+				Expect(fakeFetcher.BaseImageInfoCallCount()).To(Equal(0))
+				Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when resolving the manifest fails", func() {
+			BeforeEach(func() {
+				fakeManifestResolver.ManifestInfoReturns(base_image_puller.ManifestInfo{}, errors.New("manifest unknown"))
+			})
+
+			It("returns an error", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+					BaseImageSrc: baseImageSrcURL,
+				})
+				Expect(err).To(MatchError(ContainSubstring("resolving image manifest: manifest unknown")))
+				Expect(fakeFetcher.BaseImageInfoCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the manifest changes after it was verified", func() {
+			BeforeEach(func() {
+				fakeManifestResolver.ManifestInfoReturns(base_image_puller.ManifestInfo{
+					ManifestDigest: "sha256:another-digest",
+				}, nil)
+			})
+
+			It("returns an error without downloading any layer", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+					BaseImageSrc: baseImageSrcURL,
+				})
+				Expect(err).To(MatchError(ContainSubstring("manifest of the image changed")))
+				Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when there is no signature verifier", func() {
+			BeforeEach(func() {
+				resolvingFetcher := struct {
+					*base_image_pullerfakes.FakeFetcher
+					*base_image_pullerfakes.FakeManifestResolver
+				}{fakeFetcher, fakeManifestResolver}
+				baseImagePuller = base_image_puller.NewBaseImagePuller(resolvingFetcher, fakeUnpacker, fakeVolumeDriver, fakeDependencyRegisterer, fakeMetricsEmitter, fakeLocksmith, nil, fakeProgressReporter)
+			})
+
+			It("does not resolve the manifest", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+					BaseImageSrc: baseImageSrcURL,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeManifestResolver.ManifestInfoCallCount()).To(Equal(0))
+			})
+
+			Context("when the admission policy limits the layers", func() {
+				BeforeEach(func() {
+					fakeManifestResolver.ManifestInfoReturns(base_image_puller.ManifestInfo{
+						ManifestDigest: "sha256:manifest-digest",
+						LayerCount:     3,
+						CompressedSize: 1024,
+					}, nil)
+				})
+
+				It("admits the layers listed in the manifest before fetching the image info", func() {
+					_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+						BaseImageSrc:    baseImageSrcURL,
+						AdmissionPolicy: groot.AdmissionPolicy{MaxLayers: 2},
+					})
+					Expect(err).To(MatchError("image rejected by the admission policy: image has 3 layers, the maximum is 2"))
+
+					Expect(fakeManifestResolver.ManifestInfoCallCount()).To(Equal(1))
+					Expect(fakeFetcher.BaseImageInfoCallCount()).To(Equal(0))
+				})
+
+				It("admits the compressed size listed in the manifest before fetching the image info", func() {
+					_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+						BaseImageSrc:    baseImageSrcURL,
+						AdmissionPolicy: groot.AdmissionPolicy{MaxCompressedSizeBytes: 1000},
+					})
+					Expect(err).To(MatchError("image rejected by the admission policy: image layers are 1024 bytes, the maximum is 1000"))
+					Expect(fakeFetcher.BaseImageInfoCallCount()).To(Equal(0))
+				})
+			})
+		})
+	})
+
+	Context("when there is no signature verifier", func() {
+		BeforeEach(func() {
+			baseImagePuller = base_image_puller.NewBaseImagePuller(fakeFetcher, fakeUnpacker, fakeVolumeDriver, fakeDependencyRegisterer, fakeMetricsEmitter, fakeLocksmith, nil, fakeProgressReporter)
+		})
+
+		It("pulls the image without verifying it", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeSignatureVerifier.VerifyCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("progress", func() {
+		var events []groot.ProgressEvent
+
+		layerEvents := func(blobID string) []string {
+			names := []string{}
+			for _, event := range events {
+				if event.BlobID == blobID {
+					names = append(names, event.Event)
+				}
+			}
+			return names
+		}
+
+		BeforeEach(func() {
+			layerInfos[1].Size = 2048
+			layerInfos[2].Size = 4096
+			fakeFetcher.BaseImageInfoReturns(base_image_puller.BaseImageInfo{
+				LayerInfos:     layerInfos,
+				Config:         expectedImgDesc,
+				ManifestDigest: "sha256:manifest-digest",
+			}, nil)
+
+			fakeFetcher.StreamBlobStub = func(_ lager.Logger, _ *url.URL, layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+				Expect(layerInfo.DownloadProgress).NotTo(BeNil())
+				layerInfo.DownloadProgress(layerInfo.Size)
+				return ioutil.NopCloser(bytes.NewBuffer([]byte{})), layerInfo.Size, nil
+			}
+
+			Expect(os.MkdirAll(filepath.Join(tmpVolumesDir, "layer-111"), 0777)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc: baseImageSrcURL,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			events = []groot.ProgressEvent{}
+			for i := 0; i < fakeProgressReporter.ReportCallCount(); i++ {
+				_, event := fakeProgressReporter.ReportArgsForCall(i)
+				events = append(events, event)
+			}
+		})
+
+		It("reports the resolved manifest first", func() {
+			Expect(events[0]).To(Equal(groot.ProgressEvent{
+				Event:          groot.ProgressManifestResolved,
+				ManifestDigest: "sha256:manifest-digest",
+				Layers:         3,
+				Total:          6144,
+			}))
+		})
+
+		It("reports the layers that are already in the store as cached", func() {
+			Expect(layerEvents("i-am-a-layer")).To(Equal([]string{groot.ProgressLayerCached}))
+		})
+
+		It("reports each step of the layers that are pulled", func() {
+			Expect(layerEvents("i-am-the-last-layer")).To(Equal([]string{
+				groot.ProgressLayerQueued,
+				groot.ProgressLayerDownloading,
+				groot.ProgressLayerDownloading,
+				groot.ProgressLayerUnpacking,
+				groot.ProgressLayerDone,
+			}))
+		})
+
+		It("reports how much of the layer was downloaded", func() {
+			Expect(events).To(ContainElement(groot.ProgressEvent{
+				Event:   groot.ProgressLayerDownloading,
+				BlobID:  "i-am-another-layer",
+				ChainID: "chain-222",
+				Bytes:   2048,
+				Total:   2048,
+			}))
+		})
+
+		Context("when the layer stream is verifiable", func() {
+			BeforeEach(func() {
+				fakeFetcher.StreamBlobStub = func(_ lager.Logger, _ *url.URL, _ base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+					return &verifiableStream{Reader: bytes.NewBuffer([]byte{})}, 0, nil
+				}
+			})
+
+			It("reports the verification", func() {
+				Expect(layerEvents("i-am-the-last-layer")).To(ContainElement(groot.ProgressLayerVerifying))
+			})
+		})
+
+		Context("when there is no progress reporter", func() {
+			BeforeEach(func() {
+				baseImagePuller = base_image_puller.NewBaseImagePuller(fakeFetcher, fakeUnpacker, fakeVolumeDriver, fakeDependencyRegisterer, fakeMetricsEmitter, fakeLocksmith, fakeSignatureVerifier, nil)
+				fakeFetcher.StreamBlobStub = func(_ lager.Logger, _ *url.URL, layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+					Expect(layerInfo.DownloadProgress).To(BeNil())
+					return ioutil.NopCloser(bytes.NewBuffer([]byte{})), 0, nil
+				}
+			})
+
+			It("does not ask the fetcher for download progress", func() {
+				Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(2))
+			})
+		})
+	})
+
 	Context("when UID and GID mappings are provided", func() {
 		var spec groot.BaseImageSpec
 
@@ -692,6 +1043,69 @@ var _ = Describe("Base Image Puller", func() {
 		})
 	})
 
+	Context("when the layers violate the admission policy", func() {
+		It("returns a policy violation error without creating any layer", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+				BaseImageSrc:    baseImageSrcURL,
+				AdmissionPolicy: groot.AdmissionPolicy{MaxLayers: 2},
+			})
+			Expect(err).To(MatchError("image rejected by the admission policy: image has 3 layers, the maximum is 2"))
+			Expect(err).To(BeAssignableToTypeOf(&groot.PolicyViolationError{}))
+
+			Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(0))
+			Expect(fakeVolumeDriver.CreateVolumeCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the base image info is cached", func() {
+		BeforeEach(func() {
+			fakeFetcher.BaseImageInfoReturns(
+				base_image_puller.BaseImageInfo{
+					LayerInfos:     layerInfos,
+					Config:         expectedImgDesc,
+					ManifestDigest: "sha256:manifest-digest",
+					Cached:         true,
+				}, nil)
+		})
+
+		Context("when all volumes exist", func() {
+			BeforeEach(func() {
+				fakeVolumeDriver.VolumePathReturns("/path/to/volume", nil)
+			})
+
+			It("returns the base image", func() {
+				baseImage, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+					BaseImageSrc: baseImageSrcURL,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(baseImage.ChainIDs).To(Equal([]string{"layer-111", "chain-222", "chain-333"}))
+				Expect(baseImage.ManifestDigest).To(Equal("sha256:manifest-digest"))
+			})
+		})
+
+		Context("when a volume is missing", func() {
+			BeforeEach(func() {
+				fakeVolumeDriver.VolumePathStub = func(_ lager.Logger, id string) (string, error) {
+					if id == "chain-333" {
+						return "", errors.New("not here")
+					}
+					return "/path/to/" + id, nil
+				}
+			})
+
+			It("returns an error without downloading any layer", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{
+					BaseImageSrc: baseImageSrcURL,
+				})
+				Expect(err).To(MatchError("image is not available offline: layer `i-am-the-last-layer` has not been pulled"))
+
+				Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(0))
+				Expect(fakeVolumeDriver.CreateVolumeCallCount()).To(Equal(0))
+			})
+		})
+	})
+
 	Context("when creating a volume fails", func() {
 		BeforeEach(func() {
 			fakeVolumeDriver.CreateVolumeReturns("", errors.New("failed to create volume"))
@@ -716,6 +1130,114 @@ var _ = Describe("Base Image Puller", func() {
 		})
 	})
 
+	Context("when the stream is verified after unpacking", func() {
+		var verifyErrs map[string]error
+
+		BeforeEach(func() {
+			verifyErrs = map[string]error{}
+			fakeFetcher.StreamBlobStub = func(_ lager.Logger, _ *url.URL, layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+				return &verifiableStream{
+					Reader:    bytes.NewBuffer([]byte{}),
+					verifyErr: verifyErrs[layerInfo.ChainID],
+				}, 0, nil
+			}
+		})
+
+		It("moves the verified volumes to their final location", func() {
+			_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{BaseImageSrc: baseImageSrcURL})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVolumeDriver.MoveVolumeCallCount()).To(Equal(3))
+			Expect(fakeVolumeDriver.DestroyVolumeCallCount()).To(Equal(0))
+		})
+
+		Context("when the verification fails", func() {
+			BeforeEach(func() {
+				verifyErrs["chain-333"] = errors.New("invalid checksum")
+			})
+
+			It("returns an error", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{BaseImageSrc: baseImageSrcURL})
+				Expect(err).To(MatchError(ContainSubstring("verifying layer `i-am-the-last-layer`: invalid checksum")))
+			})
+
+			It("destroys the incomplete volume", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{BaseImageSrc: baseImageSrcURL})
+				Expect(err).To(HaveOccurred())
+
+				Expect(fakeVolumeDriver.DestroyVolumeCallCount()).To(Equal(1))
+				_, id := fakeVolumeDriver.DestroyVolumeArgsForCall(0)
+				Expect(id).To(MatchRegexp("chain-333-incomplete-\\d*-\\d*"))
+			})
+
+			It("does not finalize the volume", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{BaseImageSrc: baseImageSrcURL})
+				Expect(err).To(HaveOccurred())
+
+				Expect(fakeVolumeDriver.MoveVolumeCallCount()).To(Equal(2))
+				for i := 0; i < fakeVolumeDriver.WriteVolumeMetaCallCount(); i++ {
+					_, id, _ := fakeVolumeDriver.WriteVolumeMetaArgsForCall(i)
+					Expect(id).NotTo(Equal("chain-333"))
+				}
+			})
+		})
+
+		Context("when the blob does not match its digest", func() {
+			var (
+				mutex       sync.Mutex
+				streamCount int
+				mismatchErr *base_image_puller.BlobMismatchError
+			)
+
+			BeforeEach(func() {
+				streamCount = 0
+				mismatchErr = &base_image_puller.BlobMismatchError{
+					Digest:      "i-am-the-last-layer",
+					ServedFrom:  "mirror.example.com",
+					HasFallback: true,
+				}
+
+				fakeFetcher.StreamBlobStub = func(_ lager.Logger, _ *url.URL, layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+					stream := &verifiableStream{Reader: bytes.NewBuffer([]byte{})}
+					if layerInfo.ChainID != "chain-333" {
+						return stream, 0, nil
+					}
+
+					mutex.Lock()
+					defer mutex.Unlock()
+					streamCount++
+					if streamCount == 1 {
+						stream.verifyErr = mismatchErr
+					}
+					return stream, 0, nil
+				}
+			})
+
+			It("streams the layer again from the next endpoint", func() {
+				_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{BaseImageSrc: baseImageSrcURL})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(4))
+				Expect(fakeUnpacker.UnpackCallCount()).To(Equal(4))
+				Expect(fakeVolumeDriver.DestroyVolumeCallCount()).To(Equal(1))
+				Expect(fakeVolumeDriver.MoveVolumeCallCount()).To(Equal(3))
+			})
+
+			Context("when there is no other endpoint", func() {
+				BeforeEach(func() {
+					mismatchErr.HasFallback = false
+				})
+
+				It("returns an error", func() {
+					_, err := baseImagePuller.Pull(logger, groot.BaseImageSpec{BaseImageSrc: baseImageSrcURL})
+					Expect(err).To(MatchError(ContainSubstring("verifying layer `i-am-the-last-layer`: invalid checksum: layer is corrupted")))
+
+					Expect(fakeFetcher.StreamBlobCallCount()).To(Equal(3))
+				})
+			})
+		})
+	})
+
 	Context("when unpacking a blob fails", func() {
 		BeforeEach(func() {
 			count := 0
@@ -811,3 +1333,16 @@ var _ = Describe("Base Image Puller", func() {
 		})
 	})
 })
+
+type verifiableStream struct {
+	io.Reader
+	verifyErr error
+}
+
+func (s *verifiableStream) Verify() error {
+	return s.verifyErr
+}
+
+func (s *verifiableStream) Close() error {
+	return nil
+}
@@ -8,11 +8,12 @@ import (
 )
 
 type FakeDependencyRegisterer struct {
-	RegisterStub        func(id string, chainIDs []string) error
+	RegisterStub        func(id string, chainIDs []string, manifestDigest string) error
 	registerMutex       sync.RWMutex
 	registerArgsForCall []struct {
-		id       string
-		chainIDs []string
+		id             string
+		chainIDs       []string
+		manifestDigest string
 	}
 	registerReturns struct {
 		result1 error
@@ -24,7 +25,7 @@ type FakeDependencyRegisterer struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeDependencyRegisterer) Register(id string, chainIDs []string) error {
+func (fake *FakeDependencyRegisterer) Register(id string, chainIDs []string, manifestDigest string) error {
 	var chainIDsCopy []string
 	if chainIDs != nil {
 		chainIDsCopy = make([]string, len(chainIDs))
@@ -33,13 +34,14 @@ func (fake *FakeDependencyRegisterer) Register(id string, chainIDs []string) err
 	fake.registerMutex.Lock()
 	ret, specificReturn := fake.registerReturnsOnCall[len(fake.registerArgsForCall)]
 	fake.registerArgsForCall = append(fake.registerArgsForCall, struct {
-		id       string
-		chainIDs []string
-	}{id, chainIDsCopy})
-	fake.recordInvocation("Register", []interface{}{id, chainIDsCopy})
+		id             string
+		chainIDs       []string
+		manifestDigest string
+	}{id, chainIDsCopy, manifestDigest})
+	fake.recordInvocation("Register", []interface{}{id, chainIDsCopy, manifestDigest})
 	fake.registerMutex.Unlock()
 	if fake.RegisterStub != nil {
-		return fake.RegisterStub(id, chainIDs)
+		return fake.RegisterStub(id, chainIDs, manifestDigest)
 	}
 	if specificReturn {
 		return ret.result1
@@ -53,10 +55,10 @@ func (fake *FakeDependencyRegisterer) RegisterCallCount() int {
 	return len(fake.registerArgsForCall)
 }
 
-func (fake *FakeDependencyRegisterer) RegisterArgsForCall(i int) (string, []string) {
+func (fake *FakeDependencyRegisterer) RegisterArgsForCall(i int) (string, []string, string) {
 	fake.registerMutex.RLock()
 	defer fake.registerMutex.RUnlock()
-	return fake.registerArgsForCall[i].id, fake.registerArgsForCall[i].chainIDs
+	return fake.registerArgsForCall[i].id, fake.registerArgsForCall[i].chainIDs, fake.registerArgsForCall[i].manifestDigest
 }
 
 func (fake *FakeDependencyRegisterer) RegisterReturns(result1 error) {
@@ -0,0 +1,150 @@
+package signature // import "code.cloudfoundry.org/grootfs/base_image_puller/signature"
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/docker/reference"
+	errorspkg "github.com/pkg/errors"
+)
+
+const (
+	DockerTransport        = "docker"
+	OCITransport           = "oci"
+	OCIArchiveTransport    = "oci-archive"
+	DockerArchiveTransport = "docker-archive"
+	// TarTransport is used for local tarballs and directories
+	TarTransport = "tar"
+
+	TypeInsecureAcceptAnything = "insecureAcceptAnything"
+	TypeReject                 = "reject"
+	TypeSignedBy               = "signedBy"
+
+	KeyTypeGPGKeys = "GPGKeys"
+)
+
+// Policy is the subset of the containers/image `policy.json` format that
+// grootfs understands: scopes of each transport map to lists of requirements,
+// and all the requirements in a list must be satisfied. The scopes of the
+// docker transport are image references, the others are paths.
+type Policy struct {
+	Default    []Requirement                       `json:"default"`
+	Transports map[string]map[string][]Requirement `json:"transports"`
+}
+
+type Requirement struct {
+	Type    string `json:"type"`
+	KeyType string `json:"keyType,omitempty"`
+	KeyPath string `json:"keyPath,omitempty"`
+}
+
+func LoadPolicy(policyPath string) (Policy, error) {
+	contents, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return Policy{}, errorspkg.Wrap(err, "reading trust policy")
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(contents, &policy); err != nil {
+		return Policy{}, errorspkg.Wrap(err, "parsing trust policy")
+	}
+
+	if err := policy.validate(); err != nil {
+		return Policy{}, errorspkg.Wrap(err, "invalid trust policy")
+	}
+
+	return policy, nil
+}
+
+func (p Policy) validate() error {
+	if len(p.Default) == 0 {
+		return errorspkg.New("`default` must contain at least one requirement")
+	}
+	if err := validateRequirements(p.Default); err != nil {
+		return err
+	}
+
+	for transport, scopes := range p.Transports {
+		switch transport {
+		case DockerTransport, OCITransport, OCIArchiveTransport, DockerArchiveTransport, TarTransport:
+		default:
+			return errorspkg.Errorf("unsupported transport `%s`", transport)
+		}
+
+		for scope, requirements := range scopes {
+			if len(requirements) == 0 {
+				return errorspkg.Errorf("scope `%s` must contain at least one requirement", scope)
+			}
+			if err := validateRequirements(requirements); err != nil {
+				return errorspkg.Wrapf(err, "scope `%s`", scope)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateRequirements(requirements []Requirement) error {
+	for _, requirement := range requirements {
+		switch requirement.Type {
+		case TypeInsecureAcceptAnything, TypeReject:
+		case TypeSignedBy:
+			if requirement.KeyType != KeyTypeGPGKeys {
+				return errorspkg.Errorf("unsupported key type `%s`", requirement.KeyType)
+			}
+			if requirement.KeyPath == "" {
+				return errorspkg.New("`signedBy` requires a `keyPath`")
+			}
+		default:
+			return errorspkg.Errorf("unsupported requirement type `%s`", requirement.Type)
+		}
+	}
+
+	return nil
+}
+
+// requirementsFor returns the requirements of the most specific scope that
+// matches the reference: the full reference, then the repository, then each
+// of its parent namespaces up to the registry host, and finally the
+// transport and policy defaults.
+func (p Policy) requirementsFor(ref reference.Named) ([]Requirement, string) {
+	candidates := []string{ref.String()}
+	name := ref.Name()
+	for {
+		candidates = append(candidates, name)
+		index := strings.LastIndex(name, "/")
+		if index < 0 {
+			break
+		}
+		name = name[:index]
+	}
+	candidates = append(candidates, "")
+
+	return p.requirementsForScopes(DockerTransport, candidates)
+}
+
+// pathRequirementsFor returns the requirements of the most specific scope that
+// matches the image path: the path itself, then each of its parent
+// directories, and finally the transport and policy defaults.
+func (p Policy) pathRequirementsFor(transport, imagePath string) ([]Requirement, string) {
+	candidates := []string{imagePath}
+	for dir := filepath.Dir(imagePath); dir != "." && dir != candidates[len(candidates)-1]; dir = filepath.Dir(dir) {
+		candidates = append(candidates, dir)
+	}
+	candidates = append(candidates, "")
+
+	return p.requirementsForScopes(transport, candidates)
+}
+
+func (p Policy) requirementsForScopes(transport string, candidates []string) ([]Requirement, string) {
+	scopes := p.Transports[transport]
+	for _, scope := range candidates {
+		if requirements, ok := scopes[scope]; ok {
+			return requirements, scope
+		}
+	}
+
+	return p.Default, "default"
+}
@@ -0,0 +1,129 @@
+package signature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller/signature"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	var (
+		policyDir  string
+		policyPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		policyDir, err = ioutil.TempDir("", "policy")
+		Expect(err).NotTo(HaveOccurred())
+		policyPath = filepath.Join(policyDir, "policy.json")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(policyDir)).To(Succeed())
+	})
+
+	writePolicy := func(contents string) {
+		Expect(ioutil.WriteFile(policyPath, []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("LoadPolicy", func() {
+		It("loads the default and the docker transport scopes", func() {
+			writePolicy(`{
+				"default": [{"type": "reject"}],
+				"transports": {
+					"docker": {
+						"docker.io/library": [{"type": "signedBy", "keyType": "GPGKeys", "keyPath": "/keys/library.gpg"}],
+						"registry.example.com": [{"type": "insecureAcceptAnything"}]
+					}
+				}
+			}`)
+
+			policy, err := signature.LoadPolicy(policyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(policy.Default).To(Equal([]signature.Requirement{{Type: signature.TypeReject}}))
+			Expect(policy.Transports["docker"]["docker.io/library"]).To(Equal([]signature.Requirement{
+				{Type: signature.TypeSignedBy, KeyType: signature.KeyTypeGPGKeys, KeyPath: "/keys/library.gpg"},
+			}))
+			Expect(policy.Transports["docker"]["registry.example.com"]).To(Equal([]signature.Requirement{
+				{Type: signature.TypeInsecureAcceptAnything},
+			}))
+		})
+
+		It("loads the scopes of local transports", func() {
+			writePolicy(`{
+				"default": [{"type": "reject"}],
+				"transports": {
+					"oci": {"/images": [{"type": "insecureAcceptAnything"}]},
+					"tar": {"": [{"type": "insecureAcceptAnything"}]}
+				}
+			}`)
+
+			policy, err := signature.LoadPolicy(policyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(policy.Transports["oci"]["/images"]).To(Equal([]signature.Requirement{{Type: signature.TypeInsecureAcceptAnything}}))
+			Expect(policy.Transports["tar"][""]).To(Equal([]signature.Requirement{{Type: signature.TypeInsecureAcceptAnything}}))
+		})
+
+		Context("when the policy file does not exist", func() {
+			It("returns an error", func() {
+				_, err := signature.LoadPolicy("/not/a/policy.json")
+				Expect(err).To(MatchError(ContainSubstring("reading trust policy")))
+			})
+		})
+
+		Context("when the policy is not valid json", func() {
+			It("returns an error", func() {
+				writePolicy("{")
+				_, err := signature.LoadPolicy(policyPath)
+				Expect(err).To(MatchError(ContainSubstring("parsing trust policy")))
+			})
+		})
+
+		Context("when the default requirements are missing", func() {
+			It("returns an error", func() {
+				writePolicy(`{"transports": {}}`)
+				_, err := signature.LoadPolicy(policyPath)
+				Expect(err).To(MatchError(ContainSubstring("`default` must contain at least one requirement")))
+			})
+		})
+
+		Context("when the policy uses an unsupported transport", func() {
+			It("returns an error", func() {
+				writePolicy(`{"default": [{"type": "reject"}], "transports": {"atomic": {"": [{"type": "reject"}]}}}`)
+				_, err := signature.LoadPolicy(policyPath)
+				Expect(err).To(MatchError(ContainSubstring("unsupported transport `atomic`")))
+			})
+		})
+
+		Context("when the policy uses an unsupported requirement type", func() {
+			It("returns an error", func() {
+				writePolicy(`{"default": [{"type": "signedBaseLayer"}]}`)
+				_, err := signature.LoadPolicy(policyPath)
+				Expect(err).To(MatchError(ContainSubstring("unsupported requirement type `signedBaseLayer`")))
+			})
+		})
+
+		Context("when a signedBy requirement uses an unsupported key type", func() {
+			It("returns an error", func() {
+				writePolicy(`{"default": [{"type": "signedBy", "keyType": "X509Certificates", "keyPath": "/keys/cert.pem"}]}`)
+				_, err := signature.LoadPolicy(policyPath)
+				Expect(err).To(MatchError(ContainSubstring("unsupported key type `X509Certificates`")))
+			})
+		})
+
+		Context("when a signedBy requirement has no key path", func() {
+			It("returns an error", func() {
+				writePolicy(`{"default": [{"type": "reject"}], "transports": {"docker": {"docker.io": [{"type": "signedBy", "keyType": "GPGKeys"}]}}}`)
+				_, err := signature.LoadPolicy(policyPath)
+				Expect(err).To(MatchError(ContainSubstring("scope `docker.io`: `signedBy` requires a `keyPath`")))
+			})
+		})
+	})
+})
@@ -0,0 +1,270 @@
+package signature // import "code.cloudfoundry.org/grootfs/base_image_puller/signature"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/containers/image/docker/reference"
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+const simpleSigningType = "atomic container signature"
+
+// Verifier checks images against a trust policy. Registry images can be
+// signed with simple signing signatures stored in a local sigstore directory
+// with the same layout as the containers/image lookaside storage:
+//
+//	<sigstore>/<repository>@<algorithm>=<hex>/signature-<n>
+type Verifier struct {
+	policy       Policy
+	sigstorePath string
+}
+
+type untrustedSignature struct {
+	Critical struct {
+		Type  string `json:"type"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+	} `json:"critical"`
+}
+
+func NewVerifier(policy Policy, sigstorePath string) *Verifier {
+	return &Verifier{
+		policy:       policy,
+		sigstorePath: sigstorePath,
+	}
+}
+
+func (v *Verifier) Verify(logger lager.Logger, baseImageURL *url.URL, manifestDigest string) error {
+	logger = logger.Session("verifying-signature", lager.Data{"baseImageURL": baseImageURL.String(), "manifestDigest": manifestDigest})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	if baseImageURL.Scheme != DockerTransport {
+		return v.verifyUnsigned(logger, baseImageURL)
+	}
+
+	ref, err := dockerReference(baseImageURL)
+	if err != nil {
+		return err
+	}
+
+	requirements, scope := v.policy.requirementsFor(ref)
+	logger.Debug("matched-policy-scope", lager.Data{"reference": ref.String(), "scope": scope})
+	if len(requirements) == 0 {
+		return errorspkg.Errorf("image `%s` is rejected by the trust policy: scope `%s` has no requirements", ref.String(), scope)
+	}
+
+	var signatures [][]byte
+	for _, requirement := range requirements {
+		switch requirement.Type {
+		case TypeInsecureAcceptAnything:
+			continue
+
+		case TypeReject:
+			return errorspkg.Errorf("image `%s` is rejected by the trust policy", ref.String())
+
+		case TypeSignedBy:
+			if signatures == nil {
+				if signatures, err = v.signatures(ref, manifestDigest); err != nil {
+					return err
+				}
+			}
+			if len(signatures) == 0 {
+				return errorspkg.Errorf("image `%s` is not signed", ref.String())
+			}
+
+			if err := v.verifySignedBy(logger, requirement, ref, manifestDigest, signatures); err != nil {
+				return err
+			}
+
+		default:
+			return errorspkg.Errorf("unsupported requirement type `%s`", requirement.Type)
+		}
+	}
+
+	return nil
+}
+
+// verifyUnsigned checks images that don't come from a registry, which can't
+// have signatures: they are only accepted by a scope whose requirements are
+// all `insecureAcceptAnything`.
+func (v *Verifier) verifyUnsigned(logger lager.Logger, baseImageURL *url.URL) error {
+	transport := baseImageURL.Scheme
+	if transport == "" {
+		transport = TarTransport
+	}
+
+	requirements, scope := v.policy.pathRequirementsFor(transport, imagePath(baseImageURL))
+	logger.Debug("matched-policy-scope", lager.Data{"transport": transport, "scope": scope})
+	if len(requirements) == 0 {
+		return errorspkg.Errorf("image `%s` is rejected by the trust policy: scope `%s` has no requirements", baseImageURL.String(), scope)
+	}
+
+	for _, requirement := range requirements {
+		switch requirement.Type {
+		case TypeInsecureAcceptAnything:
+			continue
+
+		case TypeReject:
+			return errorspkg.Errorf("image `%s` is rejected by the trust policy", baseImageURL.String())
+
+		case TypeSignedBy:
+			return errorspkg.Errorf("image `%s` is not signed: only registry images can have signatures", baseImageURL.String())
+
+		default:
+			return errorspkg.Errorf("unsupported requirement type `%s`", requirement.Type)
+		}
+	}
+
+	return nil
+}
+
+func (v *Verifier) verifySignedBy(logger lager.Logger, requirement Requirement, ref reference.Named, manifestDigest string, signatures [][]byte) error {
+	keyring, err := readKeyring(requirement.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for i, signature := range signatures {
+		if lastErr = verifySignature(keyring, signature, ref, manifestDigest); lastErr == nil {
+			logger.Debug("signature-verified", lager.Data{"signature": i + 1, "keyPath": requirement.KeyPath})
+			return nil
+		}
+		logger.Debug("signature-rejected", lager.Data{"signature": i + 1, "keyPath": requirement.KeyPath, "reason": lastErr.Error()})
+	}
+
+	return errorspkg.Wrapf(lastErr, "invalid signature for image `%s`", ref.String())
+}
+
+func (v *Verifier) signatures(ref reference.Named, manifestDigest string) ([][]byte, error) {
+	digest, err := digestpkg.Parse(manifestDigest)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "parsing manifest digest")
+	}
+
+	signaturesDir := filepath.Join(v.sigstorePath, fmt.Sprintf("%s@%s=%s", reference.Path(ref), digest.Algorithm(), digest.Hex()))
+
+	signatures := [][]byte{}
+	for i := 1; ; i++ {
+		signature, err := ioutil.ReadFile(filepath.Join(signaturesDir, fmt.Sprintf("signature-%d", i)))
+		if os.IsNotExist(err) {
+			return signatures, nil
+		}
+		if err != nil {
+			return nil, errorspkg.Wrap(err, "reading signature")
+		}
+		signatures = append(signatures, signature)
+	}
+}
+
+func verifySignature(keyring openpgp.EntityList, signature []byte, ref reference.Named, manifestDigest string) error {
+	message, err := openpgp.ReadMessage(bytes.NewReader(signature), keyring, nil, nil)
+	if err != nil {
+		return errorspkg.Wrap(err, "reading signature")
+	}
+	if !message.IsSigned {
+		return errorspkg.New("message is not signed")
+	}
+
+	payload, err := ioutil.ReadAll(message.UnverifiedBody)
+	if err != nil {
+		return errorspkg.Wrap(err, "reading signed payload")
+	}
+	if message.SignatureError != nil {
+		return message.SignatureError
+	}
+	if message.SignedBy == nil {
+		return errorspkg.Errorf("signed by unknown key %X", message.SignedByKeyId)
+	}
+
+	var untrusted untrustedSignature
+	if err := json.Unmarshal(payload, &untrusted); err != nil {
+		return errorspkg.Wrap(err, "parsing signed payload")
+	}
+
+	if untrusted.Critical.Type != simpleSigningType {
+		return errorspkg.Errorf("unsupported signature type `%s`", untrusted.Critical.Type)
+	}
+
+	if untrusted.Critical.Image.DockerManifestDigest != manifestDigest {
+		return errorspkg.Errorf("signature is for manifest `%s`", untrusted.Critical.Image.DockerManifestDigest)
+	}
+
+	signedRef, err := reference.ParseNormalizedNamed(untrusted.Critical.Identity.DockerReference)
+	if err != nil {
+		return errorspkg.Wrap(err, "parsing signed reference")
+	}
+	if !matchesReference(ref, signedRef) {
+		return errorspkg.Errorf("signature is for image `%s`", signedRef.String())
+	}
+
+	return nil
+}
+
+// matchesReference requires the signed reference to be the same as the
+// requested one, except for digest references, which are already pinned to
+// the signed manifest and only need to match the repository.
+func matchesReference(ref, signedRef reference.Named) bool {
+	if _, ok := ref.(reference.Canonical); ok {
+		return ref.Name() == signedRef.Name()
+	}
+
+	return ref.String() == signedRef.String()
+}
+
+// imagePath returns the path of an image that is not in a registry, without
+// the reference of an oci layout.
+func imagePath(baseImageURL *url.URL) string {
+	imagePath := baseImageURL.Path
+	if baseImageURL.Scheme == OCITransport {
+		if index := strings.LastIndex(imagePath, ":"); index > strings.LastIndex(imagePath, "/") {
+			imagePath = imagePath[:index]
+		}
+	}
+
+	return filepath.Clean(imagePath)
+}
+
+func dockerReference(baseImageURL *url.URL) (reference.Named, error) {
+	refString := strings.TrimPrefix(path.Join(baseImageURL.Host, baseImageURL.Path), "/")
+
+	ref, err := reference.ParseNormalizedNamed(refString)
+	if err != nil {
+		return nil, errorspkg.Wrapf(err, "parsing image reference `%s`", refString)
+	}
+
+	return reference.TagNameOnly(ref), nil
+}
+
+func readKeyring(keyPath string) (openpgp.EntityList, error) {
+	contents, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "reading trusted keys")
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(contents))
+	}
+	if err != nil {
+		return nil, errorspkg.Wrapf(err, "parsing trusted keys `%s`", keyPath)
+	}
+
+	return keyring, nil
+}
@@ -0,0 +1,278 @@
+package signature_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller/signature"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/openpgp"
+)
+
+var _ = Describe("Verifier", func() {
+	const (
+		manifestDigest = "sha256:6f8c2a0d32b6df5fc8b5bad1d6b64e6e5ce0d6ae6c2e4cf9fbd0e3cd0ebf6c6a"
+		imageReference = "docker.io/library/busybox:latest"
+	)
+
+	var (
+		workDir      string
+		sigstorePath string
+		keyPath      string
+		signingKey   *openpgp.Entity
+		policy       signature.Policy
+		verifier     *signature.Verifier
+		logger       *lagertest.TestLogger
+		baseImageURL *url.URL
+	)
+
+	BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "signature")
+		Expect(err).NotTo(HaveOccurred())
+		sigstorePath = filepath.Join(workDir, "sigstore")
+		keyPath = filepath.Join(workDir, "key.gpg")
+		signingKey = testhelpers.NewSigningKey(keyPath)
+
+		policy = signature.Policy{
+			Default: []signature.Requirement{{Type: signature.TypeReject}},
+			Transports: map[string]map[string][]signature.Requirement{
+				"docker": {
+					"docker.io/library": {{Type: signature.TypeSignedBy, KeyType: signature.KeyTypeGPGKeys, KeyPath: keyPath}},
+				},
+			},
+		}
+
+		logger = lagertest.NewTestLogger("verifier")
+		baseImageURL, err = url.Parse("docker:///busybox")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workDir)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		verifier = signature.NewVerifier(policy, sigstorePath)
+	})
+
+	Context("when the image is signed by a trusted key", func() {
+		BeforeEach(func() {
+			testhelpers.WriteSignature(signingKey, sigstorePath, imageReference, manifestDigest, 1)
+		})
+
+		It("succeeds", func() {
+			Expect(verifier.Verify(logger, baseImageURL, manifestDigest)).To(Succeed())
+		})
+
+		Context("and the signature is not the first one", func() {
+			BeforeEach(func() {
+				otherKey := testhelpers.NewSigningKey(filepath.Join(workDir, "other.gpg"))
+				testhelpers.WriteSignature(otherKey, sigstorePath, imageReference, manifestDigest, 1)
+				testhelpers.WriteSignature(signingKey, sigstorePath, imageReference, manifestDigest, 2)
+			})
+
+			It("succeeds", func() {
+				Expect(verifier.Verify(logger, baseImageURL, manifestDigest)).To(Succeed())
+			})
+		})
+
+		Context("and the image is requested by digest", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse("docker:///busybox@" + manifestDigest)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("succeeds", func() {
+				Expect(verifier.Verify(logger, baseImageURL, manifestDigest)).To(Succeed())
+			})
+		})
+	})
+
+	Context("when the image is not signed", func() {
+		It("returns an unsigned error", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError("image `docker.io/library/busybox:latest` is not signed"))
+		})
+	})
+
+	Context("when the signature is made by an untrusted key", func() {
+		BeforeEach(func() {
+			otherKey := testhelpers.NewSigningKey(filepath.Join(workDir, "other.gpg"))
+			testhelpers.WriteSignature(otherKey, sigstorePath, imageReference, manifestDigest, 1)
+		})
+
+		It("returns an invalid signature error", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError(ContainSubstring("invalid signature for image `docker.io/library/busybox:latest`: signed by unknown key")))
+		})
+	})
+
+	Context("when the signature is for another manifest", func() {
+		BeforeEach(func() {
+			testhelpers.WriteSignature(signingKey, sigstorePath, imageReference, manifestDigest, 1)
+		})
+
+		It("returns an invalid signature error", func() {
+			otherDigest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+			Expect(os.Rename(
+				filepath.Join(sigstorePath, "library", "busybox@sha256=6f8c2a0d32b6df5fc8b5bad1d6b64e6e5ce0d6ae6c2e4cf9fbd0e3cd0ebf6c6a"),
+				filepath.Join(sigstorePath, "library", "busybox@sha256=1111111111111111111111111111111111111111111111111111111111111111"),
+			)).To(Succeed())
+
+			err := verifier.Verify(logger, baseImageURL, otherDigest)
+			Expect(err).To(MatchError(ContainSubstring("invalid signature for image `docker.io/library/busybox:latest`: signature is for manifest `" + manifestDigest + "`")))
+		})
+	})
+
+	Context("when the signature is for another image", func() {
+		BeforeEach(func() {
+			testhelpers.WriteSignature(signingKey, sigstorePath, imageReference, manifestDigest, 1)
+		})
+
+		It("returns an invalid signature error", func() {
+			var err error
+			baseImageURL, err = url.Parse("docker:///busybox:1.27")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError(ContainSubstring("signature is for image `docker.io/library/busybox:latest`")))
+		})
+	})
+
+	Context("when the signature has been tampered with", func() {
+		BeforeEach(func() {
+			testhelpers.WriteSignature(signingKey, sigstorePath, imageReference, manifestDigest, 1)
+
+			signaturePath := filepath.Join(sigstorePath, "library", "busybox@sha256=6f8c2a0d32b6df5fc8b5bad1d6b64e6e5ce0d6ae6c2e4cf9fbd0e3cd0ebf6c6a", "signature-1")
+			contents, err := ioutil.ReadFile(signaturePath)
+			Expect(err).NotTo(HaveOccurred())
+			contents[len(contents)-20] ^= 0xff
+			Expect(ioutil.WriteFile(signaturePath, contents, 0644)).To(Succeed())
+		})
+
+		It("returns an invalid signature error", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError(ContainSubstring("invalid signature for image `docker.io/library/busybox:latest`")))
+		})
+	})
+
+	Context("when the most specific scope accepts anything", func() {
+		BeforeEach(func() {
+			policy.Transports["docker"]["docker.io/library/busybox"] = []signature.Requirement{{Type: signature.TypeInsecureAcceptAnything}}
+		})
+
+		It("succeeds without a signature", func() {
+			Expect(verifier.Verify(logger, baseImageURL, manifestDigest)).To(Succeed())
+		})
+	})
+
+	Context("when no scope matches the image", func() {
+		BeforeEach(func() {
+			var err error
+			baseImageURL, err = url.Parse("docker://registry.example.com/busybox")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("applies the default requirements", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError("image `registry.example.com/busybox:latest` is rejected by the trust policy"))
+		})
+	})
+
+	Context("when the image is not a registry image", func() {
+		BeforeEach(func() {
+			var err error
+			baseImageURL, err = url.Parse("oci:///images/busybox:latest")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("applies the default requirements", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError("image `oci:///images/busybox:latest` is rejected by the trust policy"))
+		})
+
+		Context("when a scope of its transport accepts anything", func() {
+			BeforeEach(func() {
+				policy.Transports["oci"] = map[string][]signature.Requirement{
+					"/images": {{Type: signature.TypeInsecureAcceptAnything}},
+				}
+			})
+
+			It("succeeds", func() {
+				Expect(verifier.Verify(logger, baseImageURL, manifestDigest)).To(Succeed())
+			})
+		})
+
+		Context("when a scope of another transport accepts anything", func() {
+			BeforeEach(func() {
+				policy.Transports["oci-archive"] = map[string][]signature.Requirement{
+					"": {{Type: signature.TypeInsecureAcceptAnything}},
+				}
+			})
+
+			It("applies the default requirements", func() {
+				err := verifier.Verify(logger, baseImageURL, manifestDigest)
+				Expect(err).To(MatchError(ContainSubstring("is rejected by the trust policy")))
+			})
+		})
+
+		Context("when its scope requires a signature", func() {
+			BeforeEach(func() {
+				policy.Transports["oci"] = map[string][]signature.Requirement{
+					"/images/busybox": {{Type: signature.TypeSignedBy, KeyType: signature.KeyTypeGPGKeys, KeyPath: keyPath}},
+				}
+			})
+
+			It("returns an unsigned error", func() {
+				err := verifier.Verify(logger, baseImageURL, manifestDigest)
+				Expect(err).To(MatchError("image `oci:///images/busybox:latest` is not signed: only registry images can have signatures"))
+			})
+		})
+
+		Context("when it is a local tarball", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse("/images/busybox.tar")
+				Expect(err).NotTo(HaveOccurred())
+
+				policy.Transports["tar"] = map[string][]signature.Requirement{
+					"/images/busybox.tar": {{Type: signature.TypeInsecureAcceptAnything}},
+				}
+			})
+
+			It("uses the scopes of the tar transport", func() {
+				Expect(verifier.Verify(logger, baseImageURL, manifestDigest)).To(Succeed())
+			})
+		})
+	})
+
+	Context("when the matching scope has no requirements", func() {
+		BeforeEach(func() {
+			policy.Transports["docker"]["docker.io/library/busybox"] = []signature.Requirement{}
+		})
+
+		It("rejects the image", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError(ContainSubstring("is rejected by the trust policy")))
+		})
+	})
+
+	Context("when the trusted key file does not exist", func() {
+		BeforeEach(func() {
+			testhelpers.WriteSignature(signingKey, sigstorePath, imageReference, manifestDigest, 1)
+			Expect(os.Remove(keyPath)).To(Succeed())
+		})
+
+		It("returns an error", func() {
+			err := verifier.Verify(logger, baseImageURL, manifestDigest)
+			Expect(err).To(MatchError(ContainSubstring("reading trusted keys")))
+		})
+	})
+})
@@ -0,0 +1,106 @@
+package unpacker // import "code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"syscall"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"github.com/pkg/errors"
+)
+
+const (
+	DeviceNodesSkip      = "skip"
+	DeviceNodesCreate    = "create"
+	DeviceNodesAllowlist = "allowlist"
+)
+
+// DeviceNodePolicy decides which device entries of a layer are created. With
+// the allowlist mode, only the devices in Allowed (e.g. `c 1:3` for
+// /dev/null) are. Devices are never created in a user namespace, where mknod
+// is not permitted.
+type DeviceNodePolicy struct {
+	Mode    string
+	Allowed []string
+}
+
+func isWhiteoutDevice(tarHeader *tar.Header) bool {
+	return tarHeader.Typeflag == tar.TypeChar && tarHeader.Devmajor == 0 && tarHeader.Devminor == 0
+}
+
+func (u *TarUnpacker) deviceAllowed(tarHeader *tar.Header) bool {
+	if os.Getuid() != 0 || u.strategy.InUserNamespace {
+		return false
+	}
+
+	switch u.strategy.DeviceNodes.Mode {
+	case DeviceNodesCreate:
+		return true
+	case DeviceNodesAllowlist:
+		device := deviceName(tarHeader)
+		for _, allowed := range u.strategy.DeviceNodes.Allowed {
+			if allowed == device {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (u *TarUnpacker) createDevice(path string, tarHeader *tar.Header, spec base_image_puller.UnpackSpec) error {
+	if _, err := os.Lstat(path); err == nil {
+		if err := os.RemoveAll(path); err != nil {
+			return errors.Wrapf(err, "removing file `%s`", path)
+		}
+	}
+
+	mode := uint32(tarHeader.Mode & 07777)
+	if tarHeader.Typeflag == tar.TypeBlock {
+		mode |= syscall.S_IFBLK
+	} else {
+		mode |= syscall.S_IFCHR
+	}
+
+	if err := syscall.Mknod(path, mode, mkdev(tarHeader.Devmajor, tarHeader.Devminor)); err != nil {
+		return errors.Wrapf(err, "creating device `%s` (%s)", path, deviceName(tarHeader))
+	}
+
+	uid, gid, err := u.translateOwner(tarHeader, spec)
+	if err != nil {
+		return err
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		return errors.Wrapf(err, "chowning device %d:%d `%s`", uid, gid, path)
+	}
+
+	// we need to explicitly apply perms because mknod is subject to umask
+	if err := os.Chmod(path, tarHeader.FileInfo().Mode()); err != nil {
+		return errors.Wrapf(err, "chmoding device `%s`", path)
+	}
+
+	if err := u.setXattrs(path, tarHeader, spec); err != nil {
+		return err
+	}
+
+	if err := changeModTime(path, tarHeader.ModTime); err != nil {
+		return errors.Wrapf(err, "setting the modtime for device `%s`", path)
+	}
+
+	return nil
+}
+
+func deviceName(tarHeader *tar.Header) string {
+	kind := "c"
+	if tarHeader.Typeflag == tar.TypeBlock {
+		kind = "b"
+	}
+
+	return fmt.Sprintf("%s %d:%d", kind, tarHeader.Devmajor, tarHeader.Devminor)
+}
+
+// mkdev encodes a device number the way the kernel does for mknod
+func mkdev(major, minor int64) int {
+	return int((minor & 0xff) | ((major & 0xfff) << 8) | ((minor &^ 0xff) << 12))
+}
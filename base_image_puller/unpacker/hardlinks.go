@@ -0,0 +1,99 @@
+package unpacker // import "code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// parentLayers gives access to the volumes of the parent layers, closest
+// first, from inside the chroot where their paths can't be reached.
+type parentLayers []*os.File
+
+func openParentLayers(paths []string) (parentLayers, error) {
+	layers := parentLayers{}
+	for _, path := range paths {
+		dir, err := os.Open(path)
+		if err != nil {
+			layers.close()
+			return nil, errors.Wrapf(err, "opening parent volume `%s`", path)
+		}
+		layers = append(layers, dir)
+	}
+
+	return layers, nil
+}
+
+func (l parentLayers) close() {
+	for _, dir := range l {
+		_ = dir.Close()
+	}
+}
+
+// linkFromParentLayer handles hardlinks to files of a parent layer, which
+// are not in the volume when it is not a snapshot of its parent. The target
+// is copied up to this layer and linked to. When its directory is not in this
+// layer either, the target is copied to the link path instead.
+func (u *TarUnpacker) linkFromParentLayer(path, linkname string, layers parentLayers) error {
+	target, err := layers.open(linkname)
+	if err != nil {
+		return errors.Wrapf(err, "finding hardlink target `%s` in the parent layers", linkname)
+	}
+	defer target.Close()
+
+	if _, err := os.Stat(filepath.Dir(linkname)); err != nil {
+		return u.copyFile(target, path)
+	}
+
+	if err := u.copyFile(target, linkname); err != nil {
+		return err
+	}
+
+	return os.Link(linkname, path)
+}
+
+func (u *TarUnpacker) copyFile(source *os.File, path string) error {
+	info, err := source.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "reading `%s`", source.Name())
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return errors.Wrapf(err, "creating file `%s`", path)
+	}
+
+	if _, err := io.Copy(file, source); err != nil {
+		_ = file.Close()
+		return errors.Wrapf(err, "copying `%s` to `%s`", source.Name(), path)
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "closing file `%s`", path)
+	}
+
+	stat := info.Sys().(*syscall.Stat_t)
+	if os.Getuid() == 0 {
+		if err := os.Chown(path, int(stat.Uid), int(stat.Gid)); err != nil {
+			return errors.Wrapf(err, "chowning file %d:%d `%s`", stat.Uid, stat.Gid, path)
+		}
+	}
+
+	// chown drops the setuid and setgid bits, so the mode is set afterwards
+	if err := os.Chmod(path, info.Mode()); err != nil {
+		return errors.Wrapf(err, "chmoding file `%s`", path)
+	}
+
+	if err := u.copyXattrs(source, path); err != nil {
+		return err
+	}
+
+	if err := changeModTime(path, info.ModTime()); err != nil {
+		return errors.Wrapf(err, "setting the modtime for file `%s`", path)
+	}
+
+	return nil
+}
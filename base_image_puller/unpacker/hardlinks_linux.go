@@ -0,0 +1,177 @@
+// +build linux
+
+package unpacker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/pkg/system"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const opaqueXattr = "trusted.overlay.opaque"
+
+// open returns the file from the closest layer that has it. A whiteout, or an
+// opaque directory, in a closer layer hides the file in the layers below.
+func (l parentLayers) open(name string) (*os.File, error) {
+	components := strings.Split(strings.TrimPrefix(filepath.Clean("/"+name), "/"), "/")
+
+	for _, dir := range l {
+		file, hidden, err := openInLayer(dir, components, name)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			return file, nil
+		}
+		if hidden {
+			break
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// openInLayer looks the file up one path component at a time, so that it
+// can't be reached through a symlink: the layer directories were opened
+// before the chroot, and a symlink could lead anywhere on the host. hidden is
+// set when the file is not in the layer and the layer hides it in the layers
+// below.
+func openInLayer(layer *os.File, components []string, name string) (file *os.File, hidden bool, err error) {
+	dirFd, err := syscall.Dup(int(layer.Fd()))
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = syscall.Close(dirFd) }()
+
+	opaque := false
+	for i, component := range components {
+		var stat syscall.Stat_t
+		err := syscall.Fstatat(dirFd, component, &stat, atSymlinkNoFollow)
+		if err == syscall.ENOENT {
+			return nil, opaque, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch stat.Mode & syscall.S_IFMT {
+		case syscall.S_IFCHR:
+			if stat.Rdev == 0 {
+				return nil, true, nil
+			}
+		case syscall.S_IFLNK:
+			return nil, false, errors.Errorf("`%s` goes through the symlink `%s`", name, filepath.Join(components[:i+1]...))
+		}
+
+		if i == len(components)-1 {
+			if stat.Mode&syscall.S_IFMT != syscall.S_IFREG {
+				return nil, false, errors.Errorf("`%s` is not a regular file", name)
+			}
+
+			fd, err := syscall.Openat(dirFd, component, syscall.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+			if err != nil {
+				return nil, false, err
+			}
+			return os.NewFile(uintptr(fd), name), false, nil
+		}
+
+		// anything but a directory hides the directories of the layers below
+		if stat.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+			return nil, true, nil
+		}
+
+		nextFd, err := syscall.Openat(dirFd, component, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, false, err
+		}
+		_ = syscall.Close(dirFd)
+		dirFd = nextFd
+
+		if isOpaqueDir(dirFd) {
+			opaque = true
+		}
+	}
+
+	return nil, opaque, nil
+}
+
+func isOpaqueDir(fd int) bool {
+	value := make([]byte, 1)
+	size, err := unix.Fgetxattr(fd, opaqueXattr, value)
+	return err == nil && size == 1 && value[0] == 'y'
+}
+
+// copyXattrs copies the xattrs that were kept when the file was unpacked in
+// its parent layer. Its capabilities were translated for the same id
+// mappings then, so they are copied as they are.
+func (u *TarUnpacker) copyXattrs(source *os.File, path string) error {
+	fd := int(source.Fd())
+
+	names, err := listXattrs(fd)
+	if err != nil {
+		return errors.Wrapf(err, "listing xattrs of `%s`", source.Name())
+	}
+
+	for _, name := range names {
+		if name == capabilityXattr {
+			if os.Getuid() != 0 {
+				continue
+			}
+		} else if !u.xattrAllowed(name) {
+			continue
+		}
+
+		value, err := getXattr(fd, name)
+		if err != nil {
+			return errors.Wrapf(err, "reading xattr `%s` of `%s`", name, source.Name())
+		}
+
+		if err := system.Lsetxattr(path, name, value, 0); err != nil {
+			return errors.Wrapf(err, "setting xattr `%s` on `%s`", name, path)
+		}
+	}
+
+	return nil
+}
+
+func listXattrs(fd int) ([]string, error) {
+	size, err := unix.Flistxattr(fd, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buffer := make([]byte, size)
+	size, err = unix.Flistxattr(fd, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(string(buffer[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func getXattr(fd int, name string) ([]byte, error) {
+	size, err := unix.Fgetxattr(fd, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, size)
+	size, err = unix.Fgetxattr(fd, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value[:size], nil
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package unpacker
+
+import "os"
+
+func (l parentLayers) open(name string) (*os.File, error) {
+	return nil, os.ErrNotExist
+}
+
+func (u *TarUnpacker) copyXattrs(source *os.File, path string) error {
+	return nil
+}
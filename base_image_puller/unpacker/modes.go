@@ -0,0 +1,69 @@
+package unpacker // import "code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
+
+import (
+	"archive/tar"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"github.com/pkg/errors"
+)
+
+const (
+	FileModesKeep     = "keep"
+	FileModesSanitize = "sanitize"
+	FileModesReject   = "reject"
+
+	setIDBits         = 06000
+	worldWritableBits = 02
+)
+
+// FileModePolicy decides what happens to the setuid and setgid bits of files
+// and directories, and to their world-writable bit outside of /tmp. The bits
+// are either kept (the default), removed by `sanitize`, or make the unpack
+// fail with `reject`.
+type FileModePolicy struct {
+	SetID         string
+	WorldWritable string
+}
+
+// applyFileModePolicy changes the mode in the header of the entry according
+// to the policy, and returns the change it made, if any.
+func (u *TarUnpacker) applyFileModePolicy(path string, tarHeader *tar.Header) (*base_image_puller.ModeChange, error) {
+	oldMode := tarHeader.FileInfo().Mode()
+	mode := tarHeader.Mode
+
+	if mode&setIDBits != 0 {
+		switch u.strategy.FileModes.SetID {
+		case FileModesSanitize:
+			mode &^= setIDBits
+		case FileModesReject:
+			return nil, errors.Errorf("`%s` has the setuid or setgid bit set, which the file mode policy rejects", path)
+		}
+	}
+
+	if mode&worldWritableBits != 0 && !isTmpPath(path) {
+		switch u.strategy.FileModes.WorldWritable {
+		case FileModesSanitize:
+			mode &^= worldWritableBits
+		case FileModesReject:
+			return nil, errors.Errorf("`%s` is world-writable, which the file mode policy rejects", path)
+		}
+	}
+
+	if mode == tarHeader.Mode {
+		return nil, nil
+	}
+
+	tarHeader.Mode = mode
+	return &base_image_puller.ModeChange{
+		Path:    path,
+		OldMode: oldMode,
+		NewMode: tarHeader.FileInfo().Mode(),
+	}, nil
+}
+
+func isTmpPath(path string) bool {
+	path = filepath.Join("/", path)
+	return path == "/tmp" || strings.HasPrefix(path, "/tmp/")
+}
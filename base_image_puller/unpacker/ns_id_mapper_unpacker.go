@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"syscall"
 
 	"code.cloudfoundry.org/commandrunner"
@@ -43,7 +45,7 @@ func init() {
 		logger := lager.NewLogger("unpack")
 		logger.RegisterSink(lager.NewWriterSink(os.Stderr, lager.DEBUG))
 
-		if len(os.Args) != 4 {
+		if len(os.Args) != 5 {
 			fail(logger, "parsing-command", errorspkg.New("destination directory or filesystem were not specified"))
 		}
 
@@ -59,12 +61,30 @@ func init() {
 		targetDir := os.Args[1]
 		baseDirectory := os.Args[2]
 		unpackStrategyJSON := os.Args[3]
+		parentPathsJSON := os.Args[4]
 
 		var unpackStrategy UnpackStrategy
 		if err = json.Unmarshal([]byte(unpackStrategyJSON), &unpackStrategy); err != nil {
 			fail(logger, "unmarshal-unpack-strategy-failed", err)
 		}
 
+		var parentPaths []string
+		if err = json.Unmarshal([]byte(parentPathsJSON), &parentPaths); err != nil {
+			fail(logger, "unmarshal-parent-paths-failed", err)
+		}
+
+		// the ids are already mapped by the user namespace, but the tar
+		// unpacker still needs to know which ones are in it
+		var uidMappings, gidMappings []groot.IDMappingSpec
+		if unpackStrategy.InUserNamespace {
+			if uidMappings, err = namespaceIDMappings("/proc/self/uid_map"); err != nil {
+				fail(logger, "reading-uid-map-failed", err)
+			}
+			if gidMappings, err = namespaceIDMappings("/proc/self/gid_map"); err != nil {
+				fail(logger, "reading-gid-map-failed", err)
+			}
+		}
+
 		unpacker, err := NewTarUnpacker(unpackStrategy)
 		if err != nil {
 			fail(logger, "creating-tar-unpacker", err)
@@ -75,6 +95,9 @@ func init() {
 			Stream:        os.Stdin,
 			TargetPath:    targetDir,
 			BaseDirectory: baseDirectory,
+			ParentPaths:   parentPaths,
+			UIDMappings:   uidMappings,
+			GIDMappings:   gidMappings,
 		}); err != nil {
 			fail(logger, "unpacking-failed", err)
 		}
@@ -98,20 +121,32 @@ func (u *NSIdMapperUnpacker) Unpack(logger lager.Logger, spec base_image_puller.
 	logger.Debug("starting")
 	defer logger.Debug("ending")
 
+	if err := validateIDMappings(spec); err != nil {
+		return base_image_puller.UnpackOutput{}, err
+	}
+
 	ctrlPipeR, ctrlPipeW, err := os.Pipe()
 	if err != nil {
 		return base_image_puller.UnpackOutput{}, errorspkg.Wrap(err, "creating tar control pipe")
 	}
 
-	unpackStrategyJSON, err := json.Marshal(&u.unpackStrategy)
+	unpackStrategy := u.unpackStrategy
+	unpackStrategy.InUserNamespace = len(spec.UIDMappings) > 0 || len(spec.GIDMappings) > 0
+
+	unpackStrategyJSON, err := json.Marshal(&unpackStrategy)
 	if err != nil {
 		logger.Error("unmarshal-unpack-strategy-failed", err)
 		return base_image_puller.UnpackOutput{}, errorspkg.Wrap(err, "unmarshal unpack strategy")
 	}
 
-	unpackCmd := reexec.Command("unpack", spec.TargetPath, spec.BaseDirectory, string(unpackStrategyJSON))
+	parentPathsJSON, err := json.Marshal(spec.ParentPaths)
+	if err != nil {
+		return base_image_puller.UnpackOutput{}, errorspkg.Wrap(err, "marshal parent paths")
+	}
+
+	unpackCmd := reexec.Command("unpack", spec.TargetPath, spec.BaseDirectory, string(unpackStrategyJSON), string(parentPathsJSON))
 	unpackCmd.Stdin = spec.Stream
-	if len(spec.UIDMappings) > 0 || len(spec.GIDMappings) > 0 {
+	if unpackStrategy.InUserNamespace {
 		unpackCmd.SysProcAttr = &syscall.SysProcAttr{
 			Cloneflags: syscall.CLONE_NEWUSER,
 		}
@@ -173,3 +208,31 @@ func (u *NSIdMapperUnpacker) setIDMappings(logger lager.Logger, spec base_image_
 
 	return nil
 }
+
+// namespaceIDMappings reads the ranges of a uid_map or gid_map file as
+// mappings of the namespace ids to themselves.
+func namespaceIDMappings(path string) ([]groot.IDMappingSpec, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errorspkg.Wrapf(err, "reading `%s`", path)
+	}
+
+	mappings := []groot.IDMappingSpec{}
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var namespaceID, parentID, size int
+		if _, err := fmt.Sscan(line, &namespaceID, &parentID, &size); err != nil {
+			return nil, errorspkg.Wrapf(err, "parsing `%s`", path)
+		}
+		mappings = append(mappings, groot.IDMappingSpec{
+			HostID:      namespaceID,
+			NamespaceID: namespaceID,
+			Size:        size,
+		})
+	}
+
+	return mappings, nil
+}
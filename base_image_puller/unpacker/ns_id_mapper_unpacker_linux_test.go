@@ -75,10 +75,11 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 		Expect(os.RemoveAll(imagePath)).To(Succeed())
 	})
 
-	It("passes the rootfs path, base-directory and filesystem to the unpack command", func() {
+	It("passes the rootfs path, base-directory, filesystem and parent paths to the unpack command", func() {
 		_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
 			TargetPath:    targetPath,
 			BaseDirectory: "/base-folder/",
+			ParentPaths:   []string{"/volumes/parent", "/volumes/grandparent"},
 		})
 		Expect(err).NotTo(HaveOccurred())
 
@@ -89,7 +90,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 		Expect(commands).To(HaveLen(1))
 		Expect(commands[0].Path).To(Equal("/proc/self/exe"))
 		Expect(commands[0].Args).To(Equal([]string{
-			"unpack", targetPath, "/base-folder/", string(unpackStrategyJson),
+			"unpack", targetPath, "/base-folder/", string(unpackStrategyJson), `["/volumes/parent","/volumes/grandparent"]`,
 		}))
 	})
 
@@ -126,7 +127,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 	It("starts the unpack command in a user namespace", func() {
 		_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
 			UIDMappings: []groot.IDMappingSpec{
-				{HostID: 1000, NamespaceID: 2000, Size: 10},
+				{HostID: 1000, NamespaceID: 0, Size: 10},
 			},
 			TargetPath: targetPath,
 		})
@@ -206,7 +207,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 			_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
 				TargetPath: targetPath,
 				UIDMappings: []groot.IDMappingSpec{
-					{HostID: 1000, NamespaceID: 2000, Size: 10},
+					{HostID: 1000, NamespaceID: 0, Size: 10},
 				},
 			})
 			Expect(err).NotTo(HaveOccurred())
@@ -215,10 +216,26 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 			_, _, mappings := fakeIDMapper.MapUIDsArgsForCall(0)
 
 			Expect(mappings).To(Equal([]groot.IDMappingSpec{
-				{HostID: 1000, NamespaceID: 2000, Size: 10},
+				{HostID: 1000, NamespaceID: 0, Size: 10},
 			}))
 		})
 
+		It("tells the unpack command that it runs in a user namespace", func() {
+			_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
+				TargetPath: targetPath,
+				UIDMappings: []groot.IDMappingSpec{
+					{HostID: 1000, NamespaceID: 0, Size: 10},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var usedStrategy unpackerpkg.UnpackStrategy
+			commands := fakeCommandRunner.StartedCommands()
+			Expect(commands).To(HaveLen(1))
+			Expect(json.Unmarshal([]byte(commands[0].Args[3]), &usedStrategy)).To(Succeed())
+			Expect(usedStrategy.InUserNamespace).To(BeTrue())
+		})
+
 		Context("when applying the mappings fails", func() {
 			BeforeEach(func() {
 				fakeIDMapper.MapUIDsReturns(errors.New("Boom!"))
@@ -228,7 +245,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 				_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
 					TargetPath: targetPath,
 					UIDMappings: []groot.IDMappingSpec{
-						{HostID: 1000, NamespaceID: 2000, Size: 10},
+						{HostID: 1000, NamespaceID: 0, Size: 10},
 					},
 				})
 				Expect(err).To(HaveOccurred())
@@ -240,6 +257,20 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
+
+		Context("when the mappings leave a gap", func() {
+			It("returns an error without starting the unpack command", func() {
+				_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					TargetPath: targetPath,
+					UIDMappings: []groot.IDMappingSpec{
+						{HostID: 1000, NamespaceID: 0, Size: 1},
+						{HostID: 100000, NamespaceID: 2, Size: 10},
+					},
+				})
+				Expect(err).To(MatchError("invalid uid mappings: id mappings do not cover namespace ids 1 to 1"))
+				Expect(fakeCommandRunner.StartedCommands()).To(BeEmpty())
+			})
+		})
 	})
 
 	Describe("GIDMappings", func() {
@@ -247,7 +278,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 			_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
 				TargetPath: targetPath,
 				GIDMappings: []groot.IDMappingSpec{
-					{HostID: 1000, NamespaceID: 2000, Size: 10},
+					{HostID: 1000, NamespaceID: 0, Size: 10},
 				},
 			})
 			Expect(err).NotTo(HaveOccurred())
@@ -256,7 +287,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 			_, _, mappings := fakeIDMapper.MapGIDsArgsForCall(0)
 
 			Expect(mappings).To(Equal([]groot.IDMappingSpec{
-				{HostID: 1000, NamespaceID: 2000, Size: 10},
+				{HostID: 1000, NamespaceID: 0, Size: 10},
 			}))
 		})
 
@@ -269,7 +300,7 @@ var _ = Describe("NSIdMapperUnpacker", func() {
 				_, err := unpacker.Unpack(logger, base_image_puller.UnpackSpec{
 					TargetPath: targetPath,
 					GIDMappings: []groot.IDMappingSpec{
-						{HostID: 1000, NamespaceID: 2000, Size: 10},
+						{HostID: 1000, NamespaceID: 0, Size: 10},
 					},
 				})
 				Expect(err).To(HaveOccurred())
@@ -70,6 +70,13 @@ func init() {
 type UnpackStrategy struct {
 	Name               string
 	WhiteoutDevicePath string
+	// XattrAllowlist lists the extended attributes, other than file
+	// capabilities, that are applied. Entries ending in `*` are prefixes.
+	XattrAllowlist []string
+	// InUserNamespace is set when unpacking as the root of a user namespace
+	InUserNamespace bool
+	DeviceNodes     DeviceNodePolicy
+	FileModes       FileModePolicy
 }
 
 type TarUnpacker struct {
@@ -112,7 +119,7 @@ type overlayWhiteoutHandler struct {
 }
 
 func (h *overlayWhiteoutHandler) removeWhiteout(path string) error {
-	toBeDeletedPath := strings.Replace(path, ".wh.", "", 1)
+	toBeDeletedPath := whiteoutTarget(path)
 	if err := os.RemoveAll(toBeDeletedPath); err != nil {
 		return errors.Wrap(err, "deleting  file")
 	}
@@ -148,10 +155,17 @@ func (h *overlayWhiteoutHandler) removeWhiteout(path string) error {
 	return nil
 }
 
+// whiteoutTarget returns the path that a whiteout entry deletes. Only the
+// `.wh.` prefix of the file name is stripped, so directories that happen to
+// contain it are left alone. 0/0 character devices have no prefix.
+func whiteoutTarget(path string) string {
+	return filepath.Join(filepath.Dir(path), strings.TrimPrefix(filepath.Base(path), ".wh."))
+}
+
 type defaultWhiteoutHandler struct{}
 
 func (*defaultWhiteoutHandler) removeWhiteout(path string) error {
-	toBeDeletedPath := strings.Replace(path, ".wh.", "", 1)
+	toBeDeletedPath := whiteoutTarget(path)
 	if err := os.RemoveAll(toBeDeletedPath); err != nil {
 		return errors.Wrap(err, "deleting whiteout file")
 	}
@@ -195,10 +209,20 @@ func (u *TarUnpacker) unpack(logger lager.Logger, spec base_image_puller.UnpackS
 	logger.Info("starting")
 	defer logger.Info("ending")
 
+	if err := validateIDMappings(spec); err != nil {
+		return base_image_puller.UnpackOutput{}, err
+	}
+
 	if err := safeMkdir(spec.TargetPath, 0755); err != nil {
 		return base_image_puller.UnpackOutput{}, err
 	}
 
+	parents, err := openParentLayers(spec.ParentPaths)
+	if err != nil {
+		return base_image_puller.UnpackOutput{}, err
+	}
+	defer parents.close()
+
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	if err := chroot(spec.TargetPath); err != nil {
@@ -207,6 +231,7 @@ func (u *TarUnpacker) unpack(logger lager.Logger, spec base_image_puller.UnpackS
 
 	tarReader := tar.NewReader(spec.Stream)
 	opaqueWhiteouts := []string{}
+	var modeChanges []base_image_puller.ModeChange
 	var totalBytesUnpacked int64
 	for {
 		tarHeader, err := tarReader.Next()
@@ -218,19 +243,31 @@ func (u *TarUnpacker) unpack(logger lager.Logger, spec base_image_puller.UnpackS
 
 		entryPath := filepath.Join(spec.BaseDirectory, tarHeader.Name)
 
-		if strings.Contains(tarHeader.Name, ".wh..wh..opq") {
+		entryName := filepath.Base(tarHeader.Name)
+		if entryName == ".wh..wh..opq" {
 			opaqueWhiteouts = append(opaqueWhiteouts, entryPath)
 			continue
 		}
 
-		if strings.Contains(tarHeader.Name, ".wh.") {
+		if strings.HasPrefix(entryName, ".wh.") {
 			if err := u.whiteoutHandler.removeWhiteout(entryPath); err != nil {
 				return base_image_puller.UnpackOutput{}, err
 			}
 			continue
 		}
 
-		entrySize, err := u.handleEntry(entryPath, tarReader, tarHeader, spec)
+		switch tarHeader.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeRegA:
+			modeChange, err := u.applyFileModePolicy(entryPath, tarHeader)
+			if err != nil {
+				return base_image_puller.UnpackOutput{}, err
+			}
+			if modeChange != nil {
+				modeChanges = append(modeChanges, *modeChange)
+			}
+		}
+
+		entrySize, err := u.handleEntry(entryPath, tarReader, tarHeader, spec, parents)
 		if err != nil {
 			return base_image_puller.UnpackOutput{}, err
 		}
@@ -241,17 +278,27 @@ func (u *TarUnpacker) unpack(logger lager.Logger, spec base_image_puller.UnpackS
 	return base_image_puller.UnpackOutput{
 		BytesWritten:    totalBytesUnpacked,
 		OpaqueWhiteouts: opaqueWhiteouts,
+		ModeChanges:     modeChanges,
 	}, nil
 }
 
-func (u *TarUnpacker) handleEntry(entryPath string, tarReader *tar.Reader, tarHeader *tar.Header, spec base_image_puller.UnpackSpec) (entrySize int64, err error) {
+func (u *TarUnpacker) handleEntry(entryPath string, tarReader *tar.Reader, tarHeader *tar.Header, spec base_image_puller.UnpackSpec, parents parentLayers) (entrySize int64, err error) {
 	switch tarHeader.Typeflag {
 	case tar.TypeBlock, tar.TypeChar:
-		// ignore devices
-		return 0, nil
+		if isWhiteoutDevice(tarHeader) {
+			return 0, u.whiteoutHandler.removeWhiteout(entryPath)
+		}
+
+		if !u.deviceAllowed(tarHeader) {
+			return 0, nil
+		}
+
+		if err = u.createDevice(entryPath, tarHeader, spec); err != nil {
+			return 0, err
+		}
 
 	case tar.TypeLink:
-		if err = u.createLink(entryPath, tarHeader); err != nil {
+		if err = u.createLink(entryPath, tarHeader, parents); err != nil {
 			return 0, err
 		}
 
@@ -289,8 +336,10 @@ func (u *TarUnpacker) createDirectory(path string, tarHeader *tar.Header, spec b
 	}
 
 	if os.Getuid() == 0 {
-		uid := u.translateID(tarHeader.Uid, spec.UIDMappings)
-		gid := u.translateID(tarHeader.Gid, spec.GIDMappings)
+		uid, gid, err := u.translateOwner(tarHeader, spec)
+		if err != nil {
+			return err
+		}
 		if err := os.Chown(path, uid, gid); err != nil {
 			return errors.Wrapf(err, "chowning directory %d:%d `%s`", uid, gid, path)
 		}
@@ -301,6 +350,10 @@ func (u *TarUnpacker) createDirectory(path string, tarHeader *tar.Header, spec b
 		return errors.Wrapf(err, "chmoding directory `%s`", path)
 	}
 
+	if err := u.setXattrs(path, tarHeader, spec); err != nil {
+		return err
+	}
+
 	if err := changeModTime(path, tarHeader.ModTime); err != nil {
 		return errors.Wrapf(err, "setting the modtime for directory `%s`: %s", path)
 	}
@@ -324,19 +377,26 @@ func (u *TarUnpacker) createSymlink(path string, tarHeader *tar.Header, spec bas
 	}
 
 	if os.Getuid() == 0 {
-		uid := u.translateID(tarHeader.Uid, spec.UIDMappings)
-		gid := u.translateID(tarHeader.Gid, spec.GIDMappings)
+		uid, gid, err := u.translateOwner(tarHeader, spec)
+		if err != nil {
+			return err
+		}
 
 		if err := os.Lchown(path, uid, gid); err != nil {
 			return errors.Wrapf(err, "chowning link %d:%d `%s`", uid, gid, path)
 		}
 	}
 
-	return nil
+	return u.setXattrs(path, tarHeader, spec)
 }
 
-func (u *TarUnpacker) createLink(path string, tarHeader *tar.Header) error {
-	return os.Link(tarHeader.Linkname, path)
+func (u *TarUnpacker) createLink(path string, tarHeader *tar.Header, parents parentLayers) error {
+	err := os.Link(tarHeader.Linkname, path)
+	if os.IsNotExist(err) && len(parents) > 0 {
+		return u.linkFromParentLayer(path, tarHeader.Linkname, parents)
+	}
+
+	return err
 }
 
 func (u *TarUnpacker) createRegularFile(path string, tarHeader *tar.Header, tarReader *tar.Reader, spec base_image_puller.UnpackSpec) (int64, error) {
@@ -363,8 +423,10 @@ func (u *TarUnpacker) createRegularFile(path string, tarHeader *tar.Header, tarR
 	}
 
 	if os.Getuid() == 0 {
-		uid := u.translateID(tarHeader.Uid, spec.UIDMappings)
-		gid := u.translateID(tarHeader.Gid, spec.GIDMappings)
+		uid, gid, err := u.translateOwner(tarHeader, spec)
+		if err != nil {
+			return 0, err
+		}
 		if err := os.Chown(path, uid, gid); err != nil {
 			return 0, errors.Wrapf(err, "chowning file %d:%d `%s`", uid, gid, path)
 		}
@@ -375,6 +437,11 @@ func (u *TarUnpacker) createRegularFile(path string, tarHeader *tar.Header, tarR
 		return 0, errors.Wrapf(err, "chmoding file `%s`", path)
 	}
 
+	// chowning drops file capabilities, so xattrs are set afterwards
+	if err := u.setXattrs(path, tarHeader, spec); err != nil {
+		return 0, err
+	}
+
 	if err := changeModTime(path, tarHeader.ModTime); err != nil {
 		return 0, errors.Wrapf(err, "setting the modtime for file `%s`", path)
 	}
@@ -397,32 +464,30 @@ func cleanWhiteoutDir(path string) error {
 	return nil
 }
 
-func (u *TarUnpacker) translateID(id int, mappings []groot.IDMappingSpec) int {
-	if id == 0 {
-		return u.translateRootID(mappings)
+func validateIDMappings(spec base_image_puller.UnpackSpec) error {
+	if _, err := groot.NewIDMap(spec.UIDMappings); err != nil {
+		return errors.Wrap(err, "invalid uid mappings")
 	}
 
-	for _, mapping := range mappings {
-		if mapping.Size == 1 {
-			continue
-		}
-
-		if id >= mapping.NamespaceID && id < mapping.NamespaceID+mapping.Size {
-			return mapping.HostID + id - 1
-		}
+	if _, err := groot.NewIDMap(spec.GIDMappings); err != nil {
+		return errors.Wrap(err, "invalid gid mappings")
 	}
 
-	return id
+	return nil
 }
 
-func (u *TarUnpacker) translateRootID(mappings []groot.IDMappingSpec) int {
-	for _, mapping := range mappings {
-		if mapping.Size == 1 {
-			return mapping.HostID
-		}
+func (u *TarUnpacker) translateOwner(tarHeader *tar.Header, spec base_image_puller.UnpackSpec) (int, int, error) {
+	uid, err := groot.IDMap(spec.UIDMappings).HostID(tarHeader.Uid)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "translating the uid of `%s`", tarHeader.Name)
+	}
+
+	gid, err := groot.IDMap(spec.GIDMappings).HostID(tarHeader.Gid)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "translating the gid of `%s`", tarHeader.Name)
 	}
 
-	return 0
+	return uid, gid, nil
 }
 
 func chroot(path string) error {
@@ -1,16 +1,21 @@
 package unpacker_test
 
 import (
+	"archive/tar"
+	"encoding/binary"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/grootfs/base_image_puller"
 	"code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
+	"code.cloudfoundry.org/grootfs/groot"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/docker/docker/pkg/system"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
@@ -67,6 +72,114 @@ var _ = Describe("Tar unpacker - Linux tests", func() {
 			filePath := path.Join(targetPath, "a_device")
 			Expect(filePath).ToNot(BeAnExistingFile())
 		})
+
+		Context("when the policy is to create them", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:        "btrfs",
+					DeviceNodes: unpacker.DeviceNodePolicy{Mode: unpacker.DeviceNodesCreate},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("creates them", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				stat, err := os.Stat(path.Join(targetPath, "a_device"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stat.Mode() & os.ModeCharDevice).NotTo(BeZero())
+				Expect(stat.Sys().(*syscall.Stat_t).Rdev).To(Equal(uint64(1<<8 | 8)))
+			})
+		})
+
+		Context("when the policy is an allowlist", func() {
+			var allowed []string
+
+			JustBeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:        "btrfs",
+					DeviceNodes: unpacker.DeviceNodePolicy{Mode: unpacker.DeviceNodesAllowlist, Allowed: allowed},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			Context("when the device is allowed", func() {
+				BeforeEach(func() {
+					allowed = []string{"c 1:3", "c 1:8"}
+				})
+
+				It("creates it", func() {
+					_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+						Stream:     stream,
+						TargetPath: targetPath,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(path.Join(targetPath, "a_device")).To(BeAnExistingFile())
+				})
+			})
+
+			Context("when the device is not allowed", func() {
+				BeforeEach(func() {
+					allowed = []string{"c 1:3"}
+				})
+
+				It("excludes it", func() {
+					_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+						Stream:     stream,
+						TargetPath: targetPath,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(path.Join(targetPath, "a_device")).NotTo(BeAnExistingFile())
+				})
+			})
+		})
+	})
+
+	Describe("0/0 character devices", func() {
+		BeforeEach(func() {
+			Expect(exec.Command("sudo", "mknod", path.Join(baseImagePath, "deleted_file"), "c", "0", "0").Run()).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(targetPath, "deleted_file"), []byte("hello-world"), 0600)).To(Succeed())
+		})
+
+		It("treats them as whiteouts", func() {
+			_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+				Stream:     stream,
+				TargetPath: targetPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(path.Join(targetPath, "deleted_file")).NotTo(BeAnExistingFile())
+		})
+
+		Context("when their parent directory name contains `.wh.`", func() {
+			BeforeEach(func() {
+				Expect(os.Mkdir(path.Join(baseImagePath, "a.wh.dir"), 0755)).To(Succeed())
+				Expect(exec.Command("sudo", "mknod", path.Join(baseImagePath, "a.wh.dir", "deleted_file"), "c", "0", "0").Run()).To(Succeed())
+				Expect(os.Mkdir(path.Join(targetPath, "a.wh.dir"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(targetPath, "a.wh.dir", "deleted_file"), []byte("hello-world"), 0600)).To(Succeed())
+				Expect(os.Mkdir(path.Join(targetPath, "adir"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(targetPath, "adir", "deleted_file"), []byte("hello-world"), 0600)).To(Succeed())
+			})
+
+			It("only deletes the file in that directory", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(path.Join(targetPath, "a.wh.dir", "deleted_file")).NotTo(BeAnExistingFile())
+				Expect(path.Join(targetPath, "adir", "deleted_file")).To(BeAnExistingFile())
+			})
+		})
 	})
 
 	Describe("modification time", func() {
@@ -112,4 +225,332 @@ var _ = Describe("Tar unpacker - Linux tests", func() {
 			Expect(symlinkFi.ModTime().Unix()).To(Equal(symlinkModTime.Unix()))
 		})
 	})
+
+	Describe("extended attributes", func() {
+		var (
+			capability []byte
+			xattrs     map[string]string
+		)
+
+		BeforeEach(func() {
+			// cap_net_raw+ep
+			capability = make([]byte, 20)
+			binary.LittleEndian.PutUint32(capability, 0x02000001)
+			binary.LittleEndian.PutUint32(capability[4:], 1<<13)
+
+			xattrs = map[string]string{
+				"security.capability":    string(capability),
+				"user.grootfs":           "groot",
+				"trusted.overlay.opaque": "y",
+			}
+		})
+
+		JustBeforeEach(func() {
+			stream = gbytes.NewBuffer()
+			tarWriter := tar.NewWriter(stream)
+			Expect(tarWriter.WriteHeader(&tar.Header{
+				Name:     "ping",
+				Typeflag: tar.TypeReg,
+				Mode:     0755,
+				Size:     4,
+				Xattrs:   xattrs,
+			})).To(Succeed())
+			_, err := tarWriter.Write([]byte("ping"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tarWriter.Close()).To(Succeed())
+		})
+
+		getXattr := func(name string) []byte {
+			value, err := system.Lgetxattr(path.Join(targetPath, "ping"), name)
+			Expect(err).NotTo(HaveOccurred())
+			return value
+		}
+
+		It("keeps the file capabilities", func() {
+			_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+				Stream:     stream,
+				TargetPath: targetPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(getXattr("security.capability")).To(Equal(capability))
+		})
+
+		It("does not apply other xattrs by default", func() {
+			_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+				Stream:     stream,
+				TargetPath: targetPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(getXattr("user.grootfs")).To(BeNil())
+		})
+
+		Context("when the xattrs are in the allowlist", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:           "btrfs",
+					XattrAllowlist: []string{"user.*", "trusted.*"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("applies them", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(getXattr("user.grootfs"))).To(Equal("groot"))
+			})
+
+			It("never applies the overlay xattrs", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(getXattr("trusted.overlay.opaque")).To(BeNil())
+			})
+		})
+
+		Context("when id mappings are provided", func() {
+			It("rewrites the capabilities for the mapped root", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+					UIDMappings: []groot.IDMappingSpec{
+						groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
+						groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				v3Capability := getXattr("security.capability")
+				Expect(v3Capability).To(HaveLen(24))
+				Expect(binary.LittleEndian.Uint32(v3Capability)).To(Equal(uint32(0x03000001)))
+				Expect(v3Capability[4:20]).To(Equal(capability[4:20]))
+				Expect(binary.LittleEndian.Uint32(v3Capability[20:])).To(Equal(uint32(1000)))
+			})
+		})
+
+		Context("when the capabilities are malformed", func() {
+			BeforeEach(func() {
+				xattrs["security.capability"] = "bad"
+			})
+
+			It("returns an error", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).To(MatchError(ContainSubstring("capability is too short")))
+			})
+		})
+
+		Context("when the entry is a symlink", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:           "btrfs",
+					XattrAllowlist: []string{"user.*", "trusted.*"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				xattrs["trusted.grootfs"] = "groot"
+			})
+
+			JustBeforeEach(func() {
+				stream = gbytes.NewBuffer()
+				tarWriter := tar.NewWriter(stream)
+				Expect(tarWriter.WriteHeader(&tar.Header{
+					Name:     "ping",
+					Typeflag: tar.TypeSymlink,
+					Linkname: "pong",
+					Xattrs:   xattrs,
+				})).To(Succeed())
+				Expect(tarWriter.Close()).To(Succeed())
+			})
+
+			It("applies the xattrs that symlinks support to the link itself", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(getXattr("trusted.grootfs"))).To(Equal("groot"))
+				Expect(getXattr("user.grootfs")).To(BeNil())
+				Expect(getXattr("security.capability")).To(BeNil())
+			})
+		})
+	})
+
+	Describe("hardlinks to files of a parent layer", func() {
+		var (
+			parentPath      string
+			grandparentPath string
+			linkname        string
+		)
+
+		BeforeEach(func() {
+			var err error
+			parentPath, err = ioutil.TempDir("", "parent-")
+			Expect(err).NotTo(HaveOccurred())
+			grandparentPath, err = ioutil.TempDir("", "grandparent-")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.Mkdir(path.Join(grandparentPath, "dir"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(grandparentPath, "a_file"), []byte("hello-world"), 0640)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(grandparentPath, "dir", "a_file"), []byte("hello-dir"), 0640)).To(Succeed())
+
+			linkname = "a_file"
+		})
+
+		JustBeforeEach(func() {
+			stream = gbytes.NewBuffer()
+			tarWriter := tar.NewWriter(stream)
+			Expect(tarWriter.WriteHeader(&tar.Header{
+				Name:     "hardlink",
+				Typeflag: tar.TypeLink,
+				Linkname: linkname,
+			})).To(Succeed())
+			Expect(tarWriter.Close()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(parentPath)).To(Succeed())
+			Expect(os.RemoveAll(grandparentPath)).To(Succeed())
+		})
+
+		unpack := func() error {
+			_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+				Stream:      stream,
+				TargetPath:  targetPath,
+				ParentPaths: []string{parentPath, grandparentPath},
+			})
+			return err
+		}
+
+		It("copies up the target and links to it", func() {
+			Expect(unpack()).To(Succeed())
+
+			targetStat, err := os.Stat(path.Join(targetPath, "a_file"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targetStat.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+			linkStat, err := os.Stat(path.Join(targetPath, "hardlink"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.SameFile(targetStat, linkStat)).To(BeTrue())
+
+			contents, err := ioutil.ReadFile(path.Join(targetPath, "hardlink"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("hello-world"))
+		})
+
+		Context("when the target has xattrs", func() {
+			var capability []byte
+
+			BeforeEach(func() {
+				// cap_net_raw+ep
+				capability = make([]byte, 20)
+				binary.LittleEndian.PutUint32(capability, 0x02000001)
+				binary.LittleEndian.PutUint32(capability[4:], 1<<13)
+
+				filePath := path.Join(grandparentPath, "a_file")
+				Expect(system.Lsetxattr(filePath, "security.capability", capability, 0)).To(Succeed())
+				Expect(system.Lsetxattr(filePath, "user.grootfs", []byte("groot"), 0)).To(Succeed())
+				Expect(system.Lsetxattr(filePath, "user.other", []byte("other"), 0)).To(Succeed())
+
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:           "btrfs",
+					XattrAllowlist: []string{"user.grootfs"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("copies the capabilities and the allowed xattrs", func() {
+				Expect(unpack()).To(Succeed())
+
+				linkPath := path.Join(targetPath, "hardlink")
+				Expect(system.Lgetxattr(linkPath, "security.capability")).To(Equal(capability))
+				Expect(system.Lgetxattr(linkPath, "user.grootfs")).To(Equal([]byte("groot")))
+				Expect(system.Lgetxattr(linkPath, "user.other")).To(BeNil())
+			})
+		})
+
+		Context("when the directory of the target is not in the layer", func() {
+			BeforeEach(func() {
+				linkname = "dir/a_file"
+			})
+
+			It("copies the target to the link path", func() {
+				Expect(unpack()).To(Succeed())
+
+				contents, err := ioutil.ReadFile(path.Join(targetPath, "hardlink"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("hello-dir"))
+				Expect(path.Join(targetPath, "dir")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when a closer parent layer has a whiteout for the target", func() {
+			BeforeEach(func() {
+				Expect(syscall.Mknod(path.Join(parentPath, "a_file"), syscall.S_IFCHR, 0)).To(Succeed())
+			})
+
+			It("returns an error", func() {
+				Expect(unpack()).To(MatchError(ContainSubstring("finding hardlink target `a_file` in the parent layers")))
+			})
+		})
+
+		Context("when the target goes through a symlink of a parent layer", func() {
+			var outsidePath string
+
+			BeforeEach(func() {
+				var err error
+				outsidePath, err = ioutil.TempDir("", "outside-")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(path.Join(outsidePath, "shadow"), []byte("secret"), 0600)).To(Succeed())
+
+				Expect(os.Symlink("../../../../../../../../.."+outsidePath, path.Join(grandparentPath, "x"))).To(Succeed())
+				linkname = "x/shadow"
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(outsidePath)).To(Succeed())
+			})
+
+			It("does not follow it", func() {
+				Expect(unpack()).To(MatchError(ContainSubstring("`x/shadow` goes through the symlink `x`")))
+				Expect(path.Join(targetPath, "hardlink")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when a closer parent layer has an opaque directory", func() {
+			BeforeEach(func() {
+				Expect(os.Mkdir(path.Join(parentPath, "dir"), 0755)).To(Succeed())
+				Expect(system.Lsetxattr(path.Join(parentPath, "dir"), "trusted.overlay.opaque", []byte("y"), 0)).To(Succeed())
+				linkname = "dir/a_file"
+			})
+
+			It("does not find the target in the layers below", func() {
+				Expect(unpack()).To(MatchError(ContainSubstring("finding hardlink target `dir/a_file` in the parent layers")))
+			})
+		})
+
+		Context("when the target is not in any layer", func() {
+			BeforeEach(func() {
+				linkname = "not-here"
+			})
+
+			It("returns an error", func() {
+				Expect(unpack()).To(MatchError(ContainSubstring("finding hardlink target `not-here` in the parent layers")))
+			})
+		})
+	})
 })
@@ -183,12 +183,12 @@ var _ = Describe("Tar unpacker", func() {
 						TargetPath: targetPath,
 						UIDMappings: []groot.IDMappingSpec{
 							groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
-							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
 							groot.IDMappingSpec{HostID: 2001, NamespaceID: 1001, Size: 900},
 						},
 						GIDMappings: []groot.IDMappingSpec{
 							groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
-							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
 							groot.IDMappingSpec{HostID: 2001, NamespaceID: 1001, Size: 900},
 						},
 					})
@@ -212,15 +212,44 @@ var _ = Describe("Tar unpacker", func() {
 					Expect(filePath).To(BeARegularFile())
 					stat, err = os.Stat(filePath)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2000 + 1200)))
-					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(2000 + 1200)))
+					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2001 + 199)))
+					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(2001 + 199)))
 
 					filePath = path.Join(targetPath, "groot_file")
 					Expect(filePath).To(BeARegularFile())
 					stat, err = os.Stat(filePath)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(1000)))
-					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(1000)))
+					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(10 + 1000)))
+					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(10 + 1000)))
+				})
+
+				Context("when a file is owned by an id outside the mappings", func() {
+					It("returns an error", func() {
+						_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+							Stream:     stream,
+							TargetPath: targetPath,
+							UIDMappings: []groot.IDMappingSpec{
+								groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
+								groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
+							},
+						})
+						Expect(err).To(MatchError(ContainSubstring("translating the uid of `./1200_file`: namespace id 1200 is not mapped to a host id")))
+					})
+				})
+
+				Context("when the mappings overlap", func() {
+					It("returns an error", func() {
+						_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+							Stream:     stream,
+							TargetPath: targetPath,
+							GIDMappings: []groot.IDMappingSpec{
+								groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
+								groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
+								groot.IDMappingSpec{HostID: 500, NamespaceID: 1001, Size: 1000},
+							},
+						})
+						Expect(err).To(MatchError(ContainSubstring("invalid gid mappings: id mapping 1001:500:1000 overlaps with 1:11:1000 on the host")))
+					})
 				})
 			})
 		})
@@ -283,12 +312,12 @@ var _ = Describe("Tar unpacker", func() {
 						TargetPath: targetPath,
 						UIDMappings: []groot.IDMappingSpec{
 							groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
-							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
 							groot.IDMappingSpec{HostID: 2001, NamespaceID: 1001, Size: 900},
 						},
 						GIDMappings: []groot.IDMappingSpec{
 							groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
-							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
 							groot.IDMappingSpec{HostID: 2001, NamespaceID: 1001, Size: 900},
 						},
 					})
@@ -305,15 +334,15 @@ var _ = Describe("Tar unpacker", func() {
 					Expect(filePath).To(BeADirectory())
 					stat, err = os.Stat(filePath)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2000 + 1200)))
-					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(2000 + 1200)))
+					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2001 + 199)))
+					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(2001 + 199)))
 
 					filePath = path.Join(targetPath, "groot_dir")
 					Expect(filePath).To(BeADirectory())
 					stat, err = os.Stat(filePath)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(1000)))
-					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(1000)))
+					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(10 + 1000)))
+					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(10 + 1000)))
 				})
 			})
 		})
@@ -467,12 +496,12 @@ var _ = Describe("Tar unpacker", func() {
 						TargetPath: targetPath,
 						UIDMappings: []groot.IDMappingSpec{
 							groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
-							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
 							groot.IDMappingSpec{HostID: 2001, NamespaceID: 1001, Size: 900},
 						},
 						GIDMappings: []groot.IDMappingSpec{
 							groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
-							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 900},
+							groot.IDMappingSpec{HostID: 11, NamespaceID: 1, Size: 1000},
 							groot.IDMappingSpec{HostID: 2001, NamespaceID: 1001, Size: 900},
 						},
 					})
@@ -489,15 +518,15 @@ var _ = Describe("Tar unpacker", func() {
 					Expect(filePath).To(BeAnExistingFile())
 					stat, err = os.Lstat(filePath)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2000 + 1200)))
-					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(2000 + 1200)))
+					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2001 + 199)))
+					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(2001 + 199)))
 
 					filePath = path.Join(targetPath, "groot_link")
 					Expect(filePath).To(BeAnExistingFile())
 					stat, err = os.Lstat(filePath)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(1000)))
-					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(1000)))
+					Expect(stat.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(10 + 1000)))
+					Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(10 + 1000)))
 				})
 			})
 		})
@@ -565,6 +594,129 @@ var _ = Describe("Tar unpacker", func() {
 			Expect(stat.Mode() & os.ModeSetuid).To(Equal(os.ModeSetuid))
 			Expect(stat.Mode() & os.ModeSetgid).To(Equal(os.ModeSetgid))
 		})
+
+		Context("when the file mode policy sanitizes them", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:      "btrfs",
+					FileModes: unpacker.FileModePolicy{SetID: unpacker.FileModesSanitize},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes them and reports it", func() {
+				unpackOutput, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				stat, err := os.Stat(path.Join(targetPath, "setuid_file"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stat.Mode()).To(Equal(os.FileMode(0755)))
+
+				Expect(unpackOutput.ModeChanges).To(Equal([]base_image_puller.ModeChange{
+					{Path: "setuid_file", OldMode: 0755 | os.ModeSetuid | os.ModeSetgid, NewMode: 0755},
+				}))
+			})
+		})
+
+		Context("when the file mode policy rejects them", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:      "btrfs",
+					FileModes: unpacker.FileModePolicy{SetID: unpacker.FileModesReject},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).To(MatchError("`setuid_file` has the setuid or setgid bit set, which the file mode policy rejects"))
+			})
+		})
+	})
+
+	Context("world-writable permissions", func() {
+		BeforeEach(func() {
+			Expect(os.Mkdir(filepath.Join(baseImagePath, "shared"), 0777)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(baseImagePath, "shared"), 0777)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(baseImagePath, "tmp"), 0777)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(baseImagePath, "tmp"), 0777|os.ModeSticky)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(baseImagePath, "tmp", "a_file"), []byte{}, 0666)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(baseImagePath, "tmp", "a_file"), 0666)).To(Succeed())
+		})
+
+		It("keeps them", func() {
+			_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+				Stream:     stream,
+				TargetPath: targetPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			stat, err := os.Stat(path.Join(targetPath, "shared"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0777)))
+		})
+
+		Context("when the file mode policy sanitizes them", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:      "btrfs",
+					FileModes: unpacker.FileModePolicy{WorldWritable: unpacker.FileModesSanitize},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes them from files outside of /tmp", func() {
+				unpackOutput, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				stat, err := os.Stat(path.Join(targetPath, "shared"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0775)))
+
+				stat, err = os.Stat(path.Join(targetPath, "tmp"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0777)))
+
+				stat, err = os.Stat(path.Join(targetPath, "tmp", "a_file"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0666)))
+
+				Expect(unpackOutput.ModeChanges).To(Equal([]base_image_puller.ModeChange{
+					{Path: "shared", OldMode: os.ModeDir | 0777, NewMode: os.ModeDir | 0775},
+				}))
+			})
+		})
+
+		Context("when the file mode policy rejects them", func() {
+			BeforeEach(func() {
+				var err error
+				tarUnpacker, err = unpacker.NewTarUnpacker(unpacker.UnpackStrategy{
+					Name:      "btrfs",
+					FileModes: unpacker.FileModePolicy{WorldWritable: unpacker.FileModesReject},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := tarUnpacker.Unpack(logger, base_image_puller.UnpackSpec{
+					Stream:     stream,
+					TargetPath: targetPath,
+				})
+				Expect(err).To(MatchError("`shared` is world-writable, which the file mode policy rejects"))
+			})
+		})
 	})
 
 	Context("when it has whiteout files", func() {
@@ -0,0 +1,154 @@
+package unpacker // import "code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/groot"
+	"github.com/docker/docker/pkg/system"
+	"github.com/pkg/errors"
+)
+
+const (
+	capabilityXattr = "security.capability"
+	// the overlay driver keeps its own state in these, so images must never
+	// set them
+	overlayXattrPrefix = "trusted.overlay."
+	userXattrPrefix    = "user."
+
+	vfsCapRevisionMask = 0xFF000000
+	vfsCapRevision2    = 0x02000000
+	vfsCapRevision3    = 0x03000000
+	vfsCapV2Size       = 20
+	vfsCapV3Size       = 24
+)
+
+// setXattrs applies the extended attributes of the entry, as found in its
+// SCHILY.xattr PAX records. File capabilities are always applied when
+// unpacking as root; other attributes only when they match the allowlist.
+// The attributes of symlinks are set on the link itself.
+func (u *TarUnpacker) setXattrs(path string, tarHeader *tar.Header, spec base_image_puller.UnpackSpec) error {
+	mode := tarHeader.FileInfo().Mode()
+
+	for name, value := range tarHeader.Xattrs {
+		if !xattrSupported(name, mode) {
+			continue
+		}
+
+		if name == capabilityXattr {
+			if os.Getuid() != 0 {
+				continue
+			}
+
+			capability, err := u.translateCapability([]byte(value), spec)
+			if err != nil {
+				return errors.Wrapf(err, "reading capabilities of `%s`", path)
+			}
+			value = string(capability)
+		} else if !u.xattrAllowed(name) {
+			continue
+		}
+
+		if err := system.Lsetxattr(path, name, []byte(value), 0); err != nil {
+			return errors.Wrapf(err, "setting xattr `%s` on `%s`", name, path)
+		}
+	}
+
+	return nil
+}
+
+// xattrSupported tells whether the kernel lets the attribute be set on the
+// file type: capabilities only apply to regular files, and user attributes
+// only to regular files and directories.
+func xattrSupported(name string, mode os.FileMode) bool {
+	if name == capabilityXattr {
+		return mode.IsRegular()
+	}
+
+	if strings.HasPrefix(name, userXattrPrefix) {
+		return mode.IsRegular() || mode.IsDir()
+	}
+
+	return true
+}
+
+func (u *TarUnpacker) xattrAllowed(name string) bool {
+	if strings.HasPrefix(name, overlayXattrPrefix) {
+		return false
+	}
+
+	for _, pattern := range u.strategy.XattrAllowlist {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// translateCapability makes the capabilities valid for the root user of the
+// image. Outside of a user namespace that is the host ID that root is mapped
+// to, so the capabilities become v3 ones with that rootid. In a user
+// namespace the kernel maps the rootid itself, so it is kept as the
+// namespace ID.
+func (u *TarUnpacker) translateCapability(capability []byte, spec base_image_puller.UnpackSpec) ([]byte, error) {
+	rootID, err := capabilityRootID(capability)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.strategy.InUserNamespace {
+		return capabilityWithRootID(capability, rootID), nil
+	}
+
+	hostRootID, err := groot.IDMap(spec.UIDMappings).HostID(rootID)
+	if err != nil {
+		return nil, err
+	}
+	if hostRootID == 0 && rootID == 0 {
+		return capability, nil
+	}
+
+	return capabilityWithRootID(capability, hostRootID), nil
+}
+
+func capabilityRootID(capability []byte) (int, error) {
+	if len(capability) < 4 {
+		return 0, errors.New("capability is too short")
+	}
+
+	switch revision := binary.LittleEndian.Uint32(capability) & vfsCapRevisionMask; revision {
+	case vfsCapRevision2:
+		if len(capability) != vfsCapV2Size {
+			return 0, errors.Errorf("invalid v2 capability size %d", len(capability))
+		}
+		return 0, nil
+
+	case vfsCapRevision3:
+		if len(capability) != vfsCapV3Size {
+			return 0, errors.Errorf("invalid v3 capability size %d", len(capability))
+		}
+		return int(binary.LittleEndian.Uint32(capability[vfsCapV2Size:])), nil
+
+	default:
+		return 0, errors.Errorf("unsupported capability revision %#x", revision)
+	}
+}
+
+func capabilityWithRootID(capability []byte, rootID int) []byte {
+	magic := binary.LittleEndian.Uint32(capability)&^vfsCapRevisionMask | vfsCapRevision3
+
+	v3Capability := make([]byte, vfsCapV3Size)
+	copy(v3Capability, capability[:vfsCapV2Size])
+	binary.LittleEndian.PutUint32(v3Capability, magic)
+	binary.LittleEndian.PutUint32(v3Capability[vfsCapV2Size:], uint32(rootID))
+
+	return v3Capability
+}
@@ -2,12 +2,18 @@ package config
 
 import (
 	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
 
 	errorspkg "github.com/pkg/errors"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
+var deviceNodePattern = regexp.MustCompile(`^[bc] [0-9]+:[0-9]+$`)
+
 type Config struct {
 	StorePath      string `yaml:"store"`
 	FSDriver       string `yaml:"driver"`
@@ -21,27 +27,82 @@ type Config struct {
 	LogFile        string `yaml:"log_file"`
 	Create         Create `yaml:"create"`
 	Clean          Clean  `yaml:"clean"`
+	Pull           Pull   `yaml:"pull"`
+	Policy         Policy `yaml:"policy"`
 	Init           Init   `yaml:"-"`
 }
 
 type Create struct {
-	ExcludeImageFromQuota             bool     `yaml:"exclude_image_from_quota"`
-	SkipLayerValidation               bool     `yaml:"skip_layer_validation"`
-	WithClean                         bool     `yaml:"with_clean"`
-	WithoutMount                      bool     `yaml:"without_mount"`
-	DiskLimitSizeBytes                int64    `yaml:"disk_limit_size_bytes"`
-	InsecureRegistries                []string `yaml:"insecure_registries"`
-	RemoteLayerClientCertificatesPath string   `yaml:"remote_layer_client_certificates_path"`
+	ExcludeImageFromQuota             bool                `yaml:"exclude_image_from_quota"`
+	SkipLayerValidation               bool                `yaml:"skip_layer_validation"`
+	WithClean                         bool                `yaml:"with_clean"`
+	WithoutMount                      bool                `yaml:"without_mount"`
+	DiskLimitSizeBytes                int64               `yaml:"disk_limit_size_bytes"`
+	InsecureRegistries                []string            `yaml:"insecure_registries"`
+	RemoteLayerClientCertificatesPath string              `yaml:"remote_layer_client_certificates_path"`
+	AuthFile                          string              `yaml:"auth_file"`
+	Platform                          string              `yaml:"platform"`
+	RegistryMirrors                   map[string][]string `yaml:"registry_mirrors"`
+	StreamLayers                      bool                `yaml:"stream_layers"`
+	RetryPolicy                       RetryPolicy         `yaml:"retry_policy"`
+	TrustPolicy                       string              `yaml:"trust_policy"`
+	Sigstore                          string              `yaml:"sigstore"`
+	Offline                           bool                `yaml:"offline"`
+	ManifestCacheTTLSeconds           int64               `yaml:"manifest_cache_ttl_seconds"`
+	ForeignLayers                     ForeignLayers       `yaml:"foreign_layers"`
+	XattrAllowlist                    []string            `yaml:"xattr_allowlist"`
+	DeviceNodes                       DeviceNodes         `yaml:"device_nodes"`
+	FileModes                         FileModes           `yaml:"file_modes"`
+}
+
+type DeviceNodes struct {
+	Policy  string   `yaml:"policy"`
+	Allowed []string `yaml:"allowed"`
+}
+
+type FileModes struct {
+	SetID         string `yaml:"setid"`
+	WorldWritable string `yaml:"world_writable"`
+}
+
+type ForeignLayers struct {
+	Deny         bool              `yaml:"deny"`
+	AllowedHosts []string          `yaml:"allowed_hosts"`
+	URLRewrites  map[string]string `yaml:"url_rewrites"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts      int   `yaml:"max_attempts"`
+	InitialBackoffMs int64 `yaml:"initial_backoff_ms"`
+	MaxBackoffMs     int64 `yaml:"max_backoff_ms"`
+	// Jitter is a pointer so that 0, which disables it, can be told apart
+	// from not setting it.
+	Jitter *float64 `yaml:"jitter"`
 }
 
 type Clean struct {
 	CacheBytes int64 `yaml:"cache_bytes"`
 }
 
+type Pull struct {
+	RetentionSeconds int64 `yaml:"retention_seconds"`
+}
+
+type Policy struct {
+	AllowedSchemes         []string `yaml:"allowed_schemes"`
+	AllowedRegistries      []string `yaml:"allowed_registries"`
+	DeniedRegistries       []string `yaml:"denied_registries"`
+	AllowedRepositories    []string `yaml:"allowed_repositories"`
+	DeniedRepositories     []string `yaml:"denied_repositories"`
+	MaxLayers              int      `yaml:"max_layers"`
+	MaxCompressedSizeBytes int64    `yaml:"max_compressed_size_bytes"`
+}
+
 type Init struct {
-	StoreSizeBytes int64
-	OwnerUser      string
-	OwnerGroup     string
+	StoreSizeBytes            int64
+	OwnerUser                 string
+	OwnerGroup                string
+	ContentAddressedTarImages bool
 }
 
 type Builder struct {
@@ -75,9 +136,124 @@ func (b *Builder) Build() (Config, error) {
 		return *b.config, errorspkg.New("invalid argument: cache size cannot be negative")
 	}
 
+	if b.config.Pull.RetentionSeconds < 0 {
+		return *b.config, errorspkg.New("invalid argument: retention cannot be negative")
+	}
+
+	if b.config.Create.ManifestCacheTTLSeconds < 0 {
+		return *b.config, errorspkg.New("invalid argument: manifest cache ttl cannot be negative")
+	}
+
+	retryPolicy := b.config.Create.RetryPolicy
+	if retryPolicy.MaxAttempts < 0 || retryPolicy.InitialBackoffMs < 0 || retryPolicy.MaxBackoffMs < 0 {
+		return *b.config, errorspkg.New("invalid argument: retry policy values cannot be negative")
+	}
+
+	if retryPolicy.Jitter != nil && (*retryPolicy.Jitter < 0 || *retryPolicy.Jitter > 1) {
+		return *b.config, errorspkg.New("invalid argument: retry policy jitter must be between 0 and 1")
+	}
+
+	if err := validatePolicy(b.config.Policy); err != nil {
+		return *b.config, err
+	}
+
+	if err := validateForeignLayers(b.config.Create.ForeignLayers); err != nil {
+		return *b.config, err
+	}
+
+	if err := validateXattrAllowlist(b.config.Create.XattrAllowlist); err != nil {
+		return *b.config, err
+	}
+
+	if err := validateDeviceNodes(b.config.Create.DeviceNodes); err != nil {
+		return *b.config, err
+	}
+
+	if err := validateFileModes(b.config.Create.FileModes); err != nil {
+		return *b.config, err
+	}
+
 	return *b.config, nil
 }
 
+func validatePolicy(policy Policy) error {
+	if policy.MaxLayers < 0 || policy.MaxCompressedSizeBytes < 0 {
+		return errorspkg.New("invalid argument: policy limits cannot be negative")
+	}
+
+	for _, scheme := range policy.AllowedSchemes {
+		switch scheme {
+		case "docker", "oci", "oci-archive", "docker-archive", "tar":
+		default:
+			return errorspkg.Errorf("invalid argument: unknown policy scheme `%s`", scheme)
+		}
+	}
+
+	for _, globs := range [][]string{policy.AllowedRepositories, policy.DeniedRepositories} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return errorspkg.Errorf("invalid argument: malformed policy repository glob `%s`", glob)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateForeignLayers(foreignLayers ForeignLayers) error {
+	for prefix, replacement := range foreignLayers.URLRewrites {
+		if prefix == "" {
+			return errorspkg.New("invalid argument: foreign layer url rewrite prefix cannot be empty")
+		}
+
+		replacementURL, err := url.Parse(replacement)
+		if err != nil || (replacementURL.Scheme != "http" && replacementURL.Scheme != "https") {
+			return errorspkg.Errorf("invalid argument: malformed foreign layer url rewrite `%s`", replacement)
+		}
+	}
+
+	return nil
+}
+
+func validateXattrAllowlist(xattrAllowlist []string) error {
+	for _, pattern := range xattrAllowlist {
+		name := strings.TrimSuffix(pattern, "*")
+		if name == "" || strings.Contains(name, "*") {
+			return errorspkg.Errorf("invalid argument: malformed xattr allowlist entry `%s`", pattern)
+		}
+	}
+
+	return nil
+}
+
+func validateDeviceNodes(deviceNodes DeviceNodes) error {
+	switch deviceNodes.Policy {
+	case "", "skip", "create", "allowlist":
+	default:
+		return errorspkg.Errorf("invalid argument: unknown device nodes policy `%s`", deviceNodes.Policy)
+	}
+
+	for _, device := range deviceNodes.Allowed {
+		if !deviceNodePattern.MatchString(device) {
+			return errorspkg.Errorf("invalid argument: malformed allowed device node `%s`", device)
+		}
+	}
+
+	return nil
+}
+
+func validateFileModes(fileModes FileModes) error {
+	for _, policy := range []string{fileModes.SetID, fileModes.WorldWritable} {
+		switch policy {
+		case "", "keep", "sanitize", "reject":
+		default:
+			return errorspkg.Errorf("invalid argument: unknown file modes policy `%s`", policy)
+		}
+	}
+
+	return nil
+}
+
 func (b *Builder) WithInsecureRegistries(insecureRegistries []string) *Builder {
 	if insecureRegistries == nil || len(insecureRegistries) == 0 {
 		return b
@@ -87,6 +263,62 @@ func (b *Builder) WithInsecureRegistries(insecureRegistries []string) *Builder {
 	return b
 }
 
+func (b *Builder) WithAuthFile(authFile string, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.AuthFile = authFile
+	}
+	return b
+}
+
+func (b *Builder) WithPlatform(platform string, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.Platform = platform
+	}
+	return b
+}
+
+func (b *Builder) WithStreamLayers(streamLayers bool, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.StreamLayers = streamLayers
+	}
+	return b
+}
+
+func (b *Builder) WithOffline(offline bool, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.Offline = offline
+	}
+	return b
+}
+
+func (b *Builder) WithFileModesSetID(setID string, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.FileModes.SetID = setID
+	}
+	return b
+}
+
+func (b *Builder) WithFileModesWorldWritable(worldWritable string, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.FileModes.WorldWritable = worldWritable
+	}
+	return b
+}
+
+func (b *Builder) WithTrustPolicy(trustPolicy string, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.TrustPolicy = trustPolicy
+	}
+	return b
+}
+
+func (b *Builder) WithSigstore(sigstore string, isSet bool) *Builder {
+	if isSet {
+		b.config.Create.Sigstore = sigstore
+	}
+	return b
+}
+
 func (b *Builder) WithStorePath(storePath string, isSet bool) *Builder {
 	if isSet || b.config.StorePath == "" {
 		b.config.StorePath = storePath
@@ -175,6 +407,13 @@ func (b *Builder) WithCacheBytes(cacheSize int64, isSet bool) *Builder {
 	return b
 }
 
+func (b *Builder) WithRetentionSeconds(retention int64, isSet bool) *Builder {
+	if isSet {
+		b.config.Pull.RetentionSeconds = retention
+	}
+	return b
+}
+
 func (b *Builder) WithLogLevel(level string, isSet bool) *Builder {
 	if isSet {
 		b.config.LogLevel = level
@@ -218,6 +457,11 @@ func (b *Builder) WithStoreSizeBytes(size int64) *Builder {
 	return b
 }
 
+func (b *Builder) WithContentAddressedTarImages(contentAddressedTarImages bool) *Builder {
+	b.config.Init.ContentAddressedTarImages = contentAddressedTarImages
+	return b
+}
+
 func load(configPath string) (Config, error) {
 	configContent, err := ioutil.ReadFile(configPath)
 	if err != nil {
@@ -78,6 +78,187 @@ var _ = Describe("Builder", func() {
 			Expect(config.StorePath).To(Equal("/hello"))
 		})
 
+		Context("when registry mirrors are configured", func() {
+			BeforeEach(func() {
+				cfg.Create.RegistryMirrors = map[string][]string{
+					"docker.io": []string{"mirror-1.example.org", "http://mirror-2.example.org:5000"},
+				}
+			})
+
+			It("returns the mirrors in order", func() {
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.RegistryMirrors).To(Equal(map[string][]string{
+					"docker.io": []string{"mirror-1.example.org", "http://mirror-2.example.org:5000"},
+				}))
+			})
+		})
+
+		Context("when a retry policy is configured", func() {
+			BeforeEach(func() {
+				jitter := 0.5
+				cfg.Create.RetryPolicy = config.RetryPolicy{
+					MaxAttempts:      5,
+					InitialBackoffMs: 100,
+					MaxBackoffMs:     10000,
+					Jitter:           &jitter,
+				}
+			})
+
+			It("returns the retry policy", func() {
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.RetryPolicy.MaxAttempts).To(Equal(5))
+				Expect(config.Create.RetryPolicy.InitialBackoffMs).To(Equal(int64(100)))
+				Expect(config.Create.RetryPolicy.MaxBackoffMs).To(Equal(int64(10000)))
+				Expect(*config.Create.RetryPolicy.Jitter).To(Equal(0.5))
+			})
+
+			Context("when a value is negative", func() {
+				BeforeEach(func() {
+					cfg.Create.RetryPolicy.MaxBackoffMs = -1
+				})
+
+				It("returns an error", func() {
+					_, err := builder.Build()
+					Expect(err).To(MatchError("invalid argument: retry policy values cannot be negative"))
+				})
+			})
+
+			Context("when the jitter is 0", func() {
+				BeforeEach(func() {
+					jitter := 0.0
+					cfg.Create.RetryPolicy.Jitter = &jitter
+				})
+
+				It("keeps it, so that the default jitter is not used", func() {
+					config, err := builder.Build()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(config.Create.RetryPolicy.Jitter).NotTo(BeNil())
+					Expect(*config.Create.RetryPolicy.Jitter).To(BeZero())
+				})
+			})
+
+			Context("when the jitter is greater than 1", func() {
+				BeforeEach(func() {
+					jitter := 1.5
+					cfg.Create.RetryPolicy.Jitter = &jitter
+				})
+
+				It("returns an error", func() {
+					_, err := builder.Build()
+					Expect(err).To(MatchError("invalid argument: retry policy jitter must be between 0 and 1"))
+				})
+			})
+		})
+
+		Context("when the policy is invalid", func() {
+			Context("when a limit is negative", func() {
+				BeforeEach(func() {
+					cfg.Policy.MaxLayers = -1
+				})
+
+				It("returns an error", func() {
+					_, err := builder.Build()
+					Expect(err).To(MatchError("invalid argument: policy limits cannot be negative"))
+				})
+			})
+
+			Context("when a scheme is unknown", func() {
+				BeforeEach(func() {
+					cfg.Policy.AllowedSchemes = []string{"docker", "ftp"}
+				})
+
+				It("returns an error", func() {
+					_, err := builder.Build()
+					Expect(err).To(MatchError("invalid argument: unknown policy scheme `ftp`"))
+				})
+			})
+
+			Context("when a repository glob is malformed", func() {
+				BeforeEach(func() {
+					cfg.Policy.DeniedRepositories = []string{"cfgarden/["}
+				})
+
+				It("returns an error", func() {
+					_, err := builder.Build()
+					Expect(err).To(MatchError("invalid argument: malformed policy repository glob `cfgarden/[`"))
+				})
+			})
+		})
+
+		Context("when a foreign layer url rewrite is invalid", func() {
+			BeforeEach(func() {
+				cfg.Create.ForeignLayers.URLRewrites = map[string]string{
+					"https://go.microsoft.com/": "mirror.internal/microsoft",
+				}
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: malformed foreign layer url rewrite `mirror.internal/microsoft`"))
+			})
+		})
+
+		Context("when a foreign layer url rewrite prefix is empty", func() {
+			BeforeEach(func() {
+				cfg.Create.ForeignLayers.URLRewrites = map[string]string{
+					"": "https://mirror.internal/",
+				}
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: foreign layer url rewrite prefix cannot be empty"))
+			})
+		})
+
+		Context("when the device nodes policy is unknown", func() {
+			BeforeEach(func() {
+				cfg.Create.DeviceNodes.Policy = "sometimes"
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: unknown device nodes policy `sometimes`"))
+			})
+		})
+
+		Context("when a file modes policy is unknown", func() {
+			BeforeEach(func() {
+				cfg.Create.FileModes.SetID = "sanitize"
+				cfg.Create.FileModes.WorldWritable = "strip"
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: unknown file modes policy `strip`"))
+			})
+		})
+
+		Context("when an allowed device node is malformed", func() {
+			BeforeEach(func() {
+				cfg.Create.DeviceNodes.Policy = "allowlist"
+				cfg.Create.DeviceNodes.Allowed = []string{"c 1:3", "/dev/null"}
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: malformed allowed device node `/dev/null`"))
+			})
+		})
+
+		Context("when an xattr allowlist entry is malformed", func() {
+			BeforeEach(func() {
+				cfg.Create.XattrAllowlist = []string{"user.*", "trusted.*.foo"}
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: malformed xattr allowlist entry `trusted.*.foo`"))
+			})
+		})
+
 		Context("when disk limit property is invalid", func() {
 			BeforeEach(func() {
 				cfg.Create.DiskLimitSizeBytes = int64(-1)
@@ -89,6 +270,28 @@ var _ = Describe("Builder", func() {
 			})
 		})
 
+		Context("when the retention is invalid", func() {
+			BeforeEach(func() {
+				cfg.Pull.RetentionSeconds = int64(-1)
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: retention cannot be negative"))
+			})
+		})
+
+		Context("when the manifest cache ttl is invalid", func() {
+			BeforeEach(func() {
+				cfg.Create.ManifestCacheTTLSeconds = int64(-1)
+			})
+
+			It("returns an error", func() {
+				_, err := builder.Build()
+				Expect(err).To(MatchError("invalid argument: manifest cache ttl cannot be negative"))
+			})
+		})
+
 		Context("when cache size property is invalid", func() {
 			BeforeEach(func() {
 				cfg.Clean.CacheBytes = int64(-1)
@@ -440,6 +643,188 @@ var _ = Describe("Builder", func() {
 		})
 	})
 
+	Describe("WithAuthFile", func() {
+		BeforeEach(func() {
+			cfg.Create.AuthFile = "/config/docker-config.json"
+		})
+
+		It("overrides the config's AuthFile entry when the flag is set", func() {
+			builder = builder.WithAuthFile("/flag/docker-config.json", true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.AuthFile).To(Equal("/flag/docker-config.json"))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithAuthFile("", false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.AuthFile).To(Equal("/config/docker-config.json"))
+			})
+		})
+	})
+
+	Describe("WithPlatform", func() {
+		BeforeEach(func() {
+			cfg.Create.Platform = "linux/amd64"
+		})
+
+		It("overrides the config's Platform entry when the flag is set", func() {
+			builder = builder.WithPlatform("linux/arm64/v8", true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.Platform).To(Equal("linux/arm64/v8"))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithPlatform("", false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.Platform).To(Equal("linux/amd64"))
+			})
+		})
+	})
+
+	Describe("WithStreamLayers", func() {
+		BeforeEach(func() {
+			cfg.Create.StreamLayers = true
+		})
+
+		It("overrides the config's StreamLayers entry when the flag is set", func() {
+			builder = builder.WithStreamLayers(false, true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.StreamLayers).To(BeFalse())
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithStreamLayers(false, false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.StreamLayers).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("WithOffline", func() {
+		It("overrides the config's Offline entry when the flag is set", func() {
+			builder = builder.WithOffline(true, true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.Offline).To(BeTrue())
+		})
+
+		Context("when flag is not set", func() {
+			BeforeEach(func() {
+				cfg.Create.Offline = true
+			})
+
+			It("uses the config entry", func() {
+				builder = builder.WithOffline(false, false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.Offline).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("WithFileModesSetID", func() {
+		BeforeEach(func() {
+			cfg.Create.FileModes.SetID = "sanitize"
+		})
+
+		It("overrides the config's FileModes.SetID entry when the flag is set", func() {
+			builder = builder.WithFileModesSetID("reject", true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.FileModes.SetID).To(Equal("reject"))
+		})
+
+		It("validates the flag value", func() {
+			builder = builder.WithFileModesSetID("strip", true)
+			_, err := builder.Build()
+			Expect(err).To(MatchError("invalid argument: unknown file modes policy `strip`"))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithFileModesSetID("reject", false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.FileModes.SetID).To(Equal("sanitize"))
+			})
+		})
+	})
+
+	Describe("WithFileModesWorldWritable", func() {
+		BeforeEach(func() {
+			cfg.Create.FileModes.WorldWritable = "sanitize"
+		})
+
+		It("overrides the config's FileModes.WorldWritable entry when the flag is set", func() {
+			builder = builder.WithFileModesWorldWritable("keep", true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.FileModes.WorldWritable).To(Equal("keep"))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithFileModesWorldWritable("keep", false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.FileModes.WorldWritable).To(Equal("sanitize"))
+			})
+		})
+	})
+
+	Describe("WithTrustPolicy", func() {
+		BeforeEach(func() {
+			cfg.Create.TrustPolicy = "/etc/grootfs/policy.json"
+		})
+
+		It("overrides the config's TrustPolicy entry when the flag is set", func() {
+			builder = builder.WithTrustPolicy("/tmp/policy.json", true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.TrustPolicy).To(Equal("/tmp/policy.json"))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithTrustPolicy("/tmp/policy.json", false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.TrustPolicy).To(Equal("/etc/grootfs/policy.json"))
+			})
+		})
+	})
+
+	Describe("WithSigstore", func() {
+		BeforeEach(func() {
+			cfg.Create.Sigstore = "/var/lib/grootfs/sigstore"
+		})
+
+		It("overrides the config's Sigstore entry when the flag is set", func() {
+			builder = builder.WithSigstore("/tmp/sigstore", true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Create.Sigstore).To(Equal("/tmp/sigstore"))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithSigstore("/tmp/sigstore", false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Create.Sigstore).To(Equal("/var/lib/grootfs/sigstore"))
+			})
+		})
+	})
+
 	Describe("WithCacheBytes", func() {
 		It("overrides the config's CleanCacheBytes entry when the flag is set", func() {
 			builder = builder.WithCacheBytes(1024, true)
@@ -458,6 +843,28 @@ var _ = Describe("Builder", func() {
 		})
 	})
 
+	Describe("WithRetentionSeconds", func() {
+		BeforeEach(func() {
+			cfg.Pull.RetentionSeconds = int64(3600)
+		})
+
+		It("overrides the config's retention entry when the flag is set", func() {
+			builder = builder.WithRetentionSeconds(60, true)
+			config, err := builder.Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Pull.RetentionSeconds).To(Equal(int64(60)))
+		})
+
+		Context("when flag is not set", func() {
+			It("uses the config entry", func() {
+				builder = builder.WithRetentionSeconds(60, false)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Pull.RetentionSeconds).To(Equal(int64(3600)))
+			})
+		})
+	})
+
 	Describe("WithLogLevel", func() {
 		It("overrides the config's Log Level entry", func() {
 			builder = builder.WithLogLevel("debug", true)
@@ -584,5 +991,14 @@ var _ = Describe("Builder", func() {
 				Expect(config.Init.StoreSizeBytes).To(Equal(int64(1024)))
 			})
 		})
+
+		Describe("WithContentAddressedTarImages", func() {
+			It("sets the correct config value", func() {
+				builder = builder.WithContentAddressedTarImages(true)
+				config, err := builder.Build()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Init.ContentAddressedTarImages).To(BeTrue())
+			})
+		})
 	})
 })
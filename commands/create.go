@@ -6,15 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
 
 	"code.cloudfoundry.org/commandrunner/linux_command_runner"
 	"code.cloudfoundry.org/grootfs/base_image_puller"
-	unpackerpkg "code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
 	"code.cloudfoundry.org/grootfs/commands/config"
-	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
 	"code.cloudfoundry.org/grootfs/fetcher/tar_fetcher"
 	"code.cloudfoundry.org/grootfs/groot"
@@ -22,20 +19,24 @@ import (
 	storepkg "code.cloudfoundry.org/grootfs/store"
 	"code.cloudfoundry.org/grootfs/store/dependency_manager"
 	"code.cloudfoundry.org/grootfs/store/filesystems/namespaced"
-	"code.cloudfoundry.org/grootfs/store/filesystems/overlayxfs"
 	"code.cloudfoundry.org/grootfs/store/garbage_collector"
 	"code.cloudfoundry.org/grootfs/store/image_cloner"
 	locksmithpkg "code.cloudfoundry.org/grootfs/store/locksmith"
 	"code.cloudfoundry.org/grootfs/store/manager"
 	"code.cloudfoundry.org/lager"
 
-	"github.com/containers/image/types"
 	"github.com/docker/distribution/registry/api/errcode"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	errorspkg "github.com/pkg/errors"
 	"github.com/urfave/cli"
 )
 
+const manifestDigestAnnotation = "org.cloudfoundry.experimental.image.manifest-digest"
+
+// policyViolationExitCode is returned when the image is rejected by the
+// admission policy, so that callers can tell it apart from other failures.
+const policyViolationExitCode = 3
+
 var CreateCommand = cli.Command{
 	Name:        "create",
 	Usage:       "create [options] <image> <id>",
@@ -56,7 +57,7 @@ var CreateCommand = cli.Command{
 		},
 		cli.BoolFlag{
 			Name:  "skip-layer-validation",
-			Usage: "Do not validate checksums of image layers. (Can only be used with oci:/// protocol images.)",
+			Usage: "Do not validate checksums of image layers. (Can only be used with oci:/// and oci-archive:/// protocol images.)",
 		},
 		cli.BoolFlag{
 			Name:  "with-clean",
@@ -86,6 +87,42 @@ var CreateCommand = cli.Command{
 			Name:  "password",
 			Usage: "Password to authenticate in image registry",
 		},
+		cli.StringFlag{
+			Name:  "platform",
+			Usage: "Platform to select from multi-arch images, e.g.: linux/arm64/v8 (defaults to the host platform)",
+		},
+		cli.StringFlag{
+			Name:  "auth-file",
+			Usage: "Path to a docker config.json used to look up registry credentials and credential helpers",
+		},
+		cli.BoolFlag{
+			Name:  "stream-layers",
+			Usage: "Unpack layers while they are downloaded instead of storing them in a temporary file first",
+		},
+		cli.BoolFlag{
+			Name:  "offline",
+			Usage: "Use the cached manifest of registry images instead of contacting the registry. Fails unless all the layers have already been pulled",
+		},
+		cli.StringFlag{
+			Name:  "file-modes-setid",
+			Usage: "What to do with the setuid and setgid bits of image files: keep, sanitize or reject",
+		},
+		cli.StringFlag{
+			Name:  "file-modes-world-writable",
+			Usage: "What to do with the world-writable bit of image files outside of /tmp: keep, sanitize or reject",
+		},
+		cli.StringFlag{
+			Name:  "trust-policy",
+			Usage: "Path to a trust policy file used to verify the signatures of registry images",
+		},
+		cli.StringFlag{
+			Name:  "sigstore",
+			Usage: "Path to the directory containing the image signatures",
+		},
+		cli.IntFlag{
+			Name:  "progress-fd",
+			Usage: "Write progress events as JSON lines to this already open file descriptor",
+		},
 	},
 
 	Action: func(ctx *cli.Context) error {
@@ -107,6 +144,14 @@ var CreateCommand = cli.Command{
 			WithSkipLayerValidation(ctx.Bool("skip-layer-validation"),
 				ctx.IsSet("skip-layer-validation")).
 			WithCacheBytes(ctx.Int64("cache-bytes"), ctx.IsSet("cache-bytes")).
+			WithAuthFile(ctx.String("auth-file"), ctx.IsSet("auth-file")).
+			WithPlatform(ctx.String("platform"), ctx.IsSet("platform")).
+			WithStreamLayers(ctx.Bool("stream-layers"), ctx.IsSet("stream-layers")).
+			WithOffline(ctx.Bool("offline"), ctx.IsSet("offline")).
+			WithFileModesSetID(ctx.String("file-modes-setid"), ctx.IsSet("file-modes-setid")).
+			WithFileModesWorldWritable(ctx.String("file-modes-world-writable"), ctx.IsSet("file-modes-world-writable")).
+			WithTrustPolicy(ctx.String("trust-policy"), ctx.IsSet("trust-policy")).
+			WithSigstore(ctx.String("sigstore"), ctx.IsSet("sigstore")).
 			WithClean(ctx.IsSet("with-clean"), ctx.IsSet("without-clean")).
 			WithMount(ctx.IsSet("with-mount"), ctx.IsSet("without-mount"))
 
@@ -121,6 +166,12 @@ var CreateCommand = cli.Command{
 			return newExitError(err.Error(), 1)
 		}
 
+		platform, err := source.ParsePlatform(cfg.Create.Platform)
+		if err != nil {
+			logger.Error("parsing-platform-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
 		storePath := cfg.StorePath
 		id := ctx.Args().Tail()[0]
 		baseImage := ctx.Args().First()
@@ -154,21 +205,9 @@ var CreateCommand = cli.Command{
 		}
 
 		runner := linux_command_runner.New()
-		var unpacker base_image_puller.Unpacker
-		unpackerStrategy := unpackerpkg.UnpackStrategy{
-			Name:               cfg.FSDriver,
-			WhiteoutDevicePath: filepath.Join(storePath, overlayxfs.WhiteoutDevice),
-		}
-
-		var idMapper unpackerpkg.IDMapper
-		if os.Getuid() == 0 {
-			unpacker, err = unpackerpkg.NewTarUnpacker(unpackerStrategy)
-			if err != nil {
-				return newExitError(err.Error(), 1)
-			}
-		} else {
-			idMapper = unpackerpkg.NewIDMapper(cfg.NewuidmapBin, cfg.NewgidmapBin, runner)
-			unpacker = unpackerpkg.NewNSIdMapperUnpacker(runner, idMapper, unpackerStrategy)
+		unpacker, idMapper, err := createUnpacker(cfg, runner)
+		if err != nil {
+			return newExitError(err.Error(), 1)
 		}
 
 		dependencyManager := dependency_manager.NewDependencyManager(
@@ -177,19 +216,34 @@ var CreateCommand = cli.Command{
 
 		nsFsDriver := namespaced.New(fsDriver, idMappings, idMapper, runner)
 
-		systemContext := createSystemContext(baseImageURL, cfg.Create, ctx.String("username"), ctx.String("password"))
+		signatureVerifier, err := createSignatureVerifier(cfg.Create)
+		if err != nil {
+			logger.Error("loading-trust-policy-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		progressReporter, closeProgressReporter := createProgressReporter(ctx)
+		defer closeProgressReporter()
+
+		fetcher, closeFetcher, err := createBaseImageFetcher(logger, baseImageURL, platform, cfg, ctx.String("username"), ctx.String("password"))
+		if err != nil {
+			return newExitError(err.Error(), 1)
+		}
+		defer closeFetcher()
 
 		baseImagePuller := base_image_puller.NewBaseImagePuller(
-			createFetcher(baseImageURL, systemContext, cfg.Create),
+			fetcher,
 			unpacker,
 			nsFsDriver,
 			dependencyManager,
 			metricsEmitter,
 			exclusiveLocksmith,
+			signatureVerifier,
+			progressReporter,
 		)
 
 		sm := storepkg.NewStoreMeasurer(storePath, fsDriver)
-		gc := garbage_collector.NewGC(nsFsDriver, imageCloner, dependencyManager, baseImage, tar_fetcher.IsLocalTarVolume)
+		gc := garbage_collector.NewGC(nsFsDriver, imageCloner, dependencyManager, baseImage, tar_fetcher.IsLocalTarVolume, source.CollectPartialBlobs)
 		cleaner := groot.IamCleaner(exclusiveLocksmith, sm, gc, metricsEmitter)
 
 		defer func() {
@@ -203,7 +257,7 @@ var CreateCommand = cli.Command{
 
 		creator := groot.IamCreator(
 			imageCloner, baseImagePuller, sharedLocksmith,
-			dependencyManager, metricsEmitter, cleaner,
+			dependencyManager, metricsEmitter, cleaner, progressReporter,
 		)
 
 		createSpec := groot.CreateSpec{
@@ -216,10 +270,14 @@ var CreateCommand = cli.Command{
 			GIDMappings:               idMappings.GIDMappings,
 			CleanOnCreate:             cfg.Create.WithClean,
 			CleanOnCreateCacheBytes:   cfg.Clean.CacheBytes,
+			AdmissionPolicy:           createAdmissionPolicy(cfg.Policy),
 		}
 		image, err := creator.Create(logger, createSpec)
 		if err != nil {
 			logger.Error("creating", err)
+			if _, ok := errorspkg.Cause(err).(*groot.PolicyViolationError); ok {
+				return newExitError(errorspkg.Cause(err).Error(), policyViolationExitCode)
+			}
 			humanizedError := tryHumanize(err, createSpec)
 			return newExitError(humanizedError, 1)
 		}
@@ -234,6 +292,12 @@ var CreateCommand = cli.Command{
 			Mounts: []specs.Mount{},
 		}
 
+		if image.ManifestDigest != "" {
+			containerSpec.Annotations = map[string]string{
+				manifestDigestAnnotation: image.ManifestDigest,
+			}
+		}
+
 		for _, mount := range image.Mounts {
 			containerSpec.Mounts = append(containerSpec.Mounts, specs.Mount{
 				Destination: mount.Destination,
@@ -263,45 +327,16 @@ var CreateCommand = cli.Command{
 	},
 }
 
-func createFetcher(baseImageUrl *url.URL, systemContext types.SystemContext, createCfg config.Create) base_image_puller.Fetcher {
-	if baseImageUrl.Scheme == "" {
-		return tar_fetcher.NewTarFetcher()
-	}
-
-	skipOCIChecksumValidation := createCfg.SkipLayerValidation && baseImageUrl.Scheme == "oci"
-	layerSource := source.NewLayerSource(systemContext, skipOCIChecksumValidation)
-	return layer_fetcher.NewLayerFetcher(&layerSource)
-}
-
-func createSystemContext(baseImageURL *url.URL, createConfig config.Create, username, password string) types.SystemContext {
-	scheme := baseImageURL.Scheme
-	switch scheme {
-	case "docker":
-		return types.SystemContext{
-			DockerInsecureSkipTLSVerify: skipTLSValidation(baseImageURL, createConfig.InsecureRegistries),
-			DockerAuthConfig: &types.DockerAuthConfig{
-				Username: username,
-				Password: password,
-			},
-		}
-	case "oci":
-		return types.SystemContext{
-			OCICertPath: createConfig.RemoteLayerClientCertificatesPath,
-		}
-	default:
-		return types.SystemContext{}
-	}
-
-}
-
-func skipTLSValidation(baseImageURL *url.URL, trustedRegistries []string) bool {
-	for _, trustedRegistry := range trustedRegistries {
-		if baseImageURL.Host == trustedRegistry {
-			return true
-		}
+func createAdmissionPolicy(policyCfg config.Policy) groot.AdmissionPolicy {
+	return groot.AdmissionPolicy{
+		AllowedSchemes:         policyCfg.AllowedSchemes,
+		AllowedRegistries:      policyCfg.AllowedRegistries,
+		DeniedRegistries:       policyCfg.DeniedRegistries,
+		AllowedRepositories:    policyCfg.AllowedRepositories,
+		DeniedRepositories:     policyCfg.DeniedRepositories,
+		MaxLayers:              policyCfg.MaxLayers,
+		MaxCompressedSizeBytes: policyCfg.MaxCompressedSizeBytes,
 	}
-
-	return false
 }
 
 func containsDockerError(errorsList errcode.Errors, errCode errcode.ErrorCode) bool {
@@ -327,9 +362,6 @@ func tryParsingErrorMessage(err error) error {
 	if newErr.Error() == "unable to retrieve auth token: 401 unauthorized" {
 		return errorspkg.New("authorization failed: username and password are invalid")
 	}
-	if newErr.Error() == "directory provided instead of a tar file" {
-		return errorspkg.New("invalid base image: " + newErr.Error())
-	}
 	if regexp.MustCompile("pulling the image: fetching list of layer infos: fetching image reference: .*: no such file or directory").MatchString(err.Error()) {
 		return errorspkg.New("Image source doesn't exist")
 	}
@@ -4,21 +4,36 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"code.cloudfoundry.org/commandrunner"
 	"code.cloudfoundry.org/commandrunner/linux_command_runner"
 	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/base_image_puller/signature"
 	unpackerpkg "code.cloudfoundry.org/grootfs/base_image_puller/unpacker"
 	"code.cloudfoundry.org/grootfs/commands/config"
+	"code.cloudfoundry.org/grootfs/fetcher/credentials"
+	"code.cloudfoundry.org/grootfs/fetcher/directory_fetcher"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/grootfs/fetcher/tar_fetcher"
 	"code.cloudfoundry.org/grootfs/groot"
 	"code.cloudfoundry.org/grootfs/metrics"
+	"code.cloudfoundry.org/grootfs/progress"
+	storepkg "code.cloudfoundry.org/grootfs/store"
 	"code.cloudfoundry.org/grootfs/store/filesystems/btrfs"
 	"code.cloudfoundry.org/grootfs/store/filesystems/namespaced"
 	"code.cloudfoundry.org/grootfs/store/filesystems/overlayxfs"
 	"code.cloudfoundry.org/grootfs/store/image_cloner"
+	"code.cloudfoundry.org/grootfs/store/manager"
 	"code.cloudfoundry.org/lager"
+	"github.com/containers/image/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/opencontainers/runc/libcontainer/user"
 	errorspkg "github.com/pkg/errors"
 	"github.com/urfave/cli"
@@ -107,10 +122,13 @@ func readSubGIDMapping(groupname string) ([]groot.IDMappingSpec, error) {
 	return readSubIDMapping(groupname, group.Gid, "/etc/subgid")
 }
 
+// readSubIDMapping maps root to the given id and every subordinate id range
+// of name to the namespace ids that follow, in the order they are listed.
 func readSubIDMapping(name string, id int, subidPath string) ([]groot.IDMappingSpec, error) {
-	mappings := []groot.IDMappingSpec{{
-		HostID: id, NamespaceID: 0, Size: 1,
-	}}
+	idMap, err := groot.IDMap{}.AppendHostRange(id, 1)
+	if err != nil {
+		return nil, err
+	}
 
 	contents, err := ioutil.ReadFile(subidPath)
 	if err != nil {
@@ -120,6 +138,9 @@ func readSubIDMapping(name string, id int, subidPath string) ([]groot.IDMappingS
 	for _, line := range strings.Fields(string(contents)) {
 		entry := strings.Split(line, ":")
 		if entry[0] == name {
+			if len(entry) != 3 {
+				return nil, errorspkg.Errorf("malformed entry `%s` in %s", line, subidPath)
+			}
 			hostID, err := strconv.Atoi(entry[1])
 			if err != nil {
 				return nil, err
@@ -128,15 +149,183 @@ func readSubIDMapping(name string, id int, subidPath string) ([]groot.IDMappingS
 			if err != nil {
 				return nil, err
 			}
-			mappings = append(mappings, groot.IDMappingSpec{
-				HostID:      hostID,
-				NamespaceID: 1,
-				Size:        size,
-			})
+			idMap, err = idMap.AppendHostRange(hostID, size)
+			if err != nil {
+				return nil, errorspkg.Errorf("invalid ranges in %s: %s", subidPath, err)
+			}
 		}
 	}
 
-	return mappings, nil
+	return idMap, nil
+}
+
+// createUnpacker unpacks as root when grootfs runs as root, and with the id
+// mapping helpers otherwise, in which case the IDMapper is returned too.
+func createUnpacker(cfg config.Config, runner commandrunner.CommandRunner) (base_image_puller.Unpacker, unpackerpkg.IDMapper, error) {
+	unpackerStrategy := unpackerpkg.UnpackStrategy{
+		Name:               cfg.FSDriver,
+		WhiteoutDevicePath: filepath.Join(cfg.StorePath, overlayxfs.WhiteoutDevice),
+		XattrAllowlist:     cfg.Create.XattrAllowlist,
+		DeviceNodes: unpackerpkg.DeviceNodePolicy{
+			Mode:    cfg.Create.DeviceNodes.Policy,
+			Allowed: cfg.Create.DeviceNodes.Allowed,
+		},
+		FileModes: unpackerpkg.FileModePolicy{
+			SetID:         cfg.Create.FileModes.SetID,
+			WorldWritable: cfg.Create.FileModes.WorldWritable,
+		},
+	}
+
+	if os.Getuid() == 0 {
+		unpacker, err := unpackerpkg.NewTarUnpacker(unpackerStrategy)
+		if err != nil {
+			return nil, nil, err
+		}
+		return unpacker, nil, nil
+	}
+
+	idMapper := unpackerpkg.NewIDMapper(cfg.NewuidmapBin, cfg.NewgidmapBin, runner)
+	return unpackerpkg.NewNSIdMapperUnpacker(runner, idMapper, unpackerStrategy), idMapper, nil
+}
+
+// createBaseImageFetcher looks up the registry credentials when they are not
+// given, and creates the fetcher for the base image.
+func createBaseImageFetcher(logger lager.Logger, baseImageURL *url.URL, platform specsv1.Platform, cfg config.Config, username, password string) (base_image_puller.Fetcher, func(), error) {
+	registryCredentials, err := lookupRegistryCredentials(logger, baseImageURL, cfg.Create, username, password)
+	if err != nil {
+		logger.Error("looking-up-registry-credentials-failed", err)
+		return nil, nil, err
+	}
+
+	storeOptions, err := manager.ReadStoreOptions(cfg.StorePath)
+	if err != nil {
+		logger.Error("reading-store-options-failed", err)
+		return nil, nil, err
+	}
+
+	systemContext := createSystemContext(baseImageURL, cfg.Create, registryCredentials.Username, registryCredentials.Password)
+	fetcher, closeFetcher := createFetcher(baseImageURL, systemContext, platform, cfg.Create, cfg.StorePath, storeOptions)
+	return fetcher, closeFetcher, nil
+}
+
+// createFetcher also returns a function that cleans up what the fetcher
+// downloaded and did not use, to call once the image is pulled.
+func createFetcher(baseImageUrl *url.URL, systemContext types.SystemContext, platform specsv1.Platform, createCfg config.Create, storePath string, storeOptions manager.StoreOptions) (base_image_puller.Fetcher, func()) {
+	if baseImageUrl.Scheme == "" {
+		if directory_fetcher.IsDirectory(baseImageUrl.String()) {
+			return directory_fetcher.NewDirectoryFetcher(), func() {}
+		}
+		if storeOptions.ContentAddressedTarImages {
+			digestCache := tar_fetcher.NewDigestCache(filepath.Join(storePath, storepkg.MetaDirName, "tar-digests"))
+			return tar_fetcher.NewContentAddressedTarFetcher(digestCache), func() {}
+		}
+		return tar_fetcher.NewTarFetcher(), func() {}
+	}
+
+	isOCIImage := baseImageUrl.Scheme == "oci" || baseImageUrl.Scheme == source.OCIArchiveScheme
+	skipOCIChecksumValidation := createCfg.SkipLayerValidation && isOCIImage
+	diffIDCache := source.NewDiffIDCache(filepath.Join(storePath, storepkg.MetaDirName, "diff-ids"))
+	layerSource := source.NewLayerSource(systemContext, skipOCIChecksumValidation, platform, createCfg.RegistryMirrors, createRetryPolicy(createCfg.RetryPolicy), diffIDCache)
+
+	var manifestCache *layer_fetcher.ManifestCache
+	if baseImageUrl.Scheme == "docker" {
+		manifestCache = layer_fetcher.NewManifestCache(
+			filepath.Join(storePath, storepkg.MetaDirName, "manifests"),
+			time.Duration(createCfg.ManifestCacheTTLSeconds)*time.Second,
+		)
+	}
+	fetcher := layer_fetcher.NewLayerFetcher(&layerSource, platform, createCfg.StreamLayers, manifestCache, createCfg.Offline, createForeignLayerPolicy(createCfg.ForeignLayers))
+	return fetcher, layerSource.Close
+}
+
+func createForeignLayerPolicy(foreignLayersCfg config.ForeignLayers) layer_fetcher.ForeignLayerPolicy {
+	return layer_fetcher.ForeignLayerPolicy{
+		Deny:         foreignLayersCfg.Deny,
+		AllowedHosts: foreignLayersCfg.AllowedHosts,
+		URLRewrites:  foreignLayersCfg.URLRewrites,
+	}
+}
+
+func createSignatureVerifier(createCfg config.Create) (base_image_puller.SignatureVerifier, error) {
+	if createCfg.TrustPolicy == "" {
+		return nil, nil
+	}
+
+	policy, err := signature.LoadPolicy(createCfg.TrustPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	return signature.NewVerifier(policy, createCfg.Sigstore), nil
+}
+
+// createProgressReporter returns a nil interface when --progress-fd is not
+// given, so that no progress is reported. The returned function closes the
+// file descriptor.
+func createProgressReporter(ctx *cli.Context) (groot.ProgressReporter, func()) {
+	if !ctx.IsSet("progress-fd") {
+		return nil, func() {}
+	}
+
+	progressFile := os.NewFile(uintptr(ctx.Int("progress-fd")), "progress")
+	return progress.NewReporter(progressFile), func() { _ = progressFile.Close() }
+}
+
+func createRetryPolicy(retryPolicyCfg config.RetryPolicy) source.RetryPolicy {
+	retryPolicy := source.DefaultRetryPolicy()
+	if retryPolicyCfg.MaxAttempts != 0 {
+		retryPolicy.MaxAttempts = retryPolicyCfg.MaxAttempts
+	}
+	if retryPolicyCfg.InitialBackoffMs != 0 {
+		retryPolicy.InitialBackoff = time.Duration(retryPolicyCfg.InitialBackoffMs) * time.Millisecond
+	}
+	if retryPolicyCfg.MaxBackoffMs != 0 {
+		retryPolicy.MaxBackoff = time.Duration(retryPolicyCfg.MaxBackoffMs) * time.Millisecond
+	}
+	if retryPolicyCfg.Jitter != nil {
+		retryPolicy.Jitter = *retryPolicyCfg.Jitter
+	}
+
+	return retryPolicy
+}
+
+func createSystemContext(baseImageURL *url.URL, createConfig config.Create, username, password string) types.SystemContext {
+	scheme := baseImageURL.Scheme
+	switch scheme {
+	case "docker":
+		return types.SystemContext{
+			DockerInsecureSkipTLSVerify: skipTLSValidation(baseImageURL, createConfig.InsecureRegistries),
+			DockerAuthConfig: &types.DockerAuthConfig{
+				Username: username,
+				Password: password,
+			},
+		}
+	case "oci", source.OCIArchiveScheme:
+		return types.SystemContext{
+			OCICertPath: createConfig.RemoteLayerClientCertificatesPath,
+		}
+	default:
+		return types.SystemContext{}
+	}
+
+}
+
+func lookupRegistryCredentials(logger lager.Logger, baseImageURL *url.URL, createConfig config.Create, username, password string) (credentials.Credentials, error) {
+	if baseImageURL.Scheme != "docker" || username != "" || password != "" {
+		return credentials.Credentials{Username: username, Password: password}, nil
+	}
+
+	return credentials.NewStore(createConfig.AuthFile).Credentials(logger, baseImageURL.Host)
+}
+
+func skipTLSValidation(baseImageURL *url.URL, trustedRegistries []string) bool {
+	for _, trustedRegistry := range trustedRegistries {
+		if baseImageURL.Host == trustedRegistry {
+			return true
+		}
+	}
+
+	return false
 }
 
 type exitErrorFunc func(message string, exitCode int) *cli.ExitError
@@ -36,6 +36,10 @@ var InitStoreCommand = cli.Command{
 			Name:  "store-size-bytes",
 			Usage: "Creates a new filesystem of the given size and mounts it to the given Store Directory",
 		},
+		cli.BoolFlag{
+			Name:  "content-addressed-tar-images",
+			Usage: "Identify local tar base images by the sha256 of their contents instead of their path and modification time",
+		},
 	},
 
 	Action: func(ctx *cli.Context) error {
@@ -48,7 +52,8 @@ var InitStoreCommand = cli.Command{
 		}
 
 		configBuilder := ctx.App.Metadata["configBuilder"].(*config.Builder).
-			WithStoreSizeBytes(ctx.Int64("store-size-bytes"))
+			WithStoreSizeBytes(ctx.Int64("store-size-bytes")).
+			WithContentAddressedTarImages(ctx.Bool("content-addressed-tar-images"))
 		cfg, err := configBuilder.Build()
 		logger.Debug("init-store", lager.Data{"currentConfig": cfg})
 		if err != nil {
@@ -100,6 +105,9 @@ var InitStoreCommand = cli.Command{
 			UIDMappings:    uidMappings,
 			GIDMappings:    gidMappings,
 			StoreSizeBytes: storeSizeBytes,
+			Options: manager.StoreOptions{
+				ContentAddressedTarImages: cfg.Init.ContentAddressedTarImages,
+			},
 		}
 
 		manager := manager.New(storePath, namespacer, fsDriver, fsDriver, fsDriver)
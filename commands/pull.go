@@ -0,0 +1,254 @@
+package commands // import "code.cloudfoundry.org/grootfs/commands"
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/commandrunner/linux_command_runner"
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/commands/config"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/metrics"
+	storepkg "code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/store/dependency_manager"
+	"code.cloudfoundry.org/grootfs/store/filesystems/namespaced"
+	locksmithpkg "code.cloudfoundry.org/grootfs/store/locksmith"
+	"code.cloudfoundry.org/grootfs/store/manager"
+	"code.cloudfoundry.org/lager"
+
+	errorspkg "github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var PullCommand = cli.Command{
+	Name:        "pull",
+	Usage:       "pull [options] <image>",
+	Description: "Downloads and unpacks the layers of an image without creating a root filesystem, and keeps them until the image is unpulled.",
+
+	Flags: []cli.Flag{
+		cli.Int64Flag{
+			Name:  "retention-seconds",
+			Usage: "Keep the layers for this long after the pull instead of until the image is unpulled",
+		},
+		cli.StringSliceFlag{
+			Name:  "insecure-registry",
+			Usage: "Whitelist a private registry",
+		},
+		cli.BoolFlag{
+			Name:  "skip-layer-validation",
+			Usage: "Do not validate checksums of image layers. (Can only be used with oci:/// and oci-archive:/// protocol images.)",
+		},
+		cli.StringFlag{
+			Name:  "username",
+			Usage: "Username to authenticate in image registry",
+		},
+		cli.StringFlag{
+			Name:  "password",
+			Usage: "Password to authenticate in image registry",
+		},
+		cli.StringFlag{
+			Name:  "platform",
+			Usage: "Platform to select from multi-arch images, e.g.: linux/arm64/v8 (defaults to the host platform)",
+		},
+		cli.StringFlag{
+			Name:  "auth-file",
+			Usage: "Path to a docker config.json used to look up registry credentials and credential helpers",
+		},
+		cli.BoolFlag{
+			Name:  "stream-layers",
+			Usage: "Unpack layers while they are downloaded instead of storing them in a temporary file first",
+		},
+		cli.StringFlag{
+			Name:  "file-modes-setid",
+			Usage: "What to do with the setuid and setgid bits of image files: keep, sanitize or reject",
+		},
+		cli.StringFlag{
+			Name:  "file-modes-world-writable",
+			Usage: "What to do with the world-writable bit of image files outside of /tmp: keep, sanitize or reject",
+		},
+		cli.StringFlag{
+			Name:  "trust-policy",
+			Usage: "Path to a trust policy file used to verify the signatures of registry images",
+		},
+		cli.StringFlag{
+			Name:  "sigstore",
+			Usage: "Path to the directory containing the image signatures",
+		},
+	},
+
+	Action: func(ctx *cli.Context) error {
+		logger := ctx.App.Metadata["logger"].(lager.Logger)
+		logger = logger.Session("pull")
+		newExitError := newErrorHandler(logger, "pull")
+
+		if ctx.NArg() != 1 {
+			logger.Error("parsing-command", errorspkg.New("invalid arguments"), lager.Data{"args": ctx.Args()})
+			return newExitError(fmt.Sprintf("invalid arguments - usage: %s", ctx.Command.Usage), 1)
+		}
+
+		configBuilder := ctx.App.Metadata["configBuilder"].(*config.Builder)
+		configBuilder.WithInsecureRegistries(ctx.StringSlice("insecure-registry")).
+			WithRetentionSeconds(ctx.Int64("retention-seconds"), ctx.IsSet("retention-seconds")).
+			WithSkipLayerValidation(ctx.Bool("skip-layer-validation"), ctx.IsSet("skip-layer-validation")).
+			WithAuthFile(ctx.String("auth-file"), ctx.IsSet("auth-file")).
+			WithPlatform(ctx.String("platform"), ctx.IsSet("platform")).
+			WithStreamLayers(ctx.Bool("stream-layers"), ctx.IsSet("stream-layers")).
+			WithFileModesSetID(ctx.String("file-modes-setid"), ctx.IsSet("file-modes-setid")).
+			WithFileModesWorldWritable(ctx.String("file-modes-world-writable"), ctx.IsSet("file-modes-world-writable")).
+			WithTrustPolicy(ctx.String("trust-policy"), ctx.IsSet("trust-policy")).
+			WithSigstore(ctx.String("sigstore"), ctx.IsSet("sigstore"))
+
+		cfg, err := configBuilder.Build()
+		logger.Debug("pull-config", lager.Data{"currentConfig": cfg})
+		if err != nil {
+			logger.Error("config-builder-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		platform, err := source.ParsePlatform(cfg.Create.Platform)
+		if err != nil {
+			logger.Error("parsing-platform-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		storePath := cfg.StorePath
+		baseImage := ctx.Args().First()
+		baseImageURL, err := url.Parse(baseImage)
+		if err != nil {
+			logger.Error("base-image-url-parsing-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		fsDriver, err := createFileSystemDriver(cfg)
+		if err != nil {
+			return newExitError(err.Error(), 1)
+		}
+
+		metricsEmitter := metrics.NewEmitter()
+		sharedLocksmith := locksmithpkg.NewSharedFileSystem(storePath, metricsEmitter)
+		exclusiveLocksmith := locksmithpkg.NewExclusiveFileSystem(storePath, metricsEmitter)
+
+		storeNamespacer := groot.NewStoreNamespacer(storePath)
+		manager := manager.New(storePath, storeNamespacer, fsDriver, fsDriver, fsDriver)
+		if !manager.IsStoreInitialized(logger) {
+			logger.Error("store-verification-failed", errors.New("store is not initialized"))
+			return newExitError("Store path is not initialized. Please run init-store.", 1)
+		}
+
+		idMappings, err := storeNamespacer.Read()
+		if err != nil {
+			logger.Error("reading-namespace-file", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		runner := linux_command_runner.New()
+		unpacker, idMapper, err := createUnpacker(cfg, runner)
+		if err != nil {
+			return newExitError(err.Error(), 1)
+		}
+
+		dependencyManager := dependency_manager.NewDependencyManager(
+			filepath.Join(storePath, storepkg.MetaDirName, "dependencies"),
+		)
+
+		nsFsDriver := namespaced.New(fsDriver, idMappings, idMapper, runner)
+
+		signatureVerifier, err := createSignatureVerifier(cfg.Create)
+		if err != nil {
+			logger.Error("loading-trust-policy-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		fetcher, closeFetcher, err := createBaseImageFetcher(logger, baseImageURL, platform, cfg, ctx.String("username"), ctx.String("password"))
+		if err != nil {
+			return newExitError(err.Error(), 1)
+		}
+		defer closeFetcher()
+
+		baseImagePuller := base_image_puller.NewBaseImagePuller(
+			fetcher,
+			unpacker,
+			nsFsDriver,
+			dependencyManager,
+			metricsEmitter,
+			exclusiveLocksmith,
+			signatureVerifier,
+			nil,
+		)
+
+		puller := groot.IamPuller(baseImagePuller, sharedLocksmith, dependencyManager, metricsEmitter)
+
+		pullSpec := groot.PullSpec{
+			BaseImageURL:    baseImageURL,
+			Retention:       time.Duration(cfg.Pull.RetentionSeconds) * time.Second,
+			UIDMappings:     idMappings.UIDMappings,
+			GIDMappings:     idMappings.GIDMappings,
+			AdmissionPolicy: createAdmissionPolicy(cfg.Policy),
+		}
+		if _, err := puller.Pull(logger, pullSpec); err != nil {
+			logger.Error("pulling", err)
+			if _, ok := errorspkg.Cause(err).(*groot.PolicyViolationError); ok {
+				return newExitError(errorspkg.Cause(err).Error(), policyViolationExitCode)
+			}
+			humanizedError := tryHumanize(err, groot.CreateSpec{BaseImageURL: baseImageURL})
+			return newExitError(humanizedError, 1)
+		}
+
+		fmt.Printf("Image %s pulled\n", baseImage)
+		metricsEmitter.TryIncrementRunCount("pull", nil)
+		return nil
+	},
+}
+
+var UnpullCommand = cli.Command{
+	Name:        "unpull",
+	Usage:       "unpull <image>",
+	Description: "Allows the layers of a pulled image to be cleaned up once no image uses them.",
+
+	Action: func(ctx *cli.Context) error {
+		logger := ctx.App.Metadata["logger"].(lager.Logger)
+		logger = logger.Session("unpull")
+		newExitError := newErrorHandler(logger, "unpull")
+
+		if ctx.NArg() != 1 {
+			logger.Error("parsing-command", errorspkg.New("invalid arguments"), lager.Data{"args": ctx.Args()})
+			return newExitError(fmt.Sprintf("invalid arguments - usage: %s", ctx.Command.Usage), 1)
+		}
+
+		configBuilder := ctx.App.Metadata["configBuilder"].(*config.Builder)
+		cfg, err := configBuilder.Build()
+		logger.Debug("unpull-config", lager.Data{"currentConfig": cfg})
+		if err != nil {
+			logger.Error("config-builder-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		storePath := cfg.StorePath
+		baseImage := ctx.Args().First()
+		baseImageURL, err := url.Parse(baseImage)
+		if err != nil {
+			logger.Error("base-image-url-parsing-failed", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		metricsEmitter := metrics.NewEmitter()
+		sharedLocksmith := locksmithpkg.NewSharedFileSystem(storePath, metricsEmitter)
+		dependencyManager := dependency_manager.NewDependencyManager(
+			filepath.Join(storePath, storepkg.MetaDirName, "dependencies"),
+		)
+
+		puller := groot.IamPuller(nil, sharedLocksmith, dependencyManager, metricsEmitter)
+		if err := puller.Unpull(logger, baseImageURL); err != nil {
+			logger.Error("unpulling", err)
+			return newExitError(err.Error(), 1)
+		}
+
+		fmt.Printf("Image %s unpulled\n", baseImage)
+		metricsEmitter.TryIncrementRunCount("unpull", nil)
+		return nil
+	},
+}
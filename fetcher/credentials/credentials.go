@@ -0,0 +1,170 @@
+package credentials // import "code.cloudfoundry.org/grootfs/fetcher/credentials"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/docker/docker-credential-helpers/client"
+	helperspkg "github.com/docker/docker-credential-helpers/credentials"
+	errorspkg "github.com/pkg/errors"
+)
+
+const (
+	DefaultRegistryHost  = "docker.io"
+	helperProgramPrefix  = "docker-credential-"
+	dockerHubIndexServer = "https://index.docker.io/v1/"
+)
+
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type dockerConfigFile struct {
+	Auths       map[string]dockerAuthEntry `json:"auths"`
+	CredsStore  string                     `json:"credsStore,omitempty"`
+	CredHelpers map[string]string          `json:"credHelpers,omitempty"`
+}
+
+type dockerAuthEntry struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type Store struct {
+	authFilePath string
+}
+
+func NewStore(authFilePath string) *Store {
+	return &Store{
+		authFilePath: authFilePath,
+	}
+}
+
+// Credentials looks up the credentials for the given registry host in the
+// docker config file. A per-registry `credHelpers` entry wins over the
+// global `credsStore`, which wins over the inline `auths` entries. Empty
+// credentials are returned when nothing is configured for the host.
+func (s *Store) Credentials(logger lager.Logger, registryHost string) (Credentials, error) {
+	logger = logger.Session("looking-up-registry-credentials", lager.Data{"registryHost": registryHost, "authFile": s.authFilePath})
+	logger.Debug("starting")
+	defer logger.Debug("ending")
+
+	if s.authFilePath == "" {
+		return Credentials{}, nil
+	}
+
+	configFile, err := s.readConfigFile()
+	if err != nil {
+		if os.IsNotExist(errorspkg.Cause(err)) {
+			logger.Debug("auth-file-not-found")
+			return Credentials{}, nil
+		}
+		return Credentials{}, err
+	}
+
+	if registryHost == "" {
+		registryHost = DefaultRegistryHost
+	}
+	serverNames := registryServerNames(registryHost)
+
+	for _, serverName := range serverNames {
+		if helper, ok := configFile.CredHelpers[serverName]; ok {
+			logger.Debug("using-credential-helper", lager.Data{"helper": helper})
+			return s.helperCredentials(helper, serverNames)
+		}
+	}
+
+	if configFile.CredsStore != "" {
+		logger.Debug("using-credential-store", lager.Data{"helper": configFile.CredsStore})
+		return s.helperCredentials(configFile.CredsStore, serverNames)
+	}
+
+	for _, serverName := range serverNames {
+		for key, entry := range configFile.Auths {
+			if normalizeServerName(key) != serverName {
+				continue
+			}
+
+			logger.Debug("using-auth-entry", lager.Data{"serverName": key})
+			return decodeAuthEntry(entry)
+		}
+	}
+
+	logger.Debug("no-credentials-found")
+	return Credentials{}, nil
+}
+
+func (s *Store) readConfigFile() (dockerConfigFile, error) {
+	contents, err := ioutil.ReadFile(s.authFilePath)
+	if err != nil {
+		return dockerConfigFile{}, errorspkg.Wrap(err, "reading auth file")
+	}
+
+	var configFile dockerConfigFile
+	if err := json.Unmarshal(contents, &configFile); err != nil {
+		return dockerConfigFile{}, errorspkg.Wrapf(err, "invalid auth file `%s`", s.authFilePath)
+	}
+
+	return configFile, nil
+}
+
+func (s *Store) helperCredentials(helper string, serverNames []string) (Credentials, error) {
+	program := client.NewShellProgramFunc(helperProgramPrefix + helper)
+
+	for _, serverName := range serverNames {
+		creds, err := client.Get(program, serverName)
+		if err != nil {
+			if helperspkg.IsErrCredentialsNotFound(err) {
+				continue
+			}
+			return Credentials{}, errorspkg.Wrapf(err, "getting credentials from `%s%s`", helperProgramPrefix, helper)
+		}
+
+		return Credentials{Username: creds.Username, Password: creds.Secret}, nil
+	}
+
+	return Credentials{}, nil
+}
+
+func decodeAuthEntry(entry dockerAuthEntry) (Credentials, error) {
+	if entry.Auth == "" {
+		return Credentials{Username: entry.Username, Password: entry.Password}, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+	if err != nil {
+		return Credentials{}, errorspkg.Wrap(err, "decoding auth entry")
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return Credentials{}, errorspkg.New("invalid auth entry: expected `username:password`")
+	}
+
+	return Credentials{Username: parts[0], Password: parts[1]}, nil
+}
+
+func registryServerNames(registryHost string) []string {
+	switch registryHost {
+	case DefaultRegistryHost, "index.docker.io", "registry-1.docker.io":
+		return []string{dockerHubIndexServer, DefaultRegistryHost, "index.docker.io", "registry-1.docker.io"}
+	default:
+		return []string{registryHost}
+	}
+}
+
+func normalizeServerName(serverName string) string {
+	if serverName == dockerHubIndexServer {
+		return serverName
+	}
+
+	serverName = strings.TrimPrefix(serverName, "https://")
+	serverName = strings.TrimPrefix(serverName, "http://")
+	return strings.SplitN(serverName, "/", 2)[0]
+}
@@ -0,0 +1,173 @@
+package credentials_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/fetcher/credentials"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/st3v/glager"
+)
+
+const fakeHelperScript = `#!/bin/sh
+read server
+if [ "$1" != "get" ]; then
+	exit 1
+fi
+
+if [ "$server" = "%s" ]; then
+	echo '{"ServerURL":"'$server'","Username":"helper-user","Secret":"helper-secret"}'
+	exit 0
+fi
+
+echo "credentials not found in native keychain"
+exit 1
+`
+
+var _ = Describe("Store", func() {
+	var (
+		logger       *TestLogger
+		tmpDir       string
+		authFilePath string
+		originalPath string
+		store        *credentials.Store
+	)
+
+	writeAuthFile := func(contents string) {
+		Expect(ioutil.WriteFile(authFilePath, []byte(contents), 0600)).To(Succeed())
+	}
+
+	writeHelper := func(name, knownServer string) {
+		helperPath := filepath.Join(tmpDir, "docker-credential-"+name)
+		Expect(ioutil.WriteFile(helperPath, []byte(fmt.Sprintf(fakeHelperScript, knownServer)), 0755)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "credentials")
+		Expect(err).NotTo(HaveOccurred())
+
+		originalPath = os.Getenv("PATH")
+		Expect(os.Setenv("PATH", tmpDir+":"+originalPath)).To(Succeed())
+
+		logger = NewLogger("credentials")
+		authFilePath = filepath.Join(tmpDir, "config.json")
+		store = credentials.NewStore(authFilePath)
+	})
+
+	AfterEach(func() {
+		Expect(os.Setenv("PATH", originalPath)).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Context("when the auth file has an inline auth entry", func() {
+		BeforeEach(func() {
+			// "user:pass"
+			writeAuthFile(`{"auths": {"https://my-registry.example.com:5000": {"auth": "dXNlcjpwYXNz"}}}`)
+		})
+
+		It("decodes the credentials for the matching host", func() {
+			creds, err := store.Credentials(logger, "my-registry.example.com:5000")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(Equal(credentials.Credentials{Username: "user", Password: "pass"}))
+		})
+
+		It("returns empty credentials for other hosts", func() {
+			creds, err := store.Credentials(logger, "other-registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(Equal(credentials.Credentials{}))
+		})
+
+		Context("and the entry is not valid base64", func() {
+			BeforeEach(func() {
+				writeAuthFile(`{"auths": {"my-registry.example.com": {"auth": "not base64!"}}}`)
+			})
+
+			It("returns an error", func() {
+				_, err := store.Credentials(logger, "my-registry.example.com")
+				Expect(err).To(MatchError(ContainSubstring("decoding auth entry")))
+			})
+		})
+	})
+
+	Context("when the host is empty", func() {
+		BeforeEach(func() {
+			writeAuthFile(`{"auths": {"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNz"}}}`)
+		})
+
+		It("uses the docker hub entry", func() {
+			creds, err := store.Credentials(logger, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.Username).To(Equal("user"))
+		})
+	})
+
+	Context("when a credential helper is configured for the host", func() {
+		BeforeEach(func() {
+			writeHelper("fake", "my-registry.example.com")
+			writeAuthFile(`{
+				"auths": {"my-registry.example.com": {"auth": "dXNlcjpwYXNz"}},
+				"credHelpers": {"my-registry.example.com": "fake"}
+			}`)
+		})
+
+		It("runs the helper instead of using the inline entry", func() {
+			creds, err := store.Credentials(logger, "my-registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(Equal(credentials.Credentials{Username: "helper-user", Password: "helper-secret"}))
+		})
+
+		Context("when the helper does not exist", func() {
+			BeforeEach(func() {
+				writeAuthFile(`{"credHelpers": {"my-registry.example.com": "missing"}}`)
+			})
+
+			It("returns an error", func() {
+				_, err := store.Credentials(logger, "my-registry.example.com")
+				Expect(err).To(MatchError(ContainSubstring("docker-credential-missing")))
+			})
+		})
+	})
+
+	Context("when a credential store is configured", func() {
+		BeforeEach(func() {
+			writeHelper("store", "my-registry.example.com")
+			writeAuthFile(`{"credsStore": "store"}`)
+		})
+
+		It("runs the store helper", func() {
+			creds, err := store.Credentials(logger, "my-registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.Username).To(Equal("helper-user"))
+		})
+
+		It("returns empty credentials when the helper doesn't know the host", func() {
+			creds, err := store.Credentials(logger, "other-registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(Equal(credentials.Credentials{}))
+		})
+	})
+
+	Context("when the auth file does not exist", func() {
+		It("returns empty credentials", func() {
+			creds, err := store.Credentials(logger, "my-registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(Equal(credentials.Credentials{}))
+		})
+	})
+
+	Context("when the auth file is invalid", func() {
+		BeforeEach(func() {
+			writeAuthFile("{not-json")
+		})
+
+		It("returns an error", func() {
+			_, err := store.Credentials(logger, "my-registry.example.com")
+			Expect(err).To(MatchError(ContainSubstring("invalid auth file")))
+		})
+	})
+})
@@ -0,0 +1,226 @@
+package directory_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/directory_fetcher"
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/lager"
+	errorspkg "github.com/pkg/errors"
+)
+
+type DirectoryFetcher struct {
+}
+
+func NewDirectoryFetcher() *DirectoryFetcher {
+	return &DirectoryFetcher{}
+}
+
+func IsDirectory(baseImagePath string) bool {
+	stat, err := os.Stat(baseImagePath)
+	return err == nil && stat.IsDir()
+}
+
+func (f *DirectoryFetcher) StreamBlob(logger lager.Logger, baseImageURL *url.URL,
+	layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+	logger = logger.Session("stream-blob", lager.Data{
+		"baseImageURL": baseImageURL.String(),
+		"source":       layerInfo.BlobID,
+	})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	baseImagePath := baseImageURL.String()
+	if err := f.validateBaseImage(baseImagePath); err != nil {
+		return nil, 0, errorspkg.Wrap(err, "invalid base image")
+	}
+
+	logger.Debug("streaming-directory", lager.Data{"baseImagePath": baseImagePath})
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(f.writeTar(logger, baseImagePath, writer))
+	}()
+
+	return reader, 0, nil
+}
+
+func (f *DirectoryFetcher) BaseImageInfo(logger lager.Logger, baseImageURL *url.URL) (base_image_puller.BaseImageInfo, error) {
+	logger = logger.Session("layers-digest", lager.Data{"baseImageURL": baseImageURL.String()})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	baseImagePath := baseImageURL.String()
+	if err := f.validateBaseImage(baseImagePath); err != nil {
+		return base_image_puller.BaseImageInfo{}, errorspkg.Wrap(err, "invalid base image")
+	}
+
+	fingerprint, latestModTime, err := f.fingerprint(baseImagePath)
+	if err != nil {
+		return base_image_puller.BaseImageInfo{}, errorspkg.Wrap(err, "fingerprinting image directory")
+	}
+	logger.Debug("fingerprinted-directory", lager.Data{"fingerprint": fingerprint, "latestModTime": latestModTime})
+
+	return base_image_puller.BaseImageInfo{
+		LayerInfos: []base_image_puller.LayerInfo{
+			base_image_puller.LayerInfo{
+				BlobID:        baseImagePath,
+				ParentChainID: "",
+				ChainID:       f.generateChainID(baseImagePath, fingerprint, latestModTime),
+			},
+		},
+	}, nil
+}
+
+// generateChainID follows the format of the tar fetcher chain IDs, so that
+// the garbage collector treats directory volumes as local tar volumes.
+func (f *DirectoryFetcher) generateChainID(baseImagePath, fingerprint string, timestamp int64) string {
+	chainIDSha := sha256.Sum256([]byte(baseImagePath + " " + fingerprint))
+	return fmt.Sprintf("%s-%019d", hex.EncodeToString(chainIDSha[:]), timestamp)
+}
+
+// fingerprint hashes the metadata of every entry in the directory tree. Any
+// added, removed, renamed or modified file changes the fingerprint without
+// having to read the file contents.
+func (f *DirectoryFetcher) fingerprint(baseImagePath string) (string, int64, error) {
+	hash := sha256.New()
+	var latestModTime int64
+
+	err := filepath.Walk(baseImagePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(baseImagePath, path)
+		if err != nil {
+			return err
+		}
+
+		var linkTarget string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if linkTarget, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		var uid, gid uint32
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = stat.Uid, stat.Gid
+		}
+
+		modTime := info.ModTime().UnixNano()
+		if modTime > latestModTime {
+			latestModTime = modTime
+		}
+
+		fmt.Fprintf(hash, "%q %o %d %d %d:%d %q\n", relPath, info.Mode(), info.Size(), modTime, uid, gid, linkTarget)
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), latestModTime, nil
+}
+
+func (f *DirectoryFetcher) writeTar(logger lager.Logger, baseImagePath string, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	hardlinks := map[uint64]string{}
+
+	err := filepath.Walk(baseImagePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSocket != 0 {
+			logger.Debug("skipping-socket", lager.Data{"path": path})
+			return nil
+		}
+
+		relPath, err := filepath.Rel(baseImagePath, path)
+		if err != nil {
+			return err
+		}
+
+		var linkTarget string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if linkTarget, err = os.Readlink(path); err != nil {
+				return errorspkg.Wrapf(err, "reading symlink `%s`", path)
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, linkTarget)
+		if err != nil {
+			return errorspkg.Wrapf(err, "creating tar header for `%s`", path)
+		}
+
+		switch {
+		case relPath == ".":
+			header.Name = "./"
+		case info.IsDir():
+			header.Name = "./" + relPath + "/"
+		default:
+			header.Name = "./" + relPath
+		}
+
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			header.Uid = int(stat.Uid)
+			header.Gid = int(stat.Gid)
+
+			if info.Mode().IsRegular() && stat.Nlink > 1 {
+				if firstName, ok := hardlinks[stat.Ino]; ok {
+					header.Typeflag = tar.TypeLink
+					header.Linkname = firstName
+					header.Size = 0
+				} else {
+					hardlinks[stat.Ino] = header.Name
+				}
+			}
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return errorspkg.Wrapf(err, "writing tar header for `%s`", path)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return errorspkg.Wrapf(err, "opening `%s`", path)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(tarWriter, file); err != nil {
+			return errorspkg.Wrapf(err, "writing `%s` to the tar stream", path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Error("writing-tar-failed", err)
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+func (f *DirectoryFetcher) validateBaseImage(baseImagePath string) error {
+	stat, err := os.Stat(baseImagePath)
+	if err != nil {
+		return errorspkg.Wrapf(err, "local image not found in `%s`", baseImagePath)
+	}
+
+	if !stat.IsDir() {
+		return errorspkg.Errorf("`%s` is not a directory", baseImagePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package directory_fetcher_test
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	fetcherpkg "code.cloudfoundry.org/grootfs/fetcher/directory_fetcher"
+	"code.cloudfoundry.org/grootfs/fetcher/tar_fetcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	. "github.com/st3v/glager"
+)
+
+var _ = Describe("Directory Fetcher", func() {
+	var (
+		fetcher *fetcherpkg.DirectoryFetcher
+
+		sourceImagePath string
+		logger          *TestLogger
+		baseImageURL    *url.URL
+	)
+
+	BeforeEach(func() {
+		fetcher = fetcherpkg.NewDirectoryFetcher()
+
+		var err error
+		sourceImagePath, err = ioutil.TempDir("", "image")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(path.Join(sourceImagePath, "a_file"), []byte("hello-world"), 0600)).To(Succeed())
+		Expect(os.Mkdir(path.Join(sourceImagePath, "a_dir"), 0755)).To(Succeed())
+		Expect(os.Symlink("../a_file", path.Join(sourceImagePath, "a_dir", "a_symlink"))).To(Succeed())
+		Expect(os.Link(path.Join(sourceImagePath, "a_file"), path.Join(sourceImagePath, "a_dir", "a_hardlink"))).To(Succeed())
+
+		baseImageURL, err = url.Parse(sourceImagePath)
+		Expect(err).NotTo(HaveOccurred())
+		logger = NewLogger("directory-fetcher")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(sourceImagePath)).To(Succeed())
+	})
+
+	Describe("StreamBlob", func() {
+		It("returns the contents of the directory as a tar stream", func() {
+			stream, _, err := fetcher.StreamBlob(logger, baseImageURL, base_image_puller.LayerInfo{})
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			entries := streamTar(tar.NewReader(stream))
+			Expect(entries).To(HaveLen(5))
+
+			Expect(entries[0].header.Name).To(Equal("./"))
+			Expect(entries[0].header.Typeflag).To(Equal(byte(tar.TypeDir)))
+
+			Expect(entries[1].header.Name).To(Equal("./a_dir/"))
+			Expect(entries[1].header.Typeflag).To(Equal(byte(tar.TypeDir)))
+
+			Expect(entries[2].header.Name).To(Equal("./a_dir/a_hardlink"))
+			Expect(entries[2].header.Typeflag).To(Equal(byte(tar.TypeReg)))
+			Expect(string(entries[2].contents)).To(Equal("hello-world"))
+
+			Expect(entries[3].header.Name).To(Equal("./a_dir/a_symlink"))
+			Expect(entries[3].header.Typeflag).To(Equal(byte(tar.TypeSymlink)))
+			Expect(entries[3].header.Linkname).To(Equal("../a_file"))
+
+			Expect(entries[4].header.Name).To(Equal("./a_file"))
+			Expect(entries[4].header.Typeflag).To(Equal(byte(tar.TypeLink)))
+			Expect(entries[4].header.Linkname).To(Equal("./a_dir/a_hardlink"))
+		})
+
+		It("keeps the file modes and owners", func() {
+			stream, _, err := fetcher.StreamBlob(logger, baseImageURL, base_image_puller.LayerInfo{})
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			entries := streamTar(tar.NewReader(stream))
+			Expect(entries[2].header.Mode).To(Equal(int64(0600)))
+			Expect(entries[2].header.Uid).To(Equal(os.Getuid()))
+			Expect(entries[2].header.Gid).To(Equal(os.Getgid()))
+		})
+
+		It("logs the directory being streamed", func() {
+			stream, _, err := fetcher.StreamBlob(logger, baseImageURL, base_image_puller.LayerInfo{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stream.Close()).To(Succeed())
+
+			Expect(logger).To(ContainSequence(
+				Debug(
+					Message("directory-fetcher.stream-blob.streaming-directory"),
+					Data("baseImagePath", sourceImagePath),
+				),
+			))
+		})
+
+		Context("when the source is a file", func() {
+			It("returns an error", func() {
+				imageURL, err := url.Parse(path.Join(sourceImagePath, "a_file"))
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, err = fetcher.StreamBlob(logger, imageURL, base_image_puller.LayerInfo{})
+				Expect(err).To(MatchError(ContainSubstring("is not a directory")))
+			})
+		})
+
+		Context("when the source does not exist", func() {
+			It("returns an error", func() {
+				imageURL, _ := url.Parse("/nothing/here")
+
+				_, _, err := fetcher.StreamBlob(logger, imageURL, base_image_puller.LayerInfo{})
+				Expect(err).To(MatchError(ContainSubstring("local image not found in `/nothing/here`")))
+			})
+		})
+	})
+
+	Describe("BaseImageInfo", func() {
+		var baseImageInfo base_image_puller.BaseImageInfo
+
+		JustBeforeEach(func() {
+			var err error
+			baseImageInfo, err = fetcher.BaseImageInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns a single layer for the directory", func() {
+			layers := baseImageInfo.LayerInfos
+
+			Expect(layers).To(HaveLen(1))
+			Expect(layers[0].BlobID).To(Equal(sourceImagePath))
+			Expect(layers[0].ChainID).NotTo(BeEmpty())
+			Expect(layers[0].ParentChainID).To(BeEmpty())
+
+			Expect(baseImageInfo.Config).To(Equal(v1.Image{}))
+		})
+
+		It("returns a chain ID that is collected like local tar volumes", func() {
+			Expect(tar_fetcher.IsLocalTarVolume(baseImageInfo.LayerInfos[0].ChainID)).To(BeTrue())
+		})
+
+		It("returns the same chain ID when nothing changes", func() {
+			newBaseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(newBaseImageInfo.LayerInfos[0].ChainID).To(Equal(baseImageInfo.LayerInfos[0].ChainID))
+		})
+
+		Context("when a nested file changes", func() {
+			It("generates another chain ID", func() {
+				time.Sleep(time.Millisecond * 10)
+				Expect(ioutil.WriteFile(path.Join(sourceImagePath, "a_dir", "a_hardlink"), []byte("bye-world"), 0600)).To(Succeed())
+
+				newBaseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(newBaseImageInfo.LayerInfos[0].ChainID).NotTo(Equal(baseImageInfo.LayerInfos[0].ChainID))
+			})
+		})
+
+		Context("when a file is renamed without changing any timestamp", func() {
+			It("generates another chain ID", func() {
+				dirStat, err := os.Stat(sourceImagePath)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.Rename(path.Join(sourceImagePath, "a_file"), path.Join(sourceImagePath, "b_file"))).To(Succeed())
+				Expect(os.Chtimes(sourceImagePath, dirStat.ModTime(), dirStat.ModTime())).To(Succeed())
+
+				newBaseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(newBaseImageInfo.LayerInfos[0].ChainID).NotTo(Equal(baseImageInfo.LayerInfos[0].ChainID))
+			})
+		})
+
+		Context("when all the files have an epoch timestamp", func() {
+			BeforeEach(func() {
+				Expect(os.Remove(path.Join(sourceImagePath, "a_dir", "a_symlink"))).To(Succeed())
+				for _, entry := range []string{"a_file", "a_dir", ""} {
+					Expect(os.Chtimes(path.Join(sourceImagePath, entry), time.Unix(0, 0), time.Unix(0, 0))).To(Succeed())
+				}
+			})
+
+			It("still returns a chain ID that is collected like local tar volumes", func() {
+				Expect(tar_fetcher.IsLocalTarVolume(baseImageInfo.LayerInfos[0].ChainID)).To(BeTrue())
+			})
+		})
+
+		Context("when the image doesn't exist", func() {
+			It("returns an error", func() {
+				imageURL, _ := url.Parse("/not-here")
+
+				_, err := fetcher.BaseImageInfo(logger, imageURL)
+				Expect(err).To(MatchError(ContainSubstring("local image not found")))
+			})
+		})
+	})
+})
+
+type tarEntry struct {
+	header   *tar.Header
+	contents []byte
+}
+
+func streamTar(r *tar.Reader) []tarEntry {
+	l := []tarEntry{}
+	for {
+		header, err := r.Next()
+		if err != nil {
+			Expect(err).To(Equal(io.EOF))
+			return l
+		}
+
+		contents, err := ioutil.ReadAll(r)
+		Expect(err).NotTo(HaveOccurred())
+		l = append(l, tarEntry{
+			header:   header,
+			contents: contents,
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package directory_fetcher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDirectoryFetcher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Directory Fetcher Suite")
+}
@@ -1,46 +1,78 @@
 package layer_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
 
 import (
-	"compress/gzip"
 	"io"
 	"os"
-	"strings"
 
+	"code.cloudfoundry.org/grootfs/base_image_puller"
 	errorspkg "github.com/pkg/errors"
 )
 
+// BlobReader reads a blob from a temporary file, which the source has
+// already verified.
 type BlobReader struct {
-	reader   io.Reader
+	reader   io.ReadCloser
+	stream   io.ReadCloser
 	filePath string
 }
 
+// StreamBlobReader reads a blob straight from its stream, which has to be
+// verified once it is read.
+type StreamBlobReader struct {
+	*BlobReader
+}
+
 func NewBlobReader(blobPath, mediaType string) (*BlobReader, error) {
 	zippedReader, err := os.Open(blobPath)
 	if err != nil {
 		return nil, errorspkg.Wrap(err, "failed to open blob")
 	}
 
-	if mediaType != "" && !strings.Contains(mediaType, "gzip") {
-		return &BlobReader{
-			filePath: blobPath,
-			reader:   zippedReader,
-		}, nil
-	}
-
-	reader, err := gzip.NewReader(zippedReader)
+	reader, err := decompressedReader(zippedReader, mediaType)
 	if err != nil {
-		return nil, errorspkg.Wrap(err, "blob file is not gzipped")
+		zippedReader.Close()
+		return nil, err
 	}
+
 	return &BlobReader{
 		filePath: blobPath,
+		stream:   zippedReader,
 		reader:   reader,
 	}, nil
 }
 
+func NewStreamBlobReader(stream io.ReadCloser, mediaType string) (*StreamBlobReader, error) {
+	reader, err := decompressedReader(stream, mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamBlobReader{
+		BlobReader: &BlobReader{
+			stream: stream,
+			reader: reader,
+		},
+	}, nil
+}
+
 func (d *BlobReader) Read(p []byte) (int, error) {
 	return d.reader.Read(p)
 }
 
 func (d *BlobReader) Close() error {
+	_ = d.reader.Close()
+	closeErr := d.stream.Close()
+	if d.filePath == "" {
+		return closeErr
+	}
+
 	return os.Remove(d.filePath)
 }
+
+// Verify checks the digest of the underlying stream, when it supports it.
+func (d *StreamBlobReader) Verify() error {
+	if verifiableStream, ok := d.stream.(base_image_puller.VerifiableStream); ok {
+		return verifiableStream.Verify()
+	}
+	return nil
+}
@@ -3,12 +3,15 @@ package layer_fetcher_test
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
 
+	"code.cloudfoundry.org/grootfs/base_image_puller"
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+	"github.com/klauspost/compress/zstd"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -77,6 +80,69 @@ var _ = Describe("BlobReader", func() {
 					Expect(err).NotTo(HaveOccurred())
 					Expect(readAll(blobReader)).To(Equal("im-not-gziped!"))
 				})
+
+				Context("when the MediaType is not set", func() {
+					It("reads the blob as it is", func() {
+						blobReader, err := layer_fetcher.NewBlobReader(notABlobFile.Name(), "")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(readAll(blobReader)).To(Equal("im-not-gziped!"))
+					})
+				})
+
+				Context("when the MediaType is explicitly gzip", func() {
+					It("returns an error", func() {
+						_, err := layer_fetcher.NewBlobReader(notABlobFile.Name(), "application/vnd.oci.image.layer.v1.tar+gzip")
+						Expect(err).To(MatchError(ContainSubstring("blob file is not gzipped")))
+					})
+				})
+			})
+		})
+
+		Context("when the blob is zstd compressed", func() {
+			var zstdBlobFile *os.File
+
+			BeforeEach(func() {
+				zstdBuffer := bytes.NewBuffer([]byte{})
+				zstdWriter, err := zstd.NewWriter(zstdBuffer)
+				Expect(err).NotTo(HaveOccurred())
+				writeString(zstdWriter, "hello-zstd")
+				Expect(zstdWriter.Close()).To(Succeed())
+
+				zstdBlobFile = tempFile()
+				defer zstdBlobFile.Close()
+				writeString(zstdBlobFile, readAll(zstdBuffer))
+			})
+
+			AfterEach(func() {
+				removeAllIfTemp(zstdBlobFile.Name())
+			})
+
+			It("reads the zstd stream when the MediaType is zstd", func() {
+				blobReader, err := layer_fetcher.NewBlobReader(zstdBlobFile.Name(), "application/vnd.oci.image.layer.v1.tar+zstd")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readAll(blobReader)).To(Equal("hello-zstd"))
+			})
+
+			It("reads the zstd stream when the MediaType is not set", func() {
+				blobReader, err := layer_fetcher.NewBlobReader(zstdBlobFile.Name(), "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readAll(blobReader)).To(Equal("hello-zstd"))
+			})
+
+			It("reads the zstd stream when the MediaType is unknown", func() {
+				blobReader, err := layer_fetcher.NewBlobReader(zstdBlobFile.Name(), "application/octet-stream")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readAll(blobReader)).To(Equal("hello-zstd"))
+			})
+
+			Context("when the MediaType is explicitly zstd but the blob is gzipped", func() {
+				It("returns an error", func() {
+					blobReader, err := layer_fetcher.NewBlobReader(blobFile.Name(), "application/vnd.oci.image.layer.v1.tar+zstd")
+					if err == nil {
+						_, err = ioutil.ReadAll(blobReader)
+					}
+					Expect(err).To(HaveOccurred())
+				})
 			})
 		})
 	})
@@ -97,6 +163,45 @@ var _ = Describe("BlobReader", func() {
 			Expect(blobFile.Name()).ToNot(BeAnExistingFile())
 		})
 	})
+
+	Describe("Verify", func() {
+		It("is not needed for blob files, which the source has verified", func() {
+			var stream io.ReadCloser = blobReader
+			_, ok := stream.(base_image_puller.VerifiableStream)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("NewStreamBlobReader", func() {
+		var stream *verifiableStream
+
+		BeforeEach(func() {
+			contents, err := ioutil.ReadFile(blobFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			stream = &verifiableStream{Reader: bytes.NewReader(contents)}
+		})
+
+		It("reads the gziped stream", func() {
+			streamReader, err := layer_fetcher.NewStreamBlobReader(stream, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readAll(streamReader)).To(Equal("hello-world"))
+		})
+
+		It("verifies the underlying stream", func() {
+			stream.verifyErr = errors.New("invalid checksum")
+			streamReader, err := layer_fetcher.NewStreamBlobReader(stream, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(streamReader.Verify()).To(MatchError("invalid checksum"))
+		})
+
+		It("closes the underlying stream without touching the blob file", func() {
+			streamReader, err := layer_fetcher.NewStreamBlobReader(stream, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(streamReader.Close()).To(Succeed())
+			Expect(stream.closed).To(BeTrue())
+			Expect(blobFile.Name()).To(BeAnExistingFile())
+		})
+	})
 })
 
 func readAll(reader io.Reader) string {
@@ -0,0 +1,86 @@
+package layer_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	errorspkg "github.com/pkg/errors"
+)
+
+const (
+	MediaTypeImageLayerZstd                 = "application/vnd.oci.image.layer.v1.tar+zstd"
+	MediaTypeImageLayerNonDistributableZstd = "application/vnd.oci.image.layer.nondistributable.v1.tar+zstd"
+	MediaTypeDockerImageLayer               = "application/vnd.docker.image.rootfs.diff.tar"
+	MediaTypeDockerImageLayerGzip           = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	MediaTypeDockerImageLayerForeignGzip    = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+	MediaTypeDockerImageLayerZstd           = "application/vnd.docker.image.rootfs.diff.tar.zstd"
+)
+
+type Decompressor func(io.Reader) (io.ReadCloser, error)
+
+var decompressors = map[string]Decompressor{
+	specsv1.MediaTypeImageLayer:                     uncompressed,
+	specsv1.MediaTypeImageLayerGzip:                 gunzip,
+	MediaTypeImageLayerZstd:                         unzstd,
+	specsv1.MediaTypeImageLayerNonDistributable:     uncompressed,
+	specsv1.MediaTypeImageLayerNonDistributableGzip: gunzip,
+	MediaTypeImageLayerNonDistributableZstd:         unzstd,
+	MediaTypeDockerImageLayer:                       uncompressed,
+	MediaTypeDockerImageLayerGzip:                   gunzip,
+	MediaTypeDockerImageLayerForeignGzip:            gunzip,
+	MediaTypeDockerImageLayerZstd:                   unzstd,
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressedReader picks the decompressor for the layer media type. When
+// the media type is missing or unknown, the compression is guessed from the
+// first bytes of the blob.
+func decompressedReader(reader io.Reader, mediaType string) (io.ReadCloser, error) {
+	if decompressor, ok := decompressors[mediaType]; ok {
+		return decompressor(reader)
+	}
+
+	bufferedReader := bufio.NewReader(reader)
+	magic, err := bufferedReader.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, errorspkg.Wrap(err, "reading blob header")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gunzip(bufferedReader)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return unzstd(bufferedReader)
+	default:
+		return uncompressed(bufferedReader)
+	}
+}
+
+func uncompressed(reader io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(reader), nil
+}
+
+func gunzip(reader io.Reader) (io.ReadCloser, error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "blob file is not gzipped")
+	}
+	return gzipReader, nil
+}
+
+func unzstd(reader io.Reader) (io.ReadCloser, error) {
+	zstdReader, err := zstd.NewReader(reader)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "blob file is not zstd compressed")
+	}
+	return zstdReader.IOReadCloser(), nil
+}
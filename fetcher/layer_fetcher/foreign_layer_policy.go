@@ -0,0 +1,73 @@
+package layer_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ForeignLayerPolicy decides which of the URLs listed in the manifest for a
+// foreign (non-distributable) layer can be used. URLs are rewritten first,
+// and rewritten URLs are always allowed. When no URL is left, the layer is
+// fetched from the registry by its digest.
+type ForeignLayerPolicy struct {
+	Deny         bool
+	AllowedHosts []string
+	// URLRewrites maps URL prefixes to their replacement, e.g. to an internal
+	// mirror. The longest matching prefix wins.
+	URLRewrites map[string]string
+}
+
+func (p ForeignLayerPolicy) Resolve(layerURLs []string) []string {
+	resolvedURLs := []string{}
+	for _, layerURL := range layerURLs {
+		if rewrittenURL, ok := p.rewrite(layerURL); ok {
+			resolvedURLs = append(resolvedURLs, rewrittenURL)
+			continue
+		}
+
+		if p.allowed(layerURL) {
+			resolvedURLs = append(resolvedURLs, layerURL)
+		}
+	}
+
+	if len(resolvedURLs) == 0 {
+		return nil
+	}
+	return resolvedURLs
+}
+
+func (p ForeignLayerPolicy) rewrite(layerURL string) (string, bool) {
+	longestPrefix := ""
+	for prefix := range p.URLRewrites {
+		if strings.HasPrefix(layerURL, prefix) && len(prefix) > len(longestPrefix) {
+			longestPrefix = prefix
+		}
+	}
+
+	if longestPrefix == "" {
+		return "", false
+	}
+	return p.URLRewrites[longestPrefix] + strings.TrimPrefix(layerURL, longestPrefix), true
+}
+
+func (p ForeignLayerPolicy) allowed(layerURL string) bool {
+	if p.Deny {
+		return false
+	}
+
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+
+	parsedURL, err := url.Parse(layerURL)
+	if err != nil {
+		return false
+	}
+
+	for _, host := range p.AllowedHosts {
+		if parsedURL.Host == host {
+			return true
+		}
+	}
+	return false
+}
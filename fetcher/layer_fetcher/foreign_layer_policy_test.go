@@ -0,0 +1,65 @@
+package layer_fetcher_test
+
+import (
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForeignLayerPolicy", func() {
+	var (
+		policy    layer_fetcher.ForeignLayerPolicy
+		layerURLs []string
+	)
+
+	BeforeEach(func() {
+		policy = layer_fetcher.ForeignLayerPolicy{}
+		layerURLs = []string{
+			"https://go.microsoft.com/fwlink/?linkid=1",
+			"https://example.com:8443/layers/layer.tar.gz",
+		}
+	})
+
+	It("allows every URL by default", func() {
+		Expect(policy.Resolve(layerURLs)).To(Equal(layerURLs))
+	})
+
+	It("returns nil when there are no URLs", func() {
+		Expect(policy.Resolve(nil)).To(BeNil())
+	})
+
+	Context("when foreign URLs are denied", func() {
+		BeforeEach(func() {
+			policy.Deny = true
+		})
+
+		It("drops every URL", func() {
+			Expect(policy.Resolve(layerURLs)).To(BeNil())
+		})
+	})
+
+	Context("when only some hosts are allowed", func() {
+		BeforeEach(func() {
+			policy.AllowedHosts = []string{"example.com:8443"}
+		})
+
+		It("drops the URLs of the other hosts", func() {
+			Expect(policy.Resolve(layerURLs)).To(Equal([]string{"https://example.com:8443/layers/layer.tar.gz"}))
+		})
+	})
+
+	Context("when URL rewrites are configured", func() {
+		BeforeEach(func() {
+			policy.Deny = true
+			policy.URLRewrites = map[string]string{
+				"https://go.microsoft.com/":        "https://mirror.internal/microsoft/",
+				"https://go.microsoft.com/fwlink/": "https://mirror.internal/fwlink/",
+			}
+		})
+
+		It("rewrites the matching URLs using the longest prefix", func() {
+			Expect(policy.Resolve(layerURLs)).To(Equal([]string{"https://mirror.internal/fwlink/?linkid=1"}))
+		})
+	})
+})
@@ -9,9 +9,9 @@ import (
 	"strings"
 
 	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
 	"code.cloudfoundry.org/lager"
 
-	"github.com/containers/image/types"
 	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	errorspkg "github.com/pkg/errors"
 )
@@ -22,23 +22,39 @@ const cfBaseDirectoryAnnotation = "org.cloudfoundry.experimental.image.base-dire
 //go:generate counterfeiter . Manifest
 
 type Manifest interface {
-	// Manifest is just a shortcut for the types.Image interface,
+	// Manifest is just a shortcut for the source.Image interface,
 	// to make it simpler to test with fakes.
-	types.Image
+	source.Image
 }
 
 type Source interface {
-	Manifest(logger lager.Logger, baseImageURL *url.URL) (types.Image, error)
-	Blob(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string) (string, int64, error)
+	Manifest(logger lager.Logger, baseImageURL *url.URL) (source.Image, error)
+	// ResolveManifest fetches the manifest alone, without downloading any blob
+	ResolveManifest(logger lager.Logger, baseImageURL *url.URL) (source.Image, error)
+	// Blob and BlobStream also return where the blob was served from
+	Blob(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string, progress source.BlobProgress) (string, int64, string, error)
+	BlobStream(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string) (base_image_puller.VerifiableStream, int64, string, error)
 }
 
 type LayerFetcher struct {
-	source Source
+	source        Source
+	platform      specsv1.Platform
+	streamLayers  bool
+	manifestCache *ManifestCache
+	offline       bool
+	foreignLayers ForeignLayerPolicy
 }
 
-func NewLayerFetcher(source Source) *LayerFetcher {
+// NewLayerFetcher creates a fetcher. The manifestCache is optional: when it
+// is nil, the source is always used and offline is ignored.
+func NewLayerFetcher(source Source, platform specsv1.Platform, streamLayers bool, manifestCache *ManifestCache, offline bool, foreignLayers ForeignLayerPolicy) *LayerFetcher {
 	return &LayerFetcher{
-		source: source,
+		source:        source,
+		platform:      platform,
+		streamLayers:  streamLayers,
+		manifestCache: manifestCache,
+		offline:       offline,
+		foreignLayers: foreignLayers,
 	}
 }
 
@@ -47,6 +63,125 @@ func (f *LayerFetcher) BaseImageInfo(logger lager.Logger, baseImageURL *url.URL)
 	logger.Info("starting")
 	defer logger.Info("ending")
 
+	if f.manifestCache == nil {
+		return f.fetchBaseImageInfo(logger, baseImageURL)
+	}
+
+	if f.offline {
+		baseImageInfo, ok, err := f.cachedBaseImageInfo(logger, baseImageURL)
+		if err != nil {
+			return base_image_puller.BaseImageInfo{}, err
+		}
+		if !ok {
+			return base_image_puller.BaseImageInfo{}, errorspkg.Errorf("image `%s` is not available offline: its manifest is not cached", baseImageURL)
+		}
+		return baseImageInfo, nil
+	}
+
+	baseImageInfo, err := f.fetchBaseImageInfo(logger, baseImageURL)
+	if err != nil {
+		if !source.IsUnreachable(err) {
+			return base_image_puller.BaseImageInfo{}, err
+		}
+
+		logger.Error("source-unreachable", err)
+		cachedBaseImageInfo, ok, cacheErr := f.cachedBaseImageInfo(logger, baseImageURL)
+		if cacheErr != nil {
+			return base_image_puller.BaseImageInfo{}, cacheErr
+		}
+		if !ok {
+			return base_image_puller.BaseImageInfo{}, err
+		}
+		logger.Info("using-cached-manifest", lager.Data{"manifestDigest": cachedBaseImageInfo.ManifestDigest})
+		return cachedBaseImageInfo, nil
+	}
+
+	if err := f.manifestCache.Store(baseImageURL, f.platform, baseImageInfo); err != nil {
+		logger.Error("caching-manifest-failed", err)
+	}
+
+	return baseImageInfo, nil
+}
+
+// ManifestInfo resolves the manifest without downloading any of the layers
+// that BaseImageInfo may need to convert it, so that the image can be checked
+// before. Like BaseImageInfo, it uses the cached manifest when offline or when
+// the source is unreachable.
+func (f *LayerFetcher) ManifestInfo(logger lager.Logger, baseImageURL *url.URL) (base_image_puller.ManifestInfo, error) {
+	logger = logger.Session("manifest-info", lager.Data{"baseImageURL": baseImageURL})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	if f.manifestCache != nil && f.offline {
+		baseImageInfo, ok, err := f.cachedBaseImageInfo(logger, baseImageURL)
+		if err != nil {
+			return base_image_puller.ManifestInfo{}, err
+		}
+		if !ok {
+			return base_image_puller.ManifestInfo{}, errorspkg.Errorf("image `%s` is not available offline: its manifest is not cached", baseImageURL)
+		}
+		return manifestInfo(baseImageInfo), nil
+	}
+
+	manifest, err := f.source.ResolveManifest(logger, baseImageURL)
+	if err != nil {
+		if f.manifestCache == nil || !source.IsUnreachable(err) {
+			return base_image_puller.ManifestInfo{}, err
+		}
+
+		logger.Error("source-unreachable", err)
+		baseImageInfo, ok, cacheErr := f.cachedBaseImageInfo(logger, baseImageURL)
+		if cacheErr != nil {
+			return base_image_puller.ManifestInfo{}, cacheErr
+		}
+		if !ok {
+			return base_image_puller.ManifestInfo{}, err
+		}
+		return manifestInfo(baseImageInfo), nil
+	}
+	defer manifest.Close()
+
+	info := base_image_puller.ManifestInfo{
+		ManifestDigest: manifest.ManifestDigest().String(),
+		LayerCount:     len(manifest.LayerInfos()),
+	}
+	for _, layer := range manifest.LayerInfos() {
+		if layer.Size > 0 {
+			info.CompressedSize += layer.Size
+		}
+	}
+
+	return info, nil
+}
+
+func manifestInfo(baseImageInfo base_image_puller.BaseImageInfo) base_image_puller.ManifestInfo {
+	info := base_image_puller.ManifestInfo{
+		ManifestDigest: baseImageInfo.ManifestDigest,
+		LayerCount:     len(baseImageInfo.LayerInfos),
+	}
+	for _, layer := range baseImageInfo.LayerInfos {
+		if layer.Size > 0 {
+			info.CompressedSize += layer.Size
+		}
+	}
+
+	return info
+}
+
+func (f *LayerFetcher) cachedBaseImageInfo(logger lager.Logger, baseImageURL *url.URL) (base_image_puller.BaseImageInfo, bool, error) {
+	baseImageInfo, ok := f.manifestCache.Lookup(logger, baseImageURL, f.platform)
+	if !ok {
+		return base_image_puller.BaseImageInfo{}, false, nil
+	}
+
+	if err := f.checkArchitecture(logger, &baseImageInfo.Config); err != nil {
+		return base_image_puller.BaseImageInfo{}, false, err
+	}
+
+	return baseImageInfo, true, nil
+}
+
+func (f *LayerFetcher) fetchBaseImageInfo(logger lager.Logger, baseImageURL *url.URL) (base_image_puller.BaseImageInfo, error) {
 	logger.Debug("fetching-image-manifest")
 	manifest, err := f.source.Manifest(logger, baseImageURL)
 	if err != nil {
@@ -61,9 +196,24 @@ func (f *LayerFetcher) BaseImageInfo(logger lager.Logger, baseImageURL *url.URL)
 		return base_image_puller.BaseImageInfo{}, err
 	}
 
+	layerInfos, err := f.createLayerInfos(logger, manifest, config)
+	if err != nil {
+		return base_image_puller.BaseImageInfo{}, err
+	}
+
+	if baseImageURL.Scheme == source.DockerArchiveScheme {
+		// containers/image reports docker archive layers as gzipped, but
+		// `docker save` writes them uncompressed. Let the blob reader detect
+		// the compression instead.
+		for i := range layerInfos {
+			layerInfos[i].MediaType = ""
+		}
+	}
+
 	return base_image_puller.BaseImageInfo{
-		LayerInfos: f.createLayerInfos(logger, manifest, config),
-		Config:     *config,
+		LayerInfos:     layerInfos,
+		Config:         *config,
+		ManifestDigest: manifest.ManifestDigest().String(),
 	}, nil
 }
 
@@ -72,11 +222,23 @@ func (f *LayerFetcher) StreamBlob(logger lager.Logger, baseImageURL *url.URL, la
 	logger.Info("starting")
 	defer logger.Info("ending")
 
-	blobFilePath, size, err := f.source.Blob(logger, baseImageURL, layerInfo.BlobID, layerInfo.URLs)
+	if len(layerInfo.URLs) > 0 {
+		layerURLs := f.foreignLayers.Resolve(layerInfo.URLs)
+		logger.Info("resolved-foreign-layer-urls", lager.Data{"blobId": layerInfo.BlobID, "manifestURLs": layerInfo.URLs, "URLs": layerURLs})
+		layerInfo.URLs = layerURLs
+	}
+
+	if f.streamLayers {
+		return f.streamBlobFromSource(logger, baseImageURL, layerInfo)
+	}
+
+	progress := source.BlobProgress{Downloaded: layerInfo.DownloadProgress, Verifying: layerInfo.VerifyProgress}
+	blobFilePath, size, servedFrom, err := f.source.Blob(logger, baseImageURL, layerInfo.BlobID, layerInfo.URLs, progress)
 	if err != nil {
 		logger.Error("source-blob-failed", err, lager.Data{"baseImageUrl": baseImageURL, "blobId": layerInfo.BlobID, "URL": layerInfo.URLs})
 		return nil, 0, err
 	}
+	logger.Info("blob-served", lager.Data{"blobId": layerInfo.BlobID, "servedFrom": servedFrom})
 
 	blobReader, err := NewBlobReader(blobFilePath, layerInfo.MediaType)
 	if err != nil {
@@ -87,7 +249,33 @@ func (f *LayerFetcher) StreamBlob(logger lager.Logger, baseImageURL *url.URL, la
 	return blobReader, size, nil
 }
 
-func (f *LayerFetcher) createLayerInfos(logger lager.Logger, image Manifest, config *specsv1.Image) []base_image_puller.LayerInfo {
+func (f *LayerFetcher) streamBlobFromSource(logger lager.Logger, baseImageURL *url.URL, layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
+	stream, size, servedFrom, err := f.source.BlobStream(logger, baseImageURL, layerInfo.BlobID, layerInfo.URLs)
+	if err != nil {
+		logger.Error("source-blob-stream-failed", err, lager.Data{"baseImageUrl": baseImageURL, "blobId": layerInfo.BlobID, "URL": layerInfo.URLs})
+		return nil, 0, err
+	}
+	logger.Info("blob-served", lager.Data{"blobId": layerInfo.BlobID, "servedFrom": servedFrom})
+
+	if layerInfo.DownloadProgress != nil {
+		stream = &progressStream{VerifiableStream: stream, progress: layerInfo.DownloadProgress}
+	}
+
+	blobReader, err := NewStreamBlobReader(stream, layerInfo.MediaType)
+	if err != nil {
+		stream.Close()
+		logger.Error("blob-reader-failed", err)
+		return nil, 0, errorspkg.Wrap(err, "opening stream from source")
+	}
+
+	return blobReader, size, nil
+}
+
+func (f *LayerFetcher) createLayerInfos(logger lager.Logger, image Manifest, config *specsv1.Image) ([]base_image_puller.LayerInfo, error) {
+	if err := f.checkArchitecture(logger, config); err != nil {
+		return nil, err
+	}
+
 	layerInfos := []base_image_puller.LayerInfo{}
 
 	var parentChainID string
@@ -110,7 +298,21 @@ func (f *LayerFetcher) createLayerInfos(logger lager.Logger, image Manifest, con
 		parentChainID = chainID
 	}
 
-	return layerInfos
+	return layerInfos, nil
+}
+
+func (f *LayerFetcher) checkArchitecture(logger lager.Logger, config *specsv1.Image) error {
+	if f.platform.Architecture == "" || config.Architecture == "" {
+		return nil
+	}
+
+	if source.NormalizeArchitecture(config.Architecture) != source.NormalizeArchitecture(f.platform.Architecture) {
+		err := errorspkg.Errorf("image architecture `%s` does not match platform architecture `%s`", config.Architecture, f.platform.Architecture)
+		logger.Error("checking-architecture-failed", err)
+		return err
+	}
+
+	return nil
 }
 
 func (f *LayerFetcher) chainID(diffID string, parentChainID string) string {
@@ -4,20 +4,28 @@ import (
 	"bytes"
 	"compress/gzip"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/url"
+	"os"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/grootfs/base_image_puller"
 
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/layer_fetcherfakes"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/containers/image/types"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	digestpkg "github.com/opencontainers/go-digest"
 	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	errorspkg "github.com/pkg/errors"
 )
 
 var _ = Describe("LayerFetcher", func() {
@@ -40,7 +48,7 @@ var _ = Describe("LayerFetcher", func() {
 		gzipedBlobContent, err = ioutil.ReadAll(gzipBuffer)
 		Expect(err).NotTo(HaveOccurred())
 
-		fetcher = layer_fetcher.NewLayerFetcher(fakeSource)
+		fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, nil, false, layer_fetcher.ForeignLayerPolicy{})
 
 		logger = lagertest.NewTestLogger("test-layer-fetcher")
 		baseImageURL, err = url.Parse("docker:///cfgarden/empty:v0.1.1")
@@ -130,6 +138,84 @@ var _ = Describe("LayerFetcher", func() {
 			}))
 		})
 
+		Context("when the image comes from a docker archive", func() {
+			BeforeEach(func() {
+				config := &specsv1.Image{
+					RootFS: specsv1.RootFS{
+						DiffIDs: []digestpkg.Digest{
+							digestpkg.NewDigestFromHex("sha256", "afe200c63655576eaa5cabe036a2c09920d6aee67653ae75a9d35e0ec27205a5"),
+						},
+					},
+				}
+				fakeManifest := new(layer_fetcherfakes.FakeManifest)
+				fakeManifest.OCIConfigReturns(config, nil)
+				fakeManifest.LayerInfosReturns([]types.BlobInfo{
+					types.BlobInfo{
+						Digest:    digestpkg.NewDigestFromHex("sha256", "afe200c63655576eaa5cabe036a2c09920d6aee67653ae75a9d35e0ec27205a5"),
+						Size:      1024,
+						MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+					},
+				})
+				fakeSource.ManifestReturns(fakeManifest, nil)
+
+				var err error
+				baseImageURL, err = url.Parse("docker-archive:///images/busybox.tar")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("uses the same chain ids as registry images", func() {
+				baseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(baseImageInfo.LayerInfos).To(HaveLen(1))
+				Expect(baseImageInfo.LayerInfos[0].ChainID).To(Equal("afe200c63655576eaa5cabe036a2c09920d6aee67653ae75a9d35e0ec27205a5"))
+			})
+
+			It("does not trust the layer media type", func() {
+				baseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(baseImageInfo.LayerInfos[0].MediaType).To(BeEmpty())
+			})
+		})
+
+		Context("when the image architecture does not match the platform", func() {
+			BeforeEach(func() {
+				fakeManifest := new(layer_fetcherfakes.FakeManifest)
+				fakeManifest.OCIConfigReturns(&specsv1.Image{Architecture: "arm64", OS: "linux"}, nil)
+				fakeSource.ManifestReturns(fakeManifest, nil)
+			})
+
+			It("returns an error", func() {
+				_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).To(MatchError("image architecture `arm64` does not match platform architecture `amd64`"))
+			})
+
+			Context("but the platform matches", func() {
+				BeforeEach(func() {
+					fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "arm64"}, false, nil, false, layer_fetcher.ForeignLayerPolicy{})
+				})
+
+				It("succeeds", func() {
+					_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when the image config has an alias for the platform architecture", func() {
+			BeforeEach(func() {
+				fakeManifest := new(layer_fetcherfakes.FakeManifest)
+				fakeManifest.OCIConfigReturns(&specsv1.Image{Architecture: "x86_64", OS: "linux"}, nil)
+				fakeSource.ManifestReturns(fakeManifest, nil)
+			})
+
+			It("succeeds", func() {
+				_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
 		Context("when retrieving the OCI Config fails", func() {
 			BeforeEach(func() {
 				fakeManifest := new(layer_fetcherfakes.FakeManifest)
@@ -143,6 +229,18 @@ var _ = Describe("LayerFetcher", func() {
 			})
 		})
 
+		It("returns the digest of the manifest the reference resolved to", func() {
+			fakeManifest := new(layer_fetcherfakes.FakeManifest)
+			fakeManifest.OCIConfigReturns(&specsv1.Image{}, nil)
+			fakeManifest.ManifestDigestReturns(digestpkg.Digest("sha256:resolved-manifest-digest"))
+			fakeSource.ManifestReturns(fakeManifest, nil)
+
+			baseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(baseImageInfo.ManifestDigest).To(Equal("sha256:resolved-manifest-digest"))
+		})
+
 		It("returns the correct OCI image config", func() {
 			timestamp := time.Time{}.In(time.UTC)
 			expectedConfig := specsv1.Image{
@@ -164,6 +262,268 @@ var _ = Describe("LayerFetcher", func() {
 
 			Expect(baseImageInfo.Config).To(Equal(expectedConfig))
 		})
+
+		Context("when a manifest cache is used", func() {
+			var (
+				cachePath     string
+				manifestCache *layer_fetcher.ManifestCache
+				fakeManifest  *layer_fetcherfakes.FakeManifest
+				unreachable   error
+			)
+
+			BeforeEach(func() {
+				var err error
+				cachePath, err = ioutil.TempDir("", "manifest-cache")
+				Expect(err).NotTo(HaveOccurred())
+				manifestCache = layer_fetcher.NewManifestCache(cachePath, 0)
+
+				fakeManifest = new(layer_fetcherfakes.FakeManifest)
+				fakeManifest.OCIConfigReturns(&specsv1.Image{
+					OS: "linux",
+					RootFS: specsv1.RootFS{
+						DiffIDs: []digestpkg.Digest{
+							digestpkg.NewDigestFromHex("sha256", "afe200c63655576eaa5cabe036a2c09920d6aee67653ae75a9d35e0ec27205a5"),
+						},
+					},
+				}, nil)
+				fakeManifest.LayerInfosReturns([]types.BlobInfo{
+					{Digest: "sha256:47e3dd80d678c83c50cb133f4cf20e94d088f890679716c8b763418f55827a58", Size: 1024},
+				})
+				fakeManifest.ManifestDigestReturns(digestpkg.Digest("sha256:cached-manifest-digest"))
+				fakeSource.ManifestReturns(fakeManifest, nil)
+
+				unreachable = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+				fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, manifestCache, false, layer_fetcher.ForeignLayerPolicy{})
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(cachePath)).To(Succeed())
+			})
+
+			It("does not mark fetched infos as cached", func() {
+				baseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(baseImageInfo.Cached).To(BeFalse())
+			})
+
+			Context("when the registry becomes unreachable", func() {
+				var fetchedBaseImageInfo base_image_puller.BaseImageInfo
+
+				BeforeEach(func() {
+					var err error
+					fetchedBaseImageInfo, err = fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					fakeSource.ManifestReturns(nil, errorspkg.Wrap(unreachable, "fetching image reference"))
+				})
+
+				It("returns the cached infos", func() {
+					baseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(baseImageInfo.Cached).To(BeTrue())
+					Expect(baseImageInfo.LayerInfos).To(Equal(fetchedBaseImageInfo.LayerInfos))
+					Expect(baseImageInfo.Config).To(Equal(fetchedBaseImageInfo.Config))
+					Expect(baseImageInfo.ManifestDigest).To(Equal("sha256:cached-manifest-digest"))
+				})
+
+				Context("when the cached infos are for another image", func() {
+					It("returns the error", func() {
+						otherImageURL, err := url.Parse("docker:///cfgarden/other")
+						Expect(err).NotTo(HaveOccurred())
+
+						_, err = fetcher.BaseImageInfo(logger, otherImageURL)
+						Expect(err).To(MatchError(ContainSubstring("connection refused")))
+					})
+				})
+
+				Context("when the cached infos have expired", func() {
+					BeforeEach(func() {
+						manifestCache = layer_fetcher.NewManifestCache(cachePath, time.Nanosecond)
+						fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, manifestCache, false, layer_fetcher.ForeignLayerPolicy{})
+					})
+
+					It("returns the error", func() {
+						_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+						Expect(err).To(MatchError(ContainSubstring("connection refused")))
+					})
+				})
+			})
+
+			Context("when fetching the manifest fails for another reason", func() {
+				BeforeEach(func() {
+					_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					fakeSource.ManifestReturns(nil, errors.New("unauthorized: authentication required"))
+				})
+
+				It("does not use the cache", func() {
+					_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).To(MatchError(ContainSubstring("unauthorized")))
+				})
+			})
+
+			Context("when offline", func() {
+				BeforeEach(func() {
+					_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, manifestCache, true, layer_fetcher.ForeignLayerPolicy{})
+				})
+
+				It("returns the cached infos without using the source", func() {
+					baseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(baseImageInfo.Cached).To(BeTrue())
+					Expect(baseImageInfo.ManifestDigest).To(Equal("sha256:cached-manifest-digest"))
+					Expect(fakeSource.ManifestCallCount()).To(Equal(1))
+				})
+
+				Context("when the image is not cached", func() {
+					It("returns an error", func() {
+						otherImageURL, err := url.Parse("docker:///cfgarden/other")
+						Expect(err).NotTo(HaveOccurred())
+
+						_, err = fetcher.BaseImageInfo(logger, otherImageURL)
+						Expect(err).To(MatchError("image `docker:///cfgarden/other` is not available offline: its manifest is not cached"))
+					})
+				})
+
+				Context("when the image is only cached for another platform", func() {
+					BeforeEach(func() {
+						fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "arm64"}, false, manifestCache, true, layer_fetcher.ForeignLayerPolicy{})
+					})
+
+					It("returns an error", func() {
+						_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+						Expect(err).To(MatchError(ContainSubstring("its manifest is not cached")))
+					})
+				})
+
+				Context("when the cached config is for another architecture", func() {
+					BeforeEach(func() {
+						Expect(manifestCache.Store(baseImageURL, specsv1.Platform{OS: "linux", Architecture: "amd64"}, base_image_puller.BaseImageInfo{
+							Config: specsv1.Image{OS: "linux", Architecture: "arm64"},
+						})).To(Succeed())
+					})
+
+					It("returns an error", func() {
+						_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+						Expect(err).To(MatchError("image architecture `arm64` does not match platform architecture `amd64`"))
+					})
+				})
+			})
+		})
+	})
+
+	Describe("ManifestInfo", func() {
+		var fakeManifest *layer_fetcherfakes.FakeManifest
+
+		BeforeEach(func() {
+			fakeManifest = new(layer_fetcherfakes.FakeManifest)
+			fakeManifest.ManifestDigestReturns(digestpkg.Digest("sha256:manifest-digest"))
+			fakeSource.ResolveManifestReturns(fakeManifest, nil)
+		})
+
+		It("resolves the manifest without fetching the image info", func() {
+			manifestInfo, err := fetcher.ManifestInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifestInfo.ManifestDigest).To(Equal("sha256:manifest-digest"))
+
+			Expect(fakeSource.ResolveManifestCallCount()).To(Equal(1))
+			_, usedImageURL := fakeSource.ResolveManifestArgsForCall(0)
+			Expect(usedImageURL).To(Equal(baseImageURL))
+			Expect(fakeSource.ManifestCallCount()).To(Equal(0))
+			Expect(fakeManifest.OCIConfigCallCount()).To(Equal(0))
+			Expect(fakeManifest.CloseCallCount()).To(Equal(1))
+		})
+
+		It("counts the layers and their sizes listed in the manifest", func() {
+			fakeManifest.LayerInfosReturns([]types.BlobInfo{
+				{Digest: "sha256:47e3dd80d678c83c50cb133f4cf20e94d088f890679716c8b763418f55827a58", Size: 1024},
+				{Digest: "sha256:7f2760e7451ce455121932b178501d60e651f000c3ab3bc12ae5d1f57614cc76", Size: 2048},
+				{Digest: "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4", Size: -1},
+			})
+
+			manifestInfo, err := fetcher.ManifestInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifestInfo.LayerCount).To(Equal(3))
+			Expect(manifestInfo.CompressedSize).To(Equal(int64(3072)))
+		})
+
+		Context("when resolving the manifest fails", func() {
+			BeforeEach(func() {
+				fakeSource.ResolveManifestReturns(nil, errors.New("manifest unknown"))
+			})
+
+			It("returns an error", func() {
+				_, err := fetcher.ManifestInfo(logger, baseImageURL)
+				Expect(err).To(MatchError("manifest unknown"))
+			})
+		})
+
+		Context("when a manifest cache is used", func() {
+			var (
+				cachePath     string
+				manifestCache *layer_fetcher.ManifestCache
+			)
+
+			BeforeEach(func() {
+				var err error
+				cachePath, err = ioutil.TempDir("", "manifest-cache")
+				Expect(err).NotTo(HaveOccurred())
+				manifestCache = layer_fetcher.NewManifestCache(cachePath, 0)
+				Expect(manifestCache.Store(baseImageURL, specsv1.Platform{OS: "linux", Architecture: "amd64"}, base_image_puller.BaseImageInfo{
+					Config:         specsv1.Image{OS: "linux"},
+					ManifestDigest: "sha256:cached-manifest-digest",
+				})).To(Succeed())
+
+				fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, manifestCache, false, layer_fetcher.ForeignLayerPolicy{})
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(cachePath)).To(Succeed())
+			})
+
+			Context("when the registry is unreachable", func() {
+				BeforeEach(func() {
+					unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+					fakeSource.ResolveManifestReturns(nil, errorspkg.Wrap(unreachable, "fetching image reference"))
+				})
+
+				It("returns the cached manifest digest", func() {
+					manifestInfo, err := fetcher.ManifestInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifestInfo.ManifestDigest).To(Equal("sha256:cached-manifest-digest"))
+				})
+
+				Context("when the image is not cached", func() {
+					It("returns the error", func() {
+						otherImageURL, err := url.Parse("docker:///cfgarden/other")
+						Expect(err).NotTo(HaveOccurred())
+
+						_, err = fetcher.ManifestInfo(logger, otherImageURL)
+						Expect(err).To(MatchError(ContainSubstring("connection refused")))
+					})
+				})
+			})
+
+			Context("when offline", func() {
+				BeforeEach(func() {
+					fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, manifestCache, true, layer_fetcher.ForeignLayerPolicy{})
+				})
+
+				It("returns the cached manifest digest without using the source", func() {
+					manifestInfo, err := fetcher.ManifestInfo(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(manifestInfo.ManifestDigest).To(Equal("sha256:cached-manifest-digest"))
+					Expect(fakeSource.ResolveManifestCallCount()).To(Equal(0))
+				})
+			})
+		})
 	})
 
 	Describe("StreamBlob", func() {
@@ -177,7 +537,7 @@ var _ = Describe("LayerFetcher", func() {
 			Expect(err).NotTo(HaveOccurred())
 			defer func() { _ = tmpFile.Close() }()
 
-			fakeSource.BlobReturns(tmpFile.Name(), 0, nil)
+			fakeSource.BlobReturns(tmpFile.Name(), 0, "", nil)
 		})
 
 		It("uses the source", func() {
@@ -185,7 +545,7 @@ var _ = Describe("LayerFetcher", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(fakeSource.BlobCallCount()).To(Equal(1))
-			_, usedImageURL, usedDigest, _ := fakeSource.BlobArgsForCall(0)
+			_, usedImageURL, usedDigest, _, _ := fakeSource.BlobArgsForCall(0)
 			Expect(usedImageURL).To(Equal(baseImageURL))
 			Expect(usedDigest).To(Equal("sha256:layer-digest"))
 		})
@@ -209,7 +569,7 @@ var _ = Describe("LayerFetcher", func() {
 			gzipWriter := gzip.NewWriter(tmpFile)
 			Expect(gzipWriter.Close()).To(Succeed())
 
-			fakeSource.BlobReturns(tmpFile.Name(), 1024, nil)
+			fakeSource.BlobReturns(tmpFile.Name(), 1024, "", nil)
 
 			_, size, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
 			Expect(err).NotTo(HaveOccurred())
@@ -218,11 +578,253 @@ var _ = Describe("LayerFetcher", func() {
 
 		Context("when the source fails to stream the blob", func() {
 			It("returns an error", func() {
-				fakeSource.BlobReturns("", 0, errors.New("failed to stream blob"))
+				fakeSource.BlobReturns("", 0, "", errors.New("failed to stream blob"))
 
 				_, _, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
 				Expect(err).To(MatchError(ContainSubstring("failed to stream blob")))
 			})
 		})
+
+		Context("when the download progress is requested", func() {
+			var (
+				progress          []int64
+				verifying         int
+				progressLayerInfo base_image_puller.LayerInfo
+			)
+
+			BeforeEach(func() {
+				progress = []int64{}
+				verifying = 0
+				progressLayerInfo = layerInfo
+				progressLayerInfo.DownloadProgress = func(bytesDownloaded int64) {
+					progress = append(progress, bytesDownloaded)
+				}
+				progressLayerInfo.VerifyProgress = func() {
+					verifying++
+				}
+			})
+
+			It("passes the progress to the source, which reports it while it downloads the blob", func() {
+				tmpFile, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = tmpFile.Write(gzipedBlobContent)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmpFile.Close()).To(Succeed())
+
+				fakeSource.BlobStub = func(_ lager.Logger, _ *url.URL, _ string, _ []string, blobProgress source.BlobProgress) (string, int64, string, error) {
+					blobProgress.Downloaded(512)
+					blobProgress.Downloaded(1024)
+					blobProgress.Verifying()
+					return tmpFile.Name(), 1024, "", nil
+				}
+
+				_, _, err = fetcher.StreamBlob(logger, baseImageURL, progressLayerInfo)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(progress).To(Equal([]int64{512, 1024}))
+				Expect(verifying).To(Equal(1))
+			})
+
+			It("returns a stream that does not need verifying again", func() {
+				blobStream, _, err := fetcher.StreamBlob(logger, baseImageURL, progressLayerInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, ok := blobStream.(base_image_puller.VerifiableStream)
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		Context("when the layer has foreign URLs", func() {
+			var foreignLayerInfo base_image_puller.LayerInfo
+
+			BeforeEach(func() {
+				foreignLayerInfo = layerInfo
+				foreignLayerInfo.URLs = []string{
+					"https://go.microsoft.com/fwlink/?linkid=1",
+					"https://example.com/layer.tar.gz",
+				}
+			})
+
+			It("passes the URLs to the source by default", func() {
+				_, _, err := fetcher.StreamBlob(logger, baseImageURL, foreignLayerInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, _, usedURLs, _ := fakeSource.BlobArgsForCall(0)
+				Expect(usedURLs).To(Equal(foreignLayerInfo.URLs))
+			})
+
+			It("logs the URLs that are used", func() {
+				_, _, err := fetcher.StreamBlob(logger, baseImageURL, foreignLayerInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger).To(gbytes.Say("resolved-foreign-layer-urls.*https://example.com/layer.tar.gz"))
+			})
+
+			It("logs the URL that served the blob", func() {
+				tmpFile, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = tmpFile.Write(gzipedBlobContent)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tmpFile.Close()).To(Succeed())
+				fakeSource.BlobReturns(tmpFile.Name(), 0, "https://example.com/layer.tar.gz", nil)
+
+				_, _, err = fetcher.StreamBlob(logger, baseImageURL, foreignLayerInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger).To(gbytes.Say(`blob-served.*"servedFrom":"https://example.com/layer.tar.gz"`))
+			})
+
+			Context("when foreign URLs are denied", func() {
+				BeforeEach(func() {
+					fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, false, nil, false, layer_fetcher.ForeignLayerPolicy{Deny: true})
+				})
+
+				It("fetches the blob from the registry", func() {
+					_, _, err := fetcher.StreamBlob(logger, baseImageURL, foreignLayerInfo)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, _, usedDigest, usedURLs, _ := fakeSource.BlobArgsForCall(0)
+					Expect(usedDigest).To(Equal("sha256:layer-digest"))
+					Expect(usedURLs).To(BeEmpty())
+				})
+			})
+
+			Context("when layers are streamed and only some hosts are allowed", func() {
+				BeforeEach(func() {
+					fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, true, nil, false, layer_fetcher.ForeignLayerPolicy{AllowedHosts: []string{"example.com"}})
+					fakeSource.BlobStreamReturns(&verifiableStream{Reader: bytes.NewReader(gzipedBlobContent)}, 0, "", nil)
+				})
+
+				It("only passes the allowed URLs to the source", func() {
+					_, _, err := fetcher.StreamBlob(logger, baseImageURL, foreignLayerInfo)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, _, _, usedURLs := fakeSource.BlobStreamArgsForCall(0)
+					Expect(usedURLs).To(Equal([]string{"https://example.com/layer.tar.gz"}))
+				})
+			})
+		})
+
+		Context("when layers are streamed", func() {
+			var stream *verifiableStream
+
+			BeforeEach(func() {
+				fetcher = layer_fetcher.NewLayerFetcher(fakeSource, specsv1.Platform{OS: "linux", Architecture: "amd64"}, true, nil, false, layer_fetcher.ForeignLayerPolicy{})
+				stream = &verifiableStream{Reader: bytes.NewReader(gzipedBlobContent)}
+				fakeSource.BlobStreamReturns(stream, 1024, "", nil)
+			})
+
+			It("streams the blob from the source without using a temporary file", func() {
+				blobStream, size, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).To(Equal(int64(1024)))
+
+				Expect(fakeSource.BlobCallCount()).To(Equal(0))
+				Expect(fakeSource.BlobStreamCallCount()).To(Equal(1))
+				_, usedImageURL, usedDigest, _ := fakeSource.BlobStreamArgsForCall(0)
+				Expect(usedImageURL).To(Equal(baseImageURL))
+				Expect(usedDigest).To(Equal("sha256:layer-digest"))
+
+				contents, err := ioutil.ReadAll(blobStream)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("hello-world"))
+			})
+
+			It("returns a stream that verifies the source stream", func() {
+				blobStream, _, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				stream.verifyErr = errors.New("invalid checksum")
+				verifiable, ok := blobStream.(base_image_puller.VerifiableStream)
+				Expect(ok).To(BeTrue())
+				Expect(verifiable.Verify()).To(MatchError("invalid checksum"))
+			})
+
+			It("closes the source stream when the stream is closed", func() {
+				blobStream, _, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(blobStream.Close()).To(Succeed())
+				Expect(stream.closed).To(BeTrue())
+			})
+
+			Context("when the source fails to stream the blob", func() {
+				It("returns an error", func() {
+					fakeSource.BlobStreamReturns(nil, 0, "", errors.New("failed to stream blob"))
+
+					_, _, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
+					Expect(err).To(MatchError(ContainSubstring("failed to stream blob")))
+				})
+			})
+
+			Context("when the blob is not gzipped", func() {
+				It("closes the source stream and returns an error", func() {
+					stream.Reader = bytes.NewReader([]byte("not-gzipped"))
+
+					gzipLayerInfo := layerInfo
+					gzipLayerInfo.MediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+					_, _, err := fetcher.StreamBlob(logger, baseImageURL, gzipLayerInfo)
+					Expect(err).To(MatchError(ContainSubstring("blob file is not gzipped")))
+					Expect(stream.closed).To(BeTrue())
+				})
+			})
+
+			Context("when the download progress is requested", func() {
+				It("reports the bytes read from the source stream", func() {
+					progress := []int64{}
+					progressLayerInfo := layerInfo
+					progressLayerInfo.DownloadProgress = func(bytesDownloaded int64) {
+						progress = append(progress, bytesDownloaded)
+					}
+
+					blobStream, _, err := fetcher.StreamBlob(logger, baseImageURL, progressLayerInfo)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = ioutil.ReadAll(blobStream)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(progress).To(Equal([]int64{int64(len(gzipedBlobContent))}))
+				})
+
+				It("still returns a stream that verifies the source stream", func() {
+					progressLayerInfo := layerInfo
+					progressLayerInfo.DownloadProgress = func(int64) {}
+
+					blobStream, _, err := fetcher.StreamBlob(logger, baseImageURL, progressLayerInfo)
+					Expect(err).NotTo(HaveOccurred())
+
+					stream.verifyErr = errors.New("invalid checksum")
+					verifiable, ok := blobStream.(base_image_puller.VerifiableStream)
+					Expect(ok).To(BeTrue())
+					Expect(verifiable.Verify()).To(MatchError("invalid checksum"))
+				})
+			})
+
+			Context("when the blob has no media type and is not compressed", func() {
+				It("streams the blob as it is", func() {
+					stream.Reader = bytes.NewReader([]byte("not-compressed"))
+
+					blobStream, _, err := fetcher.StreamBlob(logger, baseImageURL, layerInfo)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadAll(blobStream)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("not-compressed"))
+				})
+			})
+		})
 	})
 })
+
+type verifiableStream struct {
+	io.Reader
+	verifyErr error
+	closed    bool
+}
+
+func (s *verifiableStream) Verify() error {
+	return s.verifyErr
+}
+
+func (s *verifiableStream) Close() error {
+	s.closed = true
+	return nil
+}
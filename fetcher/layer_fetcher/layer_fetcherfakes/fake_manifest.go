@@ -8,6 +8,7 @@ import (
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -162,6 +163,15 @@ type FakeManifest struct {
 		result1 int64
 		result2 error
 	}
+	ManifestDigestStub        func() digest.Digest
+	manifestDigestMutex       sync.RWMutex
+	manifestDigestArgsForCall []struct{}
+	manifestDigestReturns     struct {
+		result1 digest.Digest
+	}
+	manifestDigestReturnsOnCall map[int]struct {
+		result1 digest.Digest
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -782,6 +792,46 @@ func (fake *FakeManifest) SizeReturnsOnCall(i int, result1 int64, result2 error)
 	}{result1, result2}
 }
 
+func (fake *FakeManifest) ManifestDigest() digest.Digest {
+	fake.manifestDigestMutex.Lock()
+	ret, specificReturn := fake.manifestDigestReturnsOnCall[len(fake.manifestDigestArgsForCall)]
+	fake.manifestDigestArgsForCall = append(fake.manifestDigestArgsForCall, struct{}{})
+	fake.recordInvocation("ManifestDigest", []interface{}{})
+	fake.manifestDigestMutex.Unlock()
+	if fake.ManifestDigestStub != nil {
+		return fake.ManifestDigestStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.manifestDigestReturns.result1
+}
+
+func (fake *FakeManifest) ManifestDigestCallCount() int {
+	fake.manifestDigestMutex.RLock()
+	defer fake.manifestDigestMutex.RUnlock()
+	return len(fake.manifestDigestArgsForCall)
+}
+
+func (fake *FakeManifest) ManifestDigestReturns(result1 digest.Digest) {
+	fake.ManifestDigestStub = nil
+	fake.manifestDigestReturns = struct {
+		result1 digest.Digest
+	}{result1}
+}
+
+func (fake *FakeManifest) ManifestDigestReturnsOnCall(i int, result1 digest.Digest) {
+	fake.ManifestDigestStub = nil
+	if fake.manifestDigestReturnsOnCall == nil {
+		fake.manifestDigestReturnsOnCall = make(map[int]struct {
+			result1 digest.Digest
+		})
+	}
+	fake.manifestDigestReturnsOnCall[i] = struct {
+		result1 digest.Digest
+	}{result1}
+}
+
 func (fake *FakeManifest) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -813,6 +863,8 @@ func (fake *FakeManifest) Invocations() map[string][][]interface{} {
 	defer fake.isMultiImageMutex.RUnlock()
 	fake.sizeMutex.RLock()
 	defer fake.sizeMutex.RUnlock()
+	fake.manifestDigestMutex.RLock()
+	defer fake.manifestDigestMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
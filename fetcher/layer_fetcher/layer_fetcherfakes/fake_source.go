@@ -5,49 +5,87 @@ import (
 	"net/url"
 	"sync"
 
+	"code.cloudfoundry.org/grootfs/base_image_puller"
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
 	"code.cloudfoundry.org/lager"
-	"github.com/containers/image/types"
 )
 
 type FakeSource struct {
-	ManifestStub        func(logger lager.Logger, baseImageURL *url.URL) (types.Image, error)
+	ManifestStub        func(logger lager.Logger, baseImageURL *url.URL) (source.Image, error)
 	manifestMutex       sync.RWMutex
 	manifestArgsForCall []struct {
 		logger       lager.Logger
 		baseImageURL *url.URL
 	}
 	manifestReturns struct {
-		result1 types.Image
+		result1 source.Image
 		result2 error
 	}
 	manifestReturnsOnCall map[int]struct {
-		result1 types.Image
+		result1 source.Image
 		result2 error
 	}
-	BlobStub        func(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string) (string, int64, error)
+	ResolveManifestStub        func(logger lager.Logger, baseImageURL *url.URL) (source.Image, error)
+	resolveManifestMutex       sync.RWMutex
+	resolveManifestArgsForCall []struct {
+		logger       lager.Logger
+		baseImageURL *url.URL
+	}
+	resolveManifestReturns struct {
+		result1 source.Image
+		result2 error
+	}
+	resolveManifestReturnsOnCall map[int]struct {
+		result1 source.Image
+		result2 error
+	}
+	BlobStub        func(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string, progress source.BlobProgress) (string, int64, string, error)
 	blobMutex       sync.RWMutex
 	blobArgsForCall []struct {
 		logger       lager.Logger
 		baseImageURL *url.URL
 		digest       string
 		layersURLs   []string
+		progress     source.BlobProgress
 	}
 	blobReturns struct {
 		result1 string
 		result2 int64
-		result3 error
+		result3 string
+		result4 error
 	}
 	blobReturnsOnCall map[int]struct {
 		result1 string
 		result2 int64
-		result3 error
+		result3 string
+		result4 error
+	}
+	BlobStreamStub        func(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string) (base_image_puller.VerifiableStream, int64, string, error)
+	blobStreamMutex       sync.RWMutex
+	blobStreamArgsForCall []struct {
+		logger       lager.Logger
+		baseImageURL *url.URL
+		digest       string
+		layersURLs   []string
+	}
+	blobStreamReturns struct {
+		result1 base_image_puller.VerifiableStream
+		result2 int64
+		result3 string
+		result4 error
+	}
+	blobStreamReturnsOnCall map[int]struct {
+		result1 base_image_puller.VerifiableStream
+		result2 int64
+		result3 string
+		result4 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeSource) Manifest(logger lager.Logger, baseImageURL *url.URL) (types.Image, error) {
+func (fake *FakeSource) Manifest(logger lager.Logger, baseImageURL *url.URL) (source.Image, error) {
 	fake.manifestMutex.Lock()
 	ret, specificReturn := fake.manifestReturnsOnCall[len(fake.manifestArgsForCall)]
 	fake.manifestArgsForCall = append(fake.manifestArgsForCall, struct {
@@ -77,29 +115,81 @@ func (fake *FakeSource) ManifestArgsForCall(i int) (lager.Logger, *url.URL) {
 	return fake.manifestArgsForCall[i].logger, fake.manifestArgsForCall[i].baseImageURL
 }
 
-func (fake *FakeSource) ManifestReturns(result1 types.Image, result2 error) {
+func (fake *FakeSource) ManifestReturns(result1 source.Image, result2 error) {
 	fake.ManifestStub = nil
 	fake.manifestReturns = struct {
-		result1 types.Image
+		result1 source.Image
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeSource) ManifestReturnsOnCall(i int, result1 types.Image, result2 error) {
+func (fake *FakeSource) ManifestReturnsOnCall(i int, result1 source.Image, result2 error) {
 	fake.ManifestStub = nil
 	if fake.manifestReturnsOnCall == nil {
 		fake.manifestReturnsOnCall = make(map[int]struct {
-			result1 types.Image
+			result1 source.Image
 			result2 error
 		})
 	}
 	fake.manifestReturnsOnCall[i] = struct {
-		result1 types.Image
+		result1 source.Image
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string) (string, int64, error) {
+func (fake *FakeSource) ResolveManifest(logger lager.Logger, baseImageURL *url.URL) (source.Image, error) {
+	fake.resolveManifestMutex.Lock()
+	ret, specificReturn := fake.resolveManifestReturnsOnCall[len(fake.resolveManifestArgsForCall)]
+	fake.resolveManifestArgsForCall = append(fake.resolveManifestArgsForCall, struct {
+		logger       lager.Logger
+		baseImageURL *url.URL
+	}{logger, baseImageURL})
+	fake.recordInvocation("ResolveManifest", []interface{}{logger, baseImageURL})
+	fake.resolveManifestMutex.Unlock()
+	if fake.ResolveManifestStub != nil {
+		return fake.ResolveManifestStub(logger, baseImageURL)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.resolveManifestReturns.result1, fake.resolveManifestReturns.result2
+}
+
+func (fake *FakeSource) ResolveManifestCallCount() int {
+	fake.resolveManifestMutex.RLock()
+	defer fake.resolveManifestMutex.RUnlock()
+	return len(fake.resolveManifestArgsForCall)
+}
+
+func (fake *FakeSource) ResolveManifestArgsForCall(i int) (lager.Logger, *url.URL) {
+	fake.resolveManifestMutex.RLock()
+	defer fake.resolveManifestMutex.RUnlock()
+	return fake.resolveManifestArgsForCall[i].logger, fake.resolveManifestArgsForCall[i].baseImageURL
+}
+
+func (fake *FakeSource) ResolveManifestReturns(result1 source.Image, result2 error) {
+	fake.ResolveManifestStub = nil
+	fake.resolveManifestReturns = struct {
+		result1 source.Image
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSource) ResolveManifestReturnsOnCall(i int, result1 source.Image, result2 error) {
+	fake.ResolveManifestStub = nil
+	if fake.resolveManifestReturnsOnCall == nil {
+		fake.resolveManifestReturnsOnCall = make(map[int]struct {
+			result1 source.Image
+			result2 error
+		})
+	}
+	fake.resolveManifestReturnsOnCall[i] = struct {
+		result1 source.Image
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string, progress source.BlobProgress) (string, int64, string, error) {
 	var layersURLsCopy []string
 	if layersURLs != nil {
 		layersURLsCopy = make([]string, len(layersURLs))
@@ -112,16 +202,17 @@ func (fake *FakeSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest
 		baseImageURL *url.URL
 		digest       string
 		layersURLs   []string
-	}{logger, baseImageURL, digest, layersURLsCopy})
-	fake.recordInvocation("Blob", []interface{}{logger, baseImageURL, digest, layersURLsCopy})
+		progress     source.BlobProgress
+	}{logger, baseImageURL, digest, layersURLsCopy, progress})
+	fake.recordInvocation("Blob", []interface{}{logger, baseImageURL, digest, layersURLsCopy, progress})
 	fake.blobMutex.Unlock()
 	if fake.BlobStub != nil {
-		return fake.BlobStub(logger, baseImageURL, digest, layersURLs)
+		return fake.BlobStub(logger, baseImageURL, digest, layersURLs, progress)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2, ret.result3
+		return ret.result1, ret.result2, ret.result3, ret.result4
 	}
-	return fake.blobReturns.result1, fake.blobReturns.result2, fake.blobReturns.result3
+	return fake.blobReturns.result1, fake.blobReturns.result2, fake.blobReturns.result3, fake.blobReturns.result4
 }
 
 func (fake *FakeSource) BlobCallCount() int {
@@ -130,35 +221,103 @@ func (fake *FakeSource) BlobCallCount() int {
 	return len(fake.blobArgsForCall)
 }
 
-func (fake *FakeSource) BlobArgsForCall(i int) (lager.Logger, *url.URL, string, []string) {
+func (fake *FakeSource) BlobArgsForCall(i int) (lager.Logger, *url.URL, string, []string, source.BlobProgress) {
 	fake.blobMutex.RLock()
 	defer fake.blobMutex.RUnlock()
-	return fake.blobArgsForCall[i].logger, fake.blobArgsForCall[i].baseImageURL, fake.blobArgsForCall[i].digest, fake.blobArgsForCall[i].layersURLs
+	return fake.blobArgsForCall[i].logger, fake.blobArgsForCall[i].baseImageURL, fake.blobArgsForCall[i].digest, fake.blobArgsForCall[i].layersURLs, fake.blobArgsForCall[i].progress
 }
 
-func (fake *FakeSource) BlobReturns(result1 string, result2 int64, result3 error) {
+func (fake *FakeSource) BlobReturns(result1 string, result2 int64, result3 string, result4 error) {
 	fake.BlobStub = nil
 	fake.blobReturns = struct {
 		result1 string
 		result2 int64
-		result3 error
-	}{result1, result2, result3}
+		result3 string
+		result4 error
+	}{result1, result2, result3, result4}
 }
 
-func (fake *FakeSource) BlobReturnsOnCall(i int, result1 string, result2 int64, result3 error) {
+func (fake *FakeSource) BlobReturnsOnCall(i int, result1 string, result2 int64, result3 string, result4 error) {
 	fake.BlobStub = nil
 	if fake.blobReturnsOnCall == nil {
 		fake.blobReturnsOnCall = make(map[int]struct {
 			result1 string
 			result2 int64
-			result3 error
+			result3 string
+			result4 error
 		})
 	}
 	fake.blobReturnsOnCall[i] = struct {
 		result1 string
 		result2 int64
-		result3 error
-	}{result1, result2, result3}
+		result3 string
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *FakeSource) BlobStream(logger lager.Logger, baseImageURL *url.URL, digest string, layersURLs []string) (base_image_puller.VerifiableStream, int64, string, error) {
+	var layersURLsCopy []string
+	if layersURLs != nil {
+		layersURLsCopy = make([]string, len(layersURLs))
+		copy(layersURLsCopy, layersURLs)
+	}
+	fake.blobStreamMutex.Lock()
+	ret, specificReturn := fake.blobStreamReturnsOnCall[len(fake.blobStreamArgsForCall)]
+	fake.blobStreamArgsForCall = append(fake.blobStreamArgsForCall, struct {
+		logger       lager.Logger
+		baseImageURL *url.URL
+		digest       string
+		layersURLs   []string
+	}{logger, baseImageURL, digest, layersURLsCopy})
+	fake.recordInvocation("BlobStream", []interface{}{logger, baseImageURL, digest, layersURLsCopy})
+	fake.blobStreamMutex.Unlock()
+	if fake.BlobStreamStub != nil {
+		return fake.BlobStreamStub(logger, baseImageURL, digest, layersURLs)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3, ret.result4
+	}
+	return fake.blobStreamReturns.result1, fake.blobStreamReturns.result2, fake.blobStreamReturns.result3, fake.blobStreamReturns.result4
+}
+
+func (fake *FakeSource) BlobStreamCallCount() int {
+	fake.blobStreamMutex.RLock()
+	defer fake.blobStreamMutex.RUnlock()
+	return len(fake.blobStreamArgsForCall)
+}
+
+func (fake *FakeSource) BlobStreamArgsForCall(i int) (lager.Logger, *url.URL, string, []string) {
+	fake.blobStreamMutex.RLock()
+	defer fake.blobStreamMutex.RUnlock()
+	return fake.blobStreamArgsForCall[i].logger, fake.blobStreamArgsForCall[i].baseImageURL, fake.blobStreamArgsForCall[i].digest, fake.blobStreamArgsForCall[i].layersURLs
+}
+
+func (fake *FakeSource) BlobStreamReturns(result1 base_image_puller.VerifiableStream, result2 int64, result3 string, result4 error) {
+	fake.BlobStreamStub = nil
+	fake.blobStreamReturns = struct {
+		result1 base_image_puller.VerifiableStream
+		result2 int64
+		result3 string
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *FakeSource) BlobStreamReturnsOnCall(i int, result1 base_image_puller.VerifiableStream, result2 int64, result3 string, result4 error) {
+	fake.BlobStreamStub = nil
+	if fake.blobStreamReturnsOnCall == nil {
+		fake.blobStreamReturnsOnCall = make(map[int]struct {
+			result1 base_image_puller.VerifiableStream
+			result2 int64
+			result3 string
+			result4 error
+		})
+	}
+	fake.blobStreamReturnsOnCall[i] = struct {
+		result1 base_image_puller.VerifiableStream
+		result2 int64
+		result3 string
+		result4 error
+	}{result1, result2, result3, result4}
 }
 
 func (fake *FakeSource) Invocations() map[string][][]interface{} {
@@ -166,8 +325,12 @@ func (fake *FakeSource) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.manifestMutex.RLock()
 	defer fake.manifestMutex.RUnlock()
+	fake.resolveManifestMutex.RLock()
+	defer fake.resolveManifestMutex.RUnlock()
 	fake.blobMutex.RLock()
 	defer fake.blobMutex.RUnlock()
+	fake.blobStreamMutex.RLock()
+	defer fake.blobStreamMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,114 @@
+package layer_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/lager"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	errorspkg "github.com/pkg/errors"
+)
+
+// ManifestCache remembers the layers and config that each image reference
+// last resolved to for each platform, so that images can be created while the
+// registry is unreachable.
+type ManifestCache struct {
+	path string
+	ttl  time.Duration
+}
+
+type manifestCacheEntry struct {
+	Reference      string                        `json:"reference"`
+	Platform       string                        `json:"platform"`
+	CachedAt       time.Time                     `json:"cached_at"`
+	ManifestDigest string                        `json:"manifest_digest"`
+	LayerInfos     []base_image_puller.LayerInfo `json:"layer_infos"`
+	Config         specsv1.Image                 `json:"config"`
+}
+
+// NewManifestCache creates a cache whose entries can be used for ttl after
+// they are stored. When ttl is zero they never expire.
+func NewManifestCache(path string, ttl time.Duration) *ManifestCache {
+	return &ManifestCache{
+		path: path,
+		ttl:  ttl,
+	}
+}
+
+func (c *ManifestCache) Lookup(logger lager.Logger, baseImageURL *url.URL, platform specsv1.Platform) (base_image_puller.BaseImageInfo, bool) {
+	logger = logger.Session("manifest-cache-lookup", lager.Data{"baseImageURL": baseImageURL, "platform": source.FormatPlatform(platform)})
+	logger.Debug("starting")
+	defer logger.Debug("ending")
+
+	contents, err := ioutil.ReadFile(c.entryPath(baseImageURL.String(), platform))
+	if err != nil {
+		logger.Debug("cache-miss", lager.Data{"reason": err.Error()})
+		return base_image_puller.BaseImageInfo{}, false
+	}
+
+	var entry manifestCacheEntry
+	if err := json.Unmarshal(contents, &entry); err != nil {
+		logger.Error("parsing-entry-failed", err)
+		return base_image_puller.BaseImageInfo{}, false
+	}
+
+	if entry.Reference != baseImageURL.String() || entry.Platform != source.FormatPlatform(platform) {
+		return base_image_puller.BaseImageInfo{}, false
+	}
+
+	if c.ttl > 0 && time.Since(entry.CachedAt) > c.ttl {
+		logger.Debug("cache-entry-expired", lager.Data{"cachedAt": entry.CachedAt})
+		return base_image_puller.BaseImageInfo{}, false
+	}
+
+	return base_image_puller.BaseImageInfo{
+		LayerInfos:     entry.LayerInfos,
+		Config:         entry.Config,
+		ManifestDigest: entry.ManifestDigest,
+		Cached:         true,
+	}, true
+}
+
+func (c *ManifestCache) Store(baseImageURL *url.URL, platform specsv1.Platform, baseImageInfo base_image_puller.BaseImageInfo) error {
+	if err := os.MkdirAll(c.path, 0755); err != nil {
+		return errorspkg.Wrap(err, "creating manifest cache directory")
+	}
+
+	contents, err := json.Marshal(manifestCacheEntry{
+		Reference:      baseImageURL.String(),
+		Platform:       source.FormatPlatform(platform),
+		CachedAt:       time.Now(),
+		ManifestDigest: baseImageInfo.ManifestDigest,
+		LayerInfos:     baseImageInfo.LayerInfos,
+		Config:         baseImageInfo.Config,
+	})
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(c.path, "entry")
+	if err != nil {
+		return errorspkg.Wrap(err, "creating manifest cache entry")
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(contents); err != nil {
+		return errorspkg.Wrap(err, "writing manifest cache entry")
+	}
+
+	return os.Rename(tempFile.Name(), c.entryPath(baseImageURL.String(), platform))
+}
+
+func (c *ManifestCache) entryPath(reference string, platform specsv1.Platform) string {
+	referenceSha := sha256.Sum256([]byte(reference + " " + source.FormatPlatform(platform)))
+	return filepath.Join(c.path, hex.EncodeToString(referenceSha[:]))
+}
@@ -0,0 +1,31 @@
+package layer_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+
+import (
+	"io"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+)
+
+// progressInterval is how many bytes are read between two progress calls.
+const progressInterval = 1024 * 1024
+
+// progressStream counts the compressed bytes read from the source, which is
+// the download itself when layers are streamed.
+type progressStream struct {
+	base_image_puller.VerifiableStream
+	progress     func(bytesDownloaded int64)
+	bytesRead    int64
+	lastReported int64
+}
+
+func (s *progressStream) Read(p []byte) (int, error) {
+	n, err := s.VerifiableStream.Read(p)
+	s.bytesRead += int64(n)
+
+	if s.bytesRead-s.lastReported >= progressInterval || (err == io.EOF && s.bytesRead != s.lastReported) {
+		s.lastReported = s.bytesRead
+		s.progress(s.bytesRead)
+	}
+
+	return n, err
+}
@@ -0,0 +1,56 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+// progressInterval is how many bytes are written between two progress calls.
+const progressInterval = 1024 * 1024
+
+// BlobProgress is told how the download of a blob to a temporary file goes.
+// Both functions are optional.
+type BlobProgress struct {
+	// Downloaded is called with the number of bytes downloaded so far.
+	Downloaded func(bytesDownloaded int64)
+	// Verifying is called once the blob is downloaded, before its digest is
+	// checked.
+	Verifying func()
+}
+
+func (p BlobProgress) downloaded(bytesDownloaded int64) {
+	if p.Downloaded != nil {
+		p.Downloaded(bytesDownloaded)
+	}
+}
+
+func (p BlobProgress) verifying() {
+	if p.Verifying != nil {
+		p.Verifying()
+	}
+}
+
+// writer counts the bytes written to the temporary file, starting from the
+// ones that are already there when a download is resumed.
+func (p BlobProgress) writer(offset int64) *progressWriter {
+	return &progressWriter{progress: p, written: offset}
+}
+
+type progressWriter struct {
+	progress BlobProgress
+	written  int64
+	reported int64
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.written += int64(len(b))
+	if w.written-w.reported >= progressInterval {
+		w.reported = w.written
+		w.progress.downloaded(w.written)
+	}
+
+	return len(b), nil
+}
+
+// flush reports the bytes written since the last call.
+func (w *progressWriter) flush() {
+	if w.written != w.reported {
+		w.reported = w.written
+		w.progress.downloaded(w.written)
+	}
+}
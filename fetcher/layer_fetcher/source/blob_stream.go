@@ -0,0 +1,167 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+
+	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/lager"
+	"github.com/containers/image/types"
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// BlobStream returns the blob straight from the registry, without writing it
+// to disk first. The digest is only checked when Verify is called on the
+// returned stream, which must happen after the consumer is done reading it.
+func (s *LayerSource) BlobStream(logger lager.Logger, baseImageURL *url.URL, digest string, layersUrls []string) (base_image_puller.VerifiableStream, int64, string, error) {
+	logrus.SetOutput(os.Stderr)
+	logger = logger.Session("streaming-blob-from-source", lager.Data{
+		"baseImageURL": baseImageURL,
+		"digest":       digest,
+	})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	if blobPath, size, ok := s.convertedBlobs.take(digestpkg.Digest(digest)); ok {
+		logger.Debug("using-blob-downloaded-for-conversion")
+		stream, err := openDownloadedBlob(blobPath)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return stream, size, s.originEndpoint(baseImageURL).host(), nil
+	}
+
+	locations := s.mismatchedBlobs.skip(s.blobLocations(baseImageURL, digest, layersUrls))
+	if len(locations) == 0 {
+		return nil, 0, "", errorspkg.Errorf("no endpoint left to stream blob `%s` from: all of them served a blob that did not match its digest", digest)
+	}
+
+	var err error
+	for i, location := range locations {
+		stream, size, e := s.blobStreamFromEndpoint(logger, location, i < len(locations)-1)
+		if e == nil {
+			logger.Info("blob-served", location.logData())
+			return stream, size, location.servedFrom(), nil
+		}
+
+		err = e
+		location.logFailure(logger, err)
+	}
+
+	return nil, 0, "", err
+}
+
+// blobStreamFromEndpoint streams the blob from the location. When it turns
+// out not to match its digest, the location is skipped the next time the blob
+// is asked for, and the error tells whether there is another location left.
+func (s *LayerSource) blobStreamFromEndpoint(logger lager.Logger, location blobLocation, hasFallback bool) (*blobStream, int64, error) {
+	imgSrc, err := s.imageSource(logger, location.endpoint)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	blobInfo := location.blobInfo
+	blob, size, err := s.getBlobWithRetries(logger, imgSrc, blobInfo)
+	if err != nil {
+		imgSrc.Close()
+		return nil, 0, err
+	}
+	logger.Debug("got-blob-stream", lager.Data{"digest": blobInfo.Digest, "size": size})
+
+	hash := sha256.New()
+	return &blobStream{
+		reader: io.TeeReader(blob, hash),
+		blob:   blob,
+		imgSrc: imgSrc,
+		verify: func() bool {
+			if s.checkCheckSum(logger, hash, blobInfo.Digest.String(), location.endpoint.url.Scheme) {
+				return true
+			}
+			s.mismatchedBlobs.add(blobInfo.Digest, location.servedFrom())
+			return false
+		},
+		digest:      blobInfo.Digest.String(),
+		servedFrom:  location.servedFrom(),
+		hasFallback: hasFallback,
+	}, size, nil
+}
+
+type blobStream struct {
+	reader      io.Reader
+	blob        io.ReadCloser
+	imgSrc      types.ImageSource
+	verify      func() bool
+	digest      string
+	servedFrom  string
+	hasFallback bool
+}
+
+func (b *blobStream) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+// Verify drains whatever the consumer left unread (e.g. tar padding) and
+// checks the digest of the whole blob.
+func (b *blobStream) Verify() error {
+	if _, err := io.Copy(ioutil.Discard, b.reader); err != nil {
+		return errorspkg.Wrap(err, "reading remaining blob contents")
+	}
+
+	if !b.verify() {
+		return &base_image_puller.BlobMismatchError{
+			Digest:      b.digest,
+			ServedFrom:  b.servedFrom,
+			HasFallback: b.hasFallback,
+		}
+	}
+
+	return nil
+}
+
+func (b *blobStream) Close() error {
+	defer b.imgSrc.Close()
+	return b.blob.Close()
+}
+
+// mismatchedBlobs remembers the locations that streamed a blob that did not
+// match its digest.
+type mismatchedBlobs struct {
+	mutex     sync.Mutex
+	locations map[digestpkg.Digest]map[string]bool
+}
+
+func newMismatchedBlobs() *mismatchedBlobs {
+	return &mismatchedBlobs{
+		locations: map[digestpkg.Digest]map[string]bool{},
+	}
+}
+
+func (b *mismatchedBlobs) add(digest digestpkg.Digest, servedFrom string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.locations[digest] == nil {
+		b.locations[digest] = map[string]bool{}
+	}
+	b.locations[digest][servedFrom] = true
+}
+
+func (b *mismatchedBlobs) skip(locations []blobLocation) []blobLocation {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	remaining := []blobLocation{}
+	for _, location := range locations {
+		if !b.locations[location.blobInfo.Digest][location.servedFrom()] {
+			remaining = append(remaining, location)
+		}
+	}
+
+	return remaining
+}
@@ -0,0 +1,69 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+)
+
+// DiffIDCache remembers the diff ID of schema 1 layers by blob digest, so that
+// converting a schema 1 manifest doesn't need to download its layers again.
+type DiffIDCache struct {
+	path string
+}
+
+func NewDiffIDCache(path string) *DiffIDCache {
+	return &DiffIDCache{
+		path: path,
+	}
+}
+
+func (c *DiffIDCache) Lookup(blobDigest digestpkg.Digest) (digestpkg.Digest, bool) {
+	if blobDigest.Validate() != nil {
+		return "", false
+	}
+
+	contents, err := ioutil.ReadFile(c.entryPath(blobDigest))
+	if err != nil {
+		return "", false
+	}
+
+	diffID := digestpkg.Digest(strings.TrimSpace(string(contents)))
+	if diffID.Validate() != nil {
+		return "", false
+	}
+
+	return diffID, true
+}
+
+func (c *DiffIDCache) Store(blobDigest, diffID digestpkg.Digest) error {
+	if err := blobDigest.Validate(); err != nil {
+		return errorspkg.Wrapf(err, "invalid blob digest `%s`", blobDigest)
+	}
+
+	if err := os.MkdirAll(c.path, 0755); err != nil {
+		return errorspkg.Wrap(err, "creating diff ID cache directory")
+	}
+
+	tempFile, err := ioutil.TempFile(c.path, "entry")
+	if err != nil {
+		return errorspkg.Wrap(err, "creating diff ID cache entry")
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := tempFile.WriteString(diffID.String()); err != nil {
+		return errorspkg.Wrap(err, "writing diff ID cache entry")
+	}
+
+	return os.Rename(tempFile.Name(), c.entryPath(blobDigest))
+}
+
+func (c *DiffIDCache) entryPath(blobDigest digestpkg.Digest) string {
+	return filepath.Join(c.path, fmt.Sprintf("%s-%s", blobDigest.Algorithm(), blobDigest.Hex()))
+}
@@ -0,0 +1,105 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/containers/image/docker/reference"
+	errorspkg "github.com/pkg/errors"
+)
+
+const DockerArchiveScheme = "docker-archive"
+
+type dockerArchiveManifestItem struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// archiveReference splits a `docker-archive:///path.tar[:tag]` or
+// `oci-archive:///path.tar[:ref]` path the same way containers/image does, on
+// the first colon.
+func archiveReference(refString string) (string, string) {
+	parts := strings.SplitN(refString, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// checkDockerArchiveTag makes sure the archive contains the requested tag.
+// containers/image only reads archives with a single image and ignores the
+// tag when reading.
+func checkDockerArchiveTag(logger lager.Logger, refString string) error {
+	archivePath, tag := archiveReference(refString)
+	if tag == "" {
+		return nil
+	}
+
+	logger = logger.Session("checking-docker-archive-tag", lager.Data{"archivePath": archivePath, "tag": tag})
+	logger.Debug("starting")
+	defer logger.Debug("ending")
+
+	wantedRef, err := normalizedTag(tag)
+	if err != nil {
+		return errorspkg.Wrapf(err, "parsing tag `%s`", tag)
+	}
+
+	items, err := readDockerArchiveManifest(archivePath)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		for _, repoTag := range item.RepoTags {
+			if ref, err := normalizedTag(repoTag); err == nil && ref == wantedRef {
+				return nil
+			}
+		}
+	}
+
+	return errorspkg.Errorf("tag `%s` not found in docker archive `%s`", tag, archivePath)
+}
+
+func readDockerArchiveManifest(archivePath string) ([]dockerArchiveManifestItem, error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "opening docker archive")
+	}
+	defer archive.Close()
+
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, errorspkg.Errorf("docker archive `%s` has no manifest.json", archivePath)
+		}
+		if err != nil {
+			return nil, errorspkg.Wrap(err, "reading docker archive")
+		}
+
+		if strings.TrimPrefix(header.Name, "./") != "manifest.json" {
+			continue
+		}
+
+		var items []dockerArchiveManifestItem
+		if err := json.NewDecoder(tarReader).Decode(&items); err != nil {
+			return nil, errorspkg.Wrap(err, "parsing docker archive manifest.json")
+		}
+		return items, nil
+	}
+}
+
+func normalizedTag(tag string) (string, error) {
+	ref, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.TagNameOnly(ref).String(), nil
+}
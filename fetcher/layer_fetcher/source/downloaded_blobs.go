@@ -0,0 +1,86 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"os"
+	"sync"
+
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+)
+
+type downloadedBlob struct {
+	path string
+	size int64
+}
+
+// downloadedBlobs keeps verified blobs in temporary files until they are used
+type downloadedBlobs struct {
+	mutex sync.Mutex
+	blobs map[digestpkg.Digest]downloadedBlob
+}
+
+func newDownloadedBlobs() *downloadedBlobs {
+	return &downloadedBlobs{
+		blobs: map[digestpkg.Digest]downloadedBlob{},
+	}
+}
+
+func (b *downloadedBlobs) add(digest digestpkg.Digest, path string, size int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if previous, ok := b.blobs[digest]; ok {
+		_ = os.Remove(previous.path)
+	}
+	b.blobs[digest] = downloadedBlob{path: path, size: size}
+}
+
+// take hands the blob over to the caller, who is then responsible for
+// removing it.
+func (b *downloadedBlobs) take(digest digestpkg.Digest) (string, int64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	blob, ok := b.blobs[digest]
+	if !ok {
+		return "", 0, false
+	}
+	delete(b.blobs, digest)
+
+	return blob.path, blob.size, true
+}
+
+func (b *downloadedBlobs) removeAll() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for digest, blob := range b.blobs {
+		_ = os.Remove(blob.path)
+		delete(b.blobs, digest)
+	}
+}
+
+// downloadedBlobStream streams a blob that was verified when it was
+// downloaded, and removes it once closed.
+type downloadedBlobStream struct {
+	*os.File
+}
+
+func openDownloadedBlob(path string) (*downloadedBlobStream, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, errorspkg.Wrap(err, "opening downloaded blob")
+	}
+
+	return &downloadedBlobStream{File: file}, nil
+}
+
+func (s *downloadedBlobStream) Verify() error {
+	return nil
+}
+
+func (s *downloadedBlobStream) Close() error {
+	defer os.Remove(s.Name())
+	return s.File.Close()
+}
@@ -14,6 +14,8 @@ import (
 
 	"code.cloudfoundry.org/lager"
 	_ "github.com/containers/image/docker"
+	_ "github.com/containers/image/docker/archive"
+	"github.com/containers/image/image"
 	manifestpkg "github.com/containers/image/manifest"
 	_ "github.com/containers/image/oci/layout"
 	"github.com/containers/image/transports"
@@ -24,52 +26,91 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const MAX_DOCKER_RETRIES = 3
-
 type LayerSource struct {
 	skipOCIChecksumValidation bool
 	systemContext             types.SystemContext
+	platform                  specsv1.Platform
+	registryMirrors           map[string][]string
+	retryPolicy               RetryPolicy
+	diffIDCache               *DiffIDCache
+	convertedBlobs            *downloadedBlobs
+	mismatchedBlobs           *mismatchedBlobs
 }
 
-func NewLayerSource(systemContext types.SystemContext, skipOCIChecksumValidation bool) LayerSource {
+// NewLayerSource creates a source. The diffIDCache is optional: when it is
+// nil, the layers of schema 1 images are downloaded on every conversion.
+// Layers downloaded for a conversion are kept until they are asked for with
+// Blob, or until Close is called.
+func NewLayerSource(systemContext types.SystemContext, skipOCIChecksumValidation bool, platform specsv1.Platform, registryMirrors map[string][]string, retryPolicy RetryPolicy, diffIDCache *DiffIDCache) LayerSource {
 	return LayerSource{
 		systemContext:             systemContext,
 		skipOCIChecksumValidation: skipOCIChecksumValidation,
+		platform:                  platform,
+		registryMirrors:           registryMirrors,
+		retryPolicy:               retryPolicy,
+		diffIDCache:               diffIDCache,
+		convertedBlobs:            newDownloadedBlobs(),
+		mismatchedBlobs:           newMismatchedBlobs(),
 	}
 }
 
-func (s *LayerSource) Manifest(logger lager.Logger, baseImageURL *url.URL) (types.Image, error) {
+// Close removes the layers downloaded to convert a schema 1 manifest that
+// were never asked for.
+func (s *LayerSource) Close() {
+	s.convertedBlobs.removeAll()
+}
+
+func (s *LayerSource) Manifest(logger lager.Logger, baseImageURL *url.URL) (Image, error) {
 	logger = logger.Session("fetching-image-manifest", lager.Data{"baseImageURL": baseImageURL})
 	logger.Info("starting")
 	defer logger.Info("ending")
 
-	img, err := s.getImageWithRetries(logger, baseImageURL)
+	resolvedImg, err := s.getImageWithRetries(logger, baseImageURL)
 	if err != nil {
 		logger.Error("fetching-image-reference-failed", err)
 		return nil, errorspkg.Wrap(err, "fetching image reference")
 	}
 
-	img, err = s.convertImage(logger, img, baseImageURL)
+	img, err := s.convertImage(logger, resolvedImg, baseImageURL)
 	if err != nil {
 		logger.Error("converting-image-failed", err)
 		return nil, err
 	}
 
-	for i := 0; i < MAX_DOCKER_RETRIES; i++ {
-		logger.Debug("attempt-get-config", lager.Data{"attempt": i + 1})
-		_, e := img.ConfigBlob()
-		if e == nil {
-			return img, nil
+	err = s.retryPolicy.retry(logger, func(attempt int) error {
+		logger.Debug("attempt-get-config", lager.Data{"attempt": attempt})
+		if _, err := img.ConfigBlob(); err != nil {
+			logger.Error("fetching-image-config-failed", err, lager.Data{"attempt": attempt})
+			return err
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "fetching image configuration")
+	}
 
-		logger.Error("fetching-image-config-failed", e, lager.Data{"attempt": i + 1})
-		err = e
+	return &resolvedImage{Image: img, manifestDigest: resolvedImg.ManifestDigest()}, nil
+}
+
+// ResolveManifest fetches the manifest of the image only: unlike Manifest, it
+// neither converts it nor fetches the configuration, so no blob is downloaded.
+func (s *LayerSource) ResolveManifest(logger lager.Logger, baseImageURL *url.URL) (Image, error) {
+	logger = logger.Session("resolving-image-manifest", lager.Data{"baseImageURL": baseImageURL})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	img, err := s.getImageWithRetries(logger, baseImageURL)
+	if err != nil {
+		logger.Error("fetching-image-reference-failed", err)
+		return nil, errorspkg.Wrap(err, "fetching image reference")
 	}
 
-	return nil, errorspkg.Wrap(err, "fetching image configuration")
+	return img, nil
 }
 
-func (s *LayerSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest string, layersUrls []string) (string, int64, error) {
+// Blob downloads the blob to a temporary file, and also returns where it was
+// served from: the URL of a foreign layer, or the registry (or mirror) host.
+func (s *LayerSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest string, layersUrls []string, progress BlobProgress) (string, int64, string, error) {
 	logrus.SetOutput(os.Stderr)
 	logger = logger.Session("streaming-blob", lager.Data{
 		"baseImageURL": baseImageURL,
@@ -78,39 +119,65 @@ func (s *LayerSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest st
 	logger.Info("starting")
 	defer logger.Info("ending")
 
-	imgSrc, err := s.imageSource(logger, baseImageURL)
-	if err != nil {
-		return "", 0, err
+	if blobPath, size, ok := s.convertedBlobs.take(digestpkg.Digest(digest)); ok {
+		logger.Debug("using-blob-downloaded-for-conversion")
+		progress.downloaded(size)
+		return blobPath, size, s.originEndpoint(baseImageURL).host(), nil
+	}
+
+	var err error
+	for _, location := range s.blobLocations(baseImageURL, digest, layersUrls) {
+		blobPath, size, e := s.blobFromEndpoint(logger, location.endpoint, location.blobInfo, progress)
+		if e == nil {
+			logger.Info("blob-served", location.logData())
+			return blobPath, size, location.servedFrom(), nil
+		}
+
+		err = e
+		location.logFailure(logger, err)
 	}
 
-	blobInfo := types.BlobInfo{
-		Digest: digestpkg.Digest(digest),
-		URLs:   layersUrls,
+	return "", 0, "", err
+}
+
+func (s *LayerSource) blobFromEndpoint(logger lager.Logger, endpoint endpoint, blobInfo types.BlobInfo, progress BlobProgress) (string, int64, error) {
+	if s.canResume(endpoint, blobInfo) {
+		return s.resumableBlobFromEndpoint(logger, endpoint, blobInfo, progress)
 	}
 
+	imgSrc, err := s.imageSource(logger, endpoint)
+	if err != nil {
+		return "", 0, err
+	}
+	defer imgSrc.Close()
+
+	digest := blobInfo.Digest.String()
 	blob, size, err := s.getBlobWithRetries(logger, imgSrc, blobInfo)
 	if err != nil {
 		return "", 0, err
 	}
+	defer blob.Close()
 	logger.Debug("got-blob-stream", lager.Data{"digest": digest, "size": size})
 
 	blobTempFile, err := ioutil.TempFile("", fmt.Sprintf("blob-%s", digest))
 	if err != nil {
 		return "", 0, err
 	}
-	defer func() {
-		blob.Close()
-		blobTempFile.Close()
-	}()
+	defer blobTempFile.Close()
 
 	hash := sha256.New()
-	blobWriter := io.MultiWriter(blobTempFile, hash)
+	progressWriter := progress.writer(0)
+	blobWriter := io.MultiWriter(blobTempFile, hash, progressWriter)
 	if _, err := io.Copy(blobWriter, blob); err != nil {
 		logger.Error("writing-blob-to-file", err)
+		_ = os.Remove(blobTempFile.Name())
 		return "", 0, errorspkg.Wrap(err, "writing blob to tempfile")
 	}
+	progressWriter.flush()
 
-	if !s.checkCheckSum(logger, hash, digest, baseImageURL.Scheme) {
+	progress.verifying()
+	if !s.checkCheckSum(logger, hash, digest, endpoint.url.Scheme) {
+		_ = os.Remove(blobTempFile.Name())
 		return "", 0, errorspkg.Errorf("invalid checksum: layer is corrupted `%s`", digest)
 	}
 
@@ -118,23 +185,31 @@ func (s *LayerSource) Blob(logger lager.Logger, baseImageURL *url.URL, digest st
 }
 
 func (s *LayerSource) getBlobWithRetries(logger lager.Logger, imgSrc types.ImageSource, blobInfo types.BlobInfo) (io.ReadCloser, int64, error) {
-	var err error
-	for i := 0; i < MAX_DOCKER_RETRIES; i++ {
-		logger.Debug(fmt.Sprintf("attempt-get-blob-%d", i+1))
-		blob, size, e := imgSrc.GetBlob(blobInfo)
-		if e == nil {
-			logger.Debug("attempt-get-blob-success")
-			return blob, size, nil
+	var (
+		blob io.ReadCloser
+		size int64
+	)
+	err := s.retryPolicy.retry(logger, func(attempt int) error {
+		logger.Debug(fmt.Sprintf("attempt-get-blob-%d", attempt))
+		var err error
+		blob, size, err = imgSrc.GetBlob(blobInfo)
+		if err != nil {
+			logger.Error("attempt-get-blob-failed", err)
+			return err
 		}
-		err = e
-		logger.Error("attempt-get-blob-failed", err)
+
+		logger.Debug("attempt-get-blob-success")
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return nil, 0, err
+	return blob, size, nil
 }
 
 func (s *LayerSource) checkCheckSum(logger lager.Logger, hash hash.Hash, digest string, scheme string) bool {
-	if s.skipOCIChecksumValidation && scheme == "oci" {
+	if s.skipOCIChecksumValidation && (scheme == "oci" || scheme == OCIArchiveScheme) {
 		return true
 	}
 
@@ -148,13 +223,13 @@ func (s *LayerSource) checkCheckSum(logger lager.Logger, hash hash.Hash, digest
 }
 
 func (s *LayerSource) reference(logger lager.Logger, baseImageURL *url.URL) (types.ImageReference, error) {
-	refString := "/"
-	if baseImageURL.Host != "" {
-		refString += "/" + baseImageURL.Host
-	}
-	refString += baseImageURL.Path
+	refString := referenceString(baseImageURL)
 
 	logger.Debug("parsing-reference", lager.Data{"refString": refString})
+	if baseImageURL.Scheme == OCIArchiveScheme {
+		return newOCIArchiveReference(refString), nil
+	}
+
 	transport := transports.Get(baseImageURL.Scheme)
 	ref, err := transport.ParseReference(refString)
 	if err != nil {
@@ -164,34 +239,122 @@ func (s *LayerSource) reference(logger lager.Logger, baseImageURL *url.URL) (typ
 	return ref, nil
 }
 
-func (s *LayerSource) getImageWithRetries(logger lager.Logger, baseImageURL *url.URL) (types.Image, error) {
-	ref, err := s.reference(logger, baseImageURL)
-	if err != nil {
-		return nil, err
+func referenceString(baseImageURL *url.URL) string {
+	isArchive := baseImageURL.Scheme == DockerArchiveScheme || baseImageURL.Scheme == OCIArchiveScheme
+	if isArchive && baseImageURL.Host == "" {
+		return baseImageURL.Path
 	}
 
-	var imgErr error
-	for i := 0; i < MAX_DOCKER_RETRIES; i++ {
-		logger.Debug(fmt.Sprintf("attempt-get-image-%d", i+1))
+	refString := "/"
+	if baseImageURL.Host != "" {
+		refString += "/" + baseImageURL.Host
+	}
+	return refString + baseImageURL.Path
+}
 
-		img, e := ref.NewImage(&s.systemContext)
+func (s *LayerSource) getImageWithRetries(logger lager.Logger, baseImageURL *url.URL) (Image, error) {
+	var err error
+	for _, endpoint := range s.endpoints(baseImageURL) {
+		img, e := s.getImageFromEndpointWithRetries(logger, endpoint)
 		if e == nil {
-			logger.Debug("attempt-get-image-success")
+			logger.Info("image-served", lager.Data{"endpoint": endpoint.host(), "mirror": endpoint.mirror})
 			return img, nil
 		}
-		imgErr = e
+
+		err = e
+		if endpoint.mirror {
+			logger.Error("fetching-image-from-mirror-failed", err, lager.Data{"mirror": endpoint.host()})
+		}
+	}
+
+	return nil, err
+}
+
+func (s *LayerSource) getImageFromEndpointWithRetries(logger lager.Logger, endpoint endpoint) (Image, error) {
+	ref, err := s.reference(logger, endpoint.url)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.url.Scheme == DockerArchiveScheme {
+		if err := checkDockerArchiveTag(logger, referenceString(endpoint.url)); err != nil {
+			return nil, err
+		}
+	}
+
+	var img Image
+	err = s.retryPolicy.retry(logger, func(attempt int) error {
+		logger.Debug(fmt.Sprintf("attempt-get-image-%d", attempt))
+
+		var err error
+		if img, err = s.newImage(logger, ref, endpoint.systemContext); err != nil {
+			return err
+		}
+
+		logger.Debug("attempt-get-image-success")
+		return nil
+	})
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "creating image")
+	}
+
+	return img, nil
+}
+
+func (s *LayerSource) newImage(logger lager.Logger, ref types.ImageReference, systemContext types.SystemContext) (Image, error) {
+	imgSrc, err := ref.NewImageSource(&systemContext)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := s.resolveImage(logger, ref, imgSrc)
+	if err != nil {
+		imgSrc.Close()
+		return nil, err
 	}
 
-	return nil, errorspkg.Wrap(imgErr, "creating image")
+	return img, nil
 }
 
-func (s *LayerSource) imageSource(logger lager.Logger, baseImageURL *url.URL) (types.ImageSource, error) {
-	ref, err := s.reference(logger, baseImageURL)
+func (s *LayerSource) resolveImage(logger lager.Logger, ref types.ImageReference, imgSrc types.ImageSource) (Image, error) {
+	rawManifest, mimeType, err := imgSrc.GetManifest()
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "fetching manifest")
+	}
+
+	if digest, ok := pinnedDigest(ref); ok {
+		logger.Debug("checking-pinned-digest", lager.Data{"digest": digest})
+		if err := checkManifestDigest(rawManifest, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	manifestDigest, err := manifestpkg.Digest(rawManifest)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "calculating manifest digest")
+	}
+	logger.Debug("resolved-manifest-digest", lager.Data{"digest": manifestDigest})
+
+	platformImgSrc, err := s.selectPlatform(logger, imgSrc, rawManifest, mimeType)
 	if err != nil {
 		return nil, err
 	}
 
-	imgSrc, err := ref.NewImageSource(&s.systemContext)
+	img, err := image.FromSource(platformImgSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resolvedImage{Image: img, manifestDigest: manifestDigest}, nil
+}
+
+func (s *LayerSource) imageSource(logger lager.Logger, endpoint endpoint) (types.ImageSource, error) {
+	ref, err := s.reference(logger, endpoint.url)
+	if err != nil {
+		return nil, err
+	}
+
+	imgSrc, err := ref.NewImageSource(&endpoint.systemContext)
 	if err != nil {
 		return nil, errorspkg.Wrap(err, "creating image source")
 	}
@@ -213,18 +376,25 @@ func (s *LayerSource) convertImage(logger lager.Logger, originalImage types.Imag
 	logger.Info("starting")
 	defer logger.Info("ending")
 
-	imgSrc, err := s.imageSource(logger, baseImageURL)
-	if err != nil {
-		return nil, err
-	}
-
 	diffIDs := []digestpkg.Digest{}
 	for _, layer := range originalImage.LayerInfos() {
-		diffID, err := s.v1DiffID(logger, layer, imgSrc)
+		if diffID, ok := s.cachedDiffID(layer.Digest); ok {
+			logger.Debug("using-cached-diff-id", lager.Data{"digest": layer.Digest, "diffID": diffID})
+			diffIDs = append(diffIDs, diffID)
+			continue
+		}
+
+		diffID, err := s.v1DiffID(logger, layer, s.originEndpoint(baseImageURL))
 		if err != nil {
 			return nil, errorspkg.Wrap(err, "converting V1 schema failed")
 		}
 		diffIDs = append(diffIDs, diffID)
+
+		if s.diffIDCache != nil {
+			if err := s.diffIDCache.Store(layer.Digest, diffID); err != nil {
+				logger.Error("caching-diff-id-failed", err)
+			}
+		}
 	}
 
 	options := types.ManifestUpdateOptions{
@@ -237,11 +407,29 @@ func (s *LayerSource) convertImage(logger lager.Logger, originalImage types.Imag
 	return originalImage.UpdatedImage(options)
 }
 
-func (s *LayerSource) v1DiffID(logger lager.Logger, layer types.BlobInfo, imgSrc types.ImageSource) (digestpkg.Digest, error) {
-	blob, _, err := s.getBlobWithRetries(logger, imgSrc, layer)
+// v1DiffID downloads the layer, checking its digest, and computes its diff ID.
+// The layer is kept for Blob, so that it is not downloaded twice.
+func (s *LayerSource) v1DiffID(logger lager.Logger, layer types.BlobInfo, endpoint endpoint) (digestpkg.Digest, error) {
+	blobPath, size, err := s.blobFromEndpoint(logger, endpoint, layer, BlobProgress{})
 	if err != nil {
 		return "", errorspkg.Wrap(err, "fetching V1 layer blob")
 	}
+
+	diffID, err := gunzippedDigest(blobPath)
+	if err != nil {
+		_ = os.Remove(blobPath)
+		return "", err
+	}
+
+	s.convertedBlobs.add(layer.Digest, blobPath, size)
+	return diffID, nil
+}
+
+func gunzippedDigest(blobPath string) (digestpkg.Digest, error) {
+	blob, err := os.Open(blobPath)
+	if err != nil {
+		return "", errorspkg.Wrap(err, "opening V1 layer blob")
+	}
 	defer blob.Close()
 
 	gzipReader, err := gzip.NewReader(blob)
@@ -249,13 +437,20 @@ func (s *LayerSource) v1DiffID(logger lager.Logger, layer types.BlobInfo, imgSrc
 		return "", errorspkg.Wrap(err, "creating reader for V1 layer blob")
 	}
 
-	data, err := ioutil.ReadAll(gzipReader)
-	if err != nil {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, gzipReader); err != nil {
 		return "", errorspkg.Wrap(err, "reading V1 layer blob")
 	}
-	sha := sha256.Sum256(data)
 
-	return digestpkg.NewDigestFromHex("sha256", hex.EncodeToString(sha[:])), nil
+	return digestpkg.NewDigestFromHex("sha256", hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+func (s *LayerSource) cachedDiffID(blobDigest digestpkg.Digest) (digestpkg.Digest, bool) {
+	if s.diffIDCache == nil {
+		return "", false
+	}
+
+	return s.diffIDCache.Lookup(blobDigest)
 }
 
 func preferedMediaTypes() []string {
@@ -0,0 +1,126 @@
+package source_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/containers/image/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ = Describe("Layer source: docker archive", func() {
+	var (
+		layerSource source.LayerSource
+
+		logger       *lagertest.TestLogger
+		baseImageURL *url.URL
+		archivePath  string
+		layerDigest  string
+	)
+
+	BeforeEach(func() {
+		layerDigest = "sha256:4372714419f59eab13d32f4191c3e724bba0b8242182be59d3797b8b42af9cc3"
+
+		logger = lagertest.NewTestLogger("test-layer-source")
+		workDir, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		archivePath = fmt.Sprintf("%s/../../../integration/assets/docker-archive-test-image/pokemon.tar", workDir)
+		baseImageURL, err = url.Parse(fmt.Sprintf("docker-archive://%s", archivePath))
+		Expect(err).NotTo(HaveOccurred())
+
+		layerSource = source.NewLayerSource(types.SystemContext{}, false, specsv1.Platform{OS: "linux", Architecture: "amd64"}, nil, source.DefaultRetryPolicy(), nil)
+	})
+
+	Describe("Manifest", func() {
+		It("reads the manifest from the archive", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifest.LayerInfos()).To(HaveLen(1))
+			Expect(manifest.LayerInfos()[0].Digest.String()).To(Equal(layerDigest))
+		})
+
+		It("contains the config", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			config, err := manifest.OCIConfig()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(config.RootFS.DiffIDs).To(HaveLen(1))
+			Expect(config.RootFS.DiffIDs[0].String()).To(Equal(layerDigest))
+		})
+
+		Context("when a tag in the archive is requested", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse(fmt.Sprintf("docker-archive://%s:grootfs/pokemon:latest", archivePath))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("reads the manifest from the archive", func() {
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.LayerInfos()).To(HaveLen(1))
+			})
+
+			Context("when the tag is implicit", func() {
+				BeforeEach(func() {
+					var err error
+					baseImageURL, err = url.Parse(fmt.Sprintf("docker-archive://%s:grootfs/pokemon", archivePath))
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("uses the latest tag", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when the tag is not in the archive", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse(fmt.Sprintf("docker-archive://%s:grootfs/digimon:latest", archivePath))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(MatchError(ContainSubstring("tag `grootfs/digimon:latest` not found in docker archive")))
+			})
+		})
+
+		Context("when the archive does not exist", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse("docker-archive:///not/a/real/archive.tar:grootfs/pokemon:latest")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(MatchError(ContainSubstring("opening docker archive")))
+			})
+		})
+	})
+
+	Describe("Blob", func() {
+		It("extracts the layer from the archive", func() {
+			blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, layerDigest, nil, source.BlobProgress{})
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(blobPath)
+			Expect(size).To(Equal(int64(2048)))
+
+			contents, err := ioutil.ReadFile(blobPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("pikachu"))
+		})
+	})
+})
@@ -2,12 +2,16 @@ package source_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"time"
 
+	"code.cloudfoundry.org/grootfs/base_image_puller"
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
 	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
 	"code.cloudfoundry.org/grootfs/integration"
@@ -34,6 +38,8 @@ var _ = Describe("Layer source: Docker", func() {
 		systemContext     types.SystemContext
 
 		skipOCIChecksumValidation bool
+		registryMirrors           map[string][]string
+		retryPolicy               source.RetryPolicy
 	)
 
 	BeforeEach(func() {
@@ -45,6 +51,12 @@ var _ = Describe("Layer source: Docker", func() {
 		}
 
 		skipOCIChecksumValidation = false
+		registryMirrors = nil
+		retryPolicy = source.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     100 * time.Millisecond,
+		}
 
 		configBlob = "sha256:217f3b4afdf698d639f854d9c6d640903a011413bc7e7bffeabe63c7ca7e4a7d"
 		expectedBlobInfos = []types.BlobInfo{
@@ -69,7 +81,35 @@ var _ = Describe("Layer source: Docker", func() {
 	})
 
 	JustBeforeEach(func() {
-		layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation)
+		layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation, source.DefaultPlatform(), registryMirrors, retryPolicy, nil)
+	})
+
+	Describe("ResolveManifest", func() {
+		It("resolves the manifest with the same digest as Manifest", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			resolvedManifest, err := layerSource.ResolveManifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolvedManifest.ManifestDigest()).To(Equal(manifest.ManifestDigest()))
+			Expect(resolvedManifest.LayerInfos()).To(Equal(expectedBlobInfos))
+		})
+
+		Context("when the image schema version is 1", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse("docker://cfgarden/empty:schemaV1")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("does not download any layer to convert it", func() {
+				manifest, err := layerSource.ResolveManifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.LayerInfos()).To(HaveLen(3))
+
+				Expect(logger).NotTo(gbytes.Say("convert-schema-V1-image"))
+			})
+		})
 	})
 
 	Describe("Manifest", func() {
@@ -104,6 +144,56 @@ var _ = Describe("Layer source: Docker", func() {
 			})
 		})
 
+		Context("when the image is pinned to a digest", func() {
+			var manifestDigest digestpkg.Digest
+
+			JustBeforeEach(func() {
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				manifestDigest = manifest.ManifestDigest()
+
+				baseImageURL, err = url.Parse("docker:///cfgarden/empty@" + manifestDigest.String())
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("fetches the manifest the tag resolved to", func() {
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(manifest.ManifestDigest()).To(Equal(manifestDigest))
+				Expect(manifest.ConfigInfo().Digest.String()).To(Equal(configBlob))
+				Expect(manifest.LayerInfos()).To(Equal(expectedBlobInfos))
+			})
+		})
+
+		Context("when the registry serves a manifest that does not match the pinned digest", func() {
+			const pinnedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+			var fakeRegistry *testhelpers.FakeRegistry
+
+			BeforeEach(func() {
+				dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+				Expect(err).NotTo(HaveOccurred())
+				fakeRegistry = testhelpers.NewFakeRegistry(dockerHubUrl)
+				fakeRegistry.Start()
+				fakeRegistry.WhenGettingManifest(pinnedDigest, func(rw http.ResponseWriter, req *http.Request) {
+					rw.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+					_, _ = rw.Write([]byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":1,"digest":%q},"layers":[]}`, configBlob)))
+				})
+
+				systemContext.DockerInsecureSkipTLSVerify = true
+				baseImageURL = integration.String2URL(fmt.Sprintf("docker://%s/cfgarden/empty@%s", fakeRegistry.Addr(), pinnedDigest))
+			})
+
+			AfterEach(func() {
+				fakeRegistry.Stop()
+			})
+
+			It("returns an error", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(MatchError(ContainSubstring("does not match the expected digest `" + pinnedDigest + "`")))
+			})
+		})
+
 		Context("when the image is private", func() {
 			BeforeEach(func() {
 				var err error
@@ -186,6 +276,36 @@ var _ = Describe("Layer source: Docker", func() {
 				Expect(logger).To(gbytes.Say("fetching-image-reference-failed"))
 				Expect(logger).To(gbytes.Say("unauthorized: authentication required"))
 			})
+
+			It("does not retry", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(HaveOccurred())
+
+				Expect(logger.TestSink.LogMessages()).To(ContainElement("test-layer-source.fetching-image-manifest.attempt-get-image-1"))
+				Expect(logger.TestSink.LogMessages()).NotTo(ContainElement("test-layer-source.fetching-image-manifest.attempt-get-image-2"))
+			})
+
+			It("does not report the registry as unreachable", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(HaveOccurred())
+				Expect(source.IsUnreachable(err)).To(BeFalse())
+			})
+		})
+
+		Context("when the registry is not reachable", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse("docker://127.0.0.1:1/cfgarden/empty:v0.1.1")
+				Expect(err).NotTo(HaveOccurred())
+
+				retryPolicy.MaxAttempts = 1
+			})
+
+			It("reports the registry as unreachable", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(HaveOccurred())
+				Expect(source.IsUnreachable(err)).To(BeTrue())
+			})
 		})
 	})
 
@@ -211,7 +331,7 @@ var _ = Describe("Layer source: Docker", func() {
 			})
 
 			JustBeforeEach(func() {
-				layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation)
+				layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation, source.DefaultPlatform(), registryMirrors, retryPolicy, nil)
 				var err error
 				manifest, err = layerSource.Manifest(logger, baseImageURL)
 				Expect(err).NotTo(HaveOccurred())
@@ -262,6 +382,118 @@ var _ = Describe("Layer source: Docker", func() {
 				Expect(config.RootFS.DiffIDs[1].String()).To(Equal(testhelpers.SchemaV1EmptyBaseImage.Layers[1].DiffID))
 				Expect(config.RootFS.DiffIDs[2].String()).To(Equal(testhelpers.SchemaV1EmptyBaseImage.Layers[2].DiffID))
 			})
+
+			Context("when a diff ID cache is provided", func() {
+				var (
+					fakeRegistry *testhelpers.FakeRegistry
+					cacheDir     string
+					diffIDCache  *source.DiffIDCache
+				)
+
+				BeforeEach(func() {
+					dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+					Expect(err).NotTo(HaveOccurred())
+					fakeRegistry = testhelpers.NewFakeRegistry(dockerHubUrl)
+					fakeRegistry.Start()
+
+					systemContext.DockerInsecureSkipTLSVerify = true
+					baseImageURL, err = url.Parse(fmt.Sprintf("docker://%s/cfgarden/empty:schemaV1", fakeRegistry.Addr()))
+					Expect(err).NotTo(HaveOccurred())
+
+					cacheDir, err = ioutil.TempDir("", "diff-ids")
+					Expect(err).NotTo(HaveOccurred())
+					diffIDCache = source.NewDiffIDCache(cacheDir)
+				})
+
+				JustBeforeEach(func() {
+					layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation, source.DefaultPlatform(), registryMirrors, retryPolicy, diffIDCache)
+				})
+
+				AfterEach(func() {
+					fakeRegistry.Stop()
+					Expect(os.RemoveAll(cacheDir)).To(Succeed())
+				})
+
+				It("caches the diff IDs by blob digest", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					for _, layer := range testhelpers.SchemaV1EmptyBaseImage.Layers {
+						diffID, ok := diffIDCache.Lookup(digestpkg.Digest(layer.BlobID))
+						Expect(ok).To(BeTrue())
+						Expect(diffID.String()).To(Equal(layer.DiffID))
+					}
+				})
+
+				It("does not download the layers again to convert the manifest", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					for _, layer := range testhelpers.SchemaV1EmptyBaseImage.Layers {
+						fakeRegistry.WhenGettingBlob(layer.BlobID, 0, func(rw http.ResponseWriter, req *http.Request) {
+							rw.WriteHeader(http.StatusInternalServerError)
+						})
+					}
+
+					manifest, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+					config, err := manifest.OCIConfig()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(config.RootFS.DiffIDs).To(HaveLen(3))
+					for i, layer := range testhelpers.SchemaV1EmptyBaseImage.Layers {
+						Expect(config.RootFS.DiffIDs[i].String()).To(Equal(layer.DiffID))
+					}
+				})
+
+				It("does not download the converted layers again", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					layer := testhelpers.SchemaV1EmptyBaseImage.Layers[0]
+					fakeRegistry.WhenGettingBlob(layer.BlobID, 0, func(rw http.ResponseWriter, req *http.Request) {
+						rw.WriteHeader(http.StatusInternalServerError)
+					})
+
+					blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, layer.BlobID, nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(blobPath).To(BeAnExistingFile())
+					Expect(os.Remove(blobPath)).To(Succeed())
+				})
+
+				It("removes the converted layers that were not used when it's closed", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					layer := testhelpers.SchemaV1EmptyBaseImage.Layers[0]
+					blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, layer.BlobID, nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(os.Remove(blobPath)).To(Succeed())
+
+					layerSource.Close()
+
+					blobPath, _, _, err = layerSource.Blob(logger, baseImageURL, layer.BlobID, nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(blobPath).To(BeAnExistingFile())
+					Expect(os.Remove(blobPath)).To(Succeed())
+				})
+
+				Context("when a layer is corrupted", func() {
+					BeforeEach(func() {
+						fakeRegistry.WhenGettingBlob(testhelpers.SchemaV1EmptyBaseImage.Layers[1].BlobID, 0, func(rw http.ResponseWriter, req *http.Request) {
+							_, _ = rw.Write([]byte("bad-blob"))
+						})
+					})
+
+					It("does not cache its diff ID", func() {
+						_, err := layerSource.Manifest(logger, baseImageURL)
+						Expect(err).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
+
+						_, ok := diffIDCache.Lookup(digestpkg.Digest(testhelpers.SchemaV1EmptyBaseImage.Layers[1].BlobID))
+						Expect(ok).To(BeFalse())
+					})
+				})
+			})
 		})
 	})
 
@@ -298,7 +530,7 @@ var _ = Describe("Layer source: Docker", func() {
 		It("retries fetching a blob twice", func() {
 			fakeRegistry.FailNextRequests(2)
 
-			_, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+			_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(logger.TestSink.LogMessages()).To(
@@ -307,7 +539,7 @@ var _ = Describe("Layer source: Docker", func() {
 
 		It("retries fetching the config blob twice", func() {
 			fakeRegistry.WhenGettingBlob(configBlob, 1, func(resp http.ResponseWriter, req *http.Request) {
-				resp.WriteHeader(http.StatusTeapot)
+				resp.WriteHeader(http.StatusServiceUnavailable)
 				_, _ = resp.Write([]byte("null"))
 				return
 			})
@@ -320,6 +552,172 @@ var _ = Describe("Layer source: Docker", func() {
 			Expect(logger.TestSink.LogMessages()).To(
 				ContainElement("test-layer-source.fetching-image-manifest.fetching-image-config-failed"))
 		})
+
+		Context("when the registry fails with a server error", func() {
+			BeforeEach(func() {
+				retryPolicy.MaxAttempts = 5
+				fakeRegistry.WhenGettingBlob(expectedBlobInfos[0].Digest.String(), 0, func(rw http.ResponseWriter, req *http.Request) {
+					rw.WriteHeader(http.StatusServiceUnavailable)
+				})
+			})
+
+			It("gives up after the configured number of attempts", func() {
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+				Expect(err).To(MatchError(ContainSubstring("fetching blob 503")))
+				Expect(fakeRegistry.RequestedBlobRanges(expectedBlobInfos[0].Digest.String())).To(HaveLen(5))
+			})
+		})
+
+		Context("when the registry responds that the manifest is not found", func() {
+			BeforeEach(func() {
+				fakeRegistry.WhenGettingManifest("v0.1.1", func(rw http.ResponseWriter, req *http.Request) {
+					rw.WriteHeader(http.StatusNotFound)
+					_, _ = rw.Write([]byte("not found"))
+				})
+			})
+
+			It("does not retry", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(HaveOccurred())
+
+				Expect(logger.TestSink.LogMessages()).To(ContainElement("test-layer-source.fetching-image-manifest.attempt-get-image-1"))
+				Expect(logger.TestSink.LogMessages()).NotTo(ContainElement("test-layer-source.fetching-image-manifest.attempt-get-image-2"))
+			})
+		})
+
+		Context("when the registry does not implement the request", func() {
+			BeforeEach(func() {
+				fakeRegistry.WhenGettingManifest("v0.1.1", func(rw http.ResponseWriter, req *http.Request) {
+					rw.WriteHeader(http.StatusNotImplemented)
+				})
+			})
+
+			It("does not retry", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(HaveOccurred())
+
+				Expect(logger.TestSink.LogMessages()).NotTo(ContainElement("test-layer-source.fetching-image-manifest.attempt-get-image-2"))
+			})
+		})
+
+		Context("when the registry fails with an unrecognised error", func() {
+			BeforeEach(func() {
+				fakeRegistry.WhenGettingManifest("v0.1.1", func(rw http.ResponseWriter, req *http.Request) {
+					rw.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+					_, _ = rw.Write([]byte("{"))
+				})
+			})
+
+			It("retries it", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(HaveOccurred())
+
+				Expect(logger.TestSink.LogMessages()).To(ContainElement("test-layer-source.fetching-image-manifest.attempt-get-image-3"))
+			})
+		})
+	})
+
+	Context("when registry mirrors are configured", func() {
+		var fakeMirror *testhelpers.FakeRegistry
+
+		BeforeEach(func() {
+			dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+			Expect(err).NotTo(HaveOccurred())
+			fakeMirror = testhelpers.NewFakeRegistry(dockerHubUrl)
+			fakeMirror.Start()
+
+			systemContext.DockerInsecureSkipTLSVerify = true
+			registryMirrors = map[string][]string{
+				"docker.io": []string{fakeMirror.Addr()},
+			}
+		})
+
+		AfterEach(func() {
+			fakeMirror.Stop()
+		})
+
+		It("fetches the manifest from the mirror", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.LayerInfos()).To(HaveLen(2))
+
+			Expect(fakeMirror.RequestedBlobs()).To(ContainElement(configBlob))
+			Expect(logger).To(gbytes.Say(`"endpoint":"` + fakeMirror.Addr() + `"`))
+		})
+
+		It("downloads blobs from the mirror", func() {
+			_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeMirror.RequestedBlobs()).To(ConsistOf(expectedBlobInfos[0].Digest.String()))
+			Expect(logger).To(gbytes.Say("blob-served"))
+			Expect(logger).To(gbytes.Say(`"endpoint":"` + fakeMirror.Addr() + `"`))
+		})
+
+		Context("when the mirror serves a corrupted blob", func() {
+			BeforeEach(func() {
+				fakeMirror.WhenGettingBlob(expectedBlobInfos[1].Digest.String(), 0, func(rw http.ResponseWriter, req *http.Request) {
+					_, _ = rw.Write([]byte("bad-blob"))
+				})
+			})
+
+			It("falls back to the origin registry", func() {
+				blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil, source.BlobProgress{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blobPath).To(BeAnExistingFile())
+
+				Expect(logger).To(gbytes.Say("fetching-blob-from-mirror-failed"))
+				Expect(logger).To(gbytes.Say(`"endpoint":"docker.io"`))
+			})
+
+			It("streams it from the origin registry once the mirror failed the verification", func() {
+				stream, _, servedFrom, err := layerSource.BlobStream(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(servedFrom).To(Equal(fakeMirror.Addr()))
+
+				verifyErr := stream.Verify()
+				Expect(stream.Close()).To(Succeed())
+				Expect(verifyErr).To(BeAssignableToTypeOf(&base_image_puller.BlobMismatchError{}))
+				Expect(verifyErr.(*base_image_puller.BlobMismatchError).HasFallback).To(BeTrue())
+
+				stream, _, servedFrom, err = layerSource.BlobStream(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil)
+				Expect(err).NotTo(HaveOccurred())
+				defer stream.Close()
+				Expect(servedFrom).To(Equal("docker.io"))
+
+				Expect(stream.Verify()).To(Succeed())
+			})
+		})
+
+		Context("when the mirror is not reachable", func() {
+			BeforeEach(func() {
+				registryMirrors = map[string][]string{
+					"docker.io": []string{"127.0.0.1:1", fakeMirror.Addr()},
+				}
+			})
+
+			It("tries the next mirror", func() {
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger).To(gbytes.Say("fetching-image-from-mirror-failed"))
+				Expect(logger).To(gbytes.Say(`"endpoint":"` + fakeMirror.Addr() + `"`))
+			})
+		})
+
+		Context("when the mirrors are for another registry", func() {
+			BeforeEach(func() {
+				registryMirrors = map[string][]string{
+					"registry.example.org": []string{fakeMirror.Addr()},
+				}
+			})
+
+			It("does not use them", func() {
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeMirror.RequestedBlobs()).To(BeEmpty())
+			})
+		})
 	})
 
 	Context("when a private registry is used", func() {
@@ -372,7 +770,7 @@ var _ = Describe("Layer source: Docker", func() {
 			})
 
 			It("downloads a blob", func() {
-				blobPath, size, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+				blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 				Expect(err).NotTo(HaveOccurred())
 
 				blobReader, err := os.Open(blobPath)
@@ -405,7 +803,7 @@ var _ = Describe("Layer source: Docker", func() {
 				})
 
 				JustBeforeEach(func() {
-					layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation)
+					layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation, source.DefaultPlatform(), registryMirrors, retryPolicy, nil)
 				})
 
 				It("fetches the manifest", func() {
@@ -430,7 +828,7 @@ var _ = Describe("Layer source: Docker", func() {
 				})
 
 				It("downloads a blob", func() {
-					blobPath, size, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+					blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 					Expect(err).NotTo(HaveOccurred())
 
 					blobReader, err := os.Open(blobPath)
@@ -452,7 +850,7 @@ var _ = Describe("Layer source: Docker", func() {
 
 	Describe("Blob", func() {
 		It("downloads a blob", func() {
-			blobPath, size, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+			blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 			Expect(err).NotTo(HaveOccurred())
 
 			blobReader, err := os.Open(blobPath)
@@ -469,6 +867,64 @@ var _ = Describe("Layer source: Docker", func() {
 			Eventually(sess).Should(gexec.Exit(0))
 		})
 
+		It("returns the registry that served the blob", func() {
+			_, _, servedFrom, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(servedFrom).To(Equal("docker.io"))
+		})
+
+		It("reports the download progress and the verification", func() {
+			events := []string{}
+			progress := source.BlobProgress{
+				Downloaded: func(bytesDownloaded int64) {
+					events = append(events, fmt.Sprintf("downloaded-%d", bytesDownloaded))
+				},
+				Verifying: func() {
+					events = append(events, "verifying")
+				},
+			}
+
+			_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, progress)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(Equal([]string{"downloaded-90", "verifying"}))
+		})
+
+		Context("when the layer has foreign URLs", func() {
+			var foreignServer *httptest.Server
+
+			BeforeEach(func() {
+				retryPolicy.MaxAttempts = 1
+			})
+
+			JustBeforeEach(func() {
+				blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+				Expect(err).NotTo(HaveOccurred())
+				blobContents, err := ioutil.ReadFile(blobPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				foreignServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = w.Write(blobContents)
+				}))
+			})
+
+			AfterEach(func() {
+				foreignServer.Close()
+			})
+
+			It("falls back to the next URL and returns the one that served the blob", func() {
+				unreachableURL := "http://127.0.0.1:1/layer.tar.gz"
+				foreignURL := foreignServer.URL + "/layer.tar.gz"
+
+				blobPath, _, servedFrom, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), []string{unreachableURL, foreignURL}, source.BlobProgress{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blobPath).To(BeAnExistingFile())
+				Expect(servedFrom).To(Equal(foreignURL))
+
+				Expect(logger).To(gbytes.Say("fetching-blob-from-url-failed.*" + unreachableURL))
+				Expect(logger).To(gbytes.Say(`blob-served.*"servedFrom":"` + foreignURL + `"`))
+			})
+		})
+
 		Context("when the image is private", func() {
 			BeforeEach(func() {
 				var err error
@@ -481,7 +937,7 @@ var _ = Describe("Layer source: Docker", func() {
 
 			Context("when the correct credentials are provided", func() {
 				It("fetches the config", func() {
-					blobPath, size, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+					blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 					Expect(err).NotTo(HaveOccurred())
 
 					blobReader, err := os.Open(blobPath)
@@ -519,7 +975,7 @@ var _ = Describe("Layer source: Docker", func() {
 				})
 
 				It("retuns an error", func() {
-					_, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+					_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 					Expect(err).To(MatchError(ContainSubstring("unable to retrieve auth token")))
 				})
 			})
@@ -530,14 +986,14 @@ var _ = Describe("Layer source: Docker", func() {
 				baseImageURL, err := url.Parse("docker:cfgarden/empty:v0.1.0")
 				Expect(err).NotTo(HaveOccurred())
 
-				_, _, err = layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+				_, _, _, err = layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 				Expect(err).To(MatchError(ContainSubstring("parsing url failed")))
 			})
 		})
 
 		Context("when the blob does not exist", func() {
 			It("returns an error", func() {
-				_, _, err := layerSource.Blob(logger, baseImageURL, "sha256:steamed-blob", nil)
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, "sha256:steamed-blob", nil, source.BlobProgress{})
 				Expect(err).To(MatchError(ContainSubstring("fetching blob 404")))
 			})
 		})
@@ -565,7 +1021,7 @@ var _ = Describe("Layer source: Docker", func() {
 			})
 
 			It("returns an error", func() {
-				_, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil)
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil, source.BlobProgress{})
 				Expect(err).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
 			})
 
@@ -575,10 +1031,305 @@ var _ = Describe("Layer source: Docker", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil)
+					_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil, source.BlobProgress{})
 					Expect(err).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
 				})
 			})
 		})
+
+		Context("when resuming downloads", func() {
+			var (
+				fakeRegistry    *testhelpers.FakeRegistry
+				blobDigest      digestpkg.Digest
+				blobContents    []byte
+				partialBlobPath string
+			)
+
+			BeforeEach(func() {
+				blobDigest = expectedBlobInfos[0].Digest
+
+				hubLayerSource := source.NewLayerSource(systemContext, false, source.DefaultPlatform(), nil, retryPolicy, nil)
+				blobPath, _, _, err := hubLayerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+				Expect(err).NotTo(HaveOccurred())
+				blobContents, err = ioutil.ReadFile(blobPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.Remove(blobPath)).To(Succeed())
+
+				partialBlobPath = source.PartialBlobPath(blobDigest)
+				Expect(partialBlobPath).NotTo(BeAnExistingFile())
+
+				dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+				Expect(err).NotTo(HaveOccurred())
+				fakeRegistry = testhelpers.NewFakeRegistry(dockerHubUrl)
+				fakeRegistry.Start()
+
+				baseImageURL, err = url.Parse(fmt.Sprintf("docker://%s/cfgarden/empty:v0.1.1", fakeRegistry.Addr()))
+				Expect(err).NotTo(HaveOccurred())
+				systemContext.DockerInsecureSkipTLSVerify = true
+			})
+
+			AfterEach(func() {
+				fakeRegistry.Stop()
+				Expect(os.RemoveAll(partialBlobPath)).To(Succeed())
+			})
+
+			interruptedDownload := func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Length", fmt.Sprintf("%d", len(blobContents)))
+				rw.WriteHeader(http.StatusOK)
+				_, _ = rw.Write(blobContents[:10])
+			}
+
+			Context("when the download is interrupted", func() {
+				BeforeEach(func() {
+					fakeRegistry.WhenGettingBlob(blobDigest.String(), 1, interruptedDownload)
+				})
+
+				It("continues from where it was interrupted", func() {
+					blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+					defer os.Remove(blobPath)
+
+					Expect(fakeRegistry.RequestedBlobRanges(blobDigest.String())).To(Equal([]string{"", "bytes=10-"}))
+					Expect(size).To(Equal(int64(90)))
+					Expect(ioutil.ReadFile(blobPath)).To(Equal(blobContents))
+				})
+
+				It("removes the partial blob once it is complete", func() {
+					blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+					defer os.Remove(blobPath)
+
+					Expect(partialBlobPath).NotTo(BeAnExistingFile())
+				})
+			})
+
+			Context("when all the attempts are interrupted", func() {
+				BeforeEach(func() {
+					fakeRegistry.WhenGettingBlob(blobDigest.String(), 0, interruptedDownload)
+				})
+
+				It("keeps the partial blob for the next time", func() {
+					_, _, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+					Expect(err).To(HaveOccurred())
+
+					Expect(ioutil.ReadFile(partialBlobPath)).To(Equal(blobContents[:10]))
+				})
+			})
+
+			Context("when a previous download left a partial blob", func() {
+				BeforeEach(func() {
+					Expect(os.MkdirAll(filepath.Dir(partialBlobPath), 0700)).To(Succeed())
+					Expect(ioutil.WriteFile(partialBlobPath, blobContents[:10], 0600)).To(Succeed())
+				})
+
+				It("requests only the remaining bytes", func() {
+					blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+					defer os.Remove(blobPath)
+
+					Expect(fakeRegistry.RequestedBlobRanges(blobDigest.String())).To(Equal([]string{"bytes=10-"}))
+					Expect(ioutil.ReadFile(blobPath)).To(Equal(blobContents))
+				})
+
+				Context("when the registry is throttling requests", func() {
+					BeforeEach(func() {
+						retryPolicy.MaxBackoff = 2 * time.Second
+						fakeRegistry.WhenGettingBlob(expectedBlobInfos[0].Digest.String(), 1, func(rw http.ResponseWriter, req *http.Request) {
+							rw.Header().Set("Retry-After", "1")
+							rw.WriteHeader(http.StatusTooManyRequests)
+						})
+					})
+
+					It("backs off for as long as the registry asks", func() {
+						start := time.Now()
+						blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+						Expect(err).NotTo(HaveOccurred())
+						defer os.Remove(blobPath)
+
+						Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+						Expect(fakeRegistry.RequestedBlobRanges(expectedBlobInfos[0].Digest.String())).To(HaveLen(2))
+					})
+
+					Context("when the registry asks for longer than the maximum backoff", func() {
+						BeforeEach(func() {
+							retryPolicy.MaxBackoff = 100 * time.Millisecond
+						})
+
+						It("gives up instead of waiting less than it was asked to", func() {
+							start := time.Now()
+							_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+							Expect(err).To(MatchError(ContainSubstring("registry asked to retry after 1s, longer than the maximum backoff")))
+
+							Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+							Expect(fakeRegistry.RequestedBlobRanges(expectedBlobInfos[0].Digest.String())).To(HaveLen(1))
+						})
+					})
+				})
+
+				Context("when the blob is not found", func() {
+					BeforeEach(func() {
+						fakeRegistry.WhenGettingBlob(expectedBlobInfos[0].Digest.String(), 0, func(rw http.ResponseWriter, req *http.Request) {
+							rw.WriteHeader(http.StatusNotFound)
+						})
+					})
+
+					It("fails without retrying", func() {
+						_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+						Expect(err).To(MatchError(ContainSubstring("fetching blob 404")))
+						Expect(fakeRegistry.RequestedBlobRanges(expectedBlobInfos[0].Digest.String())).To(HaveLen(1))
+					})
+				})
+
+				Context("when the registry no longer accepts the token", func() {
+					BeforeEach(func() {
+						fakeRegistry.WhenGettingBlob(expectedBlobInfos[0].Digest.String(), 1, func(rw http.ResponseWriter, req *http.Request) {
+							rw.WriteHeader(http.StatusUnauthorized)
+						})
+					})
+
+					It("gets a new token and requests the remaining bytes again", func() {
+						blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
+						Expect(err).NotTo(HaveOccurred())
+						defer os.Remove(blobPath)
+
+						Expect(fakeRegistry.RequestedBlobRanges(expectedBlobInfos[0].Digest.String())).To(Equal([]string{"bytes=10-", "bytes=10-"}))
+						Expect(ioutil.ReadFile(blobPath)).To(Equal(blobContents))
+						Expect(logger).To(gbytes.Say("refreshing-registry-authorization"))
+					})
+				})
+
+				Context("when the registry certificate is trusted through the certificates path", func() {
+					var certDir string
+
+					BeforeEach(func() {
+						var err error
+						certDir, err = ioutil.TempDir("", "registry-certs")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ioutil.WriteFile(filepath.Join(certDir, "registry.crt"), fakeRegistry.CertificatePEM(), 0600)).To(Succeed())
+
+						systemContext.DockerInsecureSkipTLSVerify = false
+						systemContext.DockerCertPath = certDir
+					})
+
+					AfterEach(func() {
+						Expect(os.RemoveAll(certDir)).To(Succeed())
+					})
+
+					It("requests the remaining bytes over TLS", func() {
+						blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+						Expect(err).NotTo(HaveOccurred())
+						defer os.Remove(blobPath)
+
+						Expect(fakeRegistry.RequestedBlobRanges(blobDigest.String())).To(Equal([]string{"bytes=10-"}))
+						Expect(ioutil.ReadFile(blobPath)).To(Equal(blobContents))
+					})
+				})
+
+				Context("when the registry does not support ranges", func() {
+					BeforeEach(func() {
+						fakeRegistry.WhenGettingBlob(blobDigest.String(), 1, func(rw http.ResponseWriter, req *http.Request) {
+							_, _ = rw.Write(blobContents)
+						})
+					})
+
+					It("starts the download over", func() {
+						blobPath, _, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+						Expect(err).NotTo(HaveOccurred())
+						defer os.Remove(blobPath)
+
+						Expect(ioutil.ReadFile(blobPath)).To(Equal(blobContents))
+					})
+				})
+
+				Context("when the partial blob is corrupted", func() {
+					BeforeEach(func() {
+						Expect(ioutil.WriteFile(partialBlobPath, []byte("0123456789"), 0600)).To(Succeed())
+					})
+
+					It("fails the checksum and discards the partial blob", func() {
+						_, _, _, err := layerSource.Blob(logger, baseImageURL, blobDigest.String(), nil, source.BlobProgress{})
+						Expect(err).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
+
+						Expect(partialBlobPath).NotTo(BeAnExistingFile())
+					})
+				})
+			})
+		})
+	})
+
+	Describe("BlobStream", func() {
+		It("streams a blob", func() {
+			stream, size, _, err := layerSource.BlobStream(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			buffer := gbytes.NewBuffer()
+			cmd := exec.Command("tar", "tzv")
+			cmd.Stdin = stream
+			sess, err := gexec.Start(cmd, buffer, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).To(Equal(int64(90)))
+
+			Eventually(buffer).Should(gbytes.Say("hello"))
+			Eventually(sess).Should(gexec.Exit(0))
+
+			Expect(stream.Verify()).To(Succeed())
+		})
+
+		It("verifies the digest even when the stream was not fully read", func() {
+			stream, _, _, err := layerSource.BlobStream(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			Expect(stream.Verify()).To(Succeed())
+		})
+
+		Context("when the blob does not exist", func() {
+			It("returns an error", func() {
+				_, _, _, err := layerSource.BlobStream(logger, baseImageURL, "sha256:steamed-blob", nil)
+				Expect(err).To(MatchError(ContainSubstring("fetching blob 404")))
+			})
+		})
+
+		Context("when the blob is corrupted", func() {
+			var fakeRegistry *testhelpers.FakeRegistry
+
+			BeforeEach(func() {
+				dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+				Expect(err).NotTo(HaveOccurred())
+				fakeRegistry = testhelpers.NewFakeRegistry(dockerHubUrl)
+				fakeRegistry.WhenGettingBlob(expectedBlobInfos[1].Digest.String(), 1, func(rw http.ResponseWriter, req *http.Request) {
+					_, _ = rw.Write([]byte("bad-blob"))
+				})
+				fakeRegistry.Start()
+
+				baseImageURL, err = url.Parse(fmt.Sprintf("docker://%s/cfgarden/empty:v0.1.1", fakeRegistry.Addr()))
+				Expect(err).NotTo(HaveOccurred())
+
+				systemContext.DockerInsecureSkipTLSVerify = true
+			})
+
+			AfterEach(func() {
+				fakeRegistry.Stop()
+			})
+
+			It("fails the verification", func() {
+				stream, _, _, err := layerSource.BlobStream(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil)
+				Expect(err).NotTo(HaveOccurred())
+				defer stream.Close()
+
+				Expect(stream.Verify()).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
+			})
+
+			It("reports that there is no other endpoint to stream it from", func() {
+				stream, _, _, err := layerSource.BlobStream(logger, baseImageURL, expectedBlobInfos[1].Digest.String(), nil)
+				Expect(err).NotTo(HaveOccurred())
+				defer stream.Close()
+
+				verifyErr := stream.Verify()
+				Expect(verifyErr).To(BeAssignableToTypeOf(&base_image_puller.BlobMismatchError{}))
+				Expect(verifyErr.(*base_image_puller.BlobMismatchError).HasFallback).To(BeFalse())
+			})
+		})
 	})
 })
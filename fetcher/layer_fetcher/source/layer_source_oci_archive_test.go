@@ -0,0 +1,194 @@
+package source_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/containers/image/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ = Describe("Layer source: OCI archive", func() {
+	var (
+		layerSource source.LayerSource
+
+		logger       *lagertest.TestLogger
+		baseImageURL *url.URL
+		tmpDir       string
+		layerDigest  string
+
+		skipOCIChecksumValidation bool
+	)
+
+	archiveLayout := func(layoutName string) string {
+		workDir, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+
+		archivePath := filepath.Join(tmpDir, layoutName+".tar")
+		layoutPath := filepath.Join(workDir, "../../../integration/assets/oci-test-image", layoutName)
+		cmd := exec.Command("tar", "-C", layoutPath, "-cf", archivePath, ".")
+		output, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+
+		return archivePath
+	}
+
+	BeforeEach(func() {
+		skipOCIChecksumValidation = false
+		layerDigest = "sha256:56bec22e355981d8ba0878c6c2f23b21f422f30ab0aba188b54f1ffeff59c190"
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "oci-archive")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("test-layer-source")
+		baseImageURL, err = url.Parse(fmt.Sprintf("oci-archive://%s:latest", archiveLayout("opq-whiteouts-busybox")))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		layerSource = source.NewLayerSource(types.SystemContext{}, skipOCIChecksumValidation, specsv1.Platform{OS: "linux", Architecture: "amd64"}, nil, source.DefaultRetryPolicy(), nil)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Describe("Manifest", func() {
+		It("reads the manifest from the archive", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifest.LayerInfos()).To(HaveLen(2))
+			Expect(manifest.LayerInfos()[0].Digest.String()).To(Equal(layerDigest))
+			Expect(manifest.ManifestDigest().String()).To(Equal("sha256:9c90ae0cffa9d1426e83a516183f0267e03edbb765efc5fb0c0dccc8edca4f15"))
+		})
+
+		It("contains the config", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			config, err := manifest.OCIConfig()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(config.RootFS.DiffIDs).To(HaveLen(2))
+			Expect(config.RootFS.DiffIDs[0].String()).To(Equal("sha256:e88b3f82283bc59d5e0df427c824e9f95557e661fcb0ea15fb0fb6f97760f9d9"))
+		})
+
+		Context("when no reference is given", func() {
+			It("uses the only image in the archive", func() {
+				baseImageURL.Path = filepath.Join(tmpDir, "opq-whiteouts-busybox.tar")
+
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifest.LayerInfos()).To(HaveLen(2))
+			})
+
+			Context("and the archive contains more than one image", func() {
+				BeforeEach(func() {
+					var err error
+					baseImageURL, err = url.Parse(fmt.Sprintf("oci-archive://%s", archiveLayout("multi-arch")))
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("returns an error", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).To(MatchError(ContainSubstring("contains 3 images, a reference is required")))
+				})
+			})
+		})
+
+		Context("when the reference is not in the archive", func() {
+			It("returns an error", func() {
+				baseImageURL.Path = filepath.Join(tmpDir, "opq-whiteouts-busybox.tar") + ":non-existing"
+
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(MatchError(ContainSubstring("reference `non-existing` not found in oci archive")))
+			})
+		})
+
+		Context("when the image is a multi-arch index", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse(fmt.Sprintf("oci-archive://%s:latest", archiveLayout("multi-arch")))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("selects the image for the platform", func() {
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				config, err := manifest.OCIConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Architecture).To(Equal("amd64"))
+			})
+		})
+
+		Context("when the archive does not exist", func() {
+			It("returns an error", func() {
+				baseImageURL.Path = "/non-existing.tar:latest"
+
+				_, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).To(MatchError(ContainSubstring("opening oci archive")))
+			})
+		})
+	})
+
+	Describe("Blob", func() {
+		It("extracts the blob from the archive", func() {
+			blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, layerDigest, nil, source.BlobProgress{})
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(blobPath)
+
+			Expect(size).To(Equal(int64(668151)))
+			Expect(blobPath).To(BeAnExistingFile())
+		})
+
+		Context("when the blob is corrupted", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse(fmt.Sprintf("oci-archive://%s:latest", archiveLayout("corrupted")))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, layerDigest, nil, source.BlobProgress{})
+				Expect(err).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
+			})
+
+			Context("when skipOCIChecksumValidation is set to true", func() {
+				BeforeEach(func() {
+					skipOCIChecksumValidation = true
+				})
+
+				It("does not validate against checksums and does not return an error", func() {
+					_, _, _, err := layerSource.Blob(logger, baseImageURL, layerDigest, nil, source.BlobProgress{})
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+		})
+	})
+
+	Describe("BlobStream", func() {
+		It("streams the blob from the archive", func() {
+			stream, size, _, err := layerSource.BlobStream(logger, baseImageURL, layerDigest, nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close()
+
+			Expect(size).To(Equal(int64(668151)))
+			written, err := io.Copy(ioutil.Discard, stream)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(written).To(Equal(size))
+			Expect(stream.Verify()).To(Succeed())
+		})
+	})
+})
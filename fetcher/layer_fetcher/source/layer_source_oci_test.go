@@ -14,6 +14,7 @@ import (
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 	digestpkg "github.com/opencontainers/go-digest"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var _ = Describe("Layer source: OCI", func() {
@@ -30,10 +31,12 @@ var _ = Describe("Layer source: OCI", func() {
 		systemContext     types.SystemContext
 
 		skipOCIChecksumValidation bool
+		platform                  specsv1.Platform
 	)
 
 	BeforeEach(func() {
 		skipOCIChecksumValidation = false
+		platform = specsv1.Platform{OS: "linux", Architecture: "amd64"}
 
 		configBlob = "sha256:10c8f0eb9d1af08fe6e3b8dbd29e5aa2b6ecfa491ecd04ed90de19a4ac22de7b"
 		expectedBlobInfos = []types.BlobInfo{
@@ -62,7 +65,7 @@ var _ = Describe("Layer source: OCI", func() {
 	})
 
 	JustBeforeEach(func() {
-		layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation)
+		layerSource = source.NewLayerSource(systemContext, skipOCIChecksumValidation, platform, nil, source.DefaultRetryPolicy(), nil)
 	})
 
 	Describe("Manifest", func() {
@@ -89,6 +92,13 @@ var _ = Describe("Layer source: OCI", func() {
 			Expect(config.RootFS.DiffIDs[1]).To(Equal(expectedDiffIds[1]))
 		})
 
+		It("returns the digest of the manifest", func() {
+			manifest, err := layerSource.Manifest(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifest.ManifestDigest().String()).To(Equal("sha256:9c90ae0cffa9d1426e83a516183f0267e03edbb765efc5fb0c0dccc8edca4f15"))
+		})
+
 		Context("when the image url is invalid", func() {
 			It("returns an error", func() {
 				baseImageURL, err := url.Parse("oci://///cfgarden/empty:v0.1.0")
@@ -120,6 +130,58 @@ var _ = Describe("Layer source: OCI", func() {
 			})
 		})
 
+		Context("when the image is a multi-arch index", func() {
+			BeforeEach(func() {
+				var err error
+				baseImageURL, err = url.Parse(fmt.Sprintf("oci:///%s/../../../integration/assets/oci-test-image/multi-arch:latest", workDir))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("selects the manifest for the platform", func() {
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				config, err := manifest.OCIConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.Architecture).To(Equal("amd64"))
+			})
+
+			It("returns the digest of the index", func() {
+				manifest, err := layerSource.Manifest(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(manifest.ManifestDigest().String()).To(Equal("sha256:dab029023aff12f8f3f07adf476a96f5fcd03281c2db77416d7de8b10824bbc7"))
+			})
+
+			Context("when a different platform is requested", func() {
+				BeforeEach(func() {
+					platform = specsv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+				})
+
+				It("selects the manifest for the requested platform", func() {
+					manifest, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).NotTo(HaveOccurred())
+
+					config, err := manifest.OCIConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(config.Architecture).To(Equal("arm64"))
+				})
+			})
+
+			Context("when no manifest matches the platform", func() {
+				BeforeEach(func() {
+					var err error
+					baseImageURL, err = url.Parse(fmt.Sprintf("oci:///%s/../../../integration/assets/oci-test-image/multi-arch:arm64-only", workDir))
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("returns an error", func() {
+					_, err := layerSource.Manifest(logger, baseImageURL)
+					Expect(err).To(MatchError(ContainSubstring("no image found for platform `linux/amd64`")))
+				})
+			})
+		})
+
 		Context("when the config blob does not exist", func() {
 			BeforeEach(func() {
 				var err error
@@ -136,7 +198,7 @@ var _ = Describe("Layer source: OCI", func() {
 
 	Describe("Blob", func() {
 		It("downloads a blob", func() {
-			blobPath, size, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+			blobPath, size, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(size).To(Equal(int64(668151)))
 
@@ -155,7 +217,7 @@ var _ = Describe("Layer source: OCI", func() {
 
 		Context("when the blob has an invalid checksum", func() {
 			It("returns an error", func() {
-				_, _, err := layerSource.Blob(logger, baseImageURL, "sha256:steamed-blob", nil)
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, "sha256:steamed-blob", nil, source.BlobProgress{})
 				Expect(err).To(MatchError(ContainSubstring("invalid checksum digest format")))
 			})
 		})
@@ -168,7 +230,7 @@ var _ = Describe("Layer source: OCI", func() {
 			})
 
 			It("returns an error", func() {
-				_, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 				Expect(err).To(MatchError(ContainSubstring("invalid checksum: layer is corrupted")))
 			})
 		})
@@ -182,7 +244,7 @@ var _ = Describe("Layer source: OCI", func() {
 			})
 
 			It("does not validate against checksums and does not return an error", func() {
-				_, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil)
+				_, _, _, err := layerSource.Blob(logger, baseImageURL, expectedBlobInfos[0].Digest.String(), nil, source.BlobProgress{})
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
@@ -0,0 +1,53 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"github.com/containers/image/docker/reference"
+	manifestpkg "github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+)
+
+// Image is an image that remembers the digest of the manifest its reference
+// resolved to. For multi-arch images that is the digest of the manifest list,
+// not the one of the platform manifest, and for schema 1 images it is the
+// digest of the manifest before it is converted.
+type Image interface {
+	types.Image
+	ManifestDigest() digestpkg.Digest
+}
+
+type resolvedImage struct {
+	types.Image
+	manifestDigest digestpkg.Digest
+}
+
+func (i *resolvedImage) ManifestDigest() digestpkg.Digest {
+	return i.manifestDigest
+}
+
+func pinnedDigest(ref types.ImageReference) (digestpkg.Digest, bool) {
+	canonical, ok := ref.DockerReference().(reference.Canonical)
+	if !ok {
+		return "", false
+	}
+
+	return canonical.Digest(), true
+}
+
+func checkManifestDigest(rawManifest []byte, expectedDigest digestpkg.Digest) error {
+	matches, err := manifestpkg.MatchesDigest(rawManifest, expectedDigest)
+	if err != nil {
+		return errorspkg.Wrap(err, "checking manifest digest")
+	}
+
+	if !matches {
+		actualDigest, err := manifestpkg.Digest(rawManifest)
+		if err != nil {
+			return errorspkg.Wrap(err, "calculating manifest digest")
+		}
+		return errorspkg.Errorf("manifest digest `%s` does not match the expected digest `%s`", actualDigest, expectedDigest)
+	}
+
+	return nil
+}
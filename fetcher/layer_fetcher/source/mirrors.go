@@ -0,0 +1,129 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"net/url"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/containers/image/types"
+	digestpkg "github.com/opencontainers/go-digest"
+)
+
+const defaultRegistryHost = "docker.io"
+
+type endpoint struct {
+	url           *url.URL
+	systemContext types.SystemContext
+	mirror        bool
+}
+
+func (e endpoint) host() string {
+	if e.url.Host == "" {
+		return defaultRegistryHost
+	}
+	return e.url.Host
+}
+
+func (s *LayerSource) originEndpoint(baseImageURL *url.URL) endpoint {
+	return endpoint{
+		url:           baseImageURL,
+		systemContext: s.systemContext,
+	}
+}
+
+// endpoints returns the configured mirrors for the image registry, in order,
+// followed by the registry itself.
+func (s *LayerSource) endpoints(baseImageURL *url.URL) []endpoint {
+	origin := s.originEndpoint(baseImageURL)
+	if baseImageURL.Scheme != "docker" {
+		return []endpoint{origin}
+	}
+
+	endpoints := []endpoint{}
+	for _, mirror := range s.registryMirrors[origin.host()] {
+		endpoints = append(endpoints, s.mirrorEndpoint(origin, mirror))
+	}
+
+	return append(endpoints, origin)
+}
+
+// mirrorEndpoint never sends the credentials of the registry to the mirror:
+// they are for another host.
+func (s *LayerSource) mirrorEndpoint(origin endpoint, mirror string) endpoint {
+	systemContext := s.systemContext
+	systemContext.DockerAuthConfig = nil
+	if strings.HasPrefix(mirror, "http://") {
+		systemContext.DockerInsecureSkipTLSVerify = true
+	}
+
+	mirrorHost := strings.TrimPrefix(strings.TrimPrefix(mirror, "http://"), "https://")
+	mirrorHost = strings.TrimSuffix(mirrorHost, "/")
+
+	mirrorURL := *origin.url
+	mirrorURL.Host = mirrorHost
+	if origin.host() == defaultRegistryHost && strings.Count(strings.Trim(mirrorURL.Path, "/"), "/") == 0 {
+		// official images live under `library/` when not using the docker hub
+		// shorthand
+		mirrorURL.Path = "/library" + mirrorURL.Path
+	}
+
+	return endpoint{
+		url:           &mirrorURL,
+		systemContext: systemContext,
+		mirror:        true,
+	}
+}
+
+// blobLocation is a place a blob can be downloaded from
+type blobLocation struct {
+	endpoint endpoint
+	blobInfo types.BlobInfo
+}
+
+// blobLocations returns the places to try in order. Foreign layers are only
+// downloaded from their URLs, which are tried one at a time so that the one
+// serving the blob is known. Other blobs come from the mirrors of the
+// registry, and then the registry itself.
+func (s *LayerSource) blobLocations(baseImageURL *url.URL, digest string, layersUrls []string) []blobLocation {
+	locations := []blobLocation{}
+
+	if len(layersUrls) > 0 {
+		origin := s.originEndpoint(baseImageURL)
+		for _, layerURL := range layersUrls {
+			locations = append(locations, blobLocation{
+				endpoint: origin,
+				blobInfo: types.BlobInfo{Digest: digestpkg.Digest(digest), URLs: []string{layerURL}},
+			})
+		}
+		return locations
+	}
+
+	for _, endpoint := range s.endpoints(baseImageURL) {
+		locations = append(locations, blobLocation{
+			endpoint: endpoint,
+			blobInfo: types.BlobInfo{Digest: digestpkg.Digest(digest)},
+		})
+	}
+	return locations
+}
+
+func (l blobLocation) servedFrom() string {
+	if len(l.blobInfo.URLs) > 0 {
+		return l.blobInfo.URLs[0]
+	}
+	return l.endpoint.host()
+}
+
+func (l blobLocation) logData() lager.Data {
+	return lager.Data{"endpoint": l.endpoint.host(), "mirror": l.endpoint.mirror, "servedFrom": l.servedFrom()}
+}
+
+func (l blobLocation) logFailure(logger lager.Logger, err error) {
+	if len(l.blobInfo.URLs) > 0 {
+		logger.Error("fetching-blob-from-url-failed", err, lager.Data{"URL": l.servedFrom()})
+		return
+	}
+	if l.endpoint.mirror {
+		logger.Error("fetching-blob-from-mirror-failed", err, lager.Data{"mirror": l.endpoint.host()})
+	}
+}
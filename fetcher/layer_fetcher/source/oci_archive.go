@@ -0,0 +1,268 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/image"
+	"github.com/containers/image/types"
+	digestpkg "github.com/opencontainers/go-digest"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	errorspkg "github.com/pkg/errors"
+)
+
+const (
+	OCIArchiveScheme     = "oci-archive"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+var (
+	_ types.ImageTransport = ociArchiveTransport{}
+	_ types.ImageReference = &ociArchiveReference{}
+	_ types.ImageSource    = &ociArchiveImageSource{}
+)
+
+// ociArchiveReference reads `oci-archive:///path.tar[:ref]` images straight
+// from the tarball, without extracting it first. Archives are read-only.
+type ociArchiveReference struct {
+	archivePath string
+	ref         string
+}
+
+func newOCIArchiveReference(refString string) *ociArchiveReference {
+	archivePath, ref := archiveReference(refString)
+	return &ociArchiveReference{
+		archivePath: archivePath,
+		ref:         ref,
+	}
+}
+
+func (r *ociArchiveReference) Transport() types.ImageTransport {
+	return ociArchiveTransport{}
+}
+
+func (r *ociArchiveReference) StringWithinTransport() string {
+	if r.ref == "" {
+		return r.archivePath
+	}
+	return r.archivePath + ":" + r.ref
+}
+
+func (r *ociArchiveReference) DockerReference() reference.Named {
+	return nil
+}
+
+func (r *ociArchiveReference) PolicyConfigurationIdentity() string {
+	return r.StringWithinTransport()
+}
+
+// PolicyConfigurationNamespaces returns the archive path without the
+// reference, followed by each of its parent directories.
+func (r *ociArchiveReference) PolicyConfigurationNamespaces() []string {
+	namespaces := []string{}
+	if r.ref != "" {
+		namespaces = append(namespaces, r.archivePath)
+	}
+
+	for dir := path.Dir(r.archivePath); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		namespaces = append(namespaces, dir)
+	}
+
+	return namespaces
+}
+
+func (r *ociArchiveReference) NewImage(ctx *types.SystemContext) (types.Image, error) {
+	imgSrc, err := r.NewImageSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := image.FromSource(imgSrc)
+	if err != nil {
+		imgSrc.Close()
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func (r *ociArchiveReference) NewImageSource(ctx *types.SystemContext) (types.ImageSource, error) {
+	archive, err := os.Open(r.archivePath)
+	if err != nil {
+		return nil, errorspkg.Wrap(err, "opening oci archive")
+	}
+
+	entries, err := indexArchive(archive)
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+
+	return &ociArchiveImageSource{ref: r, archive: archive, entries: entries}, nil
+}
+
+func (r *ociArchiveReference) NewImageDestination(ctx *types.SystemContext) (types.ImageDestination, error) {
+	return nil, errorspkg.New("writing to oci archives is not supported")
+}
+
+func (r *ociArchiveReference) DeleteImage(ctx *types.SystemContext) error {
+	return errorspkg.New("deleting images from oci archives is not supported")
+}
+
+type ociArchiveTransport struct{}
+
+func (t ociArchiveTransport) Name() string {
+	return OCIArchiveScheme
+}
+
+func (t ociArchiveTransport) ParseReference(refString string) (types.ImageReference, error) {
+	return newOCIArchiveReference(refString), nil
+}
+
+func (t ociArchiveTransport) ValidatePolicyConfigurationScope(scope string) error {
+	if !path.IsAbs(scope) {
+		return errorspkg.Errorf("invalid scope `%s`: must be an absolute path", scope)
+	}
+	return nil
+}
+
+// ociArchiveImageSource keeps the archive open, and reads its files from the
+// offsets found when it was indexed.
+type ociArchiveImageSource struct {
+	ref     *ociArchiveReference
+	archive *os.File
+	entries map[string]archiveEntry
+}
+
+func (s *ociArchiveImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+func (s *ociArchiveImageSource) Close() error {
+	return s.archive.Close()
+}
+
+func (s *ociArchiveImageSource) GetManifest() ([]byte, string, error) {
+	descriptor, err := s.manifestDescriptor()
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest, err := s.readBlob(descriptor.Digest)
+	if err != nil {
+		return nil, "", errorspkg.Wrap(err, "reading manifest")
+	}
+
+	return manifest, descriptor.MediaType, nil
+}
+
+// GetTargetManifest doesn't know the media type of the manifest; the caller
+// takes it from the index descriptor instead.
+func (s *ociArchiveImageSource) GetTargetManifest(digest digestpkg.Digest) ([]byte, string, error) {
+	manifest, err := s.readBlob(digest)
+	if err != nil {
+		return nil, "", errorspkg.Wrap(err, "reading manifest")
+	}
+
+	return manifest, "", nil
+}
+
+func (s *ociArchiveImageSource) GetBlob(info types.BlobInfo) (io.ReadCloser, int64, error) {
+	if err := info.Digest.Validate(); err != nil {
+		return nil, 0, errorspkg.Wrapf(err, "invalid blob digest `%s`", info.Digest)
+	}
+
+	return s.openEntry(path.Join("blobs", info.Digest.Algorithm().String(), info.Digest.Hex()))
+}
+
+func (s *ociArchiveImageSource) GetSignatures(ctx context.Context) ([][]byte, error) {
+	return [][]byte{}, nil
+}
+
+func (s *ociArchiveImageSource) manifestDescriptor() (specsv1.Descriptor, error) {
+	indexReader, _, err := s.openEntry("index.json")
+	if err != nil {
+		return specsv1.Descriptor{}, err
+	}
+	defer indexReader.Close()
+
+	var index specsv1.Index
+	if err := json.NewDecoder(indexReader).Decode(&index); err != nil {
+		return specsv1.Descriptor{}, errorspkg.Wrap(err, "parsing oci archive index.json")
+	}
+
+	if s.ref.ref == "" {
+		if len(index.Manifests) != 1 {
+			return specsv1.Descriptor{}, errorspkg.Errorf("oci archive `%s` contains %d images, a reference is required", s.ref.archivePath, len(index.Manifests))
+		}
+		return index.Manifests[0], nil
+	}
+
+	for _, descriptor := range index.Manifests {
+		if descriptor.Annotations[ociRefNameAnnotation] == s.ref.ref {
+			return descriptor, nil
+		}
+	}
+
+	return specsv1.Descriptor{}, errorspkg.Errorf("reference `%s` not found in oci archive `%s`", s.ref.ref, s.ref.archivePath)
+}
+
+func (s *ociArchiveImageSource) readBlob(digest digestpkg.Digest) ([]byte, error) {
+	blob, _, err := s.GetBlob(types.BlobInfo{Digest: digest})
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	return ioutil.ReadAll(blob)
+}
+
+// openEntry returns a reader for a regular file in the archive. Readers use
+// ReadAt, so that blobs can be read concurrently.
+func (s *ociArchiveImageSource) openEntry(name string) (io.ReadCloser, int64, error) {
+	entry, ok := s.entries[name]
+	if !ok {
+		return nil, 0, errorspkg.Errorf("`%s` not found in oci archive `%s`", name, s.ref.archivePath)
+	}
+
+	return ioutil.NopCloser(io.NewSectionReader(s.archive, entry.offset, entry.size)), entry.size, nil
+}
+
+type archiveEntry struct {
+	offset int64
+	size   int64
+}
+
+// indexArchive scans the archive once, and records where the contents of each
+// regular file start, since blobs are requested in any order.
+func indexArchive(archive *os.File) (map[string]archiveEntry, error) {
+	entries := map[string]archiveEntry{}
+
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errorspkg.Wrap(err, "reading oci archive")
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		offset, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, errorspkg.Wrap(err, "reading oci archive")
+		}
+
+		entries[path.Clean(header.Name)] = archiveEntry{offset: offset, size: header.Size}
+	}
+}
@@ -0,0 +1,302 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/containers/image/types"
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+)
+
+const partialBlobsDirName = "partial-blobs"
+
+// PartialBlobMaxAge is how long a partial blob that is not being downloaded
+// is kept for a later create to resume from.
+const PartialBlobMaxAge = 24 * time.Hour
+
+// PartialBlobPath is where an unfinished download of the blob is kept between
+// attempts (and between creates), under the store's tmp dir.
+func PartialBlobPath(digest digestpkg.Digest) string {
+	return filepath.Join(os.TempDir(), partialBlobsDirName, fmt.Sprintf("%s-%s", digest.Algorithm(), digest.Hex()))
+}
+
+// CollectPartialBlobs removes the partial blobs that nothing has written to
+// for longer than PartialBlobMaxAge, and that are not being downloaded.
+func CollectPartialBlobs(logger lager.Logger) error {
+	logger = logger.Session("collect-partial-blobs")
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	partialBlobsDir := filepath.Join(os.TempDir(), partialBlobsDirName)
+	partialBlobs, err := ioutil.ReadDir(partialBlobsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errorspkg.Wrap(err, "listing partial blobs")
+	}
+
+	var collectErr error
+	for _, partialBlob := range partialBlobs {
+		if time.Since(partialBlob.ModTime()) < PartialBlobMaxAge {
+			continue
+		}
+
+		partialBlobPath := filepath.Join(partialBlobsDir, partialBlob.Name())
+		if err := removeUnlockedPartialBlob(partialBlobPath); err != nil {
+			logger.Error("removing-partial-blob-failed", err, lager.Data{"path": partialBlobPath})
+			collectErr = errorspkg.New("removing partial blobs failed")
+			continue
+		}
+		logger.Debug("removed-partial-blob", lager.Data{"path": partialBlobPath})
+	}
+
+	return collectErr
+}
+
+func removeUnlockedPartialBlob(partialBlobPath string) error {
+	partialBlob, err := os.Open(partialBlobPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer partialBlob.Close()
+
+	if err := syscall.Flock(int(partialBlob.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return nil
+		}
+		return errorspkg.Wrap(err, "locking partial blob")
+	}
+
+	if !samePartialBlob(partialBlob, partialBlobPath) {
+		return nil
+	}
+
+	return os.Remove(partialBlobPath)
+}
+
+// canResume tells whether the blob is downloaded to a partial blob, so that an
+// interrupted download can be resumed. Foreign layers and local images go
+// through containers/image as usual.
+func (s *LayerSource) canResume(endpoint endpoint, blobInfo types.BlobInfo) bool {
+	return endpoint.url.Scheme == "docker" && len(blobInfo.URLs) == 0 && blobInfo.Digest.Validate() == nil
+}
+
+// resumableBlobFromEndpoint downloads the blob through containers/image, which
+// cannot request part of a blob. Only once part of it has been downloaded, by
+// an interrupted attempt or an earlier create, is the rest requested with
+// range requests.
+func (s *LayerSource) resumableBlobFromEndpoint(logger lager.Logger, endpoint endpoint, blobInfo types.BlobInfo, progress BlobProgress) (string, int64, error) {
+	partialBlob, err := openPartialBlob(blobInfo.Digest)
+	if err != nil {
+		return "", 0, err
+	}
+	defer partialBlob.Close()
+	logger.Debug("opened-partial-blob", lager.Data{"path": partialBlob.Name(), "endpoint": endpoint.host()})
+
+	var client *registryClient
+	err = s.retryPolicy.retry(logger, func(attempt int) error {
+		logger.Debug(fmt.Sprintf("attempt-get-blob-%d", attempt))
+		offset, err := partialBlob.Seek(0, io.SeekEnd)
+		if err != nil {
+			return errorspkg.Wrap(err, "seeking partial blob")
+		}
+
+		if offset == 0 {
+			err = s.downloadPartialBlob(logger, endpoint, blobInfo, partialBlob, progress)
+		} else {
+			if client == nil {
+				if client, err = newRegistryClient(endpoint); err != nil {
+					return err
+				}
+			}
+			err = s.downloadRemainingBlob(logger, client, partialBlob, blobInfo.Digest, progress)
+		}
+		if err != nil {
+			logger.Error("attempt-get-blob-failed", err)
+			return err
+		}
+
+		logger.Debug("attempt-get-blob-success")
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := partialBlob.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", 0, errorspkg.Wrap(err, "measuring downloaded blob")
+	}
+
+	progress.verifying()
+	if _, err := partialBlob.Seek(0, io.SeekStart); err != nil {
+		return "", 0, errorspkg.Wrap(err, "rewinding downloaded blob")
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, partialBlob); err != nil {
+		return "", 0, errorspkg.Wrap(err, "hashing downloaded blob")
+	}
+
+	if !s.checkCheckSum(logger, hash, blobInfo.Digest.String(), endpoint.url.Scheme) {
+		_ = os.Remove(partialBlob.Name())
+		return "", 0, errorspkg.Errorf("invalid checksum: layer is corrupted `%s`", blobInfo.Digest)
+	}
+
+	blobPath, err := completeBlob(partialBlob.Name(), blobInfo.Digest)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return blobPath, size, nil
+}
+
+// downloadPartialBlob downloads the whole blob through containers/image. If
+// the download is interrupted, whatever was written is kept for the next
+// attempt to resume from.
+func (s *LayerSource) downloadPartialBlob(logger lager.Logger, endpoint endpoint, blobInfo types.BlobInfo, partialBlob *os.File, progress BlobProgress) error {
+	imgSrc, err := s.imageSource(logger, endpoint)
+	if err != nil {
+		return err
+	}
+	defer imgSrc.Close()
+
+	blob, size, err := imgSrc.GetBlob(blobInfo)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	logger.Debug("got-blob-stream", lager.Data{"size": size})
+
+	progressWriter := progress.writer(0)
+	written, err := io.Copy(io.MultiWriter(partialBlob, progressWriter), blob)
+	progressWriter.flush()
+	if err != nil {
+		logger.Info("blob-download-interrupted", lager.Data{"downloaded": written, "size": size})
+		return errorspkg.Wrap(err, "writing blob to partial file")
+	}
+
+	return nil
+}
+
+// downloadRemainingBlob appends whatever is missing from the partial blob. If
+// the registry ignores the range the partial blob is started over.
+func (s *LayerSource) downloadRemainingBlob(logger lager.Logger, client *registryClient, partialBlob *os.File, digest digestpkg.Digest, progress BlobProgress) error {
+	offset, err := partialBlob.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errorspkg.Wrap(err, "seeking partial blob")
+	}
+
+	blob, size, resumed, err := client.getBlob(logger, digest, offset)
+	if err == errRangeNotSatisfiable {
+		logger.Info("discarding-partial-blob", lager.Data{"offset": offset})
+		if err := truncatePartialBlob(partialBlob); err != nil {
+			return err
+		}
+		blob, size, resumed, err = client.getBlob(logger, digest, 0)
+	}
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	if offset > 0 && !resumed {
+		logger.Info("range-not-supported-restarting-download", lager.Data{"offset": offset})
+		if err := truncatePartialBlob(partialBlob); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	logger.Debug("got-blob-stream", lager.Data{"offset": offset, "size": size, "resumed": resumed})
+
+	progressWriter := progress.writer(offset)
+	written, err := io.Copy(io.MultiWriter(partialBlob, progressWriter), blob)
+	progressWriter.flush()
+	if err != nil {
+		logger.Info("blob-download-interrupted", lager.Data{"downloaded": offset + written, "size": size})
+		return errorspkg.Wrap(err, "writing blob to partial file")
+	}
+
+	return nil
+}
+
+func openPartialBlob(digest digestpkg.Digest) (*os.File, error) {
+	partialBlobPath := PartialBlobPath(digest)
+	if err := os.MkdirAll(filepath.Dir(partialBlobPath), 0700); err != nil {
+		return nil, errorspkg.Wrap(err, "creating partial blobs directory")
+	}
+
+	for {
+		partialBlob, err := os.OpenFile(partialBlobPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, errorspkg.Wrap(err, "opening partial blob")
+		}
+
+		// concurrent downloads of the same blob take turns
+		if err := syscall.Flock(int(partialBlob.Fd()), syscall.LOCK_EX); err != nil {
+			partialBlob.Close()
+			return nil, errorspkg.Wrap(err, "locking partial blob")
+		}
+
+		// the previous holder of the lock may have completed the blob and
+		// moved it away, in which case we start a new one
+		if samePartialBlob(partialBlob, partialBlobPath) {
+			return partialBlob, nil
+		}
+		partialBlob.Close()
+	}
+}
+
+func samePartialBlob(partialBlob *os.File, partialBlobPath string) bool {
+	openedInfo, err := partialBlob.Stat()
+	if err != nil {
+		return false
+	}
+
+	pathInfo, err := os.Stat(partialBlobPath)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(openedInfo, pathInfo)
+}
+
+func truncatePartialBlob(partialBlob *os.File) error {
+	if err := partialBlob.Truncate(0); err != nil {
+		return errorspkg.Wrap(err, "truncating partial blob")
+	}
+
+	if _, err := partialBlob.Seek(0, io.SeekStart); err != nil {
+		return errorspkg.Wrap(err, "rewinding partial blob")
+	}
+
+	return nil
+}
+
+// completeBlob moves the verified blob out of the partial blobs directory so
+// it gets removed once it has been unpacked.
+func completeBlob(partialBlobPath string, digest digestpkg.Digest) (string, error) {
+	blobFile, err := ioutil.TempFile("", fmt.Sprintf("blob-%s", digest))
+	if err != nil {
+		return "", err
+	}
+	blobFile.Close()
+
+	if err := os.Rename(partialBlobPath, blobFile.Name()); err != nil {
+		_ = os.Remove(blobFile.Name())
+		return "", errorspkg.Wrap(err, "moving downloaded blob")
+	}
+
+	return blobFile.Name(), nil
+}
@@ -0,0 +1,73 @@
+package source_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	digestpkg "github.com/opencontainers/go-digest"
+)
+
+var _ = Describe("CollectPartialBlobs", func() {
+	var (
+		logger          *lagertest.TestLogger
+		partialBlobPath string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test-partial-blobs")
+
+		partialBlobPath = source.PartialBlobPath(digestpkg.FromString("partial-blob"))
+		Expect(os.MkdirAll(filepath.Dir(partialBlobPath), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(partialBlobPath, []byte("partial"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(partialBlobPath)).To(Succeed())
+	})
+
+	makeStale := func() {
+		staleTime := time.Now().Add(-source.PartialBlobMaxAge - time.Minute)
+		Expect(os.Chtimes(partialBlobPath, staleTime, staleTime)).To(Succeed())
+	}
+
+	It("keeps the partial blobs that were written recently", func() {
+		Expect(source.CollectPartialBlobs(logger)).To(Succeed())
+		Expect(partialBlobPath).To(BeAnExistingFile())
+	})
+
+	It("removes the stale partial blobs", func() {
+		makeStale()
+
+		Expect(source.CollectPartialBlobs(logger)).To(Succeed())
+		Expect(partialBlobPath).NotTo(BeAnExistingFile())
+	})
+
+	Context("when a stale partial blob is being downloaded", func() {
+		var partialBlob *os.File
+
+		BeforeEach(func() {
+			makeStale()
+
+			var err error
+			partialBlob, err = os.Open(partialBlobPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syscall.Flock(int(partialBlob.Fd()), syscall.LOCK_EX)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(partialBlob.Close()).To(Succeed())
+		})
+
+		It("keeps it", func() {
+			Expect(source.CollectPartialBlobs(logger)).To(Succeed())
+			Expect(partialBlobPath).To(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,135 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	manifestpkg "github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	errorspkg "github.com/pkg/errors"
+)
+
+func DefaultPlatform() specsv1.Platform {
+	return specsv1.Platform{
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+	}
+}
+
+func ParsePlatform(platform string) (specsv1.Platform, error) {
+	if platform == "" {
+		return DefaultPlatform(), nil
+	}
+
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return specsv1.Platform{}, errorspkg.Errorf("invalid platform `%s`: expected os/arch[/variant]", platform)
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return specsv1.Platform{}, errorspkg.Errorf("invalid platform `%s`: expected os/arch[/variant]", platform)
+		}
+	}
+
+	parsedPlatform := specsv1.Platform{
+		OS:           parts[0],
+		Architecture: NormalizeArchitecture(parts[1]),
+	}
+	if len(parts) == 3 {
+		parsedPlatform.Variant = parts[2]
+	}
+
+	return parsedPlatform, nil
+}
+
+func NormalizeArchitecture(architecture string) string {
+	switch architecture {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	default:
+		return architecture
+	}
+}
+
+func PlatformMatches(wanted, candidate specsv1.Platform) bool {
+	if candidate.OS != wanted.OS {
+		return false
+	}
+
+	if NormalizeArchitecture(candidate.Architecture) != NormalizeArchitecture(wanted.Architecture) {
+		return false
+	}
+
+	return wanted.Variant == "" || candidate.Variant == wanted.Variant
+}
+
+type platformImageSource struct {
+	types.ImageSource
+	manifest []byte
+	mimeType string
+}
+
+func (s *platformImageSource) GetManifest() ([]byte, string, error) {
+	return s.manifest, s.mimeType, nil
+}
+
+func (s *LayerSource) selectPlatform(logger lager.Logger, imgSrc types.ImageSource, rawManifest []byte, mimeType string) (types.ImageSource, error) {
+	if mimeType == "" {
+		mimeType = manifestpkg.GuessMIMEType(rawManifest)
+	}
+
+	if mimeType != manifestpkg.DockerV2ListMediaType && mimeType != specsv1.MediaTypeImageIndex {
+		return imgSrc, nil
+	}
+
+	logger = logger.Session("selecting-platform", lager.Data{"platform": s.platform, "mimeType": mimeType})
+	logger.Debug("starting")
+	defer logger.Debug("ending")
+
+	var index specsv1.Index
+	if err := json.Unmarshal(rawManifest, &index); err != nil {
+		return nil, errorspkg.Wrap(err, "parsing manifest list")
+	}
+
+	for _, descriptor := range index.Manifests {
+		if descriptor.Platform == nil || !PlatformMatches(s.platform, *descriptor.Platform) {
+			continue
+		}
+
+		logger.Debug("platform-matched", lager.Data{"digest": descriptor.Digest, "descriptorPlatform": descriptor.Platform})
+		targetManifest, targetMimeType, err := imgSrc.GetTargetManifest(descriptor.Digest)
+		if err != nil {
+			return nil, errorspkg.Wrapf(err, "fetching manifest `%s`", descriptor.Digest)
+		}
+
+		if err := checkManifestDigest(targetManifest, descriptor.Digest); err != nil {
+			return nil, err
+		}
+
+		if targetMimeType == "" {
+			targetMimeType = descriptor.MediaType
+		}
+
+		return &platformImageSource{
+			ImageSource: imgSrc,
+			manifest:    targetManifest,
+			mimeType:    targetMimeType,
+		}, nil
+	}
+
+	return nil, errorspkg.Errorf("no image found for platform `%s`", FormatPlatform(s.platform))
+}
+
+func FormatPlatform(platform specsv1.Platform) string {
+	formatted := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		formatted += "/" + platform.Variant
+	}
+	return formatted
+}
@@ -0,0 +1,64 @@
+package source_test
+
+import (
+	"runtime"
+
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ = Describe("Platform", func() {
+	Describe("ParsePlatform", func() {
+		It("parses os and architecture", func() {
+			platform, err := source.ParsePlatform("linux/arm64")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(platform).To(Equal(specsv1.Platform{OS: "linux", Architecture: "arm64"}))
+		})
+
+		It("parses the variant", func() {
+			platform, err := source.ParsePlatform("linux/arm/v7")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(platform).To(Equal(specsv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}))
+		})
+
+		It("normalizes architecture aliases", func() {
+			platform, err := source.ParsePlatform("linux/x86_64")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(platform.Architecture).To(Equal("amd64"))
+		})
+
+		Context("when the platform is empty", func() {
+			It("returns the host platform", func() {
+				platform, err := source.ParsePlatform("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(platform).To(Equal(specsv1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}))
+			})
+		})
+
+		Context("when the platform is invalid", func() {
+			It("returns an error", func() {
+				for _, invalid := range []string{"linux", "linux/", "linux/arm/v7/extra", "/amd64"} {
+					_, err := source.ParsePlatform(invalid)
+					Expect(err).To(MatchError(ContainSubstring("expected os/arch[/variant]")), invalid)
+				}
+			})
+		})
+	})
+
+	Describe("PlatformMatches", func() {
+		It("matches on os and architecture", func() {
+			wanted := specsv1.Platform{OS: "linux", Architecture: "arm64"}
+			Expect(source.PlatformMatches(wanted, specsv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})).To(BeTrue())
+			Expect(source.PlatformMatches(wanted, specsv1.Platform{OS: "linux", Architecture: "amd64"})).To(BeFalse())
+			Expect(source.PlatformMatches(wanted, specsv1.Platform{OS: "windows", Architecture: "arm64"})).To(BeFalse())
+		})
+
+		It("matches the variant when one is wanted", func() {
+			wanted := specsv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+			Expect(source.PlatformMatches(wanted, specsv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})).To(BeTrue())
+			Expect(source.PlatformMatches(wanted, specsv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"})).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,258 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	digestpkg "github.com/opencontainers/go-digest"
+	errorspkg "github.com/pkg/errors"
+)
+
+const dockerHubRegistryHost = "registry-1.docker.io"
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+var errRangeNotSatisfiable = errorspkg.New("requested range not satisfiable")
+
+// registryClient talks to the registry blob endpoint directly, as
+// containers/image has no way of requesting part of a blob.
+type registryClient struct {
+	httpClient    *http.Client
+	scheme        string
+	host          string
+	repository    string
+	username      string
+	password      string
+	insecure      bool
+	authorized    bool
+	authorization string
+}
+
+func newRegistryClient(endpoint endpoint) (*registryClient, error) {
+	host := endpoint.host()
+	if host == defaultRegistryHost {
+		host = dockerHubRegistryHost
+	}
+
+	tlsConfig, err := registryTLSConfig(endpoint.systemContext, host)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &registryClient{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		scheme:     "https",
+		host:       host,
+		repository: repositoryName(endpoint),
+		insecure:   endpoint.systemContext.DockerInsecureSkipTLSVerify,
+	}
+
+	if authConfig := endpoint.systemContext.DockerAuthConfig; authConfig != nil {
+		client.username = authConfig.Username
+		client.password = authConfig.Password
+	}
+
+	return client, nil
+}
+
+func repositoryName(endpoint endpoint) string {
+	repository := strings.TrimPrefix(endpoint.url.Path, "/")
+	if i := strings.Index(repository, "@"); i != -1 {
+		repository = repository[:i]
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+
+	if endpoint.host() == defaultRegistryHost && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+
+	return repository
+}
+
+// authorize pings the registry and, when it challenges us, gets hold of the
+// token (or basic credentials) needed to pull from the repository.
+func (c *registryClient) authorize(logger lager.Logger) error {
+	response, err := c.httpClient.Get(c.url("/v2/"))
+	if err != nil && c.insecure && c.scheme == "https" {
+		logger.Debug("falling-back-to-http", lager.Data{"host": c.host, "error": err.Error()})
+		c.scheme = "http"
+		response, err = c.httpClient.Get(c.url("/v2/"))
+	}
+	if err != nil {
+		return errorspkg.Wrap(err, "pinging registry")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusUnauthorized {
+		c.authorized = true
+		return nil
+	}
+
+	challenge := response.Header.Get("Www-Authenticate")
+	switch {
+	case strings.HasPrefix(strings.ToLower(challenge), "bearer"):
+		token, err := c.fetchToken(challengeParams(challenge))
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+	case strings.HasPrefix(strings.ToLower(challenge), "basic"):
+		credentials := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
+		c.authorization = "Basic " + credentials
+	}
+
+	c.authorized = true
+	return nil
+}
+
+func (c *registryClient) fetchToken(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", errorspkg.Wrap(err, "parsing auth realm")
+	}
+
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", c.repository))
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		request.SetBasicAuth(c.username, c.password)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return "", errorspkg.Wrap(err, "requesting auth token")
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return "", errorspkg.New("unable to retrieve auth token: 401 unauthorized")
+	default:
+		return "", newRegistryStatusError("retrieving auth token", response)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return "", errorspkg.Wrap(err, "decoding auth token")
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+// getBlob requests the blob starting at offset. The returned bool tells
+// whether the registry honoured the range, in which case the body starts at
+// offset; otherwise it contains the whole blob. Tokens expire during long
+// downloads, so when the registry no longer accepts ours a new one is fetched
+// and the request is made again.
+func (c *registryClient) getBlob(logger lager.Logger, digest digestpkg.Digest, offset int64) (io.ReadCloser, int64, bool, error) {
+	if !c.authorized {
+		if err := c.authorize(logger); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	response, err := c.requestBlob(digest, offset)
+	if err == nil && response.StatusCode == http.StatusUnauthorized {
+		response.Body.Close()
+		logger.Info("refreshing-registry-authorization")
+		if err := c.authorize(logger); err != nil {
+			return nil, 0, false, err
+		}
+		response, err = c.requestBlob(digest, offset)
+	}
+	if err != nil {
+		return nil, 0, false, errorspkg.Wrap(err, "fetching blob")
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response.Body, response.ContentLength, false, nil
+	case http.StatusPartialContent:
+		size, err := contentRangeSize(response.Header.Get("Content-Range"))
+		if err != nil {
+			response.Body.Close()
+			return nil, 0, false, err
+		}
+		return response.Body, size, true, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		response.Body.Close()
+		return nil, 0, false, errRangeNotSatisfiable
+	default:
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		return nil, 0, false, newRegistryStatusError("fetching blob", response)
+	}
+}
+
+func (c *registryClient) requestBlob(digest digestpkg.Digest, offset int64) (*http.Response, error) {
+	request, err := http.NewRequest("GET", c.url(fmt.Sprintf("/v2/%s/blobs/%s", c.repository, digest)), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.authorization != "" {
+		request.Header.Set("Authorization", c.authorization)
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	return c.httpClient.Do(request)
+}
+
+func (c *registryClient) url(path string) string {
+	return fmt.Sprintf("%s://%s%s", c.scheme, c.host, path)
+}
+
+func challengeParams(challenge string) map[string]string {
+	params := map[string]string{}
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	return params
+}
+
+// contentRangeSize returns the total blob size from a `bytes a-b/size`
+// Content-Range header.
+func contentRangeSize(contentRange string) (int64, error) {
+	i := strings.LastIndex(contentRange, "/")
+	if i == -1 {
+		return 0, errorspkg.Errorf("invalid Content-Range `%s`", contentRange)
+	}
+
+	size := contentRange[i+1:]
+	if size == "*" {
+		return -1, nil
+	}
+
+	return strconv.ParseInt(size, 10, 64)
+}
@@ -0,0 +1,94 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/types"
+	errorspkg "github.com/pkg/errors"
+)
+
+const systemPerHostCertDirPath = "/etc/docker/certs.d"
+
+// registryTLSConfig builds the TLS configuration for the registry client the
+// same way containers/image does for its own requests, so that both trust the
+// same certificate authorities and present the same client certificates.
+func registryTLSConfig(systemContext types.SystemContext, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: systemContext.DockerInsecureSkipTLSVerify,
+	}
+
+	if err := setupCertificates(registryCertDir(systemContext, host), tlsConfig); err != nil {
+		return nil, err
+	}
+
+	return tlsConfig, nil
+}
+
+func registryCertDir(systemContext types.SystemContext, host string) string {
+	if systemContext.DockerCertPath != "" {
+		return systemContext.DockerCertPath
+	}
+
+	if systemContext.OCICertPath != "" {
+		return systemContext.OCICertPath
+	}
+
+	return filepath.Join(systemPerHostCertDirPath, host)
+}
+
+// setupCertificates loads `*.crt` files as certificate authorities and
+// `*.cert`/`*.key` pairs as client certificates. A missing directory is not
+// an error.
+func setupCertificates(dir string, tlsConfig *tls.Config) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errorspkg.Wrapf(err, "reading registry certificates directory `%s`", dir)
+	}
+
+	for _, file := range files {
+		fullPath := filepath.Join(dir, file.Name())
+
+		switch {
+		case strings.HasSuffix(file.Name(), ".crt"):
+			if tlsConfig.RootCAs == nil {
+				systemPool, err := x509.SystemCertPool()
+				if err != nil {
+					return errorspkg.Wrap(err, "loading system certificate pool")
+				}
+				tlsConfig.RootCAs = systemPool
+			}
+
+			data, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				return errorspkg.Wrapf(err, "reading certificate authority `%s`", fullPath)
+			}
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				return errorspkg.Errorf("no certificates found in `%s`", fullPath)
+			}
+
+		case strings.HasSuffix(file.Name(), ".cert"):
+			keyPath := strings.TrimSuffix(fullPath, ".cert") + ".key"
+			cert, err := tls.LoadX509KeyPair(fullPath, keyPath)
+			if err != nil {
+				return errorspkg.Wrapf(err, "loading client certificate `%s`", fullPath)
+			}
+			tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+
+		case strings.HasSuffix(file.Name(), ".key"):
+			certPath := strings.TrimSuffix(fullPath, ".key") + ".cert"
+			if _, err := os.Stat(certPath); err != nil {
+				return errorspkg.Errorf("missing client certificate `%s` for key `%s`", certPath, fullPath)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package source // import "code.cloudfoundry.org/grootfs/fetcher/layer_fetcher/source"
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+	errorspkg "github.com/pkg/errors"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 250 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultJitter         = 0.2
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of each backoff that is randomised, between 0
+	// and 1.
+	Jitter float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Jitter:         DefaultJitter,
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error that is not worth
+// retrying, or the policy runs out of attempts.
+func (p RetryPolicy) retry(logger lager.Logger, fn func(attempt int) error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = fn(attempt); err == nil {
+			return nil
+		}
+
+		retryable, retryAfter := classifyError(err)
+		if !retryable {
+			logger.Debug("not-retrying", lager.Data{"attempt": attempt, "error": err.Error()})
+			return err
+		}
+
+		if attempt == maxAttempts {
+			break
+		}
+
+		if retryAfter > p.MaxBackoff {
+			logger.Info("retry-after-exceeds-max-backoff", lager.Data{"attempt": attempt, "retryAfter": retryAfter.String(), "maxBackoff": p.MaxBackoff.String()})
+			return errorspkg.Wrapf(err, "registry asked to retry after %s, longer than the maximum backoff", retryAfter)
+		}
+
+		backoff := p.backoff(attempt, retryAfter)
+		logger.Debug("backing-off", lager.Data{"attempt": attempt, "backoff": backoff.String()})
+		time.Sleep(backoff)
+	}
+
+	return err
+}
+
+// backoff doubles the initial backoff on every attempt, up to the maximum
+// backoff. A Retry-After sent by the registry is honoured in full: retry gives
+// up before asking for one longer than the maximum backoff.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if p.Jitter > 0 {
+		backoff += time.Duration(float64(backoff) * p.Jitter * (2*rand.Float64() - 1))
+	}
+
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if retryAfter > backoff {
+		backoff = retryAfter
+	}
+
+	return backoff
+}
+
+// registryStatusError is returned for unexpected responses to requests made
+// by grootfs itself, so that the Retry-After header can be honoured.
+type registryStatusError struct {
+	action     string
+	statusCode int
+	retryAfter time.Duration
+}
+
+func newRegistryStatusError(action string, response *http.Response) *registryStatusError {
+	return &registryStatusError{
+		action:     action,
+		statusCode: response.StatusCode,
+		retryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+	}
+}
+
+func (e *registryStatusError) Error() string {
+	return fmt.Sprintf("%s %d (%s)", e.action, e.statusCode, http.StatusText(e.statusCode))
+}
+
+func parseRetryAfter(retryAfter string) time.Duration {
+	if retryAfter == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// classifyError tells whether the error is worth retrying. Errors known to be
+// permanent are not: client errors other than throttling and timeouts, and
+// system errors such as a full disk or a denied permission. Everything else,
+// including errors of unknown types, is retried.
+func classifyError(err error) (bool, time.Duration) {
+	cause := errorspkg.Cause(err)
+
+	if errno, ok := unwrapErrno(cause); ok {
+		return retryableErrno(errno), 0
+	}
+
+	switch e := cause.(type) {
+	case *registryStatusError:
+		return retryableStatusCode(e.statusCode), e.retryAfter
+	case errcode.Errors:
+		if len(e) == 0 {
+			return true, 0
+		}
+		for _, codeErr := range e {
+			if retryable, _ := classifyError(codeErr); !retryable {
+				return false, 0
+			}
+		}
+		return true, 0
+	case *url.Error:
+		return classifyError(e.Err)
+	case *net.OpError:
+		return true, 0
+	case net.Error:
+		return e.Timeout() || e.Temporary(), 0
+	}
+
+	if statusCode, ok := responseStatusCode(cause); ok {
+		return retryableStatusCode(statusCode), 0
+	}
+
+	return true, 0
+}
+
+// responseStatusCode returns the status code of the unexpected responses
+// reported by docker/distribution, as used by containers/image.
+func responseStatusCode(err error) (int, bool) {
+	switch e := err.(type) {
+	case *registryStatusError:
+		return e.statusCode, true
+	case errcode.Error:
+		return e.Code.Descriptor().HTTPStatusCode, true
+	case errcode.ErrorCode:
+		return e.Descriptor().HTTPStatusCode, true
+	case *client.UnexpectedHTTPResponseError:
+		return e.StatusCode, true
+	case *client.UnexpectedHTTPStatusError:
+		fields := strings.Fields(e.Status)
+		if len(fields) == 0 {
+			return 0, false
+		}
+		statusCode, err := strconv.Atoi(fields[0])
+		return statusCode, err == nil
+	}
+
+	return 0, false
+}
+
+func unwrapErrno(err error) (syscall.Errno, bool) {
+	for {
+		switch e := err.(type) {
+		case syscall.Errno:
+			return e, true
+		case *os.PathError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		default:
+			return 0, false
+		}
+	}
+}
+
+func retryableErrno(errno syscall.Errno) bool {
+	switch errno {
+	case syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED,
+		syscall.ETIMEDOUT, syscall.EPIPE, syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return true
+	default:
+		return false
+	}
+}
+
+func retryableStatusCode(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsUnreachable tells whether the error means that the registry could not be
+// reached or is failing, rather than that it rejected the request.
+func IsUnreachable(err error) bool {
+	cause := errorspkg.Cause(err)
+
+	if errno, ok := unwrapErrno(cause); ok {
+		return errno == syscall.ECONNRESET || errno == syscall.ECONNREFUSED ||
+			errno == syscall.ETIMEDOUT || errno == syscall.EHOSTUNREACH || errno == syscall.ENETUNREACH
+	}
+
+	switch e := cause.(type) {
+	case errcode.Errors:
+		for _, codeErr := range e {
+			if IsUnreachable(codeErr) {
+				return true
+			}
+		}
+		return false
+	case *url.Error:
+		return IsUnreachable(e.Err)
+	case net.Error:
+		return true
+	}
+
+	if statusCode, ok := responseStatusCode(cause); ok {
+		return statusCode >= http.StatusInternalServerError
+	}
+
+	return false
+}
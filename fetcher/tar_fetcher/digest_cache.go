@@ -0,0 +1,143 @@
+package tar_fetcher // import "code.cloudfoundry.org/grootfs/fetcher/tar_fetcher"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
+	"code.cloudfoundry.org/lager"
+	errorspkg "github.com/pkg/errors"
+)
+
+// DigestCache remembers the sha256 of the uncompressed contents of local tar
+// base images, so that unchanged tarballs are not hashed on every create.
+type DigestCache struct {
+	path string
+}
+
+type digestCacheEntry struct {
+	Path    string `json:"path"`
+	Inode   uint64 `json:"inode"`
+	ModTime int64  `json:"mod_time"`
+	Size    int64  `json:"size"`
+	Digest  string `json:"digest"`
+}
+
+func NewDigestCache(path string) *DigestCache {
+	return &DigestCache{
+		path: path,
+	}
+}
+
+func (c *DigestCache) Digest(logger lager.Logger, tarPath string) (string, error) {
+	logger = logger.Session("tar-digest", lager.Data{"tarPath": tarPath})
+	logger.Debug("starting")
+	defer logger.Debug("ending")
+
+	stat, err := os.Stat(tarPath)
+	if err != nil {
+		return "", errorspkg.Wrap(err, "fetching image timestamp")
+	}
+
+	entry := digestCacheEntry{
+		Path:    tarPath,
+		ModTime: stat.ModTime().UnixNano(),
+		Size:    stat.Size(),
+	}
+	if sysStat, ok := stat.Sys().(*syscall.Stat_t); ok {
+		entry.Inode = sysStat.Ino
+	}
+
+	if digest, ok := c.lookup(entry); ok {
+		logger.Debug("cache-hit", lager.Data{"digest": digest})
+		return digest, nil
+	}
+
+	entry.Digest, err = tarDigest(tarPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.store(entry); err != nil {
+		logger.Error("storing-digest-failed", err)
+	}
+
+	return entry.Digest, nil
+}
+
+func (c *DigestCache) lookup(wanted digestCacheEntry) (string, bool) {
+	contents, err := ioutil.ReadFile(c.entryPath(wanted.Path))
+	if err != nil {
+		return "", false
+	}
+
+	var entry digestCacheEntry
+	if err := json.Unmarshal(contents, &entry); err != nil {
+		return "", false
+	}
+
+	if entry.Path != wanted.Path || entry.Inode != wanted.Inode ||
+		entry.ModTime != wanted.ModTime || entry.Size != wanted.Size || entry.Digest == "" {
+		return "", false
+	}
+
+	return entry.Digest, true
+}
+
+func (c *DigestCache) store(entry digestCacheEntry) error {
+	if err := os.MkdirAll(c.path, 0755); err != nil {
+		return errorspkg.Wrap(err, "creating digest cache directory")
+	}
+
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(c.path, "entry")
+	if err != nil {
+		return errorspkg.Wrap(err, "creating digest cache entry")
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(contents); err != nil {
+		return errorspkg.Wrap(err, "writing digest cache entry")
+	}
+
+	return os.Rename(tempFile.Name(), c.entryPath(entry.Path))
+}
+
+func (c *DigestCache) entryPath(tarPath string) string {
+	pathSha := sha256.Sum256([]byte(tarPath))
+	return filepath.Join(c.path, hex.EncodeToString(pathSha[:]))
+}
+
+// tarDigest hashes the uncompressed tar, so that compressed and uncompressed
+// copies of the same image share the same volume.
+func tarDigest(tarPath string) (string, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return "", errorspkg.Wrap(err, "reading local image")
+	}
+
+	reader, err := layer_fetcher.NewStreamBlobReader(file, "")
+	if err != nil {
+		file.Close()
+		return "", errorspkg.Wrap(err, "decompressing local image")
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", errorspkg.Wrap(err, "hashing local image")
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
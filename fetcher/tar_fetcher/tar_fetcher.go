@@ -4,12 +4,16 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"regexp"
+	"strings"
 
 	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/fetcher/layer_fetcher"
 	"code.cloudfoundry.org/lager"
 	errorspkg "github.com/pkg/errors"
 )
@@ -21,12 +25,22 @@ func IsLocalTarVolume(id string) bool {
 }
 
 type TarFetcher struct {
+	digestCache *DigestCache
 }
 
 func NewTarFetcher() *TarFetcher {
 	return &TarFetcher{}
 }
 
+// NewContentAddressedTarFetcher returns a fetcher that uses the sha256 of the
+// uncompressed tar contents as chain ID, so identical tarballs share a volume
+// regardless of their path or modification time.
+func NewContentAddressedTarFetcher(digestCache *DigestCache) *TarFetcher {
+	return &TarFetcher{
+		digestCache: digestCache,
+	}
+}
+
 func (l *TarFetcher) StreamBlob(logger lager.Logger, baseImageURL *url.URL,
 	layerInfo base_image_puller.LayerInfo) (io.ReadCloser, int64, error) {
 	logger = logger.Session("stream-blob", lager.Data{
@@ -41,17 +55,25 @@ func (l *TarFetcher) StreamBlob(logger lager.Logger, baseImageURL *url.URL,
 		return nil, 0, errorspkg.Wrapf(err, "local image not found in `%s`", baseImagePath)
 	}
 
-	if err := l.validateBaseImage(baseImagePath); err != nil {
-		return nil, 0, errorspkg.Wrap(err, "invalid base image")
-	}
-
 	logger.Debug("opening-tar", lager.Data{"baseImagePath": baseImagePath})
 	stream, err := os.Open(baseImagePath)
 	if err != nil {
 		return nil, 0, errorspkg.Wrap(err, "reading local image")
 	}
 
-	return stream, 0, nil
+	// The compression of the tarball, if any, is detected from its first bytes
+	blobReader, err := layer_fetcher.NewStreamBlobReader(stream, "")
+	if err != nil {
+		stream.Close()
+		return nil, 0, errorspkg.Wrap(err, "decompressing local image")
+	}
+
+	if l.digestCache != nil {
+		digest := strings.SplitN(layerInfo.ChainID, "-", 2)[0]
+		return newVerifiedTarStream(blobReader, digest), 0, nil
+	}
+
+	return blobReader, 0, nil
 }
 
 func (l *TarFetcher) BaseImageInfo(logger lager.Logger, baseImageURL *url.URL) (base_image_puller.BaseImageInfo, error) {
@@ -59,10 +81,9 @@ func (l *TarFetcher) BaseImageInfo(logger lager.Logger, baseImageURL *url.URL) (
 	logger.Info("starting")
 	defer logger.Info("ending")
 
-	stat, err := os.Stat(baseImageURL.String())
+	chainID, err := l.chainID(logger, baseImageURL.String())
 	if err != nil {
-		return base_image_puller.BaseImageInfo{},
-			errorspkg.Wrap(err, "fetching image timestamp")
+		return base_image_puller.BaseImageInfo{}, err
 	}
 
 	return base_image_puller.BaseImageInfo{
@@ -70,25 +91,67 @@ func (l *TarFetcher) BaseImageInfo(logger lager.Logger, baseImageURL *url.URL) (
 			base_image_puller.LayerInfo{
 				BlobID:        baseImageURL.String(),
 				ParentChainID: "",
-				ChainID:       l.generateChainID(baseImageURL.String(), stat.ModTime().UnixNano()),
+				ChainID:       chainID,
 			},
 		},
 	}, nil
 }
 
+func (l *TarFetcher) chainID(logger lager.Logger, baseImagePath string) (string, error) {
+	if l.digestCache != nil {
+		digest, err := l.digestCache.Digest(logger, baseImagePath)
+		if err != nil {
+			return "", err
+		}
+
+		// The suffix is fixed so that the chain ID only depends on the contents,
+		// while IsLocalTarVolume still matches it
+		return fmt.Sprintf("%s-%019d", digest, 0), nil
+	}
+
+	stat, err := os.Stat(baseImagePath)
+	if err != nil {
+		return "", errorspkg.Wrap(err, "fetching image timestamp")
+	}
+
+	return l.generateChainID(baseImagePath, stat.ModTime().UnixNano()), nil
+}
+
 func (l *TarFetcher) generateChainID(baseImagePath string, timestamp int64) string {
 	baseImagePathSha := sha256.Sum256([]byte(baseImagePath))
 	return fmt.Sprintf("%s-%d", hex.EncodeToString(baseImagePathSha[:32]), timestamp)
 }
 
-func (l *TarFetcher) validateBaseImage(baseImagePath string) error {
-	stat, err := os.Stat(baseImagePath)
-	if err != nil {
-		return err
+// verifiedTarStream checks that the tarball did not change between computing
+// its digest and unpacking it, as the digest is used as the volume name.
+type verifiedTarStream struct {
+	io.ReadCloser
+	reader io.Reader
+	hash   hash.Hash
+	digest string
+}
+
+func newVerifiedTarStream(stream io.ReadCloser, digest string) *verifiedTarStream {
+	tarHash := sha256.New()
+	return &verifiedTarStream{
+		ReadCloser: stream,
+		reader:     io.TeeReader(stream, tarHash),
+		hash:       tarHash,
+		digest:     digest,
+	}
+}
+
+func (s *verifiedTarStream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+func (s *verifiedTarStream) Verify() error {
+	if _, err := io.Copy(ioutil.Discard, s.reader); err != nil {
+		return errorspkg.Wrap(err, "reading remaining local image contents")
 	}
 
-	if stat.IsDir() {
-		return errorspkg.New("directory provided instead of a tar file")
+	if hex.EncodeToString(s.hash.Sum(nil)) != s.digest {
+		return errorspkg.New("local image changed while it was being unpacked")
 	}
 
 	return nil
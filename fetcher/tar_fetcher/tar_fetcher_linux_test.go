@@ -2,6 +2,9 @@ package tar_fetcher_test
 
 import (
 	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"net/url"
@@ -13,6 +16,7 @@ import (
 	"code.cloudfoundry.org/grootfs/base_image_puller"
 	fetcherpkg "code.cloudfoundry.org/grootfs/fetcher/tar_fetcher"
 	"code.cloudfoundry.org/grootfs/integration"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/opencontainers/image-spec/specs-go/v1"
@@ -76,14 +80,41 @@ var _ = Describe("Tar Fetcher", func() {
 			))
 		})
 
-		Context("when the source is a directory", func() {
-			It("returns an error message", func() {
-				tempDir, err := ioutil.TempDir("", "")
-				Expect(err).NotTo(HaveOccurred())
+		Context("when the tar is gzip compressed", func() {
+			JustBeforeEach(func() {
+				compressFile(baseImagePath, func(writer io.Writer) io.WriteCloser {
+					return gzip.NewWriter(writer)
+				})
+			})
+
+			It("returns the decompressed tar stream", func() {
+				stream, _, err := fetcher.StreamBlob(logger, baseImageURL, base_image_puller.LayerInfo{})
+				Expect(err).ToNot(HaveOccurred())
+
+				entries := streamTar(tar.NewReader(stream))
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[1].header.Name).To(Equal("./a_file"))
+				Expect(string(entries[1].contents)).To(Equal("hello-world"))
+			})
+		})
+
+		Context("when the tar is zstd compressed", func() {
+			JustBeforeEach(func() {
+				compressFile(baseImagePath, func(writer io.Writer) io.WriteCloser {
+					zstdWriter, err := zstd.NewWriter(writer)
+					Expect(err).NotTo(HaveOccurred())
+					return zstdWriter
+				})
+			})
 
-				imageURL, _ := url.Parse(tempDir)
-				_, _, err = fetcher.StreamBlob(logger, imageURL, base_image_puller.LayerInfo{})
-				Expect(err).To(MatchError(ContainSubstring("invalid base image: directory provided instead of a tar file")))
+			It("returns the decompressed tar stream", func() {
+				stream, _, err := fetcher.StreamBlob(logger, baseImageURL, base_image_puller.LayerInfo{})
+				Expect(err).ToNot(HaveOccurred())
+
+				entries := streamTar(tar.NewReader(stream))
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[1].header.Name).To(Equal("./a_file"))
+				Expect(string(entries[1].contents)).To(Equal("hello-world"))
 			})
 		})
 
@@ -156,8 +187,134 @@ var _ = Describe("Tar Fetcher", func() {
 			})
 		})
 	})
+
+	Describe("content addressed tar images", func() {
+		var (
+			digestCachePath string
+			baseImageInfo   base_image_puller.BaseImageInfo
+		)
+
+		BeforeEach(func() {
+			var err error
+			digestCachePath, err = ioutil.TempDir("", "tar-digests")
+			Expect(err).NotTo(HaveOccurred())
+			fetcher = fetcherpkg.NewContentAddressedTarFetcher(fetcherpkg.NewDigestCache(digestCachePath))
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(digestCachePath)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			baseImageInfo, err = fetcher.BaseImageInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("uses the sha256 of the tar contents as chain ID", func() {
+			contents, err := ioutil.ReadFile(baseImagePath)
+			Expect(err).NotTo(HaveOccurred())
+			tarSha := sha256.Sum256(contents)
+
+			Expect(baseImageInfo.LayerInfos).To(HaveLen(1))
+			Expect(baseImageInfo.LayerInfos[0].ChainID).To(Equal(hex.EncodeToString(tarSha[:]) + "-0000000000000000000"))
+			Expect(fetcherpkg.IsLocalTarVolume(baseImageInfo.LayerInfos[0].ChainID)).To(BeTrue())
+		})
+
+		It("returns the same chain ID when the tar is touched", func() {
+			Expect(os.Chtimes(baseImagePath, time.Now(), time.Now().Add(time.Hour))).To(Succeed())
+
+			newBaseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(newBaseImageInfo.LayerInfos[0].ChainID).To(Equal(baseImageInfo.LayerInfos[0].ChainID))
+		})
+
+		It("returns the same chain ID for a compressed copy of the tar", func() {
+			compressedCopyPath := baseImagePath + ".gz"
+			contents, err := ioutil.ReadFile(baseImagePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(compressedCopyPath, contents, 0600)).To(Succeed())
+			defer os.Remove(compressedCopyPath)
+			compressFile(compressedCopyPath, func(writer io.Writer) io.WriteCloser {
+				return gzip.NewWriter(writer)
+			})
+
+			compressedCopyURL, err := url.Parse(compressedCopyPath)
+			Expect(err).NotTo(HaveOccurred())
+			newBaseImageInfo, err := fetcher.BaseImageInfo(logger, compressedCopyURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(newBaseImageInfo.LayerInfos[0].ChainID).To(Equal(baseImageInfo.LayerInfos[0].ChainID))
+		})
+
+		It("caches the digest", func() {
+			Expect(logger).NotTo(ContainSequence(Debug(Message("tar-fetcher.layers-digest.tar-digest.cache-hit"))))
+
+			_, err := fetcher.BaseImageInfo(logger, baseImageURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger).To(ContainSequence(Debug(Message("tar-fetcher.layers-digest.tar-digest.cache-hit"))))
+
+			entries, err := ioutil.ReadDir(digestCachePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		Context("when the tar contents change", func() {
+			It("generates another chain ID", func() {
+				time.Sleep(time.Millisecond * 10)
+				Expect(ioutil.WriteFile(filepath.Join(sourceImagePath, "foobar"), []byte("hello-world"), 0700)).To(Succeed())
+				integration.UpdateBaseImageTar(baseImagePath, sourceImagePath)
+
+				newBaseImageInfo, err := fetcher.BaseImageInfo(logger, baseImageURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(newBaseImageInfo.LayerInfos[0].ChainID).NotTo(Equal(baseImageInfo.LayerInfos[0].ChainID))
+			})
+		})
+
+		Describe("StreamBlob", func() {
+			It("returns a stream that verifies the tar contents", func() {
+				stream, _, err := fetcher.StreamBlob(logger, baseImageURL, baseImageInfo.LayerInfos[0])
+				Expect(err).NotTo(HaveOccurred())
+				defer stream.Close()
+
+				streamTar(tar.NewReader(stream))
+				verifiableStream, ok := stream.(base_image_puller.VerifiableStream)
+				Expect(ok).To(BeTrue())
+				Expect(verifiableStream.Verify()).To(Succeed())
+			})
+
+			Context("when the tar changes after its digest was computed", func() {
+				It("fails to verify the stream", func() {
+					Expect(ioutil.WriteFile(filepath.Join(sourceImagePath, "foobar"), []byte("hello-world"), 0700)).To(Succeed())
+					integration.UpdateBaseImageTar(baseImagePath, sourceImagePath)
+
+					stream, _, err := fetcher.StreamBlob(logger, baseImageURL, baseImageInfo.LayerInfos[0])
+					Expect(err).NotTo(HaveOccurred())
+					defer stream.Close()
+
+					streamTar(tar.NewReader(stream))
+					verifiableStream, ok := stream.(base_image_puller.VerifiableStream)
+					Expect(ok).To(BeTrue())
+					Expect(verifiableStream.Verify()).To(MatchError(ContainSubstring("local image changed while it was being unpacked")))
+				})
+			})
+		})
+	})
 })
 
+func compressFile(filePath string, newWriter func(io.Writer) io.WriteCloser) {
+	contents, err := ioutil.ReadFile(filePath)
+	Expect(err).NotTo(HaveOccurred())
+
+	file, err := os.Create(filePath)
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	writer := newWriter(file)
+	_, err = writer.Write(contents)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+}
+
 type tarEntry struct {
 	header   *tar.Header
 	contents []byte
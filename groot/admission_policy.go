@@ -0,0 +1,167 @@
+package groot
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/containers/image/docker/reference"
+	errorspkg "github.com/pkg/errors"
+)
+
+const (
+	defaultRegistryHost = "docker.io"
+	localTarScheme      = "tar"
+)
+
+// dockerHubAliases are the other names Docker Hub is known by
+var dockerHubAliases = []string{"index.docker.io", "registry-1.docker.io"}
+
+// AdmissionPolicy restricts the images that can be created. Registry and
+// repository rules only apply to docker images. Denied entries take
+// precedence over allowed ones, and empty lists allow everything.
+type AdmissionPolicy struct {
+	// AllowedSchemes are base image URL schemes. Local tarballs and
+	// directories use the `tar` scheme.
+	AllowedSchemes []string
+	// AllowedRegistries and DeniedRegistries are registry hosts. Docker Hub is
+	// `docker.io`, whichever of its aliases is used.
+	AllowedRegistries []string
+	DeniedRegistries  []string
+	// AllowedRepositories and DeniedRepositories are globs, as in path.Match,
+	// matched against the normalized repository name, e.g. `library/ubuntu`
+	// for `ubuntu`.
+	AllowedRepositories    []string
+	DeniedRepositories     []string
+	MaxLayers              int
+	MaxCompressedSizeBytes int64
+}
+
+type PolicyViolationError struct {
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("image rejected by the admission policy: %s", e.Reason)
+}
+
+func policyViolation(format string, args ...interface{}) error {
+	return &PolicyViolationError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// AdmitURL checks the parts of the policy that only depend on the image URL.
+func (p AdmissionPolicy) AdmitURL(baseImageURL *url.URL) error {
+	scheme := baseImageURL.Scheme
+	if scheme == "" {
+		scheme = localTarScheme
+	}
+
+	if len(p.AllowedSchemes) > 0 && !contains(p.AllowedSchemes, scheme) {
+		return policyViolation("scheme `%s` is not allowed", scheme)
+	}
+
+	if scheme != "docker" {
+		return nil
+	}
+
+	registry, repository, err := dockerRepository(baseImageURL)
+	if err != nil {
+		return err
+	}
+
+	if containsRegistry(p.DeniedRegistries, registry) {
+		return policyViolation("registry `%s` is denied", registry)
+	}
+	if len(p.AllowedRegistries) > 0 && !containsRegistry(p.AllowedRegistries, registry) {
+		return policyViolation("registry `%s` is not allowed", registry)
+	}
+
+	if matchesRepository(p.DeniedRepositories, registry, repository) {
+		return policyViolation("repository `%s` is denied", repository)
+	}
+	if len(p.AllowedRepositories) > 0 && !matchesRepository(p.AllowedRepositories, registry, repository) {
+		return policyViolation("repository `%s` is not allowed", repository)
+	}
+
+	return nil
+}
+
+// LimitsLayers returns whether AdmitLayers can reject an image.
+func (p AdmissionPolicy) LimitsLayers() bool {
+	return p.MaxLayers > 0 || p.MaxCompressedSizeBytes > 0
+}
+
+// AdmitLayers checks the parts of the policy that depend on the image
+// manifest.
+func (p AdmissionPolicy) AdmitLayers(layerCount int, compressedSize int64) error {
+	if p.MaxLayers > 0 && layerCount > p.MaxLayers {
+		return policyViolation("image has %d layers, the maximum is %d", layerCount, p.MaxLayers)
+	}
+
+	if p.MaxCompressedSizeBytes > 0 && compressedSize > p.MaxCompressedSizeBytes {
+		return policyViolation("image layers are %d bytes, the maximum is %d", compressedSize, p.MaxCompressedSizeBytes)
+	}
+
+	return nil
+}
+
+func dockerRepository(baseImageURL *url.URL) (string, string, error) {
+	refString := strings.TrimPrefix(path.Join(normalizeRegistry(baseImageURL.Host), baseImageURL.Path), "/")
+
+	ref, err := reference.ParseNormalizedNamed(refString)
+	if err != nil {
+		return "", "", errorspkg.Wrapf(err, "parsing image reference `%s`", refString)
+	}
+
+	return reference.Domain(ref), reference.Path(ref), nil
+}
+
+func normalizeRegistry(registry string) string {
+	if contains(dockerHubAliases, registry) {
+		return defaultRegistryHost
+	}
+	return registry
+}
+
+func containsRegistry(registries []string, registry string) bool {
+	for _, entry := range registries {
+		if normalizeRegistry(entry) == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRepository also matches official Docker Hub images by their short
+// name, so that `ubuntu` matches `library/ubuntu`.
+func matchesRepository(globs []string, registry, repository string) bool {
+	if matchesAny(globs, repository) {
+		return true
+	}
+
+	officialPrefix := "library/"
+	if registry == defaultRegistryHost && strings.HasPrefix(repository, officialPrefix) {
+		return matchesAny(globs, strings.TrimPrefix(repository, officialPrefix))
+	}
+
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(globs []string, value string) bool {
+	for _, glob := range globs {
+		if matched, _ := path.Match(glob, value); matched {
+			return true
+		}
+	}
+	return false
+}
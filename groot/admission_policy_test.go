@@ -0,0 +1,178 @@
+package groot_test
+
+import (
+	"net/url"
+
+	"code.cloudfoundry.org/grootfs/groot"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AdmissionPolicy", func() {
+	var policy groot.AdmissionPolicy
+
+	BeforeEach(func() {
+		policy = groot.AdmissionPolicy{}
+	})
+
+	admitURL := func(rawURL string) error {
+		baseImageURL, err := url.Parse(rawURL)
+		Expect(err).NotTo(HaveOccurred())
+		return policy.AdmitURL(baseImageURL)
+	}
+
+	Describe("AdmitURL", func() {
+		It("admits everything by default", func() {
+			Expect(admitURL("docker:///cfgarden/empty")).To(Succeed())
+			Expect(admitURL("oci:///images/busybox")).To(Succeed())
+			Expect(admitURL("/images/busybox.tar")).To(Succeed())
+		})
+
+		Context("when schemes are restricted", func() {
+			BeforeEach(func() {
+				policy.AllowedSchemes = []string{"docker", "tar"}
+			})
+
+			It("admits the allowed schemes", func() {
+				Expect(admitURL("docker:///cfgarden/empty")).To(Succeed())
+				Expect(admitURL("/images/busybox.tar")).To(Succeed())
+			})
+
+			It("rejects the other schemes", func() {
+				err := admitURL("oci:///images/busybox")
+				Expect(err).To(MatchError("image rejected by the admission policy: scheme `oci` is not allowed"))
+				Expect(err).To(BeAssignableToTypeOf(&groot.PolicyViolationError{}))
+			})
+		})
+
+		Context("when registries are restricted", func() {
+			BeforeEach(func() {
+				policy.AllowedRegistries = []string{"docker.io", "registry.example.com:5000"}
+			})
+
+			It("admits images from the allowed registries", func() {
+				Expect(admitURL("docker:///cfgarden/empty")).To(Succeed())
+				Expect(admitURL("docker://registry.example.com:5000/my-org/app:v1")).To(Succeed())
+			})
+
+			It("rejects images from the other registries", func() {
+				Expect(admitURL("docker://quay.io/my-org/app")).To(MatchError("image rejected by the admission policy: registry `quay.io` is not allowed"))
+			})
+
+			It("does not apply to other schemes", func() {
+				Expect(admitURL("oci:///images/busybox")).To(Succeed())
+			})
+
+			It("treats the Docker Hub aliases as docker.io", func() {
+				Expect(admitURL("docker://index.docker.io/cfgarden/empty")).To(Succeed())
+				Expect(admitURL("docker://registry-1.docker.io/cfgarden/empty")).To(Succeed())
+			})
+
+			Context("when a registry is also denied", func() {
+				BeforeEach(func() {
+					policy.DeniedRegistries = []string{"index.docker.io"}
+				})
+
+				It("rejects its images, whichever alias is used", func() {
+					Expect(admitURL("docker:///cfgarden/empty")).To(MatchError("image rejected by the admission policy: registry `docker.io` is denied"))
+					Expect(admitURL("docker://registry-1.docker.io/cfgarden/empty")).To(MatchError("image rejected by the admission policy: registry `docker.io` is denied"))
+				})
+			})
+		})
+
+		Context("when repositories are restricted", func() {
+			BeforeEach(func() {
+				policy.AllowedRepositories = []string{"cfgarden/*", "library/*"}
+				policy.DeniedRepositories = []string{"cfgarden/private-*"}
+			})
+
+			It("admits the repositories matching the allowed globs", func() {
+				Expect(admitURL("docker:///cfgarden/empty:v0.1.1")).To(Succeed())
+				Expect(admitURL("docker:///cfgarden/empty@sha256:1111111111111111111111111111111111111111111111111111111111111111")).To(Succeed())
+			})
+
+			It("matches official images under library", func() {
+				Expect(admitURL("docker:///ubuntu:latest")).To(Succeed())
+				Expect(admitURL("docker://index.docker.io/ubuntu:latest")).To(Succeed())
+				Expect(admitURL("docker://registry-1.docker.io/ubuntu")).To(Succeed())
+			})
+
+			It("rejects the repositories that don't match", func() {
+				Expect(admitURL("docker:///my-org/app")).To(MatchError("image rejected by the admission policy: repository `my-org/app` is not allowed"))
+			})
+
+			It("rejects the repositories matching the denied globs", func() {
+				Expect(admitURL("docker:///cfgarden/private-app")).To(MatchError("image rejected by the admission policy: repository `cfgarden/private-app` is denied"))
+			})
+
+			It("does not confuse registry ports with tags", func() {
+				Expect(admitURL("docker://registry.example.com:5000/cfgarden/empty")).To(Succeed())
+			})
+
+			Context("when an official image is denied by its short name", func() {
+				BeforeEach(func() {
+					policy.DeniedRepositories = []string{"ubuntu"}
+				})
+
+				It("rejects it, with or without the library prefix", func() {
+					Expect(admitURL("docker:///ubuntu")).To(MatchError("image rejected by the admission policy: repository `library/ubuntu` is denied"))
+					Expect(admitURL("docker:///library/ubuntu")).To(MatchError("image rejected by the admission policy: repository `library/ubuntu` is denied"))
+				})
+			})
+		})
+
+		Context("when the image reference is invalid", func() {
+			It("returns an error", func() {
+				Expect(admitURL("docker:///cfgarden/Empty")).To(MatchError(ContainSubstring("parsing image reference `cfgarden/Empty`")))
+			})
+		})
+	})
+
+	Describe("LimitsLayers", func() {
+		It("is false by default", func() {
+			Expect(policy.LimitsLayers()).To(BeFalse())
+		})
+
+		It("is true when the layer count or size is limited", func() {
+			Expect(groot.AdmissionPolicy{MaxLayers: 1}.LimitsLayers()).To(BeTrue())
+			Expect(groot.AdmissionPolicy{MaxCompressedSizeBytes: 1}.LimitsLayers()).To(BeTrue())
+		})
+	})
+
+	Describe("AdmitLayers", func() {
+		It("admits everything by default", func() {
+			Expect(policy.AdmitLayers(1000, 1024*1024*1024)).To(Succeed())
+		})
+
+		Context("when the layer count is limited", func() {
+			BeforeEach(func() {
+				policy.MaxLayers = 3
+			})
+
+			It("admits images up to the limit", func() {
+				Expect(policy.AdmitLayers(3, 0)).To(Succeed())
+			})
+
+			It("rejects images with more layers", func() {
+				err := policy.AdmitLayers(4, 0)
+				Expect(err).To(MatchError("image rejected by the admission policy: image has 4 layers, the maximum is 3"))
+				Expect(err).To(BeAssignableToTypeOf(&groot.PolicyViolationError{}))
+			})
+		})
+
+		Context("when the compressed size is limited", func() {
+			BeforeEach(func() {
+				policy.MaxCompressedSizeBytes = 1024
+			})
+
+			It("admits images up to the limit", func() {
+				Expect(policy.AdmitLayers(1, 1024)).To(Succeed())
+			})
+
+			It("rejects bigger images", func() {
+				Expect(policy.AdmitLayers(1, 1025)).To(MatchError("image rejected by the admission policy: image layers are 1025 bytes, the maximum is 1024"))
+			})
+		})
+	})
+})
@@ -23,6 +23,7 @@ type CreateSpec struct {
 	CleanOnCreateCacheBytes   int64
 	UIDMappings               []IDMappingSpec
 	GIDMappings               []IDMappingSpec
+	AdmissionPolicy           AdmissionPolicy
 }
 
 type Creator struct {
@@ -32,12 +33,16 @@ type Creator struct {
 	locksmith         Locksmith
 	dependencyManager DependencyManager
 	metricsEmitter    MetricsEmitter
+	progressReporter  ProgressReporter
 }
 
+// IamCreator creates a creator. The progressReporter is optional: when it is
+// nil, no progress is reported.
 func IamCreator(
 	imageCloner ImageCloner, baseImagePuller BaseImagePuller,
 	locksmith Locksmith, dependencyManager DependencyManager,
-	metricsEmitter MetricsEmitter, cleaner Cleaner) *Creator {
+	metricsEmitter MetricsEmitter, cleaner Cleaner,
+	progressReporter ProgressReporter) *Creator {
 	return &Creator{
 		imageCloner:       imageCloner,
 		baseImagePuller:   baseImagePuller,
@@ -45,6 +50,7 @@ func IamCreator(
 		dependencyManager: dependencyManager,
 		metricsEmitter:    metricsEmitter,
 		cleaner:           cleaner,
+		progressReporter:  progressReporter,
 	}
 }
 
@@ -67,7 +73,12 @@ func (c *Creator) Create(logger lager.Logger, spec CreateSpec) (ImageInfo, error
 		return ImageInfo{}, errorspkg.Errorf("image for id `%s` already exists", spec.ID)
 	}
 
-	ownerUid, ownerGid := c.parseOwner(spec.UIDMappings, spec.GIDMappings)
+	if err := spec.AdmissionPolicy.AdmitURL(spec.BaseImageURL); err != nil {
+		logger.Error("admitting-image-failed", err)
+		return ImageInfo{}, err
+	}
+
+	ownerUid, ownerGid := parseOwner(spec.UIDMappings, spec.GIDMappings)
 	baseImageSpec := BaseImageSpec{
 		BaseImageSrc:              spec.BaseImageURL,
 		DiskLimit:                 spec.DiskLimit,
@@ -76,6 +87,7 @@ func (c *Creator) Create(logger lager.Logger, spec CreateSpec) (ImageInfo, error
 		GIDMappings:               spec.GIDMappings,
 		OwnerUID:                  ownerUid,
 		OwnerGID:                  ownerGid,
+		AdmissionPolicy:           spec.AdmissionPolicy,
 	}
 
 	if spec.CleanOnCreate {
@@ -109,6 +121,11 @@ func (c *Creator) Create(logger lager.Logger, spec CreateSpec) (ImageInfo, error
 		OwnerUID:                  ownerUid,
 		OwnerGID:                  ownerGid,
 	}
+	if c.progressReporter != nil {
+		imageSpec.Progress = func(event ProgressEvent) {
+			c.progressReporter.Report(logger, event)
+		}
+	}
 
 	image, err := c.imageCloner.Create(logger, imageSpec)
 	if err != nil {
@@ -116,7 +133,7 @@ func (c *Creator) Create(logger lager.Logger, spec CreateSpec) (ImageInfo, error
 	}
 
 	imageRefName := fmt.Sprintf(ImageReferenceFormat, spec.ID)
-	if err := c.dependencyManager.Register(imageRefName, baseImage.ChainIDs); err != nil {
+	if err := c.dependencyManager.Register(imageRefName, baseImage.ChainIDs, baseImage.ManifestDigest); err != nil {
 		if destroyErr := c.imageCloner.Destroy(logger, spec.ID); destroyErr != nil {
 			logger.Error("failed-to-destroy-image", destroyErr)
 		}
@@ -124,10 +141,11 @@ func (c *Creator) Create(logger lager.Logger, spec CreateSpec) (ImageInfo, error
 		return ImageInfo{}, err
 	}
 
+	image.ManifestDigest = baseImage.ManifestDigest
 	return image, nil
 }
 
-func (c *Creator) parseOwner(uidMappings, gidMappings []IDMappingSpec) (int, int) {
+func parseOwner(uidMappings, gidMappings []IDMappingSpec) (int, int) {
 	uid := os.Getuid()
 	gid := os.Getgid()
 
@@ -25,6 +25,7 @@ var _ = Describe("Creator", func() {
 		fakeDependencyManager *grootfakes.FakeDependencyManager
 		fakeMetricsEmitter    *grootfakes.FakeMetricsEmitter
 		fakeCleaner           *grootfakes.FakeCleaner
+		fakeProgressReporter  *grootfakes.FakeProgressReporter
 		lockFile              *os.File
 
 		creator *groot.Creator
@@ -40,6 +41,7 @@ var _ = Describe("Creator", func() {
 		fakeDependencyManager = new(grootfakes.FakeDependencyManager)
 		fakeMetricsEmitter = new(grootfakes.FakeMetricsEmitter)
 		fakeCleaner = new(grootfakes.FakeCleaner)
+		fakeProgressReporter = new(grootfakes.FakeProgressReporter)
 
 		var err error
 		lockFile, err = ioutil.TempFile("", "")
@@ -57,7 +59,7 @@ var _ = Describe("Creator", func() {
 		creator = groot.IamCreator(
 			fakeImageCloner, fakeBaseImagePuller, fakeLocksmith,
 			fakeDependencyManager, fakeMetricsEmitter,
-			fakeCleaner)
+			fakeCleaner, fakeProgressReporter)
 	})
 
 	AfterEach(func() {
@@ -145,6 +147,8 @@ var _ = Describe("Creator", func() {
 
 			Expect(fakeImageCloner.CreateCallCount()).To(Equal(1))
 			_, createImagerSpec := fakeImageCloner.CreateArgsForCall(0)
+			Expect(createImagerSpec.Progress).NotTo(BeNil())
+			createImagerSpec.Progress = nil
 			Expect(createImagerSpec).To(Equal(groot.ImageSpec{
 				ID:            "some-id",
 				BaseVolumeIDs: []string{"id-1", "id-2"},
@@ -178,6 +182,26 @@ var _ = Describe("Creator", func() {
 			Expect(image).To(Equal(expectedImage))
 		})
 
+		It("registers the image dependencies with the manifest digest", func() {
+			fakeBaseImagePuller.PullReturns(groot.BaseImage{
+				ChainIDs:       []string{"id-1", "id-2"},
+				ManifestDigest: "sha256:manifest-digest",
+			}, nil)
+
+			image, err := creator.Create(logger, groot.CreateSpec{
+				ID:           "some-id",
+				BaseImageURL: baseImageUrl,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(image.ManifestDigest).To(Equal("sha256:manifest-digest"))
+
+			Expect(fakeDependencyManager.RegisterCallCount()).To(Equal(1))
+			imageRefName, chainIDs, manifestDigest := fakeDependencyManager.RegisterArgsForCall(0)
+			Expect(imageRefName).To(Equal("image:some-id"))
+			Expect(chainIDs).To(Equal([]string{"id-1", "id-2"}))
+			Expect(manifestDigest).To(Equal("sha256:manifest-digest"))
+		})
+
 		It("emits metrics for creation", func() {
 			_, err := creator.Create(logger, groot.CreateSpec{
 				ID:           "some-id",
@@ -315,6 +339,45 @@ var _ = Describe("Creator", func() {
 			})
 		})
 
+		Context("when an admission policy is given", func() {
+			var admissionPolicy groot.AdmissionPolicy
+
+			BeforeEach(func() {
+				admissionPolicy = groot.AdmissionPolicy{
+					AllowedSchemes: []string{"docker"},
+					MaxLayers:      10,
+				}
+			})
+
+			It("passes the policy to the puller", func() {
+				dockerImageURL, err := url.Parse("docker:///cfgarden/empty")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = creator.Create(logger, groot.CreateSpec{
+					BaseImageURL:    dockerImageURL,
+					AdmissionPolicy: admissionPolicy,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, baseImageSpec := fakeBaseImagePuller.PullArgsForCall(0)
+				Expect(baseImageSpec.AdmissionPolicy).To(Equal(admissionPolicy))
+			})
+
+			Context("when the image URL violates the policy", func() {
+				It("returns a policy violation error without pulling the image", func() {
+					_, err := creator.Create(logger, groot.CreateSpec{
+						BaseImageURL:    baseImageUrl,
+						AdmissionPolicy: admissionPolicy,
+					})
+					Expect(err).To(MatchError("image rejected by the admission policy: scheme `tar` is not allowed"))
+					Expect(err).To(BeAssignableToTypeOf(&groot.PolicyViolationError{}))
+
+					Expect(fakeLocksmith.LockCallCount()).To(Equal(0))
+					Expect(fakeBaseImagePuller.PullCallCount()).To(Equal(0))
+				})
+			})
+		})
+
 		Context("when acquiring the lock fails", func() {
 			BeforeEach(func() {
 				fakeLocksmith.LockReturns(nil, errors.New("failed to lock"))
@@ -415,6 +478,7 @@ var _ = Describe("Creator", func() {
 
 				Expect(fakeImageCloner.CreateCallCount()).To(Equal(1))
 				_, createImagerSpec := fakeImageCloner.CreateArgsForCall(0)
+				createImagerSpec.Progress = nil
 				Expect(createImagerSpec).To(Equal(groot.ImageSpec{
 					ID:            "some-id",
 					BaseVolumeIDs: []string{"id-1", "id-2"},
@@ -427,5 +491,63 @@ var _ = Describe("Creator", func() {
 				}))
 			})
 		})
+
+		Describe("progress", func() {
+			It("reports the steps the image cloner takes", func() {
+				fakeImageCloner.CreateStub = func(_ lager.Logger, spec groot.ImageSpec) (groot.ImageInfo, error) {
+					spec.Progress(groot.ProgressEvent{Event: groot.ProgressQuotaApplied, DiskLimit: 1024})
+					spec.Progress(groot.ProgressEvent{Event: groot.ProgressMountDone})
+					return groot.ImageInfo{}, nil
+				}
+
+				_, err := creator.Create(logger, groot.CreateSpec{
+					ID:           "some-id",
+					DiskLimit:    int64(1024),
+					Mount:        true,
+					BaseImageURL: baseImageUrl,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeProgressReporter.ReportCallCount()).To(Equal(2))
+				_, event := fakeProgressReporter.ReportArgsForCall(0)
+				Expect(event).To(Equal(groot.ProgressEvent{Event: groot.ProgressQuotaApplied, DiskLimit: 1024}))
+				_, event = fakeProgressReporter.ReportArgsForCall(1)
+				Expect(event).To(Equal(groot.ProgressEvent{Event: groot.ProgressMountDone}))
+			})
+
+			It("does not report steps the image cloner does not take", func() {
+				_, err := creator.Create(logger, groot.CreateSpec{
+					ID:           "some-id",
+					DiskLimit:    int64(1024),
+					Mount:        true,
+					BaseImageURL: baseImageUrl,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeProgressReporter.ReportCallCount()).To(Equal(0))
+			})
+
+			Context("when no progress reporter is given", func() {
+				BeforeEach(func() {
+					creator = groot.IamCreator(
+						fakeImageCloner, fakeBaseImagePuller, fakeLocksmith,
+						fakeDependencyManager, fakeMetricsEmitter,
+						fakeCleaner, nil)
+				})
+
+				It("does not ask the image cloner for progress", func() {
+					_, err := creator.Create(logger, groot.CreateSpec{
+						ID:           "some-id",
+						DiskLimit:    int64(1024),
+						Mount:        true,
+						BaseImageURL: baseImageUrl,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					_, createImagerSpec := fakeImageCloner.CreateArgsForCall(0)
+					Expect(createImagerSpec.Progress).To(BeNil())
+				})
+			})
+		})
 	})
 })
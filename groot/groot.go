@@ -12,6 +12,7 @@ import (
 const (
 	GlobalLockKey                      = "global-groot-lock"
 	MetricImageCreationTime            = "ImageCreationTime"
+	MetricImagePullTime                = "ImagePullTime"
 	MetricImageDeletionTime            = "ImageDeletionTime"
 	MetricImageStatsTime               = "ImageStatsTime"
 	MetricImageCleanTime               = "ImageCleanTime"
@@ -28,12 +29,14 @@ const (
 //go:generate counterfeiter . StoreMeasurer
 //go:generate counterfeiter . RootFSConfigurer
 //go:generate counterfeiter . MetricsEmitter
+//go:generate counterfeiter . ProgressReporter
 
 type ImageInfo struct {
-	Rootfs string        `json:"rootfs"`
-	Image  specsv1.Image `json:"image,omitempty"`
-	Mounts []MountInfo   `json:"mounts,omitempty"`
-	Path   string        `json:"-"`
+	Rootfs         string        `json:"rootfs"`
+	Image          specsv1.Image `json:"image,omitempty"`
+	Mounts         []MountInfo   `json:"mounts,omitempty"`
+	Path           string        `json:"-"`
+	ManifestDigest string        `json:"-"`
 }
 
 type MountInfo struct {
@@ -62,11 +65,13 @@ type BaseImageSpec struct {
 	GIDMappings               []IDMappingSpec
 	OwnerUID                  int
 	OwnerGID                  int
+	AdmissionPolicy           AdmissionPolicy
 }
 
 type BaseImage struct {
-	BaseImage specsv1.Image
-	ChainIDs  []string
+	BaseImage      specsv1.Image
+	ChainIDs       []string
+	ManifestDigest string
 }
 
 type BaseImagePuller interface {
@@ -82,6 +87,9 @@ type ImageSpec struct {
 	BaseImage                 specsv1.Image
 	OwnerUID                  int
 	OwnerGID                  int
+	// Progress is optional. It is told about the steps taken to create the
+	// image.
+	Progress func(event ProgressEvent) `json:"-"`
 }
 
 type ImageCloner interface {
@@ -96,8 +104,10 @@ type RootFSConfigurer interface {
 }
 
 type DependencyManager interface {
-	Register(id string, chainIDs []string) error
+	Register(id string, chainIDs []string, manifestDigest string) error
 	Deregister(id string) error
+	Retain(id string, until time.Time) error
+	Release(id string) error
 }
 
 type GarbageCollector interface {
@@ -121,6 +131,10 @@ type MetricsEmitter interface {
 	TryEmitDurationFrom(logger lager.Logger, name string, from time.Time)
 }
 
+type ProgressReporter interface {
+	Report(logger lager.Logger, event ProgressEvent)
+}
+
 type DiskUsage struct {
 	TotalBytesUsed     int64 `json:"total_bytes_used"`
 	ExclusiveBytesUsed int64 `json:"exclusive_bytes_used"`
@@ -3,16 +3,18 @@ package grootfakes
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/grootfs/groot"
 )
 
 type FakeDependencyManager struct {
-	RegisterStub        func(id string, chainIDs []string) error
+	RegisterStub        func(id string, chainIDs []string, manifestDigest string) error
 	registerMutex       sync.RWMutex
 	registerArgsForCall []struct {
-		id       string
-		chainIDs []string
+		id             string
+		chainIDs       []string
+		manifestDigest string
 	}
 	registerReturns struct {
 		result1 error
@@ -31,11 +33,34 @@ type FakeDependencyManager struct {
 	deregisterReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RetainStub        func(id string, until time.Time) error
+	retainMutex       sync.RWMutex
+	retainArgsForCall []struct {
+		id    string
+		until time.Time
+	}
+	retainReturns struct {
+		result1 error
+	}
+	retainReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ReleaseStub        func(id string) error
+	releaseMutex       sync.RWMutex
+	releaseArgsForCall []struct {
+		id string
+	}
+	releaseReturns struct {
+		result1 error
+	}
+	releaseReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeDependencyManager) Register(id string, chainIDs []string) error {
+func (fake *FakeDependencyManager) Register(id string, chainIDs []string, manifestDigest string) error {
 	var chainIDsCopy []string
 	if chainIDs != nil {
 		chainIDsCopy = make([]string, len(chainIDs))
@@ -44,13 +69,14 @@ func (fake *FakeDependencyManager) Register(id string, chainIDs []string) error
 	fake.registerMutex.Lock()
 	ret, specificReturn := fake.registerReturnsOnCall[len(fake.registerArgsForCall)]
 	fake.registerArgsForCall = append(fake.registerArgsForCall, struct {
-		id       string
-		chainIDs []string
-	}{id, chainIDsCopy})
-	fake.recordInvocation("Register", []interface{}{id, chainIDsCopy})
+		id             string
+		chainIDs       []string
+		manifestDigest string
+	}{id, chainIDsCopy, manifestDigest})
+	fake.recordInvocation("Register", []interface{}{id, chainIDsCopy, manifestDigest})
 	fake.registerMutex.Unlock()
 	if fake.RegisterStub != nil {
-		return fake.RegisterStub(id, chainIDs)
+		return fake.RegisterStub(id, chainIDs, manifestDigest)
 	}
 	if specificReturn {
 		return ret.result1
@@ -64,10 +90,10 @@ func (fake *FakeDependencyManager) RegisterCallCount() int {
 	return len(fake.registerArgsForCall)
 }
 
-func (fake *FakeDependencyManager) RegisterArgsForCall(i int) (string, []string) {
+func (fake *FakeDependencyManager) RegisterArgsForCall(i int) (string, []string, string) {
 	fake.registerMutex.RLock()
 	defer fake.registerMutex.RUnlock()
-	return fake.registerArgsForCall[i].id, fake.registerArgsForCall[i].chainIDs
+	return fake.registerArgsForCall[i].id, fake.registerArgsForCall[i].chainIDs, fake.registerArgsForCall[i].manifestDigest
 }
 
 func (fake *FakeDependencyManager) RegisterReturns(result1 error) {
@@ -137,6 +163,103 @@ func (fake *FakeDependencyManager) DeregisterReturnsOnCall(i int, result1 error)
 	}{result1}
 }
 
+func (fake *FakeDependencyManager) Retain(id string, until time.Time) error {
+	fake.retainMutex.Lock()
+	ret, specificReturn := fake.retainReturnsOnCall[len(fake.retainArgsForCall)]
+	fake.retainArgsForCall = append(fake.retainArgsForCall, struct {
+		id    string
+		until time.Time
+	}{id, until})
+	fake.recordInvocation("Retain", []interface{}{id, until})
+	fake.retainMutex.Unlock()
+	if fake.RetainStub != nil {
+		return fake.RetainStub(id, until)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.retainReturns.result1
+}
+
+func (fake *FakeDependencyManager) RetainCallCount() int {
+	fake.retainMutex.RLock()
+	defer fake.retainMutex.RUnlock()
+	return len(fake.retainArgsForCall)
+}
+
+func (fake *FakeDependencyManager) RetainArgsForCall(i int) (string, time.Time) {
+	fake.retainMutex.RLock()
+	defer fake.retainMutex.RUnlock()
+	return fake.retainArgsForCall[i].id, fake.retainArgsForCall[i].until
+}
+
+func (fake *FakeDependencyManager) RetainReturns(result1 error) {
+	fake.RetainStub = nil
+	fake.retainReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDependencyManager) RetainReturnsOnCall(i int, result1 error) {
+	fake.RetainStub = nil
+	if fake.retainReturnsOnCall == nil {
+		fake.retainReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.retainReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDependencyManager) Release(id string) error {
+	fake.releaseMutex.Lock()
+	ret, specificReturn := fake.releaseReturnsOnCall[len(fake.releaseArgsForCall)]
+	fake.releaseArgsForCall = append(fake.releaseArgsForCall, struct {
+		id string
+	}{id})
+	fake.recordInvocation("Release", []interface{}{id})
+	fake.releaseMutex.Unlock()
+	if fake.ReleaseStub != nil {
+		return fake.ReleaseStub(id)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.releaseReturns.result1
+}
+
+func (fake *FakeDependencyManager) ReleaseCallCount() int {
+	fake.releaseMutex.RLock()
+	defer fake.releaseMutex.RUnlock()
+	return len(fake.releaseArgsForCall)
+}
+
+func (fake *FakeDependencyManager) ReleaseArgsForCall(i int) string {
+	fake.releaseMutex.RLock()
+	defer fake.releaseMutex.RUnlock()
+	return fake.releaseArgsForCall[i].id
+}
+
+func (fake *FakeDependencyManager) ReleaseReturns(result1 error) {
+	fake.ReleaseStub = nil
+	fake.releaseReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeDependencyManager) ReleaseReturnsOnCall(i int, result1 error) {
+	fake.ReleaseStub = nil
+	if fake.releaseReturnsOnCall == nil {
+		fake.releaseReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.releaseReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeDependencyManager) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -144,6 +267,10 @@ func (fake *FakeDependencyManager) Invocations() map[string][][]interface{} {
 	defer fake.registerMutex.RUnlock()
 	fake.deregisterMutex.RLock()
 	defer fake.deregisterMutex.RUnlock()
+	fake.retainMutex.RLock()
+	defer fake.retainMutex.RUnlock()
+	fake.releaseMutex.RLock()
+	defer fake.releaseMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
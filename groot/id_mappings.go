@@ -0,0 +1,96 @@
+package groot
+
+import (
+	"fmt"
+	"sort"
+
+	errorspkg "github.com/pkg/errors"
+)
+
+// IDMap translates IDs between a user namespace and the host. Its ranges are
+// sorted by namespace ID and cover the namespace IDs from 0 without gaps or
+// overlaps. An empty IDMap translates every ID to itself.
+type IDMap []IDMappingSpec
+
+func NewIDMap(mappings []IDMappingSpec) (IDMap, error) {
+	idMap := make(IDMap, len(mappings))
+	copy(idMap, mappings)
+	sort.Slice(idMap, func(i, j int) bool {
+		return idMap[i].NamespaceID < idMap[j].NamespaceID
+	})
+
+	nextNamespaceID := 0
+	for i, mapping := range idMap {
+		if mapping.NamespaceID < 0 || mapping.HostID < 0 || mapping.Size <= 0 {
+			return nil, errorspkg.Errorf("invalid id mapping %s", mapping)
+		}
+
+		if mapping.NamespaceID < nextNamespaceID {
+			return nil, errorspkg.Errorf("id mapping %s overlaps with %s", mapping, idMap[i-1])
+		}
+
+		if mapping.NamespaceID > nextNamespaceID {
+			return nil, errorspkg.Errorf("id mappings do not cover namespace ids %d to %d", nextNamespaceID, mapping.NamespaceID-1)
+		}
+
+		for _, other := range idMap[:i] {
+			if mapping.HostID < other.HostID+other.Size && other.HostID < mapping.HostID+mapping.Size {
+				return nil, errorspkg.Errorf("id mapping %s overlaps with %s on the host", mapping, other)
+			}
+		}
+
+		nextNamespaceID = mapping.NamespaceID + mapping.Size
+	}
+
+	return idMap, nil
+}
+
+// HostID returns the host ID that a namespace ID is mapped to
+func (m IDMap) HostID(namespaceID int) (int, error) {
+	if len(m) == 0 {
+		return namespaceID, nil
+	}
+
+	for _, mapping := range m {
+		if namespaceID >= mapping.NamespaceID && namespaceID < mapping.NamespaceID+mapping.Size {
+			return mapping.HostID + namespaceID - mapping.NamespaceID, nil
+		}
+	}
+
+	return 0, errorspkg.Errorf("namespace id %d is not mapped to a host id", namespaceID)
+}
+
+// NamespaceID returns the namespace ID that a host ID is mapped to
+func (m IDMap) NamespaceID(hostID int) (int, error) {
+	if len(m) == 0 {
+		return hostID, nil
+	}
+
+	for _, mapping := range m {
+		if hostID >= mapping.HostID && hostID < mapping.HostID+mapping.Size {
+			return mapping.NamespaceID + hostID - mapping.HostID, nil
+		}
+	}
+
+	return 0, errorspkg.Errorf("host id %d is not mapped to a namespace id", hostID)
+}
+
+// AppendHostRange maps a range of host IDs to the namespace IDs that follow
+// the ones already mapped.
+func (m IDMap) AppendHostRange(hostID, size int) (IDMap, error) {
+	nextNamespaceID := 0
+	if len(m) > 0 {
+		last := m[len(m)-1]
+		nextNamespaceID = last.NamespaceID + last.Size
+	}
+
+	return NewIDMap(append(m[:len(m):len(m)], IDMappingSpec{
+		HostID:      hostID,
+		NamespaceID: nextNamespaceID,
+		Size:        size,
+	}))
+}
+
+func (s IDMappingSpec) String() string {
+	return fmt.Sprintf("%d:%d:%d", s.NamespaceID, s.HostID, s.Size)
+}
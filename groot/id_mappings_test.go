@@ -0,0 +1,169 @@
+package groot_test
+
+import (
+	"code.cloudfoundry.org/grootfs/groot"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IDMap", func() {
+	var mappings []groot.IDMappingSpec
+
+	BeforeEach(func() {
+		mappings = []groot.IDMappingSpec{
+			groot.IDMappingSpec{HostID: 100000, NamespaceID: 1, Size: 1000},
+			groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
+			groot.IDMappingSpec{HostID: 300000, NamespaceID: 1001, Size: 500},
+		}
+	})
+
+	Describe("NewIDMap", func() {
+		It("sorts the mappings by namespace id", func() {
+			idMap, err := groot.NewIDMap(mappings)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(idMap).To(Equal(groot.IDMap{
+				groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
+				groot.IDMappingSpec{HostID: 100000, NamespaceID: 1, Size: 1000},
+				groot.IDMappingSpec{HostID: 300000, NamespaceID: 1001, Size: 500},
+			}))
+		})
+
+		It("accepts no mappings", func() {
+			idMap, err := groot.NewIDMap(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(idMap).To(BeEmpty())
+		})
+
+		Context("when a mapping is empty", func() {
+			BeforeEach(func() {
+				mappings[2].Size = 0
+			})
+
+			It("returns an error", func() {
+				_, err := groot.NewIDMap(mappings)
+				Expect(err).To(MatchError("invalid id mapping 1001:300000:0"))
+			})
+		})
+
+		Context("when the namespace ranges overlap", func() {
+			BeforeEach(func() {
+				mappings[2].NamespaceID = 900
+			})
+
+			It("returns an error", func() {
+				_, err := groot.NewIDMap(mappings)
+				Expect(err).To(MatchError("id mapping 900:300000:500 overlaps with 1:100000:1000"))
+			})
+		})
+
+		Context("when the host ranges overlap", func() {
+			BeforeEach(func() {
+				mappings[2].HostID = 100500
+			})
+
+			It("returns an error", func() {
+				_, err := groot.NewIDMap(mappings)
+				Expect(err).To(MatchError("id mapping 1001:100500:500 overlaps with 1:100000:1000 on the host"))
+			})
+		})
+
+		Context("when the namespace ranges leave a gap", func() {
+			BeforeEach(func() {
+				mappings[2].NamespaceID = 2001
+			})
+
+			It("returns an error", func() {
+				_, err := groot.NewIDMap(mappings)
+				Expect(err).To(MatchError("id mappings do not cover namespace ids 1001 to 2000"))
+			})
+		})
+
+		Context("when root is not mapped", func() {
+			BeforeEach(func() {
+				mappings = mappings[:1]
+			})
+
+			It("returns an error", func() {
+				_, err := groot.NewIDMap(mappings)
+				Expect(err).To(MatchError("id mappings do not cover namespace ids 0 to 0"))
+			})
+		})
+	})
+
+	Describe("HostID", func() {
+		var idMap groot.IDMap
+
+		BeforeEach(func() {
+			var err error
+			idMap, err = groot.NewIDMap(mappings)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("translates ids of every range", func() {
+			Expect(idMap.HostID(0)).To(Equal(1000))
+			Expect(idMap.HostID(1)).To(Equal(100000))
+			Expect(idMap.HostID(1000)).To(Equal(100999))
+			Expect(idMap.HostID(1001)).To(Equal(300000))
+			Expect(idMap.HostID(1200)).To(Equal(300199))
+		})
+
+		It("returns an error for ids outside the mappings", func() {
+			_, err := idMap.HostID(1501)
+			Expect(err).To(MatchError("namespace id 1501 is not mapped to a host id"))
+		})
+
+		It("does not translate ids without mappings", func() {
+			Expect(groot.IDMap{}.HostID(1501)).To(Equal(1501))
+		})
+	})
+
+	Describe("NamespaceID", func() {
+		var idMap groot.IDMap
+
+		BeforeEach(func() {
+			var err error
+			idMap, err = groot.NewIDMap(mappings)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("translates host ids of every range", func() {
+			Expect(idMap.NamespaceID(1000)).To(Equal(0))
+			Expect(idMap.NamespaceID(100999)).To(Equal(1000))
+			Expect(idMap.NamespaceID(300199)).To(Equal(1200))
+		})
+
+		It("returns an error for host ids outside the mappings", func() {
+			_, err := idMap.NamespaceID(5)
+			Expect(err).To(MatchError("host id 5 is not mapped to a namespace id"))
+		})
+	})
+
+	Describe("AppendHostRange", func() {
+		It("maps the host range after the mapped namespace ids", func() {
+			idMap, err := groot.NewIDMap(mappings)
+			Expect(err).NotTo(HaveOccurred())
+
+			idMap, err = idMap.AppendHostRange(500000, 100)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(idMap.HostID(1501)).To(Equal(500000))
+			Expect(idMap.HostID(1600)).To(Equal(500099))
+		})
+
+		It("maps the first range to root", func() {
+			idMap, err := groot.IDMap{}.AppendHostRange(1000, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(idMap).To(Equal(groot.IDMap{
+				groot.IDMappingSpec{HostID: 1000, NamespaceID: 0, Size: 1},
+			}))
+		})
+
+		It("returns an error when the host range overlaps", func() {
+			idMap, err := groot.NewIDMap(mappings)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = idMap.AppendHostRange(100100, 100)
+			Expect(err).To(MatchError(ContainSubstring("overlaps")))
+		})
+	})
+})
@@ -0,0 +1,27 @@
+package groot
+
+const (
+	ProgressManifestResolved = "manifest-resolved"
+	ProgressLayerQueued      = "layer-queued"
+	ProgressLayerDownloading = "layer-downloading"
+	ProgressLayerVerifying   = "layer-verifying"
+	ProgressLayerUnpacking   = "layer-unpacking"
+	ProgressLayerDone        = "layer-done"
+	ProgressLayerCached      = "layer-cached"
+	ProgressQuotaApplied     = "quota-applied"
+	ProgressMountDone        = "mount-done"
+)
+
+// ProgressEvent is reported while an image is created. Only the fields that
+// make sense for the event are set.
+type ProgressEvent struct {
+	Event          string `json:"event"`
+	ManifestDigest string `json:"manifest_digest,omitempty"`
+	Layers         int    `json:"layers,omitempty"`
+	BlobID         string `json:"blob_id,omitempty"`
+	ChainID        string `json:"chain_id,omitempty"`
+	// Bytes is how much of the layer has been read so far, out of Total.
+	Bytes     int64 `json:"bytes,omitempty"`
+	Total     int64 `json:"total,omitempty"`
+	DiskLimit int64 `json:"disk_limit,omitempty"`
+}
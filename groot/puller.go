@@ -0,0 +1,111 @@
+package groot
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	errorspkg "github.com/pkg/errors"
+)
+
+const BaseImageReferenceFormat = "baseimage:%s"
+
+type PullSpec struct {
+	BaseImageURL *url.URL
+	// Retention is how long the pulled layers are kept after the last pull.
+	// When it is zero they are kept until the image is unpulled.
+	Retention       time.Duration
+	UIDMappings     []IDMappingSpec
+	GIDMappings     []IDMappingSpec
+	AdmissionPolicy AdmissionPolicy
+}
+
+type Puller struct {
+	baseImagePuller   BaseImagePuller
+	locksmith         Locksmith
+	dependencyManager DependencyManager
+	metricsEmitter    MetricsEmitter
+}
+
+func IamPuller(baseImagePuller BaseImagePuller, locksmith Locksmith, dependencyManager DependencyManager, metricsEmitter MetricsEmitter) *Puller {
+	return &Puller{
+		baseImagePuller:   baseImagePuller,
+		locksmith:         locksmith,
+		dependencyManager: dependencyManager,
+		metricsEmitter:    metricsEmitter,
+	}
+}
+
+func (p *Puller) Pull(logger lager.Logger, spec PullSpec) (BaseImage, error) {
+	defer p.metricsEmitter.TryEmitDurationFrom(logger, MetricImagePullTime, time.Now())
+
+	logger = logger.Session("groot-pulling", lager.Data{"spec": spec})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	if err := spec.AdmissionPolicy.AdmitURL(spec.BaseImageURL); err != nil {
+		logger.Error("admitting-image-failed", err)
+		return BaseImage{}, err
+	}
+
+	ownerUid, ownerGid := parseOwner(spec.UIDMappings, spec.GIDMappings)
+	baseImageSpec := BaseImageSpec{
+		BaseImageSrc:    spec.BaseImageURL,
+		UIDMappings:     spec.UIDMappings,
+		GIDMappings:     spec.GIDMappings,
+		OwnerUID:        ownerUid,
+		OwnerGID:        ownerGid,
+		AdmissionPolicy: spec.AdmissionPolicy,
+	}
+
+	lockFile, err := p.locksmith.Lock(GlobalLockKey)
+	if err != nil {
+		return BaseImage{}, err
+	}
+	defer func() {
+		if err := p.locksmith.Unlock(lockFile); err != nil {
+			logger.Error("failed-to-unlock", err)
+		}
+	}()
+
+	baseImage, err := p.baseImagePuller.Pull(logger, baseImageSpec)
+	if err != nil {
+		return BaseImage{}, errorspkg.Wrap(err, "pulling the image")
+	}
+
+	var retainUntil time.Time
+	if spec.Retention > 0 {
+		retainUntil = time.Now().Add(spec.Retention)
+	}
+
+	baseImageRefName := fmt.Sprintf(BaseImageReferenceFormat, spec.BaseImageURL.String())
+	if err := p.dependencyManager.Retain(baseImageRefName, retainUntil); err != nil {
+		return BaseImage{}, errorspkg.Wrap(err, "retaining the image")
+	}
+
+	return baseImage, nil
+}
+
+func (p *Puller) Unpull(logger lager.Logger, baseImageURL *url.URL) error {
+	logger = logger.Session("groot-unpulling", lager.Data{"baseImageURL": baseImageURL.String()})
+	logger.Info("starting")
+	defer logger.Info("ending")
+
+	lockFile, err := p.locksmith.Lock(GlobalLockKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := p.locksmith.Unlock(lockFile); err != nil {
+			logger.Error("failed-to-unlock", err)
+		}
+	}()
+
+	baseImageRefName := fmt.Sprintf(BaseImageReferenceFormat, baseImageURL.String())
+	if err := p.dependencyManager.Release(baseImageRefName); err != nil {
+		return errorspkg.Wrap(err, "releasing the image")
+	}
+
+	return nil
+}
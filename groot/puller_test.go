@@ -0,0 +1,236 @@
+package groot_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/groot/grootfakes"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Puller", func() {
+	var (
+		baseImageUrl          *url.URL
+		fakeBaseImagePuller   *grootfakes.FakeBaseImagePuller
+		fakeLocksmith         *grootfakes.FakeLocksmith
+		fakeDependencyManager *grootfakes.FakeDependencyManager
+		fakeMetricsEmitter    *grootfakes.FakeMetricsEmitter
+		lockFile              *os.File
+
+		puller *groot.Puller
+		logger lager.Logger
+	)
+
+	BeforeEach(func() {
+		baseImageUrl, _ = url.Parse("docker:///cfgarden/empty")
+
+		fakeBaseImagePuller = new(grootfakes.FakeBaseImagePuller)
+		fakeLocksmith = new(grootfakes.FakeLocksmith)
+		fakeDependencyManager = new(grootfakes.FakeDependencyManager)
+		fakeMetricsEmitter = new(grootfakes.FakeMetricsEmitter)
+
+		var err error
+		lockFile, err = ioutil.TempFile("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeLocksmith.LockReturns(lockFile, nil)
+
+		logger = lagertest.NewTestLogger("puller")
+
+		puller = groot.IamPuller(fakeBaseImagePuller, fakeLocksmith, fakeDependencyManager, fakeMetricsEmitter)
+	})
+
+	AfterEach(func() {
+		Expect(os.Remove(lockFile.Name())).To(Succeed())
+	})
+
+	Describe("Pull", func() {
+		It("pulls the image under the global lock", func() {
+			_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLocksmith.LockCallCount()).To(Equal(1))
+			Expect(fakeLocksmith.LockArgsForCall(0)).To(Equal(groot.GlobalLockKey))
+			Expect(fakeBaseImagePuller.PullCallCount()).To(Equal(1))
+			Expect(fakeLocksmith.UnlockCallCount()).To(Equal(1))
+			Expect(fakeLocksmith.UnlockArgsForCall(0)).To(Equal(lockFile))
+		})
+
+		It("pulls the image with the given mappings", func() {
+			uidMappings := []groot.IDMappingSpec{{HostID: 50, NamespaceID: 0, Size: 1}}
+			gidMappings := []groot.IDMappingSpec{{HostID: 60, NamespaceID: 0, Size: 1}}
+
+			_, err := puller.Pull(logger, groot.PullSpec{
+				BaseImageURL: baseImageUrl,
+				UIDMappings:  uidMappings,
+				GIDMappings:  gidMappings,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, baseImageSpec := fakeBaseImagePuller.PullArgsForCall(0)
+			Expect(baseImageSpec).To(Equal(groot.BaseImageSpec{
+				BaseImageSrc: baseImageUrl,
+				UIDMappings:  uidMappings,
+				GIDMappings:  gidMappings,
+				OwnerUID:     50,
+				OwnerGID:     60,
+			}))
+		})
+
+		It("returns the base image", func() {
+			fakeBaseImagePuller.PullReturns(groot.BaseImage{ChainIDs: []string{"id-1", "id-2"}}, nil)
+
+			baseImage, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(baseImage.ChainIDs).To(Equal([]string{"id-1", "id-2"}))
+		})
+
+		It("retains the base image until it is unpulled", func() {
+			_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeDependencyManager.RetainCallCount()).To(Equal(1))
+			id, until := fakeDependencyManager.RetainArgsForCall(0)
+			Expect(id).To(Equal("baseimage:docker:///cfgarden/empty"))
+			Expect(until.IsZero()).To(BeTrue())
+		})
+
+		It("emits metrics for pulling", func() {
+			_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeMetricsEmitter.TryEmitDurationFromCallCount()).To(Equal(1))
+			_, name, start := fakeMetricsEmitter.TryEmitDurationFromArgsForCall(0)
+			Expect(name).To(Equal(groot.MetricImagePullTime))
+			Expect(start).NotTo(BeZero())
+		})
+
+		Context("when a retention is given", func() {
+			It("retains the base image for that long", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{
+					BaseImageURL: baseImageUrl,
+					Retention:    time.Hour,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, until := fakeDependencyManager.RetainArgsForCall(0)
+				Expect(until).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			})
+		})
+
+		Context("when an admission policy is given", func() {
+			var admissionPolicy groot.AdmissionPolicy
+
+			BeforeEach(func() {
+				admissionPolicy = groot.AdmissionPolicy{
+					AllowedRepositories: []string{"cfgarden/*"},
+					MaxLayers:           10,
+				}
+			})
+
+			It("passes the policy to the base image puller", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{
+					BaseImageURL:    baseImageUrl,
+					AdmissionPolicy: admissionPolicy,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, baseImageSpec := fakeBaseImagePuller.PullArgsForCall(0)
+				Expect(baseImageSpec.AdmissionPolicy).To(Equal(admissionPolicy))
+			})
+
+			Context("when the image URL violates the policy", func() {
+				It("returns a policy violation error without pulling the image", func() {
+					otherImageURL, err := url.Parse("docker:///my-org/app")
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = puller.Pull(logger, groot.PullSpec{
+						BaseImageURL:    otherImageURL,
+						AdmissionPolicy: admissionPolicy,
+					})
+					Expect(err).To(MatchError("image rejected by the admission policy: repository `my-org/app` is not allowed"))
+					Expect(err).To(BeAssignableToTypeOf(&groot.PolicyViolationError{}))
+
+					Expect(fakeLocksmith.LockCallCount()).To(Equal(0))
+					Expect(fakeBaseImagePuller.PullCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when acquiring the lock fails", func() {
+			BeforeEach(func() {
+				fakeLocksmith.LockReturns(nil, errors.New("failed to lock"))
+			})
+
+			It("returns an error without pulling", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+				Expect(err).To(MatchError(ContainSubstring("failed to lock")))
+				Expect(fakeBaseImagePuller.PullCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when pulling the image fails", func() {
+			BeforeEach(func() {
+				fakeBaseImagePuller.PullReturns(groot.BaseImage{}, errors.New("failed to pull"))
+			})
+
+			It("returns an error", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+				Expect(err).To(MatchError(ContainSubstring("failed to pull")))
+			})
+
+			It("does not retain the image", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+				Expect(err).To(HaveOccurred())
+				Expect(fakeDependencyManager.RetainCallCount()).To(Equal(0))
+			})
+
+			It("releases the global lock", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+				Expect(err).To(HaveOccurred())
+				Expect(fakeLocksmith.UnlockCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when retaining the image fails", func() {
+			BeforeEach(func() {
+				fakeDependencyManager.RetainReturns(errors.New("failed to retain"))
+			})
+
+			It("returns an error", func() {
+				_, err := puller.Pull(logger, groot.PullSpec{BaseImageURL: baseImageUrl})
+				Expect(err).To(MatchError(ContainSubstring("failed to retain")))
+			})
+		})
+	})
+
+	Describe("Unpull", func() {
+		It("releases the base image under the global lock", func() {
+			Expect(puller.Unpull(logger, baseImageUrl)).To(Succeed())
+
+			Expect(fakeLocksmith.LockCallCount()).To(Equal(1))
+			Expect(fakeLocksmith.LockArgsForCall(0)).To(Equal(groot.GlobalLockKey))
+			Expect(fakeDependencyManager.ReleaseCallCount()).To(Equal(1))
+			Expect(fakeDependencyManager.ReleaseArgsForCall(0)).To(Equal("baseimage:docker:///cfgarden/empty"))
+			Expect(fakeLocksmith.UnlockCallCount()).To(Equal(1))
+		})
+
+		Context("when releasing the image fails", func() {
+			BeforeEach(func() {
+				fakeDependencyManager.ReleaseReturns(errors.New("image not found"))
+			})
+
+			It("returns an error", func() {
+				Expect(puller.Unpull(logger, baseImageUrl)).To(MatchError(ContainSubstring("image not found")))
+			})
+		})
+	})
+})
@@ -31,6 +31,14 @@ func NewStoreNamespacer(storePath string) *StoreNamespacer {
 }
 
 func (n *StoreNamespacer) ApplyMappings(uidMappings, gidMappings []IDMappingSpec) error {
+	if _, err := NewIDMap(uidMappings); err != nil {
+		return errorspkg.Errorf("invalid uid mappings: %s", err)
+	}
+
+	if _, err := NewIDMap(gidMappings); err != nil {
+		return errorspkg.Errorf("invalid gid mappings: %s", err)
+	}
+
 	namespaceFilePath := n.namespaceFilePath()
 
 	_, err := os.Stat(namespaceFilePath)
@@ -116,7 +124,7 @@ func (n *StoreNamespacer) namespaceFilePath() string {
 func (n *StoreNamespacer) normalizeMappings(mappings []IDMappingSpec) []string {
 	stringMappings := []string{}
 	for _, mapping := range mappings {
-		stringMappings = append(stringMappings, fmt.Sprintf("%d:%d:%d", mapping.NamespaceID, mapping.HostID, mapping.Size))
+		stringMappings = append(stringMappings, mapping.String())
 	}
 
 	sort.Strings(stringMappings)
@@ -224,5 +224,32 @@ var _ = Describe("StoreNamespacer", func() {
 				Expect(err).To(MatchError(ContainSubstring("creating namespace file")))
 			})
 		})
+
+		Context("when the uid mappings overlap", func() {
+			BeforeEach(func() {
+				uidMappings = append(uidMappings, groot.IDMappingSpec{HostID: 300000, NamespaceID: 5, Size: 10})
+			})
+
+			It("returns an error", func() {
+				err := storeNamespacer.ApplyMappings(uidMappings, gidMappings)
+				Expect(err).To(MatchError(ContainSubstring("invalid uid mappings")))
+			})
+
+			It("does not write the namespace file", func() {
+				Expect(storeNamespacer.ApplyMappings(uidMappings, gidMappings)).NotTo(Succeed())
+				Expect(filepath.Join(storePath, store.MetaDirName, "namespace.json")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when the gid mappings leave a gap", func() {
+			BeforeEach(func() {
+				gidMappings[0].NamespaceID = 2
+			})
+
+			It("returns an error", func() {
+				err := storeNamespacer.ApplyMappings(uidMappings, gidMappings)
+				Expect(err).To(MatchError(ContainSubstring("invalid gid mappings")))
+			})
+		})
 	})
 })
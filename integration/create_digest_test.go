@@ -0,0 +1,132 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with manifest digests", func() {
+	const manifestDigestAnnotation = "org.cloudfoundry.experimental.image.manifest-digest"
+
+	var randomImageID string
+
+	BeforeEach(func() {
+		randomImageID = testhelpers.NewRandomID()
+	})
+
+	readDependencies := func(id string) map[string]interface{} {
+		escapedID := strings.Replace(id, "/", "__", -1)
+		contents, err := ioutil.ReadFile(filepath.Join(StorePath, store.MetaDirName, "dependencies", fmt.Sprintf("%s.json", escapedID)))
+		Expect(err).NotTo(HaveOccurred())
+
+		var dependencies map[string]interface{}
+		Expect(json.Unmarshal(contents, &dependencies)).To(Succeed())
+		return dependencies
+	}
+
+	Context("when the image is referenced by tag", func() {
+		It("records the digest the tag resolved to", func() {
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///cfgarden/empty:v0.1.1"),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			manifestDigest := containerSpec.Annotations[manifestDigestAnnotation]
+			Expect(manifestDigest).To(HavePrefix("sha256:"))
+
+			Expect(readDependencies("image:" + randomImageID)).To(HaveKeyWithValue("manifest_digest", manifestDigest))
+			Expect(readDependencies("baseimage:docker:///cfgarden/empty:v0.1.1")).To(HaveKeyWithValue("manifest_digest", manifestDigest))
+		})
+	})
+
+	Context("when the image is pinned to a digest", func() {
+		var manifestDigest string
+
+		BeforeEach(func() {
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///cfgarden/empty:v0.1.1"),
+				ID:           testhelpers.NewRandomID(),
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			manifestDigest = containerSpec.Annotations[manifestDigestAnnotation]
+		})
+
+		It("creates a root filesystem from the pinned manifest", func() {
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///cfgarden/empty@" + manifestDigest),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+			Expect(containerSpec.Root.Path).To(BeADirectory())
+
+			Expect(containerSpec.Annotations).To(HaveKeyWithValue(manifestDigestAnnotation, manifestDigest))
+			Expect(readDependencies("image:" + randomImageID)).To(HaveKeyWithValue("manifest_digest", manifestDigest))
+		})
+
+		Context("when the digest does not exist", func() {
+			It("fails", func() {
+				_, err := Runner.Create(groot.CreateSpec{
+					BaseImageURL: integration.String2URL("docker:///cfgarden/empty@sha256:1111111111111111111111111111111111111111111111111111111111111111"),
+					ID:           randomImageID,
+					Mount:        mountByDefault(),
+				})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when the image is an OCI image", func() {
+		It("records the digest of its manifest", func() {
+			workDir, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/opq-whiteouts-busybox:latest", workDir)),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(containerSpec.Annotations).To(HaveKeyWithValue(manifestDigestAnnotation, "sha256:9c90ae0cffa9d1426e83a516183f0267e03edbb765efc5fb0c0dccc8edca4f15"))
+		})
+	})
+
+	Context("when the image is a local tarball", func() {
+		It("does not record a manifest digest", func() {
+			sourceImagePath, err := ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(sourceImagePath)
+			Expect(ioutil.WriteFile(filepath.Join(sourceImagePath, "foo"), []byte("hello-world"), 0644)).To(Succeed())
+
+			baseImageFile := integration.CreateBaseImageTar(sourceImagePath)
+			defer os.Remove(baseImageFile.Name())
+
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL(baseImageFile.Name()),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(containerSpec.Annotations).NotTo(HaveKey(manifestDigestAnnotation))
+			Expect(readDependencies("image:" + randomImageID)).NotTo(HaveKey("manifest_digest"))
+		})
+	})
+})
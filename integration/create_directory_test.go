@@ -0,0 +1,129 @@
+package integration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/fetcher/tar_fetcher"
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with local directory images", func() {
+	var (
+		randomImageID   string
+		sourceImagePath string
+		spec            groot.CreateSpec
+	)
+
+	BeforeEach(func() {
+		var err error
+		sourceImagePath, err = ioutil.TempDir("", "local-image-dir")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(path.Join(sourceImagePath, "foo"), []byte("hello-world"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(path.Join(sourceImagePath, "permissive-folder"), 0777)).To(Succeed())
+
+		// we need to explicitly apply perms because mkdir is subject to umask
+		Expect(os.Chmod(path.Join(sourceImagePath, "permissive-folder"), 0777)).To(Succeed())
+		Expect(os.Symlink("foo", path.Join(sourceImagePath, "foo-link"))).To(Succeed())
+
+		randomImageID = testhelpers.NewRandomID()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(sourceImagePath)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		spec = groot.CreateSpec{
+			BaseImageURL: integration.String2URL(sourceImagePath),
+			ID:           randomImageID,
+			Mount:        mountByDefault(),
+		}
+	})
+
+	It("creates a root filesystem", func() {
+		containerSpec, err := Runner.Create(spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+		fooContents, err := ioutil.ReadFile(path.Join(containerSpec.Root.Path, "foo"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(fooContents)).To(Equal("hello-world"))
+
+		linkTarget, err := os.Readlink(path.Join(containerSpec.Root.Path, "foo-link"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(linkTarget).To(Equal("foo"))
+	})
+
+	It("keeps folders original permissions", func() {
+		containerSpec, err := Runner.Create(spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+		stat, err := os.Stat(path.Join(containerSpec.Root.Path, "permissive-folder"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0777)))
+	})
+
+	It("creates a volume that is collected like local tar volumes", func() {
+		_, err := Runner.Create(spec)
+		Expect(err).NotTo(HaveOccurred())
+
+		volumes, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes).To(HaveLen(1))
+		Expect(tar_fetcher.IsLocalTarVolume(volumes[0].Name())).To(BeTrue())
+	})
+
+	Context("when the directory content changes", func() {
+		JustBeforeEach(func() {
+			_, err := Runner.Create(spec)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("uses the new content for the new image", func() {
+			time.Sleep(time.Millisecond * 10)
+			Expect(ioutil.WriteFile(path.Join(sourceImagePath, "permissive-folder", "bar"), []byte("this-is-a-bar-content"), 0644)).To(Succeed())
+
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				ID:           testhelpers.NewRandomID(),
+				BaseImageURL: integration.String2URL(sourceImagePath),
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+			Expect(path.Join(containerSpec.Root.Path, "permissive-folder", "bar")).To(BeARegularFile())
+
+			volumes, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(HaveLen(2))
+		})
+
+		It("cleans up the outdated volume on create", func() {
+			Expect(Runner.Delete(randomImageID)).To(Succeed())
+			time.Sleep(time.Millisecond * 10)
+			Expect(ioutil.WriteFile(path.Join(sourceImagePath, "bar"), []byte("this-is-a-bar-content"), 0644)).To(Succeed())
+
+			_, err := Runner.WithClean().Create(groot.CreateSpec{
+				ID:           testhelpers.NewRandomID(),
+				BaseImageURL: integration.String2URL(sourceImagePath),
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			volumes, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(HaveLen(1))
+		})
+	})
+})
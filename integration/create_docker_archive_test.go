@@ -0,0 +1,117 @@
+package integration_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with docker archives", func() {
+	var (
+		randomImageID string
+		baseImageURL  *url.URL
+		workDir       string
+	)
+
+	BeforeEach(func() {
+		integration.SkipIfNonRoot(GrootfsTestUid)
+
+		var err error
+		workDir, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		baseImageURL = integration.String2URL(fmt.Sprintf("docker-archive:///%s/assets/docker-archive-test-image/pokemon.tar", workDir))
+		randomImageID = testhelpers.NewRandomID()
+	})
+
+	It("creates a root filesystem based on the image provided", func() {
+		containerSpec, err := Runner.Create(groot.CreateSpec{
+			BaseImageURL: baseImageURL,
+			ID:           randomImageID,
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+		filePath := path.Join(containerSpec.Root.Path, "pokemon.txt")
+		Expect(strings.TrimSpace(readFile(filePath))).To(Equal("pikachu"))
+	})
+
+	It("shares the layers with the same image pulled from elsewhere", func() {
+		_, err := Runner.Create(groot.CreateSpec{
+			BaseImageURL: baseImageURL,
+			ID:           randomImageID,
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Runner.Create(groot.CreateSpec{
+			BaseImageURL: integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/gzip-layer:latest", workDir)),
+			ID:           testhelpers.NewRandomID(),
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumes, err := filepath.Glob(filepath.Join(StorePath, store.VolumesDirName, "*"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes).To(ConsistOf(filepath.Join(StorePath, store.VolumesDirName, "4372714419f59eab13d32f4191c3e724bba0b8242182be59d3797b8b42af9cc3")))
+	})
+
+	Context("when the tag is in the archive", func() {
+		BeforeEach(func() {
+			baseImageURL = integration.String2URL(fmt.Sprintf("docker-archive:///%s/assets/docker-archive-test-image/pokemon.tar:grootfs/pokemon:latest", workDir))
+		})
+
+		It("creates a root filesystem based on the tagged image", func() {
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			filePath := path.Join(containerSpec.Root.Path, "pokemon.txt")
+			Expect(strings.TrimSpace(readFile(filePath))).To(Equal("pikachu"))
+		})
+	})
+
+	Context("when the tag is not in the archive", func() {
+		BeforeEach(func() {
+			baseImageURL = integration.String2URL(fmt.Sprintf("docker-archive:///%s/assets/docker-archive-test-image/pokemon.tar:grootfs/digimon:latest", workDir))
+		})
+
+		It("returns an error", func() {
+			_, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(MatchError(ContainSubstring("tag `grootfs/digimon:latest` not found in docker archive")))
+		})
+	})
+
+	Context("when the archive does not exist", func() {
+		BeforeEach(func() {
+			baseImageURL = integration.String2URL("docker-archive:///not/a/real/archive.tar")
+		})
+
+		It("returns an error", func() {
+			_, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
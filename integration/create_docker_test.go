@@ -1,7 +1,11 @@
 package integration_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
@@ -447,6 +451,56 @@ var _ = Describe("Create with remote DOCKER images", func() {
 				})
 			})
 
+			Context("when the credentials come from an auth file", func() {
+				var authDir string
+
+				BeforeEach(func() {
+					var err error
+					authDir, err = ioutil.TempDir("", "auth-file")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(os.Chmod(authDir, 0755)).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.RemoveAll(authDir)).To(Succeed())
+				})
+
+				Context("and the file has an inline auth entry", func() {
+					It("succeeds", func() {
+						auth := base64.StdEncoding.EncodeToString([]byte(RegistryUsername + ":" + RegistryPassword))
+						authFile := filepath.Join(authDir, "config.json")
+						Expect(ioutil.WriteFile(authFile, []byte(fmt.Sprintf(`{"auths":{"https://index.docker.io/v1/":{"auth":"%s"}}}`, auth)), 0644)).To(Succeed())
+
+						containerSpec, err := runner.WithAuthFile(authFile).Create(groot.CreateSpec{
+							BaseImageURL: baseImageURL,
+							ID:           randomImageID,
+							Mount:        mountByDefault(),
+						})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(runner.EnsureMounted(containerSpec)).To(Succeed())
+					})
+				})
+
+				Context("and the file points to a credential helper", func() {
+					It("uses the helper to get the credentials", func() {
+						helperScript := fmt.Sprintf("#!/bin/sh\ncat > /dev/null\necho '{\"Username\":\"%s\",\"Secret\":\"%s\"}'\n", RegistryUsername, RegistryPassword)
+						Expect(ioutil.WriteFile(filepath.Join(authDir, "docker-credential-fake"), []byte(helperScript), 0755)).To(Succeed())
+						authFile := filepath.Join(authDir, "config.json")
+						Expect(ioutil.WriteFile(authFile, []byte(`{"credHelpers":{"docker.io":"fake"}}`), 0644)).To(Succeed())
+
+						containerSpec, err := runner.WithAuthFile(authFile).
+							WithEnvVar("PATH=" + authDir + ":" + os.Getenv("PATH")).
+							Create(groot.CreateSpec{
+								BaseImageURL: baseImageURL,
+								ID:           randomImageID,
+								Mount:        mountByDefault(),
+							})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(runner.EnsureMounted(containerSpec)).To(Succeed())
+					})
+				})
+			})
+
 			It("does not log the credentials OR their references", func() {
 				buffer := gbytes.NewBuffer()
 				runner := runner.WithCredentials(RegistryUsername, RegistryPassword).WithStderr(buffer).WithLogLevel(lager.DEBUG)
@@ -561,6 +615,45 @@ var _ = Describe("Create with remote DOCKER images", func() {
 					})
 				})
 
+				Context("when layers are streamed", func() {
+					BeforeEach(func() {
+						volumesDir = filepath.Join(StorePath, store.VolumesDirName)
+						dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+						Expect(err).NotTo(HaveOccurred())
+						fakeRegistry = testhelpers.NewFakeRegistry(dockerHubUrl)
+						corruptedBlob = testhelpers.EmptyBaseImageV011.Layers[1].BlobID
+						fakeRegistry.WhenGettingBlob(corruptedBlob, 0, func(w http.ResponseWriter, r *http.Request) {
+							// a valid layer that does not match the digest, so that it
+							// is only caught after being unpacked
+							_, err := w.Write(gzippedTar("tampered-file"))
+							Expect(err).NotTo(HaveOccurred())
+						})
+						fakeRegistry.Start()
+						baseImageURL = integration.String2URL(fmt.Sprintf("docker://%s/cfgarden/empty:v0.1.1", fakeRegistry.Addr()))
+					})
+
+					It("fails and does not leave the incomplete volume behind", func() {
+						runner := runner.WithInsecureRegistry(fakeRegistry.Addr()).WithStreamLayers()
+
+						_, err := runner.Create(groot.CreateSpec{
+							BaseImageURL: baseImageURL,
+							ID:           randomImageID,
+							Mount:        mountByDefault(),
+						})
+
+						Expect(err).To(MatchError(ContainSubstring("layer is corrupted")))
+
+						volumes, _ := ioutil.ReadDir(volumesDir)
+						Expect(len(volumes)).To(Equal(len(testhelpers.EmptyBaseImageV011.Layers) - 1))
+						for _, volume := range volumes {
+							Expect(volume.Name()).NotTo(ContainSubstring("incomplete"))
+						}
+
+						Expect(filepath.Join(volumesDir, testhelpers.EmptyBaseImageV011.Layers[0].ChainID)).To(BeADirectory())
+						Expect(filepath.Join(volumesDir, testhelpers.EmptyBaseImageV011.Layers[1].ChainID)).ToNot(BeADirectory())
+					})
+				})
+
 				Context("when the image has a version 1 manifest schema", func() {
 					BeforeEach(func() {
 						dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
@@ -593,6 +686,20 @@ var _ = Describe("Create with remote DOCKER images", func() {
 			})
 		})
 
+		Context("when layers are streamed", func() {
+			It("creates a root filesystem", func() {
+				containerSpec, err := runner.WithStreamLayers().Create(groot.CreateSpec{
+					BaseImageURL: baseImageURL,
+					ID:           randomImageID,
+					Mount:        mountByDefault(),
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(runner.EnsureMounted(containerSpec)).To(Succeed())
+
+				Expect(path.Join(containerSpec.Root.Path, "hello")).To(BeARegularFile())
+			})
+		})
+
 		Context("when the image has a version 1 manifest schema", func() {
 			BeforeEach(func() {
 				baseImageURL = integration.String2URL("docker:///cfgarden/empty:schemaV1")
@@ -803,3 +910,13 @@ var _ = Describe("Create with remote DOCKER images", func() {
 		})
 	})
 })
+
+func gzippedTar(fileName string) []byte {
+	buffer := bytes.NewBuffer([]byte{})
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	Expect(tarWriter.WriteHeader(&tar.Header{Name: fileName, Mode: 0644, Typeflag: tar.TypeReg})).To(Succeed())
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	return buffer.Bytes()
+}
@@ -0,0 +1,100 @@
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with OCI archives", func() {
+	var (
+		randomImageID string
+		baseImageURL  *url.URL
+		workDir       string
+		archiveDir    string
+		archivePath   string
+	)
+
+	BeforeEach(func() {
+		integration.SkipIfNonRoot(GrootfsTestUid)
+
+		var err error
+		workDir, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+
+		archiveDir, err = ioutil.TempDir("", "oci-archive")
+		Expect(err).NotTo(HaveOccurred())
+		archivePath = filepath.Join(archiveDir, "gzip-layer.tar")
+		cmd := exec.Command("tar", "-C", filepath.Join(workDir, "assets/oci-test-image/gzip-layer"), "-cf", archivePath, ".")
+		output, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+
+		baseImageURL = integration.String2URL(fmt.Sprintf("oci-archive://%s:latest", archivePath))
+		randomImageID = testhelpers.NewRandomID()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(archiveDir)).To(Succeed())
+	})
+
+	It("creates a root filesystem based on the image provided", func() {
+		containerSpec, err := Runner.Create(groot.CreateSpec{
+			BaseImageURL: baseImageURL,
+			ID:           randomImageID,
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+		filePath := path.Join(containerSpec.Root.Path, "pokemon.txt")
+		Expect(strings.TrimSpace(readFile(filePath))).To(Equal("pikachu"))
+	})
+
+	It("shares the layers with the same image from an OCI layout directory", func() {
+		_, err := Runner.Create(groot.CreateSpec{
+			BaseImageURL: baseImageURL,
+			ID:           randomImageID,
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Runner.Create(groot.CreateSpec{
+			BaseImageURL: integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/gzip-layer:latest", workDir)),
+			ID:           testhelpers.NewRandomID(),
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumes, err := filepath.Glob(filepath.Join(StorePath, store.VolumesDirName, "*"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes).To(HaveLen(1))
+	})
+
+	Context("when the reference is not in the archive", func() {
+		BeforeEach(func() {
+			baseImageURL = integration.String2URL(fmt.Sprintf("oci-archive://%s:non-existing", archivePath))
+		})
+
+		It("returns an error", func() {
+			_, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(MatchError(ContainSubstring("reference `non-existing` not found in oci archive")))
+		})
+	})
+})
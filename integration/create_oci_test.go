@@ -383,6 +383,60 @@ var _ = Describe("Create with OCI images", func() {
 		})
 	})
 
+	Context("when a layer is a gzip compressed blob", func() {
+		BeforeEach(func() {
+			integration.SkipIfNonRoot(GrootfsTestUid)
+			baseImageURL = integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/gzip-layer:latest", workDir))
+		})
+
+		It("is readable after image creation", func() {
+			containerSpec, err := runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			filePath := path.Join(containerSpec.Root.Path, "pokemon.txt")
+			Expect(strings.TrimSpace(readFile(filePath))).To(Equal("pikachu"))
+		})
+	})
+
+	Context("when a layer is a zstd compressed blob", func() {
+		BeforeEach(func() {
+			integration.SkipIfNonRoot(GrootfsTestUid)
+			baseImageURL = integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/zstd-layer:latest", workDir))
+		})
+
+		It("is readable after image creation", func() {
+			containerSpec, err := runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			filePath := path.Join(containerSpec.Root.Path, "pokemon.txt")
+			Expect(strings.TrimSpace(readFile(filePath))).To(Equal("pikachu"))
+		})
+	})
+
+	Context("when a layer is a zstd compressed blob without a media type", func() {
+		BeforeEach(func() {
+			integration.SkipIfNonRoot(GrootfsTestUid)
+			baseImageURL = integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/zstd-layer-without-media-type:latest", workDir))
+		})
+
+		It("is readable after image creation", func() {
+			containerSpec, err := runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			filePath := path.Join(containerSpec.Root.Path, "pokemon.txt")
+			Expect(strings.TrimSpace(readFile(filePath))).To(Equal("pikachu"))
+		})
+	})
+
 	Context("when the image has files that are not writable to their owner", func() {
 		BeforeEach(func() {
 			baseImageURL = integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/non-writable-file:latest", workDir))
@@ -421,6 +475,68 @@ var _ = Describe("Create with OCI images", func() {
 		})
 	})
 
+	Context("when the image is a multi-arch index", func() {
+		BeforeEach(func() {
+			baseImageURL = integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/multi-arch:latest", workDir))
+		})
+
+		It("creates the image for the host platform", func() {
+			containerSpec, err := runner.Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+			Expect(path.Join(containerSpec.Root.Path, "hello")).To(BeARegularFile())
+		})
+
+		Context("when --platform is set", func() {
+			It("creates the image for the requested platform", func() {
+				containerSpec, err := runner.WithPlatform("linux/arm64/v8").Create(groot.CreateSpec{
+					BaseImageURL: baseImageURL,
+					ID:           randomImageID,
+					Mount:        mountByDefault(),
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+			})
+
+			Context("and the index has no image for it", func() {
+				It("fails", func() {
+					_, err := runner.WithPlatform("linux/s390x").Create(groot.CreateSpec{
+						BaseImageURL: baseImageURL,
+						ID:           randomImageID,
+						Mount:        mountByDefault(),
+					})
+					Expect(err).To(MatchError(ContainSubstring("no image found for platform `linux/s390x`")))
+				})
+			})
+		})
+
+		Context("when the tag points to an image for another architecture", func() {
+			It("fails", func() {
+				_, err := runner.WithPlatform("linux/amd64").Create(groot.CreateSpec{
+					BaseImageURL: integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/multi-arch:arm64", workDir)),
+					ID:           randomImageID,
+					Mount:        mountByDefault(),
+				})
+				Expect(err).To(MatchError(ContainSubstring("image architecture `arm64` does not match platform architecture `amd64`")))
+			})
+		})
+
+		Context("when --platform is invalid", func() {
+			It("fails", func() {
+				_, err := runner.WithPlatform("linux").Create(groot.CreateSpec{
+					BaseImageURL: baseImageURL,
+					ID:           randomImageID,
+					Mount:        mountByDefault(),
+				})
+				Expect(err).To(MatchError(ContainSubstring("invalid platform `linux`")))
+			})
+		})
+	})
+
 	Context("when --skip-layer-validation flag is passed", func() {
 		It("does not validate the checksums for oci image layers", func() {
 			containerSpec, err := runner.SkipLayerCheckSumValidation().Create(groot.CreateSpec{
@@ -0,0 +1,107 @@
+package integration_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with cached manifests", func() {
+	var (
+		fakeRegistry *testhelpers.FakeRegistry
+		baseImageURL *url.URL
+	)
+
+	BeforeEach(func() {
+		dockerHubUrl, err := url.Parse("https://registry-1.docker.io")
+		Expect(err).NotTo(HaveOccurred())
+		fakeRegistry = testhelpers.NewFakeRegistry(dockerHubUrl)
+		fakeRegistry.Start()
+
+		baseImageURL = integration.String2URL(fmt.Sprintf("docker://%s/cfgarden/empty:v0.1.1", fakeRegistry.Addr()))
+
+		_, err = Runner.WithInsecureRegistry(fakeRegistry.Addr()).Create(groot.CreateSpec{
+			BaseImageURL: baseImageURL,
+			ID:           testhelpers.NewRandomID(),
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		fakeRegistry.Stop()
+	})
+
+	Context("when the registry becomes unreachable", func() {
+		BeforeEach(func() {
+			fakeRegistry.Stop()
+		})
+
+		It("creates a root filesystem from the cached manifest", func() {
+			containerSpec, err := Runner.WithInsecureRegistry(fakeRegistry.Addr()).Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           testhelpers.NewRandomID(),
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+			Expect(path.Join(containerSpec.Root.Path, "hello")).To(BeARegularFile())
+		})
+
+		Context("when the image was never created", func() {
+			It("fails", func() {
+				_, err := Runner.WithInsecureRegistry(fakeRegistry.Addr()).Create(groot.CreateSpec{
+					BaseImageURL: integration.String2URL(fmt.Sprintf("docker://%s/cfgarden/empty:v0.1.0", fakeRegistry.Addr())),
+					ID:           testhelpers.NewRandomID(),
+					Mount:        mountByDefault(),
+				})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when offline", func() {
+		var manifestRequested bool
+
+		BeforeEach(func() {
+			manifestRequested = false
+			fakeRegistry.WhenGettingManifest("v0.1.1", func(w http.ResponseWriter, r *http.Request) {
+				manifestRequested = true
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+		})
+
+		It("creates a root filesystem without contacting the registry", func() {
+			containerSpec, err := Runner.WithInsecureRegistry(fakeRegistry.Addr()).WithOffline().Create(groot.CreateSpec{
+				BaseImageURL: baseImageURL,
+				ID:           testhelpers.NewRandomID(),
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+			Expect(path.Join(containerSpec.Root.Path, "hello")).To(BeARegularFile())
+			Expect(manifestRequested).To(BeFalse())
+		})
+
+		Context("when the image is not cached", func() {
+			It("fails", func() {
+				_, err := Runner.WithInsecureRegistry(fakeRegistry.Addr()).WithOffline().Create(groot.CreateSpec{
+					BaseImageURL: integration.String2URL(fmt.Sprintf("docker://%s/cfgarden/empty:v0.1.0", fakeRegistry.Addr())),
+					ID:           testhelpers.NewRandomID(),
+					Mount:        mountByDefault(),
+				})
+				Expect(err).To(MatchError(ContainSubstring("is not available offline")))
+			})
+		})
+	})
+})
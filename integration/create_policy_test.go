@@ -0,0 +1,109 @@
+package integration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/commands/config"
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+	yaml "gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Create with an admission policy", func() {
+	var (
+		configDir      string
+		configFilePath string
+		policy         config.Policy
+	)
+
+	BeforeEach(func() {
+		policy = config.Policy{}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		configDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(configDir, 0755)).To(Succeed())
+
+		configYaml, err := yaml.Marshal(config.Config{Policy: policy})
+		Expect(err).NotTo(HaveOccurred())
+		configFilePath = path.Join(configDir, "config.yaml")
+		Expect(ioutil.WriteFile(configFilePath, configYaml, 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(configDir)).To(Succeed())
+	})
+
+	startCreate := func(baseImage string) *gexec.Session {
+		sess, err := Runner.WithConfig(configFilePath).StartCreate(groot.CreateSpec{
+			BaseImageURL: integration.String2URL(baseImage),
+			ID:           testhelpers.NewRandomID(),
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return sess
+	}
+
+	Context("when the repository is allowed", func() {
+		BeforeEach(func() {
+			policy.AllowedRepositories = []string{"cfgarden/*"}
+		})
+
+		It("creates the image", func() {
+			sess := startCreate("docker:///cfgarden/empty:v0.1.1")
+			Eventually(sess, 60).Should(gexec.Exit(0))
+		})
+	})
+
+	Context("when the repository is denied", func() {
+		BeforeEach(func() {
+			policy.DeniedRepositories = []string{"cfgarden/*"}
+		})
+
+		It("fails with the policy violation exit code without pulling any layer", func() {
+			sess := startCreate("docker:///cfgarden/empty:v0.1.1")
+			Eventually(sess, 60).Should(gexec.Exit(3))
+			Expect(sess).To(gbytes.Say("image rejected by the admission policy: repository `cfgarden/empty` is denied"))
+
+			volumes, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(BeEmpty())
+		})
+	})
+
+	Context("when the image has too many layers", func() {
+		BeforeEach(func() {
+			policy.MaxLayers = 1
+		})
+
+		It("fails with the policy violation exit code", func() {
+			sess := startCreate("docker:///cfgarden/empty:v0.1.1")
+			Eventually(sess, 60).Should(gexec.Exit(3))
+			Expect(sess).To(gbytes.Say("image has 2 layers, the maximum is 1"))
+		})
+	})
+
+	Context("when the scheme is not allowed", func() {
+		BeforeEach(func() {
+			policy.AllowedSchemes = []string{"docker"}
+		})
+
+		It("fails with the policy violation exit code", func() {
+			sess := startCreate("/path/to/rootfs.tar")
+			Eventually(sess, 60).Should(gexec.Exit(3))
+			Expect(sess).To(gbytes.Say("scheme `tar` is not allowed"))
+		})
+	})
+})
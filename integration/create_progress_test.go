@@ -0,0 +1,100 @@
+package integration_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with progress reporting", func() {
+	var (
+		progressFile *os.File
+		createSpec   groot.CreateSpec
+	)
+
+	readEvents := func() []groot.ProgressEvent {
+		_, err := progressFile.Seek(0, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		events := []groot.ProgressEvent{}
+		scanner := bufio.NewScanner(progressFile)
+		for scanner.Scan() {
+			var event groot.ProgressEvent
+			Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+			events = append(events, event)
+		}
+		Expect(scanner.Err()).NotTo(HaveOccurred())
+
+		return events
+	}
+
+	eventNames := func(events []groot.ProgressEvent) []string {
+		names := []string{}
+		for _, event := range events {
+			names = append(names, event.Event)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		workDir, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+
+		progressFile, err = ioutil.TempFile("", "progress")
+		Expect(err).NotTo(HaveOccurred())
+
+		createSpec = groot.CreateSpec{
+			BaseImageURL: integration.String2URL(fmt.Sprintf("oci:///%s/assets/oci-test-image/opq-whiteouts-busybox:latest", workDir)),
+			ID:           testhelpers.NewRandomID(),
+			Mount:        mountByDefault(),
+			DiskLimit:    tenMegabytes,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(progressFile.Close()).To(Succeed())
+		Expect(os.Remove(progressFile.Name())).To(Succeed())
+	})
+
+	It("writes the progress of the create as JSON lines", func() {
+		_, err := Runner.WithProgressFile(progressFile).Create(createSpec)
+		Expect(err).NotTo(HaveOccurred())
+
+		events := readEvents()
+		Expect(events[0].Event).To(Equal(groot.ProgressManifestResolved))
+		Expect(events[0].Layers).To(Equal(2))
+		Expect(eventNames(events)).To(ContainElement(groot.ProgressLayerDownloading))
+		Expect(eventNames(events)).To(ContainElement(groot.ProgressLayerVerifying))
+		Expect(eventNames(events)).To(ContainElement(groot.ProgressLayerUnpacking))
+		Expect(eventNames(events)).To(ContainElement(groot.ProgressLayerDone))
+		Expect(eventNames(events)).To(ContainElement(groot.ProgressQuotaApplied))
+	})
+
+	It("reports the layers as cached when they are already in the store", func() {
+		_, err := Runner.Create(createSpec)
+		Expect(err).NotTo(HaveOccurred())
+
+		createSpec.ID = testhelpers.NewRandomID()
+		_, err = Runner.WithProgressFile(progressFile).Create(createSpec)
+		Expect(err).NotTo(HaveOccurred())
+
+		expectedEvents := []string{
+			groot.ProgressManifestResolved,
+			groot.ProgressLayerCached,
+			groot.ProgressQuotaApplied,
+		}
+		if createSpec.Mount {
+			expectedEvents = append(expectedEvents, groot.ProgressMountDone)
+		}
+		Expect(eventNames(readEvents())).To(Equal(expectedEvents))
+	})
+})
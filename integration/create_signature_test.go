@@ -0,0 +1,154 @@
+package integration_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Create with a trust policy", func() {
+	var (
+		randomImageID string
+		policyDir     string
+		policyPath    string
+		sigstorePath  string
+		keyPath       string
+	)
+
+	BeforeEach(func() {
+		var err error
+		policyDir, err = ioutil.TempDir("", "trust-policy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chmod(policyDir, 0755)).To(Succeed())
+
+		policyPath = filepath.Join(policyDir, "policy.json")
+		sigstorePath = filepath.Join(policyDir, "sigstore")
+		keyPath = filepath.Join(policyDir, "key.gpg")
+		testhelpers.NewSigningKey(keyPath)
+
+		policy := fmt.Sprintf(`{
+			"default": [{"type": "reject"}],
+			"transports": {
+				"docker": {
+					"docker.io/cfgarden": [{"type": "signedBy", "keyType": "GPGKeys", "keyPath": %q}],
+					"docker.io/cfgarden/garden-busybox": [{"type": "insecureAcceptAnything"}]
+				}
+			}
+		}`, keyPath)
+		Expect(ioutil.WriteFile(policyPath, []byte(policy), 0644)).To(Succeed())
+
+		randomImageID = testhelpers.NewRandomID()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(policyDir)).To(Succeed())
+	})
+
+	Context("when the image is not signed", func() {
+		It("fails without downloading any layer", func() {
+			_, err := Runner.WithTrustPolicy(policyPath).WithSigstore(sigstorePath).Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///cfgarden/empty:v0.1.1"),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(MatchError(ContainSubstring("image `docker.io/cfgarden/empty:v0.1.1` is not signed")))
+
+			volumes, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(BeEmpty())
+		})
+	})
+
+	Context("when the image is rejected by the default requirements", func() {
+		It("fails", func() {
+			_, err := Runner.WithTrustPolicy(policyPath).WithSigstore(sigstorePath).Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///busybox"),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(MatchError(ContainSubstring("image `docker.io/library/busybox:latest` is rejected by the trust policy")))
+		})
+	})
+
+	Context("when the policy accepts the image without a signature", func() {
+		It("creates the root filesystem", func() {
+			containerSpec, err := Runner.WithTrustPolicy(policyPath).WithSigstore(sigstorePath).Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///cfgarden/garden-busybox"),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+			Expect(filepath.Join(containerSpec.Root.Path, "bin")).To(BeADirectory())
+		})
+	})
+
+	Context("when the image does not come from a registry", func() {
+		var baseImageURL string
+
+		BeforeEach(func() {
+			workDir, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			baseImageURL = fmt.Sprintf("oci:///%s/assets/oci-test-image/opq-whiteouts-busybox:latest", workDir)
+		})
+
+		It("is rejected by the default requirements", func() {
+			_, err := Runner.WithTrustPolicy(policyPath).WithSigstore(sigstorePath).Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL(baseImageURL),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(MatchError(ContainSubstring("is rejected by the trust policy")))
+		})
+
+		Context("when the policy accepts its path", func() {
+			BeforeEach(func() {
+				workDir, err := os.Getwd()
+				Expect(err).NotTo(HaveOccurred())
+
+				policy := fmt.Sprintf(`{
+					"default": [{"type": "reject"}],
+					"transports": {
+						"oci": {
+							%q: [{"type": "insecureAcceptAnything"}]
+						}
+					}
+				}`, filepath.Join(workDir, "assets"))
+				Expect(ioutil.WriteFile(policyPath, []byte(policy), 0644)).To(Succeed())
+			})
+
+			It("creates the root filesystem", func() {
+				_, err := Runner.WithTrustPolicy(policyPath).WithSigstore(sigstorePath).Create(groot.CreateSpec{
+					BaseImageURL: integration.String2URL(baseImageURL),
+					ID:           randomImageID,
+					Mount:        mountByDefault(),
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when the trust policy is invalid", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(policyPath, []byte(`{"default": []}`), 0644)).To(Succeed())
+		})
+
+		It("fails", func() {
+			_, err := Runner.WithTrustPolicy(policyPath).Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL("docker:///cfgarden/empty:v0.1.1"),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid trust policy")))
+		})
+	})
+})
@@ -207,19 +207,6 @@ var _ = Describe("Create with local TAR images", func() {
 		})
 	})
 
-	Context("when the provided base image is a directory", func() {
-		It("returns a sensible error", func() {
-			tempDir, err := ioutil.TempDir("", "")
-			Expect(err).NotTo(HaveOccurred())
-			_, err = Runner.Create(groot.CreateSpec{
-				ID:           randomImageID,
-				BaseImageURL: integration.String2URL(tempDir),
-				Mount:        true,
-			})
-			Expect(err).To(MatchError("invalid base image: directory provided instead of a tar file"))
-		})
-	})
-
 	Context("when required args are not provided", func() {
 		It("returns an error", func() {
 			_, err := Runner.Create(groot.CreateSpec{})
@@ -289,6 +276,85 @@ var _ = Describe("Create with local TAR images", func() {
 		})
 	})
 
+	Context("when the tar is gzip compressed", func() {
+		var compressedImagePath string
+
+		BeforeEach(func() {
+			compressedImageFile, err := ioutil.TempFile("", "image.tar.gz")
+			Expect(err).NotTo(HaveOccurred())
+			compressedImagePath = compressedImageFile.Name()
+			Expect(compressedImageFile.Close()).To(Succeed())
+
+			sess, err := gexec.Start(exec.Command("tar", "-czpf", compressedImagePath, "-C", sourceImagePath, "."), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess, 15*time.Second).Should(gexec.Exit(0))
+			Expect(os.Chmod(compressedImagePath, 0666)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(compressedImagePath)).To(Succeed())
+		})
+
+		It("creates a root filesystem", func() {
+			containerSpec, err := Runner.Create(groot.CreateSpec{
+				BaseImageURL: integration.String2URL(compressedImagePath),
+				ID:           randomImageID,
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Runner.EnsureMounted(containerSpec)).To(Succeed())
+
+			fooContents, err := ioutil.ReadFile(path.Join(containerSpec.Root.Path, "foo"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(fooContents)).To(Equal("hello-world"))
+		})
+	})
+
+	Context("when content addressed tar images are enabled", func() {
+		var copiedImagePath string
+
+		BeforeEach(func() {
+			copiedImageFile, err := ioutil.TempFile("", "image-copy.tar")
+			Expect(err).NotTo(HaveOccurred())
+			copiedImagePath = copiedImageFile.Name()
+			Expect(copiedImageFile.Close()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(copiedImagePath)).To(Succeed())
+		})
+
+		It("shares the volume between identical tarballs", func() {
+			runner := Runner.WithContentAddressedTarImages()
+			_, err := runner.Create(spec)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(baseImagePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(copiedImagePath, contents, 0666)).To(Succeed())
+
+			_, err = runner.Create(groot.CreateSpec{
+				ID:           testhelpers.NewRandomID(),
+				BaseImageURL: integration.String2URL(copiedImagePath),
+				Mount:        mountByDefault(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			volumes, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes).To(HaveLen(1))
+		})
+
+		It("caches the tarball digest in the store", func() {
+			_, err := Runner.WithContentAddressedTarImages().Create(spec)
+			Expect(err).NotTo(HaveOccurred())
+
+			digests, err := ioutil.ReadDir(filepath.Join(StorePath, store.MetaDirName, "tar-digests"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digests).To(HaveLen(1))
+		})
+	})
+
 	Context("when local image does not exist", func() {
 		It("returns an error", func() {
 			_, err := Runner.Create(groot.CreateSpec{
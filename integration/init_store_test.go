@@ -14,6 +14,7 @@ import (
 	"code.cloudfoundry.org/grootfs/groot"
 	"code.cloudfoundry.org/grootfs/integration"
 	grootfsRunner "code.cloudfoundry.org/grootfs/integration/runner"
+	"code.cloudfoundry.org/grootfs/store/manager"
 	"code.cloudfoundry.org/grootfs/testhelpers"
 
 	. "github.com/onsi/ginkgo"
@@ -63,6 +64,20 @@ var _ = Describe("Init Store", func() {
 		Expect(stat.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(rootGID)))
 	})
 
+	Context("when --content-addressed-tar-images is passed", func() {
+		BeforeEach(func() {
+			spec.ContentAddressedTarImages = true
+		})
+
+		It("records it in the store options", func() {
+			Expect(runner.InitStore(spec)).To(Succeed())
+
+			options, err := manager.ReadStoreOptions(runner.StorePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options.ContentAddressedTarImages).To(BeTrue())
+		})
+	})
+
 	Context("when --store-size-bytes is passed", func() {
 		var backingStoreFile string
 
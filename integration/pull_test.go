@@ -0,0 +1,163 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/commands/config"
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/integration"
+	"code.cloudfoundry.org/grootfs/store"
+	"code.cloudfoundry.org/grootfs/testhelpers"
+	yaml "gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pull", func() {
+	var (
+		baseImagePath string
+		pullSpec      groot.PullSpec
+	)
+
+	BeforeEach(func() {
+		workDir, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		baseImagePath = fmt.Sprintf("oci:///%s/assets/oci-test-image/4mb-image:latest", workDir)
+		pullSpec = groot.PullSpec{BaseImageURL: integration.String2URL(baseImagePath)}
+	})
+
+	volumes := func() []string {
+		contents, err := ioutil.ReadDir(filepath.Join(StorePath, store.VolumesDirName))
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, content := range contents {
+			names = append(names, content.Name())
+		}
+		return names
+	}
+
+	It("unpacks the layers of the image without creating an image", func() {
+		Expect(Runner.Pull(pullSpec)).To(Succeed())
+
+		Expect(volumes()).NotTo(BeEmpty())
+		images, err := ioutil.ReadDir(filepath.Join(StorePath, store.ImageDirName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(BeEmpty())
+	})
+
+	It("retains the base image in its dependency file", func() {
+		Expect(Runner.Pull(pullSpec)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(filepath.Join(StorePath, store.MetaDirName, "dependencies", fmt.Sprintf("baseimage:%s.json", strings.Replace(baseImagePath, "/", "__", -1))))
+		Expect(err).NotTo(HaveOccurred())
+
+		var dependencies map[string]interface{}
+		Expect(json.Unmarshal(contents, &dependencies)).To(Succeed())
+		Expect(dependencies).To(HaveKeyWithValue("retained", true))
+		Expect(dependencies).NotTo(HaveKey("retain_until"))
+	})
+
+	It("keeps the layers when the store is cleaned", func() {
+		Expect(Runner.Pull(pullSpec)).To(Succeed())
+		pulledVolumes := volumes()
+
+		_, err := Runner.Clean(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes()).To(ConsistOf(pulledVolumes))
+	})
+
+	It("reuses the layers when creating an image", func() {
+		Expect(Runner.Pull(pullSpec)).To(Succeed())
+		pulledVolumes := volumes()
+
+		imageID := testhelpers.NewRandomID()
+		_, err := Runner.Create(groot.CreateSpec{
+			ID:           imageID,
+			BaseImageURL: integration.String2URL(baseImagePath),
+			Mount:        mountByDefault(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes()).To(ConsistOf(pulledVolumes))
+
+		Expect(Runner.Delete(imageID)).To(Succeed())
+		_, err = Runner.Clean(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes()).To(ConsistOf(pulledVolumes))
+	})
+
+	Context("when the image is unpulled", func() {
+		It("cleans up the layers", func() {
+			Expect(Runner.Pull(pullSpec)).To(Succeed())
+			Expect(Runner.Unpull(baseImagePath)).To(Succeed())
+
+			_, err := Runner.Clean(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes()).To(BeEmpty())
+		})
+	})
+
+	Context("when the retention expires", func() {
+		BeforeEach(func() {
+			pullSpec.Retention = time.Second
+		})
+
+		It("cleans up the layers", func() {
+			Expect(Runner.Pull(pullSpec)).To(Succeed())
+			time.Sleep(2 * time.Second)
+
+			_, err := Runner.Clean(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumes()).To(BeEmpty())
+		})
+	})
+
+	Context("when the image was not pulled", func() {
+		It("fails to unpull it", func() {
+			Expect(Runner.Pull(pullSpec)).To(Succeed())
+
+			err := Runner.Unpull("docker:///cfgarden/not-pulled")
+			Expect(err).To(MatchError(ContainSubstring("not found")))
+		})
+	})
+
+	Context("when the admission policy denies the image", func() {
+		var configDir string
+
+		BeforeEach(func() {
+			var err error
+			configDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chmod(configDir, 0755)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(configDir)).To(Succeed())
+		})
+
+		It("fails without pulling any layer", func() {
+			configYaml, err := yaml.Marshal(config.Config{Policy: config.Policy{AllowedSchemes: []string{"docker"}}})
+			Expect(err).NotTo(HaveOccurred())
+			configFilePath := filepath.Join(configDir, "config.yaml")
+			Expect(ioutil.WriteFile(configFilePath, configYaml, 0755)).To(Succeed())
+
+			err = Runner.WithConfig(configFilePath).Pull(pullSpec)
+			Expect(err).To(MatchError(ContainSubstring("image rejected by the admission policy: scheme `oci` is not allowed")))
+			Expect(volumes()).To(BeEmpty())
+		})
+	})
+
+	Context("when the image does not exist", func() {
+		It("fails", func() {
+			err := Runner.Pull(groot.PullSpec{BaseImageURL: integration.String2URL("docker:///cfgaren/sorry-not-here")})
+			Expect(err).To(MatchError(ContainSubstring("docker:///cfgaren/sorry-not-here does not exist or you do not have permissions to see it.")))
+		})
+	})
+})
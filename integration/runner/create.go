@@ -56,7 +56,7 @@ func (r Runner) EnsureMounted(containerSpec specs.Spec) error {
 }
 
 func (r Runner) initStoreAsRoot() error {
-	spec := InitSpec{}
+	spec := InitSpec{ContentAddressedTarImages: r.ContentAddressedTarImages}
 
 	if r.SysCredential.Uid != 0 {
 		spec.UIDMappings = defaultIdMapping(r.SysCredential.Uid)
@@ -121,10 +121,39 @@ func (r Runner) makeCreateArgs(spec groot.CreateSpec) []string {
 		args = append(args, "--password", r.RegistryPassword)
 	}
 
+	if r.AuthFile != "" {
+		args = append(args, "--auth-file", r.AuthFile)
+	}
+
+	if r.Platform != "" {
+		args = append(args, "--platform", r.Platform)
+	}
+
 	if r.SkipLayerValidation {
 		args = append(args, "--skip-layer-validation")
 	}
 
+	if r.StreamLayers {
+		args = append(args, "--stream-layers")
+	}
+
+	if r.Offline {
+		args = append(args, "--offline")
+	}
+
+	if r.TrustPolicy != "" {
+		args = append(args, "--trust-policy", r.TrustPolicy)
+	}
+
+	if r.Sigstore != "" {
+		args = append(args, "--sigstore", r.Sigstore)
+	}
+
+	// ExtraFiles start at fd 3 in the child process
+	if r.ProgressFile != nil {
+		args = append(args, "--progress-fd", "3")
+	}
+
 	if spec.DiskLimit != 0 {
 		args = append(args, "--disk-limit-size-bytes",
 			strconv.FormatInt(spec.DiskLimit, 10),
@@ -7,10 +7,11 @@ import (
 )
 
 type InitSpec struct {
-	Rootless       string
-	UIDMappings    []groot.IDMappingSpec
-	GIDMappings    []groot.IDMappingSpec
-	StoreSizeBytes int64
+	Rootless                  string
+	UIDMappings               []groot.IDMappingSpec
+	GIDMappings               []groot.IDMappingSpec
+	StoreSizeBytes            int64
+	ContentAddressedTarImages bool
 }
 
 func (r Runner) InitStore(spec InitSpec) error {
@@ -36,6 +37,10 @@ func (r Runner) InitStore(spec InitSpec) error {
 		args = append(args, "--store-size-bytes", fmt.Sprintf("%d", spec.StoreSizeBytes))
 	}
 
+	if spec.ContentAddressedTarImages {
+		args = append(args, "--content-addressed-tar-images")
+	}
+
 	_, err := r.RunSubcommand("init-store", args...)
 	return err
 }
@@ -23,6 +23,11 @@ func (r Runner) WithCredentials(username, password string) Runner {
 	return r
 }
 
+func (r Runner) WithAuthFile(authFile string) Runner {
+	r.AuthFile = authFile
+	return r
+}
+
 func (r Runner) WithInsecureRegistry(registry string) Runner {
 	r.InsecureRegistry = registry
 	return r
@@ -222,3 +227,62 @@ func (r Runner) SkipLayerCheckSumValidation() Runner {
 	r.SkipLayerValidation = true
 	return r
 }
+
+///////////////////////////////////////////////////////////////////////////////
+// Multi-arch images
+///////////////////////////////////////////////////////////////////////////////
+
+func (r Runner) WithPlatform(platform string) Runner {
+	r.Platform = platform
+	return r
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Layer streaming
+///////////////////////////////////////////////////////////////////////////////
+
+func (r Runner) WithStreamLayers() Runner {
+	r.StreamLayers = true
+	return r
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Offline mode
+///////////////////////////////////////////////////////////////////////////////
+
+func (r Runner) WithOffline() Runner {
+	r.Offline = true
+	return r
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Content addressed tar images
+///////////////////////////////////////////////////////////////////////////////
+
+func (r Runner) WithContentAddressedTarImages() Runner {
+	r.ContentAddressedTarImages = true
+	return r
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Signature verification
+///////////////////////////////////////////////////////////////////////////////
+
+func (r Runner) WithTrustPolicy(trustPolicy string) Runner {
+	r.TrustPolicy = trustPolicy
+	return r
+}
+
+func (r Runner) WithSigstore(sigstore string) Runner {
+	r.Sigstore = sigstore
+	return r
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Progress reporting
+///////////////////////////////////////////////////////////////////////////////
+
+func (r Runner) WithProgressFile(progressFile *os.File) Runner {
+	r.ProgressFile = progressFile
+	return r
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"strconv"
+
+	"code.cloudfoundry.org/grootfs/groot"
+)
+
+func (r Runner) Pull(spec groot.PullSpec) error {
+	if !r.skipInitStore {
+		if err := r.initStoreAsRoot(); err != nil {
+			return err
+		}
+	}
+
+	args := []string{}
+
+	if spec.Retention > 0 {
+		args = append(args, "--retention-seconds", strconv.FormatInt(int64(spec.Retention.Seconds()), 10))
+	}
+
+	if r.InsecureRegistry != "" {
+		args = append(args, "--insecure-registry", r.InsecureRegistry)
+	}
+
+	if r.RegistryUsername != "" {
+		args = append(args, "--username", r.RegistryUsername)
+	}
+
+	if r.RegistryPassword != "" {
+		args = append(args, "--password", r.RegistryPassword)
+	}
+
+	if r.AuthFile != "" {
+		args = append(args, "--auth-file", r.AuthFile)
+	}
+
+	if r.Platform != "" {
+		args = append(args, "--platform", r.Platform)
+	}
+
+	if r.TrustPolicy != "" {
+		args = append(args, "--trust-policy", r.TrustPolicy)
+	}
+
+	if r.Sigstore != "" {
+		args = append(args, "--sigstore", r.Sigstore)
+	}
+
+	if spec.BaseImageURL != nil {
+		args = append(args, spec.BaseImageURL.String())
+	}
+
+	_, err := r.RunSubcommand("pull", args...)
+	return err
+}
+
+func (r Runner) Unpull(baseImage string) error {
+	_, err := r.RunSubcommand("unpull", baseImage)
+	return err
+}
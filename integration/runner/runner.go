@@ -46,12 +46,26 @@ type Runner struct {
 	InsecureRegistry string
 	RegistryUsername string
 	RegistryPassword string
+	AuthFile         string
 	EnvVars          []string
 	// Clean on Create
 	CleanOnCreate   bool
 	NoCleanOnCreate bool
 	// Layer Checksum Validation
 	SkipLayerValidation bool
+	// Multi-arch images
+	Platform string
+	// Layer streaming
+	StreamLayers bool
+	// Offline mode
+	Offline bool
+	// Content addressed tar images
+	ContentAddressedTarImages bool
+	// Signature verification
+	TrustPolicy string
+	Sigstore    string
+	// Progress reporting
+	ProgressFile *os.File
 
 	SysCredential syscall.Credential
 }
@@ -157,6 +171,9 @@ func (r Runner) makeCmd(subcommand string, args []string) *exec.Cmd {
 	if r.Stderr != nil {
 		cmd.Stderr = r.Stderr
 	}
+	if r.ProgressFile != nil {
+		cmd.ExtraFiles = []*os.File{r.ProgressFile}
+	}
 
 	return cmd
 }
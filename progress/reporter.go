@@ -0,0 +1,38 @@
+package progress // import "code.cloudfoundry.org/grootfs/progress"
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/lager"
+)
+
+type timedEvent struct {
+	groot.ProgressEvent
+	Time time.Time `json:"time"`
+}
+
+// Reporter writes each progress event as a JSON line. Layers are downloaded
+// concurrently, so writes are serialised.
+type Reporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewReporter(writer io.Writer) *Reporter {
+	return &Reporter{
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+func (r *Reporter) Report(logger lager.Logger, event groot.ProgressEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.encoder.Encode(timedEvent{ProgressEvent: event, Time: time.Now()}); err != nil {
+		logger.Error("failed-to-report-progress", err, lager.Data{"event": event})
+	}
+}
@@ -0,0 +1,69 @@
+package progress_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"code.cloudfoundry.org/grootfs/groot"
+	"code.cloudfoundry.org/grootfs/progress"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Reporter", func() {
+	var (
+		logger   *lagertest.TestLogger
+		buffer   *bytes.Buffer
+		reporter *progress.Reporter
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("progress")
+		buffer = bytes.NewBuffer([]byte{})
+		reporter = progress.NewReporter(buffer)
+	})
+
+	It("writes each event as a JSON line", func() {
+		reporter.Report(logger, groot.ProgressEvent{Event: groot.ProgressLayerQueued, BlobID: "sha256:layer-1", Total: 1024})
+		reporter.Report(logger, groot.ProgressEvent{Event: groot.ProgressLayerDownloading, BlobID: "sha256:layer-1", Bytes: 512, Total: 1024})
+
+		scanner := bufio.NewScanner(buffer)
+		events := []map[string]interface{}{}
+		for scanner.Scan() {
+			var event map[string]interface{}
+			Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+			events = append(events, event)
+		}
+
+		Expect(events).To(HaveLen(2))
+		Expect(events[0]).To(HaveKeyWithValue("event", "layer-queued"))
+		Expect(events[0]).NotTo(HaveKey("bytes"))
+		Expect(events[1]).To(HaveKeyWithValue("event", "layer-downloading"))
+		Expect(events[1]).To(HaveKeyWithValue("blob_id", "sha256:layer-1"))
+		Expect(events[1]).To(HaveKeyWithValue("bytes", BeNumerically("==", 512)))
+		Expect(events[1]).To(HaveKeyWithValue("total", BeNumerically("==", 1024)))
+		Expect(events[1]).To(HaveKey("time"))
+	})
+
+	Context("when writing fails", func() {
+		BeforeEach(func() {
+			reporter = progress.NewReporter(failingWriter{})
+		})
+
+		It("logs the error", func() {
+			reporter.Report(logger, groot.ProgressEvent{Event: groot.ProgressMountDone})
+			Expect(logger).To(gbytes.Say("failed-to-report-progress"))
+		})
+	})
+})
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
@@ -1,13 +1,16 @@
 package dependency_manager
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"code.cloudfoundry.org/lager"
 	errorspkg "github.com/pkg/errors"
 )
 
@@ -15,19 +18,97 @@ type DependencyManager struct {
 	dependenciesPath string
 }
 
+type dependencies struct {
+	ChainIDs       []string   `json:"chain_ids"`
+	ManifestDigest string     `json:"manifest_digest,omitempty"`
+	Retained       bool       `json:"retained,omitempty"`
+	RetainUntil    *time.Time `json:"retain_until,omitempty"`
+}
+
 func NewDependencyManager(dependenciesPath string) *DependencyManager {
 	return &DependencyManager{
 		dependenciesPath: dependenciesPath,
 	}
 }
 
-func (d *DependencyManager) Register(id string, chainIDs []string) error {
-	data, err := json.Marshal(chainIDs)
+func (d *DependencyManager) Register(id string, chainIDs []string, manifestDigest string) error {
+	deps := dependencies{
+		ChainIDs:       chainIDs,
+		ManifestDigest: manifestDigest,
+	}
+
+	// Registering again must not release a retained reference
+	if existing, err := d.read(id); err == nil {
+		deps.Retained = existing.Retained
+		deps.RetainUntil = existing.RetainUntil
+	}
+
+	return d.write(id, deps)
+}
+
+// Retain keeps the dependencies of a registered id from being collected,
+// until it is released or, when until is not zero, until it expires.
+func (d *DependencyManager) Retain(id string, until time.Time) error {
+	deps, err := d.read(id)
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(d.filePath(id), data, 0666)
+	deps.Retained = true
+	deps.RetainUntil = nil
+	if !until.IsZero() {
+		deps.RetainUntil = &until
+	}
+
+	return d.write(id, deps)
+}
+
+func (d *DependencyManager) Release(id string) error {
+	deps, err := d.read(id)
+	if err != nil {
+		return err
+	}
+
+	deps.Retained = false
+	deps.RetainUntil = nil
+
+	return d.write(id, deps)
+}
+
+// RetainedDependencies returns the chain IDs of all the retained ids that
+// haven't expired yet. Files that can't be read are skipped, so that one of
+// them does not stop the other layers from being collected.
+func (d *DependencyManager) RetainedDependencies(logger lager.Logger) ([]string, error) {
+	logger = logger.Session("retained-dependencies")
+	logger.Debug("starting")
+	defer logger.Debug("ending")
+
+	files, err := ioutil.ReadDir(d.dependenciesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	chainIDs := []string{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		id := strings.TrimSuffix(file.Name(), ".json")
+		deps, err := d.read(id)
+		if err != nil {
+			logger.Error("reading-dependencies-failed", err, lager.Data{"id": id})
+			continue
+		}
+
+		if !deps.Retained || (deps.RetainUntil != nil && deps.RetainUntil.Before(now)) {
+			continue
+		}
+		chainIDs = append(chainIDs, deps.ChainIDs...)
+	}
+
+	return chainIDs, nil
 }
 
 func (d *DependencyManager) Deregister(id string) error {
@@ -35,20 +116,75 @@ func (d *DependencyManager) Deregister(id string) error {
 }
 
 func (d *DependencyManager) Dependencies(id string) ([]string, error) {
-	f, err := os.Open(d.filePath(id))
+	deps, err := d.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return deps.ChainIDs, nil
+}
+
+func (d *DependencyManager) ManifestDigest(id string) (string, error) {
+	deps, err := d.read(id)
+	if err != nil {
+		return "", err
+	}
+
+	return deps.ManifestDigest, nil
+}
+
+func (d *DependencyManager) read(id string) (dependencies, error) {
+	data, err := ioutil.ReadFile(d.filePath(id))
 	if err != nil && os.IsNotExist(err) {
-		return nil, errorspkg.Errorf("image `%s` not found", id)
+		return dependencies{}, errorspkg.Errorf("image `%s` not found", id)
 	}
 	if err != nil {
-		return nil, err
+		return dependencies{}, err
 	}
 
-	var chainIDs []string
-	if err := json.NewDecoder(f).Decode(&chainIDs); err != nil {
-		return nil, err
+	// Files written by older versions only contain the list of chain IDs
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var chainIDs []string
+		if err := json.Unmarshal(data, &chainIDs); err != nil {
+			return dependencies{}, err
+		}
+		return dependencies{ChainIDs: chainIDs}, nil
 	}
 
-	return chainIDs, nil
+	var deps dependencies
+	if err := json.Unmarshal(data, &deps); err != nil {
+		return dependencies{}, err
+	}
+
+	return deps, nil
+}
+
+// write replaces the file atomically, so that readers never see it half
+// written.
+func (d *DependencyManager) write(id string, deps dependencies) error {
+	data, err := json.Marshal(deps)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(d.dependenciesPath, ".dependencies")
+	if err != nil {
+		return errorspkg.Wrap(err, "creating dependencies file")
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(data); err != nil {
+		return errorspkg.Wrap(err, "writing dependencies file")
+	}
+	if err := tempFile.Chmod(0644); err != nil {
+		return errorspkg.Wrap(err, "writing dependencies file")
+	}
+	if err := tempFile.Close(); err != nil {
+		return errorspkg.Wrap(err, "writing dependencies file")
+	}
+
+	return os.Rename(tempFile.Name(), d.filePath(id))
 }
 
 func (d *DependencyManager) filePath(id string) string {
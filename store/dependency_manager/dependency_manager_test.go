@@ -4,11 +4,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	"code.cloudfoundry.org/grootfs/store/dependency_manager"
+	"code.cloudfoundry.org/lager/lagertest"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("DependencyManager", func() {
@@ -16,12 +19,14 @@ var _ = Describe("DependencyManager", func() {
 	var (
 		depsPath string
 		manager  *dependency_manager.DependencyManager
+		logger   *lagertest.TestLogger
 	)
 
 	BeforeEach(func() {
 		var err error
 		depsPath, err = ioutil.TempDir("", "dependencies")
 		Expect(err).NotTo(HaveOccurred())
+		logger = lagertest.NewTestLogger("dependency-manager")
 
 		manager = dependency_manager.NewDependencyManager(depsPath)
 	})
@@ -34,7 +39,7 @@ var _ = Describe("DependencyManager", func() {
 		It("register the dependencies for given image id", func() {
 			imageID := "my-image"
 			chainIDs := []string{"sha256:vol-1", "sha256:vol-2"}
-			Expect(manager.Register(imageID, chainIDs)).To(Succeed())
+			Expect(manager.Register(imageID, chainIDs, "")).To(Succeed())
 
 			dependencies, err := manager.Dependencies(imageID)
 			Expect(err).NotTo(HaveOccurred())
@@ -44,28 +49,159 @@ var _ = Describe("DependencyManager", func() {
 		It("escapes the id", func() {
 			imageID := "my/image"
 			chainIDs := []string{"sha256:vol-1", "sha256:vol-2"}
-			Expect(manager.Register(imageID, chainIDs)).To(Succeed())
+			Expect(manager.Register(imageID, chainIDs, "")).To(Succeed())
 			Expect(path.Join(depsPath, "my__image.json")).To(BeAnExistingFile())
 		})
 
+		It("does not leave temporary files behind", func() {
+			Expect(manager.Register("my-image", []string{"sha256:vol-1"}, "")).To(Succeed())
+			Expect(manager.Register("my-image", []string{"sha256:vol-2"}, "")).To(Succeed())
+
+			files, err := ioutil.ReadDir(depsPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Name()).To(Equal("my-image.json"))
+		})
+
+		It("records the manifest digest", func() {
+			imageID := "my-image"
+			chainIDs := []string{"sha256:vol-1", "sha256:vol-2"}
+			Expect(manager.Register(imageID, chainIDs, "sha256:manifest")).To(Succeed())
+
+			manifestDigest, err := manager.ManifestDigest(imageID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifestDigest).To(Equal("sha256:manifest"))
+
+			contents, err := ioutil.ReadFile(path.Join(depsPath, "my-image.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(MatchJSON(`{"chain_ids": ["sha256:vol-1", "sha256:vol-2"], "manifest_digest": "sha256:manifest"}`))
+		})
+
 		Context("when the base path does not exist", func() {
 			BeforeEach(func() {
 				manager = dependency_manager.NewDependencyManager("/path/to/non/existent/dir")
 			})
 
 			It("return an error", func() {
-				Expect(manager.Register("my-id", []string{"a-dep"})).To(
+				Expect(manager.Register("my-id", []string{"a-dep"}, "")).To(
 					MatchError(ContainSubstring("no such file or directory")),
 				)
 			})
 		})
 	})
 
+	Describe("Dependencies", func() {
+		Context("when the dependencies were registered by an older version", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(path.Join(depsPath, "my-image.json"), []byte(`["sha256:vol-1","sha256:vol-2"]`), 0666)).To(Succeed())
+			})
+
+			It("returns the chain ids", func() {
+				dependencies, err := manager.Dependencies("my-image")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies).To(ConsistOf("sha256:vol-1", "sha256:vol-2"))
+			})
+
+			It("returns an empty manifest digest", func() {
+				manifestDigest, err := manager.ManifestDigest("my-image")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manifestDigest).To(BeEmpty())
+			})
+		})
+
+		Context("when the image does not exist", func() {
+			It("returns an error", func() {
+				_, err := manager.Dependencies("my-image")
+				Expect(err).To(MatchError("image `my-image` not found"))
+			})
+		})
+	})
+
+	Describe("Retain", func() {
+		BeforeEach(func() {
+			Expect(manager.Register("baseimage:docker:///my/image", []string{"sha256:vol-1", "sha256:vol-2"}, "")).To(Succeed())
+			Expect(manager.Register("baseimage:docker:///other/image", []string{"sha256:vol-3"}, "")).To(Succeed())
+		})
+
+		It("retains the dependencies of the given id", func() {
+			Expect(manager.Retain("baseimage:docker:///my/image", time.Time{})).To(Succeed())
+
+			retained, err := manager.RetainedDependencies(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retained).To(ConsistOf("sha256:vol-1", "sha256:vol-2"))
+		})
+
+		It("keeps the dependencies retained when they are registered again", func() {
+			Expect(manager.Retain("baseimage:docker:///my/image", time.Time{})).To(Succeed())
+			Expect(manager.Register("baseimage:docker:///my/image", []string{"sha256:vol-4"}, "")).To(Succeed())
+
+			retained, err := manager.RetainedDependencies(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retained).To(ConsistOf("sha256:vol-4"))
+		})
+
+		Context("when the retention has expired", func() {
+			It("does not retain the dependencies", func() {
+				Expect(manager.Retain("baseimage:docker:///my/image", time.Now().Add(-time.Minute))).To(Succeed())
+				Expect(manager.Retain("baseimage:docker:///other/image", time.Now().Add(time.Hour))).To(Succeed())
+
+				retained, err := manager.RetainedDependencies(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(retained).To(ConsistOf("sha256:vol-3"))
+			})
+		})
+
+		Context("when a dependencies file can't be read", func() {
+			BeforeEach(func() {
+				Expect(manager.Retain("baseimage:docker:///my/image", time.Time{})).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(depsPath, "broken.json"), []byte("{not json"), 0644)).To(Succeed())
+			})
+
+			It("skips it and logs the error", func() {
+				retained, err := manager.RetainedDependencies(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(retained).To(ConsistOf("sha256:vol-1", "sha256:vol-2"))
+				Expect(logger).To(gbytes.Say("reading-dependencies-failed"))
+			})
+		})
+
+		Context("when the id is not registered", func() {
+			It("returns an error", func() {
+				Expect(manager.Retain("baseimage:docker:///not/here", time.Time{})).To(
+					MatchError(ContainSubstring("image `baseimage:docker:///not/here` not found")),
+				)
+			})
+		})
+	})
+
+	Describe("Release", func() {
+		BeforeEach(func() {
+			Expect(manager.Register("baseimage:docker:///my/image", []string{"sha256:vol-1"}, "")).To(Succeed())
+			Expect(manager.Retain("baseimage:docker:///my/image", time.Time{})).To(Succeed())
+		})
+
+		It("stops retaining the dependencies", func() {
+			Expect(manager.Release("baseimage:docker:///my/image")).To(Succeed())
+
+			retained, err := manager.RetainedDependencies(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retained).To(BeEmpty())
+		})
+
+		It("keeps the dependencies registered", func() {
+			Expect(manager.Release("baseimage:docker:///my/image")).To(Succeed())
+
+			dependencies, err := manager.Dependencies("baseimage:docker:///my/image")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dependencies).To(ConsistOf("sha256:vol-1"))
+		})
+	})
+
 	Describe("Deregister", func() {
 		It("deregisters the dependencies for a given image", func() {
 			imageID := "my-image"
 			chainIDs := []string{"sha256:vol-1", "sha256:vol-2"}
-			Expect(manager.Register(imageID, chainIDs)).To(Succeed())
+			Expect(manager.Register(imageID, chainIDs, "")).To(Succeed())
 
 			Expect(manager.Deregister(imageID)).To(Succeed())
 
@@ -76,7 +212,7 @@ var _ = Describe("DependencyManager", func() {
 		It("escapes the id", func() {
 			imageID := "my/image"
 			chainIDs := []string{"sha256:vol-1", "sha256:vol-2"}
-			Expect(manager.Register(imageID, chainIDs)).To(Succeed())
+			Expect(manager.Register(imageID, chainIDs, "")).To(Succeed())
 
 			Expect(manager.Deregister(imageID)).To(Succeed())
 			Expect(path.Join(depsPath, "my__image.json")).ToNot(BeAnExistingFile())
@@ -207,7 +207,16 @@ func (d *Driver) CreateImage(logger lager.Logger, spec image_cloner.ImageDriverS
 		return mountInfo, errorspkg.Wrap(err, "chmoding snapshot")
 	}
 
-	return mountInfo, d.applyDiskLimit(logger, spec)
+	if err := d.applyDiskLimit(logger, spec); err != nil {
+		return mountInfo, err
+	}
+
+	// the snapshot is the rootfs itself when the image is mounted
+	if spec.Mount {
+		spec.ReportProgress(groot.ProgressEvent{Event: groot.ProgressMountDone})
+	}
+
+	return mountInfo, nil
 }
 
 func (d *Driver) Volumes(logger lager.Logger) ([]string, error) {
@@ -436,6 +445,7 @@ func (d *Driver) applyDiskLimit(logger lager.Logger, spec image_cloner.ImageDriv
 		return err
 	}
 
+	spec.ReportProgress(groot.ProgressEvent{Event: groot.ProgressQuotaApplied, DiskLimit: spec.DiskLimit})
 	return nil
 }
 
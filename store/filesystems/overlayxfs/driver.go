@@ -286,6 +286,7 @@ func (d *Driver) CreateImage(logger lager.Logger, spec image_cloner.ImageDriverS
 		if err := d.mountImage(logger, rootfsDir, mountData); err != nil {
 			return groot.MountInfo{}, err
 		}
+		spec.ReportProgress(groot.ProgressEvent{Event: groot.ProgressMountDone})
 	}
 
 	imageInfoFileName := filepath.Join(spec.ImagePath, imageInfoName)
@@ -719,6 +720,8 @@ func (d *Driver) applyDiskLimit(logger lager.Logger, spec image_cloner.ImageDriv
 		logger.Error("writing-image-quota-failed", err)
 		return errorspkg.Wrap(err, "writing image quota")
 	}
+
+	spec.ReportProgress(groot.ProgressEvent{Event: groot.ProgressQuotaApplied, DiskLimit: spec.DiskLimit})
 	return nil
 }
 
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/grootfs/base_image_puller"
+	"code.cloudfoundry.org/grootfs/groot"
 	"code.cloudfoundry.org/grootfs/store"
 	"code.cloudfoundry.org/grootfs/store/filesystems"
 	"code.cloudfoundry.org/grootfs/store/filesystems/overlayxfs"
@@ -282,6 +283,17 @@ var _ = Describe("Driver", func() {
 			Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0755)))
 		})
 
+		It("reports when the image is mounted", func() {
+			events := []groot.ProgressEvent{}
+			spec.Progress = func(event groot.ProgressEvent) {
+				events = append(events, event)
+			}
+
+			_, err := driver.CreateImage(logger, spec)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(Equal([]groot.ProgressEvent{{Event: groot.ProgressMountDone}}))
+		})
+
 		Context("when Mount is false", func() {
 			BeforeEach(func() {
 				spec.Mount = false
@@ -357,6 +369,20 @@ var _ = Describe("Driver", func() {
 				Expect(ioutil.WriteFile(filepath.Join(storePath, store.MetaDirName, fmt.Sprintf("volume-%s", layer1ID)), []byte(`{"Size": 3145728}`), 0644)).To(Succeed())
 			})
 
+			It("reports the quota once it is applied, before the image is mounted", func() {
+				events := []groot.ProgressEvent{}
+				spec.Progress = func(event groot.ProgressEvent) {
+					events = append(events, event)
+				}
+
+				_, err := driver.CreateImage(logger, spec)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(events).To(Equal([]groot.ProgressEvent{
+					{Event: groot.ProgressQuotaApplied, DiskLimit: spec.DiskLimit},
+					{Event: groot.ProgressMountDone},
+				}))
+			})
+
 			It("creates the storeDevice block device in the `images` parent folder", func() {
 				storeDevicePath := filepath.Join(storePath, "storeDevice")
 
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"code.cloudfoundry.org/grootfs/store/garbage_collector"
+	"code.cloudfoundry.org/lager"
 )
 
 type FakeDependencyManager struct {
@@ -21,6 +22,19 @@ type FakeDependencyManager struct {
 		result1 []string
 		result2 error
 	}
+	RetainedDependenciesStub        func(logger lager.Logger) ([]string, error)
+	retainedDependenciesMutex       sync.RWMutex
+	retainedDependenciesArgsForCall []struct {
+		logger lager.Logger
+	}
+	retainedDependenciesReturns struct {
+		result1 []string
+		result2 error
+	}
+	retainedDependenciesReturnsOnCall map[int]struct {
+		result1 []string
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -76,11 +90,64 @@ func (fake *FakeDependencyManager) DependenciesReturnsOnCall(i int, result1 []st
 	}{result1, result2}
 }
 
+func (fake *FakeDependencyManager) RetainedDependencies(logger lager.Logger) ([]string, error) {
+	fake.retainedDependenciesMutex.Lock()
+	ret, specificReturn := fake.retainedDependenciesReturnsOnCall[len(fake.retainedDependenciesArgsForCall)]
+	fake.retainedDependenciesArgsForCall = append(fake.retainedDependenciesArgsForCall, struct {
+		logger lager.Logger
+	}{logger})
+	fake.recordInvocation("RetainedDependencies", []interface{}{logger})
+	fake.retainedDependenciesMutex.Unlock()
+	if fake.RetainedDependenciesStub != nil {
+		return fake.RetainedDependenciesStub(logger)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.retainedDependenciesReturns.result1, fake.retainedDependenciesReturns.result2
+}
+
+func (fake *FakeDependencyManager) RetainedDependenciesCallCount() int {
+	fake.retainedDependenciesMutex.RLock()
+	defer fake.retainedDependenciesMutex.RUnlock()
+	return len(fake.retainedDependenciesArgsForCall)
+}
+
+func (fake *FakeDependencyManager) RetainedDependenciesArgsForCall(i int) lager.Logger {
+	fake.retainedDependenciesMutex.RLock()
+	defer fake.retainedDependenciesMutex.RUnlock()
+	return fake.retainedDependenciesArgsForCall[i].logger
+}
+
+func (fake *FakeDependencyManager) RetainedDependenciesReturns(result1 []string, result2 error) {
+	fake.RetainedDependenciesStub = nil
+	fake.retainedDependenciesReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDependencyManager) RetainedDependenciesReturnsOnCall(i int, result1 []string, result2 error) {
+	fake.RetainedDependenciesStub = nil
+	if fake.retainedDependenciesReturnsOnCall == nil {
+		fake.retainedDependenciesReturnsOnCall = make(map[int]struct {
+			result1 []string
+			result2 error
+		})
+	}
+	fake.retainedDependenciesReturnsOnCall[i] = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeDependencyManager) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.dependenciesMutex.RLock()
 	defer fake.dependenciesMutex.RUnlock()
+	fake.retainedDependenciesMutex.RLock()
+	defer fake.retainedDependenciesMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -21,6 +21,7 @@ type ImageCloner interface {
 
 type DependencyManager interface {
 	Dependencies(id string) ([]string, error)
+	RetainedDependencies(logger lager.Logger) ([]string, error)
 }
 
 type VolumeDriver interface {
@@ -36,15 +37,19 @@ type GarbageCollector struct {
 	dependencyManager DependencyManager
 	baseImage         string
 	isLocalTarVolume  func(string) bool
+	// collectPartialBlobs removes the stale downloads left in the store's tmp
+	// directory, it is optional
+	collectPartialBlobs func(lager.Logger) error
 }
 
-func NewGC(volumeDriver VolumeDriver, imageCloner ImageCloner, dependencyManager DependencyManager, baseImage string, isLocalTarVolume func(string) bool) *GarbageCollector {
+func NewGC(volumeDriver VolumeDriver, imageCloner ImageCloner, dependencyManager DependencyManager, baseImage string, isLocalTarVolume func(string) bool, collectPartialBlobs func(lager.Logger) error) *GarbageCollector {
 	return &GarbageCollector{
-		volumeDriver:      volumeDriver,
-		imageCloner:       imageCloner,
-		dependencyManager: dependencyManager,
-		baseImage:         baseImage,
-		isLocalTarVolume:  isLocalTarVolume,
+		volumeDriver:        volumeDriver,
+		imageCloner:         imageCloner,
+		dependencyManager:   dependencyManager,
+		baseImage:           baseImage,
+		isLocalTarVolume:    isLocalTarVolume,
+		collectPartialBlobs: collectPartialBlobs,
 	}
 }
 
@@ -88,6 +93,12 @@ func (g *GarbageCollector) Collect(logger lager.Logger) error {
 	logger.Info("starting")
 	defer logger.Info("ending")
 
+	if g.collectPartialBlobs != nil {
+		if err := g.collectPartialBlobs(logger); err != nil {
+			logger.Error("collecting-partial-blobs-failed", err)
+		}
+	}
+
 	return g.collectVolumes(logger)
 }
 
@@ -165,6 +176,14 @@ func (g *GarbageCollector) UnusedVolumes(logger lager.Logger) ([]string, []strin
 		}
 	}
 
+	retainedVolumes, err := g.dependencyManager.RetainedDependencies(logger)
+	if err != nil {
+		return nil, nil, errorspkg.Wrap(err, "failed to retrieve retained base images")
+	}
+	for _, volumeID := range retainedVolumes {
+		delete(orphanedVolumes, volumeID)
+	}
+
 	if g.baseImage != "" {
 		imageRefName := fmt.Sprintf(base_image_puller.BaseImageReferenceFormat, g.baseImage)
 		if err := g.removeDependencies(orphanedVolumes, imageRefName); err != nil {
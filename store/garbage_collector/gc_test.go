@@ -23,6 +23,7 @@ var _ = Describe("Gc", func() {
 		fakeDependencyManager *garbage_collectorfakes.FakeDependencyManager
 		fakeImageCloner       *garbage_collectorfakes.FakeImageCloner
 		baseImage             string
+		collectPartialBlobs   func(lager.Logger) error
 	)
 
 	BeforeEach(func() {
@@ -30,6 +31,7 @@ var _ = Describe("Gc", func() {
 		fakeVolumeDriver = new(garbage_collectorfakes.FakeVolumeDriver)
 		fakeDependencyManager = new(garbage_collectorfakes.FakeDependencyManager)
 		baseImage = ""
+		collectPartialBlobs = nil
 
 		logger = lagertest.NewTestLogger("garbage_collector")
 	})
@@ -38,7 +40,7 @@ var _ = Describe("Gc", func() {
 		isLocalTarVolume := func(id string) bool {
 			return strings.Count(id, "-") == 1
 		}
-		garbageCollector = garbage_collector.NewGC(fakeVolumeDriver, fakeImageCloner, fakeDependencyManager, baseImage, isLocalTarVolume)
+		garbageCollector = garbage_collector.NewGC(fakeVolumeDriver, fakeImageCloner, fakeDependencyManager, baseImage, isLocalTarVolume, collectPartialBlobs)
 	})
 
 	Describe("UnusedVolumes", func() {
@@ -111,6 +113,30 @@ var _ = Describe("Gc", func() {
 			})
 		})
 
+		Context("when base images are retained", func() {
+			BeforeEach(func() {
+				fakeDependencyManager.RetainedDependenciesReturns([]string{"sha256privateubuntu"}, nil)
+			})
+
+			It("doesn't list their volumes as unused", func() {
+				unusedVolumes, _, err := garbageCollector.UnusedVolumes(logger)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(unusedVolumes).To(ConsistOf("sha256ubuntu", "unusedLayerVolume"))
+			})
+		})
+
+		Context("when retrieving the retained base images fails", func() {
+			BeforeEach(func() {
+				fakeDependencyManager.RetainedDependenciesReturns(nil, errors.New("failed to read retained deps"))
+			})
+
+			It("returns an error", func() {
+				_, _, err := garbageCollector.UnusedVolumes(logger)
+				Expect(err).To(MatchError(ContainSubstring("failed to read retained deps")))
+			})
+		})
+
 		Context("when retrieving images fails", func() {
 			BeforeEach(func() {
 				fakeImageCloner.ImageIDsReturns(nil, errors.New("failed to retrieve images"))
@@ -277,5 +303,35 @@ var _ = Describe("Gc", func() {
 				Expect(fakeVolumeDriver.DestroyVolumeCallCount()).To(Equal(3))
 			})
 		})
+
+		Context("when partial blobs are collected", func() {
+			var partialBlobsCollected bool
+
+			BeforeEach(func() {
+				partialBlobsCollected = false
+				collectPartialBlobs = func(lager.Logger) error {
+					partialBlobsCollected = true
+					return nil
+				}
+			})
+
+			It("collects them too", func() {
+				Expect(garbageCollector.Collect(logger)).To(Succeed())
+				Expect(partialBlobsCollected).To(BeTrue())
+			})
+
+			Context("when collecting them fails", func() {
+				BeforeEach(func() {
+					collectPartialBlobs = func(lager.Logger) error {
+						return errors.New("failed to collect partial blobs")
+					}
+				})
+
+				It("still collects the unused volumes", func() {
+					Expect(garbageCollector.Collect(logger)).To(Succeed())
+					Expect(fakeVolumeDriver.DestroyVolumeCallCount()).To(Equal(3))
+				})
+			})
+		})
 	})
 })
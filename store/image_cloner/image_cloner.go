@@ -22,6 +22,15 @@ type ImageDriverSpec struct {
 	ImagePath          string
 	DiskLimit          int64
 	ExclusiveDiskLimit bool
+	// Progress is optional. Drivers call it once they have applied the disk
+	// limit and mounted the image.
+	Progress func(event groot.ProgressEvent) `json:"-"`
+}
+
+func (s ImageDriverSpec) ReportProgress(event groot.ProgressEvent) {
+	if s.Progress != nil {
+		s.Progress(event)
+	}
 }
 
 //go:generate counterfeiter . ImageDriver
@@ -97,6 +106,7 @@ func (b *ImageCloner) Create(logger lager.Logger, spec groot.ImageSpec) (groot.I
 		ImagePath:          imagePath,
 		DiskLimit:          spec.DiskLimit,
 		ExclusiveDiskLimit: spec.ExcludeBaseImageFromQuota,
+		Progress:           spec.Progress,
 	}
 
 	var mountInfo groot.MountInfo
@@ -113,6 +113,22 @@ var _ = Describe("Image", func() {
 			Expect(spec.ImagePath).To(Equal(image.Path))
 		})
 
+		It("passes the progress to the image driver", func() {
+			events := []groot.ProgressEvent{}
+			_, err := imageCloner.Create(logger, groot.ImageSpec{
+				ID:        "some-id",
+				BaseImage: imageConfig,
+				Progress: func(event groot.ProgressEvent) {
+					events = append(events, event)
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, spec := fakeImageDriver.CreateImageArgsForCall(0)
+			spec.ReportProgress(groot.ProgressEvent{Event: groot.ProgressMountDone})
+			Expect(events).To(Equal([]groot.ProgressEvent{{Event: groot.ProgressMountDone}}))
+		})
+
 		Context("when mounting is skipped", func() {
 			It("returns a image with mount information", func() {
 				image, err := imageCloner.Create(logger, groot.ImageSpec{ID: "some-id", BaseImage: imageConfig, Mount: false})
@@ -41,6 +41,8 @@ type InitSpec struct {
 	UIDMappings    []groot.IDMappingSpec
 	GIDMappings    []groot.IDMappingSpec
 	StoreSizeBytes int64
+	// Options replace those of an already initialized store
+	Options StoreOptions
 }
 
 func New(storePath string, storeNamespacer StoreNamespacer, volumeDriver base_image_puller.VolumeDriver, imageDriver image_cloner.ImageDriver, storeDriver StoreDriver) *Manager {
@@ -94,6 +96,11 @@ func (m *Manager) InitStore(logger lager.Logger, spec InitSpec) error {
 		return err
 	}
 
+	if err := writeStoreOptions(m.storePath, spec.Options); err != nil {
+		logger.Error("writing-store-options-failed", err)
+		return err
+	}
+
 	ownerUID, ownerGID := m.findStoreOwner(spec.UIDMappings, spec.GIDMappings)
 	if err := os.Chown(m.storePath, ownerUID, ownerGID); err != nil {
 		logger.Error("chowning-store-path-failed", err, lager.Data{"uid": ownerUID, "gid": ownerGID})
@@ -135,6 +135,29 @@ var _ = Describe("Manager", func() {
 			Expect(gidArg).To(Equal(0))
 		})
 
+		It("records the store options", func() {
+			spec.Options = managerpkg.StoreOptions{ContentAddressedTarImages: true}
+			Expect(manager.InitStore(logger, spec)).To(Succeed())
+
+			options, err := managerpkg.ReadStoreOptions(storePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options.ContentAddressedTarImages).To(BeTrue())
+		})
+
+		Context("when the store is initialized again with other options", func() {
+			It("replaces them", func() {
+				spec.Options = managerpkg.StoreOptions{ContentAddressedTarImages: true}
+				Expect(manager.InitStore(logger, spec)).To(Succeed())
+
+				spec.Options = managerpkg.StoreOptions{}
+				Expect(manager.InitStore(logger, spec)).To(Succeed())
+
+				options, err := managerpkg.ReadStoreOptions(storePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(options.ContentAddressedTarImages).To(BeFalse())
+			})
+		})
+
 		It("chmods the storePath to 700", func() {
 			Expect(manager.InitStore(logger, spec)).To(Succeed())
 
@@ -379,6 +402,32 @@ var _ = Describe("Manager", func() {
 		})
 	})
 
+	Describe("ReadStoreOptions", func() {
+		BeforeEach(func() {
+			var err error
+			storePath, err = ioutil.TempDir("", "store-options")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(storePath, store.MetaDirName), 0755)).To(Succeed())
+		})
+
+		Context("when the store was initialized before options were recorded", func() {
+			It("returns the default options", func() {
+				options, err := managerpkg.ReadStoreOptions(storePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(options).To(Equal(managerpkg.StoreOptions{}))
+			})
+		})
+
+		Context("when the options file is invalid", func() {
+			It("returns an error", func() {
+				Expect(ioutil.WriteFile(filepath.Join(storePath, store.MetaDirName, managerpkg.OptionsFilename), []byte("{"), 0644)).To(Succeed())
+
+				_, err := managerpkg.ReadStoreOptions(storePath)
+				Expect(err).To(MatchError(ContainSubstring("invalid store options file")))
+			})
+		})
+	})
+
 	Describe("IsStoreInitialized", func() {
 		BeforeEach(func() {
 			var err error
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/grootfs/store"
+	errorspkg "github.com/pkg/errors"
+)
+
+const OptionsFilename = "options.json"
+
+// StoreOptions are set when the store is initialized and apply to every image
+// created in it.
+type StoreOptions struct {
+	// ContentAddressedTarImages names the volumes of local tar base images
+	// after the sha256 of their contents.
+	ContentAddressedTarImages bool `json:"content-addressed-tar-images"`
+}
+
+// ReadStoreOptions returns the default options for stores initialized before
+// they were recorded.
+func ReadStoreOptions(storePath string) (StoreOptions, error) {
+	contents, err := ioutil.ReadFile(optionsFilePath(storePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return StoreOptions{}, nil
+		}
+		return StoreOptions{}, errorspkg.Wrap(err, "reading store options file")
+	}
+
+	var options StoreOptions
+	if err := json.Unmarshal(contents, &options); err != nil {
+		return StoreOptions{}, errorspkg.Wrap(err, "invalid store options file")
+	}
+
+	return options, nil
+}
+
+func writeStoreOptions(storePath string, options StoreOptions) error {
+	contents, err := json.Marshal(options)
+	if err != nil {
+		return errorspkg.Wrap(err, "encoding store options")
+	}
+
+	if err := ioutil.WriteFile(optionsFilePath(storePath), contents, 0644); err != nil {
+		return errorspkg.Wrap(err, "writing store options file")
+	}
+
+	return nil
+}
+
+func optionsFilePath(storePath string) string {
+	return filepath.Join(storePath, store.MetaDirName, OptionsFilename)
+}
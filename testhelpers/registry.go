@@ -1,6 +1,7 @@
 package testhelpers
 
 import (
+	"encoding/pem"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -18,7 +19,9 @@ type blobHandler struct {
 type FakeRegistry struct {
 	ActualRegistryURL   *url.URL
 	blobHandlers        map[string]blobHandler
+	manifestHandlers    map[string]http.HandlerFunc
 	blobRequestsCounter map[string]int
+	blobRequestRanges   map[string][]string
 	blobRegexp          *regexp.Regexp
 	manifestRegexp      *regexp.Regexp
 	failNextRequests    int
@@ -32,7 +35,9 @@ func NewFakeRegistry(actualRegistryURL *url.URL) *FakeRegistry {
 	return &FakeRegistry{
 		ActualRegistryURL:   actualRegistryURL,
 		blobHandlers:        make(map[string]blobHandler),
+		manifestHandlers:    make(map[string]http.HandlerFunc),
 		blobRequestsCounter: make(map[string]int),
+		blobRequestRanges:   make(map[string][]string),
 		mutex:               &sync.RWMutex{},
 	}
 }
@@ -99,18 +104,29 @@ func (r *FakeRegistry) serveHTTP(rw http.ResponseWriter, req *http.Request) {
 func (r *FakeRegistry) serveManifest(rw http.ResponseWriter, req *http.Request) {
 	if r.failNextRequests > 0 {
 		r.failNextRequests--
-		rw.WriteHeader(http.StatusTeapot)
+		rw.WriteHeader(http.StatusServiceUnavailable)
 		_, _ = rw.Write([]byte("null"))
 		return
 	}
 
+	if match := r.manifestRegexp.FindStringSubmatch(req.URL.Path); match != nil {
+		r.mutex.RLock()
+		handler, ok := r.manifestHandlers[match[1]]
+		r.mutex.RUnlock()
+
+		if ok {
+			handler(rw, req)
+			return
+		}
+	}
+
 	r.revProxy.ServeHTTP(rw, req)
 }
 
 func (r *FakeRegistry) serveBlob(rw http.ResponseWriter, req *http.Request) {
 	if r.failNextRequests > 0 {
 		r.failNextRequests--
-		rw.WriteHeader(http.StatusTeapot)
+		rw.WriteHeader(http.StatusServiceUnavailable)
 		_, _ = rw.Write([]byte("null"))
 		return
 	}
@@ -125,6 +141,7 @@ func (r *FakeRegistry) serveBlob(rw http.ResponseWriter, req *http.Request) {
 
 	r.mutex.Lock()
 	r.blobRequestsCounter[digest]++
+	r.blobRequestRanges[digest] = append(r.blobRequestRanges[digest], req.Header.Get("Range"))
 	r.mutex.Unlock()
 
 	r.mutex.RLock()
@@ -151,6 +168,13 @@ func (r *FakeRegistry) Addr() string {
 	return r.server.Addr()
 }
 
+// CertificatePEM returns the self-signed certificate of the registry, so that
+// clients can be told to trust it.
+func (r *FakeRegistry) CertificatePEM() []byte {
+	cert := r.server.HTTPTestServer.TLS.Certificates[0].Certificate[0]
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+}
+
 func (r *FakeRegistry) WhenGettingBlob(digest string, order int, httpHandler http.HandlerFunc) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -161,6 +185,13 @@ func (r *FakeRegistry) WhenGettingBlob(digest string, order int, httpHandler htt
 	}
 }
 
+func (r *FakeRegistry) WhenGettingManifest(reference string, httpHandler http.HandlerFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.manifestHandlers[reference] = httpHandler
+}
+
 func (r *FakeRegistry) RequestedBlobs() []string {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -171,3 +202,9 @@ func (r *FakeRegistry) RequestedBlobs() []string {
 
 	return blobDigests
 }
+
+func (r *FakeRegistry) RequestedBlobRanges(digest string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]string{}, r.blobRequestRanges[digest]...)
+}
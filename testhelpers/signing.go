@@ -0,0 +1,90 @@
+package testhelpers
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/image/docker/reference"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// NewSigningKey generates a GPG key and writes its public part to keyPath.
+func NewSigningKey(keyPath string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity("grootfs", "test", "grootfs@example.com", nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	keyFile, err := os.Create(keyPath)
+	Expect(err).NotTo(HaveOccurred())
+	defer keyFile.Close()
+	Expect(entity.Serialize(keyFile)).To(Succeed())
+
+	return entity
+}
+
+// WriteSignature stores a simple signing signature for the image in the
+// sigstore, using the containers/image lookaside layout.
+func WriteSignature(entity *openpgp.Entity, sigstorePath, dockerReference, manifestDigest string, index int) {
+	payload := fmt.Sprintf(
+		`{"critical":{"type":"atomic container signature","image":{"docker-manifest-digest":%q},"identity":{"docker-reference":%q}},"optional":{"creator":"grootfs tests"}}`,
+		manifestDigest, dockerReference,
+	)
+
+	ref, err := reference.ParseNormalizedNamed(dockerReference)
+	Expect(err).NotTo(HaveOccurred())
+
+	signaturesDir := filepath.Join(sigstorePath, reference.Path(ref)+"@"+strings.Replace(manifestDigest, ":", "=", 1))
+	Expect(os.MkdirAll(signaturesDir, 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(signaturesDir, fmt.Sprintf("signature-%d", index)), SignPayload(entity, []byte(payload)), 0644)).To(Succeed())
+}
+
+// SignPayload creates an OpenPGP signed message, as produced by
+// `gpg --sign`, with the payload inlined.
+func SignPayload(entity *openpgp.Entity, payload []byte) []byte {
+	buffer := new(bytes.Buffer)
+
+	onePassSignature := &packet.OnePassSignature{
+		SigType:    packet.SigTypeBinary,
+		Hash:       crypto.SHA256,
+		PubKeyAlgo: entity.PrivateKey.PubKeyAlgo,
+		KeyId:      entity.PrivateKey.KeyId,
+		IsLast:     true,
+	}
+	Expect(onePassSignature.Serialize(buffer)).To(Succeed())
+
+	literal, err := packet.SerializeLiteral(nopWriteCloser{buffer}, true, "", 0)
+	Expect(err).NotTo(HaveOccurred())
+	hash := crypto.SHA256.New()
+	_, err = io.MultiWriter(literal, hash).Write(payload)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(literal.Close()).To(Succeed())
+
+	signature := &packet.Signature{
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   entity.PrivateKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &entity.PrivateKey.KeyId,
+	}
+	Expect(signature.Sign(hash, entity.PrivateKey, nil)).To(Succeed())
+	Expect(signature.Serialize(buffer)).To(Succeed())
+
+	return buffer.Bytes()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}